@@ -1,18 +1,23 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/letusgogo/playable-backend/internal/anbox"
 	"github.com/letusgogo/playable-backend/internal/api"
 	"github.com/letusgogo/playable-backend/internal/game"
+	"github.com/letusgogo/playable-backend/internal/session"
 	"github.com/letusgogo/quick/app"
 	"github.com/letusgogo/quick/logger"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
+// defaultShutdownGrace is how long in-use sessions keep running after a shutdown signal
+const defaultShutdownGrace = 30 * time.Second
+
 func main() {
 	myApp := app.NewApp("playable", "Playable backend")
 	myApp.SetVersion("1.0.0")
@@ -42,6 +47,10 @@ func main() {
 func runServer(c *cli.Context, myApp *app.App) error {
 	log := logger.GetLogger("server")
 	address := myApp.Config().GetString("server.address")
+	shutdownGrace := myApp.Config().GetViper().GetDuration("server.shutdown_grace_period")
+	if shutdownGrace <= 0 {
+		shutdownGrace = defaultShutdownGrace
+	}
 
 	// anbox gateway client
 	var anboxConfig anbox.AnboxConfig
@@ -51,11 +60,23 @@ func runServer(c *cli.Context, myApp *app.App) error {
 		return err
 	}
 
-	anboxClient, err := anbox.NewClient(anboxConfig)
+	// Every anbox client takes its transport from one pool, so clients of further farms reuse its connections
+	transports := anbox.NewTransportPool()
+	anboxClient, err := anbox.NewClient(anboxConfig, anbox.WithTransportPool(transports))
 	if err != nil {
 		log.Errorf("Failed to create anbox client: %v", err)
 		return err
 	}
+	var farmConfigs map[string]anbox.AnboxConfig
+	if err := myApp.Config().UnmarshalKey("anbox_farms", &farmConfigs); err != nil {
+		log.Errorf("Failed to unmarshal anbox farm configs: %v", err)
+		return err
+	}
+	farms, err := newFarmClients(farmConfigs, anboxConfig, anboxClient, transports)
+	if err != nil {
+		log.Errorf("Failed to create anbox farm clients: %v", err)
+		return err
+	}
 
 	// game manager
 	var gamesList []*game.GameConfig
@@ -65,16 +86,60 @@ func runServer(c *cli.Context, myApp *app.App) error {
 		return err
 	}
 
-	gameManager := game.NewManager(gamesList, anboxClient)
-	gameManager.Init(c.Context)
-	gameManager.Start(c.Context)
+	// games from games_dir are appended to the ones in the main config
+	if gamesDir := myApp.Config().GetString("games_dir"); gamesDir != "" {
+		dirGames, err := game.LoadGameConfigs(gamesDir)
+		if err != nil {
+			log.Errorf("Failed to load game configs from %s: %v", gamesDir, err)
+			return err
+		}
+		log.Infof("Loaded %d game configs from %s", len(dirGames), gamesDir)
+		gamesList = append(gamesList, dirGames...)
+	}
+
+	if err := game.ValidateGameConfigs(gamesList); err != nil {
+		log.Errorf("Invalid game config: %v", err)
+		return err
+	}
+
+	managerConfig := game.NewManagerConfig()
+	err = myApp.Config().UnmarshalKey("game_manager", &managerConfig)
+	if err != nil {
+		log.Errorf("Failed to unmarshal game manager config: %v", err)
+		return err
+	}
+
+	gameManager, err := game.NewManager(managerConfig, gamesList, anboxClient, game.WithFarms(farms))
+	if err != nil {
+		log.Errorf("Failed to create game manager: %v", err)
+		return err
+	}
+	if err := gameManager.Init(c.Context); err != nil {
+		log.Errorf("Failed to initialize game manager: %v", err)
+		return err
+	}
+	if err := gameManager.Start(c.Context); err != nil {
+		log.Errorf("Failed to start game manager: %v", err)
+		return err
+	}
+	for name, err := range gameManager.DegradedGames() {
+		log.Warnf("Game %s is degraded and will not serve sessions: %v", name, err)
+	}
 	defer func() {
 		gameManager.Stop(c.Context)
 	}()
 
-	apiService := api.NewApiService(api.ApiServiceConfig{
-		Address: address,
-	}, gameManager)
+	apiConfig := api.NewApiServiceConfig()
+	apiConfig.Address = address
+	if gzipMinSize := myApp.Config().GetInt("server.gzip_min_size"); gzipMinSize != 0 {
+		apiConfig.GzipMinSize = gzipMinSize
+	}
+	if detectMaxBodySize := myApp.Config().GetViper().GetInt64("server.detect_max_body_size"); detectMaxBodySize > 0 {
+		apiConfig.DetectMaxBodySize = detectMaxBodySize
+	}
+	apiConfig.DefaultGame = myApp.Config().GetString("server.default_game")
+	apiConfig.Debug = myApp.Config().GetBool("server.debug")
+	apiService := api.NewApiService(apiConfig, gameManager, anboxClient)
 
 	err = apiService.Init()
 	if err != nil {
@@ -92,10 +157,40 @@ func runServer(c *cli.Context, myApp *app.App) error {
 
 	// Wait for shutdown signal
 	app.WaitForSignal(func(s os.Signal) {
-		log.Infof("Received signal %v, shutting down HTTP server gracefully", s)
+		// Keep serving heartbeats while in-use sessions are told they are ending
+		log.Infof("Received signal %v, draining in-use sessions for %s", s, shutdownGrace)
+		if err := gameManager.Drain(c.Context, shutdownGrace); err != nil {
+			log.Errorf("Failed to drain game manager: %v", err)
+		}
+
+		log.Infof("Shutting down HTTP server gracefully")
 		err := apiService.StopGracefully(1 * time.Second)
 		log.Info("API server stopped, error: ", err)
 	})
 
 	return nil
 }
+
+// newFarmClients creates a client per named anbox farm. Farms with the same config, including the anbox
+// block itself, share one client and so its circuit breaker.
+func newFarmClients(farmConfigs map[string]anbox.AnboxConfig, defaultConfig anbox.AnboxConfig, defaultClient *anbox.Client, transports *anbox.TransportPool) (map[string]session.AnboxClient, error) {
+	clients := map[anbox.AnboxConfig]*anbox.Client{defaultConfig: defaultClient}
+	farms := make(map[string]session.AnboxClient, len(farmConfigs))
+	for name, cfg := range farmConfigs {
+		// A farm is shared by the same replica, its instances carry the replica ID of the anbox block unless set
+		if cfg.ReplicaID == "" {
+			cfg.ReplicaID = defaultConfig.ReplicaID
+		}
+		client, ok := clients[cfg]
+		if !ok {
+			var err error
+			client, err = anbox.NewClient(cfg, anbox.WithTransportPool(transports))
+			if err != nil {
+				return nil, fmt.Errorf("farm %s: %w", name, err)
+			}
+			clients[cfg] = client
+		}
+		farms[name] = client
+	}
+	return farms, nil
+}
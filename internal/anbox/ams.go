@@ -1,23 +1,33 @@
 package anbox
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
+// ErrAppNotFound is returned when AMS does not know the requested application
+var ErrAppNotFound = errors.New("application not found")
+
 // AMSClient handles communication with Anbox Management Service
 type AMSClient struct {
 	cfg    *AnboxConfig
 	client *http.Client
+
+	// instanceIDs maps session IDs to the instances backing them, as seen in the last instance listing
+	mu          sync.Mutex
+	instanceIDs map[string]string
 }
 
 // NewAMSClient creates a new AMS client with certificate authentication
-func NewAMSClient(config AnboxConfig) (*AMSClient, error) {
+func NewAMSClient(config AnboxConfig, opts ...ClientOption) (*AMSClient, error) {
 	// Load client certificate
 	cert, err := tls.LoadX509KeyPair(config.AmsCert, config.AmsKey)
 	if err != nil {
@@ -32,9 +42,7 @@ func NewAMSClient(config AnboxConfig) (*AMSClient, error) {
 
 	// Create HTTP client with TLS config
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+		Transport: newClientOptions(opts).transports.transport("ams:"+config.AmsCert+"\x00"+config.AmsKey, config, tlsConfig),
 	}
 
 	// Ensure baseURL has https:// scheme and no trailing slash
@@ -53,9 +61,14 @@ func NewAMSClient(config AnboxConfig) (*AMSClient, error) {
 	}, nil
 }
 
+// endpoint builds the URL of an AMS API resource
+func (a *AMSClient) endpoint(elems ...string) string {
+	return joinURL(a.cfg.AmsAddr, append([]string{basePathOrDefault(a.cfg.AmsBasePath)}, elems...)...)
+}
+
 // GetAllRunningSession gets all running sessions from AMS
 func (a *AMSClient) GetAllRunningSession(ctx context.Context) ([]*SessionDetails, error) {
-	url := fmt.Sprintf("%s/1.0/instances", a.cfg.AmsAddr)
+	url := a.endpoint("instances")
 
 	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -68,7 +81,7 @@ func (a *AMSClient) GetAllRunningSession(ctx context.Context) ([]*SessionDetails
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer response.Body.Close()
+	defer closeBody(response.Body)
 
 	if response.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(response.Body)
@@ -82,9 +95,11 @@ func (a *AMSClient) GetAllRunningSession(ctx context.Context) ([]*SessionDetails
 
 	// Extract instance IDs from metadata paths
 	var sessions []*SessionDetails
+	instanceIDs := make(map[string]string)
+	defer a.setInstanceIDs(instanceIDs)
 	for _, path := range result.Metadata {
 		// Extract ID from path "/1.0/instances/instance-id"
-		instanceID := strings.TrimPrefix(path, "/1.0/instances/")
+		instanceID := instanceIDFromPath(path)
 		if instanceID != "" {
 			// Get detailed information for each instance to check if it's running
 			details, err := a.GetInstanceDetails(ctx, instanceID)
@@ -100,14 +115,18 @@ func (a *AMSClient) GetAllRunningSession(ctx context.Context) ([]*SessionDetails
 				if extractedID := GetSessionIDFromTags(details.Tags); extractedID != "" {
 					sessionID = extractedID
 				}
+				instanceIDs[instanceID] = instanceID
+				instanceIDs[sessionID] = instanceID
 
 				session := &SessionDetails{
 					ID:     sessionID,
+					App:    details.AppName,
 					Status: details.Status,
 					// Map other fields as needed
 					Region:   "", // AMS doesn't provide region info
 					URL:      "", // This would come from gateway
 					Joinable: true,
+					Tags:     details.Tags,
 				}
 				sessions = append(sessions, session)
 			}
@@ -117,9 +136,181 @@ func (a *AMSClient) GetAllRunningSession(ctx context.Context) ([]*SessionDetails
 	return sessions, nil
 }
 
+// GetAllInstances retrieves the details of every instance on AMS in a single request
+func (a *AMSClient) GetAllInstances(ctx context.Context) ([]*InstanceDetails, error) {
+	url := a.endpoint("instances") + "?recursion=1"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result ListInstanceDetailsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	instances := make([]*InstanceDetails, 0, len(result.Metadata))
+	instanceIDs := make(map[string]string, len(result.Metadata))
+	for i := range result.Metadata {
+		instance := &result.Metadata[i]
+		instances = append(instances, instance)
+		instanceIDs[instance.ID] = instance.ID
+		if sessionID := GetSessionIDFromTags(instance.Tags); sessionID != "" {
+			instanceIDs[sessionID] = instance.ID
+		}
+	}
+	a.setInstanceIDs(instanceIDs)
+
+	return instances, nil
+}
+
+// setInstanceIDs replaces the session to instance mapping with the one of a fresh listing
+func (a *AMSClient) setInstanceIDs(instanceIDs map[string]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.instanceIDs = instanceIDs
+}
+
+// instanceFor returns the instance backing a session, listing the instances only for a session the last
+// listing did not know, e.g. one created since
+func (a *AMSClient) instanceFor(ctx context.Context, sessionID string) (string, error) {
+	a.mu.Lock()
+	instanceID, ok := a.instanceIDs[sessionID]
+	a.mu.Unlock()
+	if ok {
+		return instanceID, nil
+	}
+
+	if _, err := a.GetAllInstances(ctx); err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	instanceID, ok = a.instanceIDs[sessionID]
+	a.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no instance backs session %s", sessionID)
+	}
+	return instanceID, nil
+}
+
+// DeleteInstance deletes an instance directly on AMS, bypassing the gateway
+func (a *AMSClient) DeleteInstance(ctx context.Context, instanceID string) error {
+	url := a.endpoint("instances", instanceID)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to delete instance (status code: %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// execRequest is the body of an AMS instance exec
+type execRequest struct {
+	Command     []string          `json:"command"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Interactive bool              `json:"interactive"`
+}
+
+// Exec runs command in an instance and waits for it to finish
+func (a *AMSClient) Exec(ctx context.Context, instanceID string, command []string) error {
+	body, err := json.Marshal(execRequest{Command: command})
+	if err != nil {
+		return fmt.Errorf("failed to encode exec request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint("instances", instanceID, "exec"), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to exec in instance (status code: %d): %s", resp.StatusCode, string(bodyBytes))
+	}
+	var accepted asyncResponse
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if accepted.Operation == "" {
+		return nil
+	}
+	return a.waitOperation(ctx, operationID(accepted.Operation))
+}
+
+// waitOperation blocks on the AMS wait endpoint of an operation until it finishes or ctx is done
+func (a *AMSClient) waitOperation(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.endpoint("operations", id, "wait"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to wait for operation %s (status code: %d): %s", id, resp.StatusCode, string(bodyBytes))
+	}
+	var result operationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.Metadata.Failed() {
+		return fmt.Errorf("%w: operation %s is %s: %s", ErrOperationFailed, id, result.Metadata.Status, result.Metadata.Err)
+	}
+	return nil
+}
+
+// LaunchApp runs commands in order in the instance backing a session, found by its session tag or ID
+func (a *AMSClient) LaunchApp(ctx context.Context, sessionID string, commands [][]string) error {
+	instanceID, err := a.instanceFor(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	for _, command := range commands {
+		if err := a.Exec(ctx, instanceID, command); err != nil {
+			return fmt.Errorf("failed to run %q: %w", command, err)
+		}
+	}
+	return nil
+}
+
 // ListInstances retrieves all instances from AMS
 func (a *AMSClient) ListInstances(ctx context.Context) (*ListInstanceDetails, error) {
-	url := fmt.Sprintf("%s/1.0/instances", a.cfg.AmsAddr)
+	url := a.endpoint("instances")
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -130,7 +321,7 @@ func (a *AMSClient) ListInstances(ctx context.Context) (*ListInstanceDetails, er
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
@@ -145,7 +336,7 @@ func (a *AMSClient) ListInstances(ctx context.Context) (*ListInstanceDetails, er
 	instanceIDs := make([]string, 0, len(rawResponse.Metadata))
 	for _, path := range rawResponse.Metadata {
 		// Extract ID from path "/1.0/instances/instance-id"
-		id := strings.TrimPrefix(path, "/1.0/instances/")
+		id := instanceIDFromPath(path)
 		if id != "" {
 			instanceIDs = append(instanceIDs, id)
 		}
@@ -160,9 +351,9 @@ func (a *AMSClient) ListInstances(ctx context.Context) (*ListInstanceDetails, er
 // GetInstanceDetails retrieves detailed information about a specific instance
 func (a *AMSClient) GetInstanceDetails(ctx context.Context, instanceID string) (*InstanceDetails, error) {
 	// Extract the actual instance ID from the full path if necessary
-	instanceID = strings.TrimPrefix(instanceID, "/1.0/instances/")
+	instanceID = instanceIDFromPath(instanceID)
 
-	url := fmt.Sprintf("%s/1.0/instances/%s", a.cfg.AmsAddr, instanceID)
+	url := a.endpoint("instances", instanceID)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -173,7 +364,7 @@ func (a *AMSClient) GetInstanceDetails(ctx context.Context, instanceID string) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
@@ -187,13 +378,85 @@ func (a *AMSClient) GetInstanceDetails(ctx context.Context, instanceID string) (
 	return &result.Metadata, nil
 }
 
-// GetSessionIDFromTags extracts the session ID from instance tags
-func GetSessionIDFromTags(tags []string) string {
-	for _, tag := range tags {
-		if strings.HasPrefix(tag, "session=") {
-			// assuming there is only one session id in the tags
-			return strings.TrimPrefix(tag, "session=")
+// ListApps retrieves all applications and their versions from AMS
+func (a *AMSClient) ListApps(ctx context.Context) ([]AppSummary, error) {
+	url := a.endpoint("applications") + "?recursion=1"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result ListAppsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	apps := make([]AppSummary, 0, len(result.Metadata))
+	for _, app := range result.Metadata {
+		summary := AppSummary{
+			ID:        app.ID,
+			Name:      app.Name,
+			Status:    app.Status,
+			Published: app.Published,
+			Versions:  make([]int, 0, len(app.Versions)),
 		}
+		for _, version := range app.Versions {
+			summary.Versions = append(summary.Versions, version.Number)
+			if version.Number > summary.LatestVersion {
+				summary.LatestVersion = version.Number
+			}
+		}
+		apps = append(apps, summary)
 	}
-	return ""
+
+	return apps, nil
+}
+
+// GetApp retrieves an application by name from AMS
+func (a *AMSClient) GetApp(ctx context.Context, name string) (*AppDetails, error) {
+	url := a.endpoint("applications", name)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result AppDetailsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result.Metadata, nil
+}
+
+// GetSessionIDFromTags extracts the session ID from instance tags
+func GetSessionIDFromTags(tags []string) string {
+	// assuming there is only one session id in the tags
+	return GetTagValue(tags, TagSession)
 }
@@ -0,0 +1,283 @@
+package anbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestAMSClient(server *httptest.Server) *AMSClient {
+	return &AMSClient{
+		cfg:    &AnboxConfig{AmsAddr: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestAMSListApps_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
+		}
+
+		if r.URL.Path != "/1.0/applications" {
+			t.Errorf("Expected path '/1.0/applications', got '%s'", r.URL.Path)
+		}
+
+		if r.URL.Query().Get("recursion") != "1" {
+			t.Error("Expected recursion=1 in query parameters")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"type": "sync",
+			"status": "Success",
+			"status_code": 200,
+			"metadata": [
+				{
+					"id": "app-1",
+					"name": "idle_weapon",
+					"status": "ready",
+					"published": true,
+					"versions": [
+						{"number": 0, "status": "active", "published": true},
+						{"number": 2, "status": "active", "published": true},
+						{"number": 1, "status": "active", "published": true}
+					]
+				},
+				{
+					"id": "app-2",
+					"name": "other_game",
+					"status": "initializing",
+					"published": false,
+					"versions": []
+				}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	apps, err := newTestAMSClient(server).ListApps(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(apps) != 2 {
+		t.Fatalf("Expected 2 apps, got %d", len(apps))
+	}
+
+	if apps[0].Name != "idle_weapon" || apps[0].ID != "app-1" {
+		t.Errorf("Unexpected first app: %+v", apps[0])
+	}
+
+	if apps[0].LatestVersion != 2 {
+		t.Errorf("Expected latest version 2, got %d", apps[0].LatestVersion)
+	}
+
+	if len(apps[0].Versions) != 3 {
+		t.Errorf("Expected 3 versions, got %d", len(apps[0].Versions))
+	}
+
+	if apps[1].Published {
+		t.Error("Expected second app to be unpublished")
+	}
+}
+
+func TestAMSGetApp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/applications/idle_weapon":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{
+				"type": "sync",
+				"status": "Success",
+				"status_code": 200,
+				"metadata": {"id": "app-1", "name": "idle_weapon", "status": "ready", "published": true}
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": "not found", "error_code": 404}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newTestAMSClient(server)
+	ctx := context.Background()
+
+	app, err := client.GetApp(ctx, "idle_weapon")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if app.Name != "idle_weapon" {
+		t.Errorf("Expected app name 'idle_weapon', got '%s'", app.Name)
+	}
+
+	_, err = client.GetApp(ctx, "missing")
+	if !errors.Is(err, ErrAppNotFound) {
+		t.Errorf("Expected ErrAppNotFound, got %v", err)
+	}
+}
+
+func TestAMSGetAllRunningSession_Tags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/1.0/instances":
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": ["/1.0/instances/inst-1", "/1.0/instances/inst-2"]}`))
+		case "/1.0/instances/inst-1":
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": {
+				"id": "inst-1", "status": "running", "app_name": "idle_weapon",
+				"tags": ["session=sess-1", "game=idle_weapon", "managed-by=playable-backend"]
+			}}`))
+		case "/1.0/instances/inst-2":
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": {
+				"id": "inst-2", "status": "running", "app_name": "idle_weapon", "tags": []
+			}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sessions, err := newTestAMSClient(server).GetAllRunningSession(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	if sessions[0].ID != "sess-1" {
+		t.Errorf("Expected session ID from tags 'sess-1', got '%s'", sessions[0].ID)
+	}
+
+	if GetTagValue(sessions[0].Tags, TagGame) != "idle_weapon" || !IsManagedInstance(sessions[0].Tags) {
+		t.Errorf("Expected attribution tags to round-trip, got %v", sessions[0].Tags)
+	}
+
+	if sessions[1].ID != "inst-2" {
+		t.Errorf("Expected untagged instance to fall back to instance ID, got '%s'", sessions[1].ID)
+	}
+
+	if IsManagedInstance(sessions[1].Tags) {
+		t.Error("Expected untagged instance not to be reported as managed")
+	}
+}
+
+func TestAMSGetAllInstancesAndDelete(t *testing.T) {
+	deleted := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0/instances":
+			if r.URL.Query().Get("recursion") != "1" {
+				t.Error("Expected recursion=1 in query parameters")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": [
+				{"id": "inst-1", "status": "running", "tags": ["managed-by=playable-backend"]},
+				{"id": "inst-2", "status": "error", "created_at": 1700000000}
+			]}`))
+		case r.Method == "DELETE" && r.URL.Path == "/1.0/instances/inst-2":
+			deleted = "inst-2"
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestAMSClient(server)
+	ctx := context.Background()
+
+	instances, err := client.GetAllInstances(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d", len(instances))
+	}
+	if instances[1].Status != "error" || instances[1].CreatedAt != 1700000000 {
+		t.Errorf("Unexpected second instance: %+v", instances[1])
+	}
+
+	if err := client.DeleteInstance(ctx, "inst-2"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if deleted != "inst-2" {
+		t.Error("Expected instance inst-2 to be deleted")
+	}
+}
+
+func TestAMSLaunchApp(t *testing.T) {
+	var commands []string
+	listings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0/instances":
+			listings++
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": [
+				{"id": "inst-1", "status": "running", "tags": ["session=other"]},
+				{"id": "inst-2", "status": "running", "tags": ["session=session-2"]}
+			]}`))
+		case r.Method == "POST" && r.URL.Path == "/1.0/instances/inst-2/exec":
+			var req execRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			commands = append(commands, strings.Join(req.Command, " "))
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `{"type": "async", "status_code": 100, "operation": "/1.0/operations/op-%d"}`, len(commands))
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/op-1/wait":
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": {"id": "op-1", "status": "Success", "status_code": 200}}`))
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/op-2/wait":
+			w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": {"id": "op-2", "status": "Failure", "status_code": 400, "err": "no such activity"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestAMSClient(server)
+	ctx := context.Background()
+
+	launch := [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	if err := client.LaunchApp(ctx, "session-2", launch); err != nil {
+		t.Fatalf("Expected launch to succeed, got %v", err)
+	}
+	if len(commands) != 1 || commands[0] != "am start -W -n com.example/.Main" {
+		t.Errorf("Expected the launch command to run in inst-2, got %q", commands)
+	}
+
+	// A failed command fails the launch, the instance is not listed again for a known session
+	if err := client.LaunchApp(ctx, "session-2", [][]string{{"input", "tap", "10", "10"}}); !errors.Is(err, ErrOperationFailed) {
+		t.Errorf("Expected ErrOperationFailed, got %v", err)
+	}
+	if listings != 1 {
+		t.Errorf("Expected the instances to be listed once for two launches, got %d listings", listings)
+	}
+	if err := client.LaunchApp(ctx, "missing", launch); err == nil {
+		t.Errorf("Expected an error for a session without instance")
+	}
+}
+
+func TestAMSGetApp_PrefixedBasePath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ams/2.0/applications/idle_weapon" {
+			t.Errorf("Expected path '/ams/2.0/applications/idle_weapon', got '%s'", r.URL.Path)
+		}
+		w.Write([]byte(`{"type": "sync", "status_code": 200, "metadata": {"name": "idle_weapon"}}`))
+	}))
+	defer server.Close()
+
+	client := newTestAMSClient(server)
+	client.cfg.AmsBasePath = "ams/2.0"
+
+	if _, err := client.GetApp(context.Background(), "idle_weapon"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package anbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUpstreamUnavailable is returned without calling anbox while the circuit breaker is open
+var ErrUpstreamUnavailable = errors.New("anbox upstream unavailable")
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+const (
+	DefaultBreakerThreshold   = 5
+	DefaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// CircuitBreaker fast-fails calls after threshold consecutive failures, and lets a
+// single probe through once openTimeout has elapsed to detect recovery
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	state       BreakerState
+	openedAt    time.Time
+	probing     bool
+	trips       int64 // times the breaker opened
+	now         func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker, zero values select the defaults
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if openTimeout <= 0 {
+		openTimeout = DefaultBreakerOpenTimeout
+	}
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       BreakerClosed,
+		now:         time.Now,
+	}
+}
+
+// Allow returns ErrUpstreamUnavailable if the call must not be attempted
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrUpstreamUnavailable
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		// Only one probe at a time while half-open
+		if b.probing {
+			return ErrUpstreamUnavailable
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Record records the outcome of an allowed call. A call its caller canceled tells nothing about the
+// upstream, a gateway that hangs until callers give up must not count as healthy, so it is ignored.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !isUpstreamFailure(err) {
+		b.failures = 0
+		b.state = BreakerClosed
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.trips++
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Trips returns how many times the breaker opened
+func (b *CircuitBreaker) Trips() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.trips
+}
+
+// State returns the current breaker state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// isUpstreamFailure reports whether err means the upstream is unhealthy. Requests the
+// upstream rejected on their merits (bad app, auth, capacity) prove it is reachable.
+func isUpstreamFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrAppNotFound) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Category == ErrorCategoryServer
+	}
+	return true
+}
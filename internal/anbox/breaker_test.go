@@ -0,0 +1,102 @@
+package anbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_OpenHalfOpenClose(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	upstreamErr := errors.New("connection refused")
+
+	// Failures below the threshold keep the breaker closed
+	for i := 0; i < 2; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Expected call to be allowed, got %v", err)
+		}
+		breaker.Record(upstreamErr)
+	}
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("Expected breaker closed, got %s", breaker.State())
+	}
+
+	// The threshold-th consecutive failure opens it
+	breaker.Allow()
+	breaker.Record(upstreamErr)
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected breaker open, got %s", breaker.State())
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("Expected ErrUpstreamUnavailable while open, got %v", err)
+	}
+
+	// After the open timeout a single probe is let through
+	now = now.Add(time.Minute)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("Expected breaker half-open, got %s", breaker.State())
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("Expected concurrent calls to fail while probing, got %v", err)
+	}
+
+	// A failed probe reopens immediately
+	breaker.Record(upstreamErr)
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected breaker to reopen after failed probe, got %s", breaker.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	breaker.Record(nil)
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("Expected breaker closed after successful probe, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoresRejectedRequests(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Minute)
+
+	breaker.Allow()
+	breaker.Record(&APIError{StatusCode: 404, Category: ErrorCategoryNotFound})
+	breaker.Allow()
+	breaker.Record(&APIError{StatusCode: 503, Category: ErrorCategoryCapacity})
+
+	if breaker.State() != BreakerClosed {
+		t.Errorf("Expected requests rejected by a reachable upstream to keep the breaker closed, got %s", breaker.State())
+	}
+
+	breaker.Allow()
+	breaker.Record(&APIError{StatusCode: 502, Category: ErrorCategoryServer})
+	if breaker.State() != BreakerOpen {
+		t.Errorf("Expected server errors to open the breaker, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoresCanceledCalls(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Minute)
+
+	// A canceled call between two failures neither counts as one nor resets the streak
+	breaker.Allow()
+	breaker.Record(errors.New("connection reset"))
+	breaker.Allow()
+	breaker.Record(context.Canceled)
+	breaker.Allow()
+	breaker.Record(errors.New("connection reset"))
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("Expected a canceled call not to reset the failure streak, got %s", breaker.State())
+	}
+	if breaker.Trips() != 1 {
+		t.Errorf("Expected 1 trip, got %d", breaker.Trips())
+	}
+}
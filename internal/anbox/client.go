@@ -2,40 +2,167 @@ package anbox
 
 import (
 	"context"
+	"fmt"
 )
 
 // Client implements the AnboxClient interface by combining GatewayClient and AMSClient
 type Client struct {
 	gatewayClient *GatewayClient
 	amsClient     *AMSClient
+	replicaID     string
+	breaker       *CircuitBreaker
 }
 
 // NewClient creates a new Anbox client with both Gateway and AMS clients
-func NewClient(cfg AnboxConfig) (*Client, error) {
-	amsClient, err := NewAMSClient(cfg)
+func NewClient(cfg AnboxConfig, opts ...ClientOption) (*Client, error) {
+	amsClient, err := NewAMSClient(cfg, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	// Orphans are only reaped among the instances tagged with this replica's ID, so it must survive restarts
+	if cfg.ReplicaID == "" {
+		return nil, fmt.Errorf("replica_id is required to tell this replica's instances on the farm apart")
+	}
+
 	return &Client{
-		gatewayClient: NewGatewayClient(cfg),
+		gatewayClient: NewGatewayClient(cfg, opts...),
 		amsClient:     amsClient,
+		replicaID:     cfg.ReplicaID,
+		breaker:       NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerOpenTimeout),
 	}, nil
 }
 
+// call runs fn through the circuit breaker
+func (c *Client) call(fn func() error) error {
+	if err := c.breaker.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	c.breaker.Record(err)
+	return err
+}
+
+// BreakerState returns the state of the circuit breaker guarding anbox calls
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
+// BreakerTrips returns how many times the circuit breaker guarding anbox calls opened
+func (c *Client) BreakerTrips() int64 {
+	return c.breaker.Trips()
+}
+
+// Available reports whether anbox calls are currently let through
+func (c *Client) Available() bool {
+	return c.breaker.State() != BreakerOpen
+}
+
+// Create creates a new Anbox streaming session and waits for the gateway to return it
+func (c *Client) Create(ctx context.Context, req CreateSessionRequest) (session *SessionDetails, err error) {
+	err = c.call(func() error {
+		session, err = c.gatewayClient.Create(ctx, req)
+		return err
+	})
+	return session, err
+}
+
 // CreateAsync creates a new Anbox streaming session asynchronously
 func (c *Client) CreateAsync(ctx context.Context, req CreateSessionRequest) error {
-	return c.gatewayClient.CreateAsync(ctx, req)
+	return c.call(func() error {
+		return c.gatewayClient.CreateAsync(ctx, req)
+	})
+}
+
+// GetSession returns the gateway's view of a session
+func (c *Client) GetSession(ctx context.Context, sessionID string) (session *SessionDetails, err error) {
+	err = c.call(func() error {
+		session, err = c.gatewayClient.GetSession(ctx, sessionID)
+		return err
+	})
+	return session, err
+}
+
+// Join requests connection details scoped to a single session
+func (c *Client) Join(ctx context.Context, sessionID string) (details *JoinSessionDetails, err error) {
+	err = c.call(func() error {
+		details, err = c.gatewayClient.Join(ctx, sessionID)
+		return err
+	})
+	return details, err
+}
+
+// CaptureScreenshot returns the current frame of a session
+func (c *Client) CaptureScreenshot(ctx context.Context, sessionID string) (image []byte, err error) {
+	err = c.call(func() error {
+		image, err = c.gatewayClient.CaptureScreenshot(ctx, sessionID)
+		return err
+	})
+	return image, err
 }
 
 // Delete deletes an existing session
 func (c *Client) Delete(ctx context.Context, sessionID string) error {
-	return c.gatewayClient.Delete(ctx, sessionID)
+	return c.call(func() error {
+		return c.gatewayClient.Delete(ctx, sessionID)
+	})
 }
 
 // GetAllRunningSession gets all running sessions from AMS
-func (c *Client) GetAllRunningSession(ctx context.Context) ([]*SessionDetails, error) {
-	return c.amsClient.GetAllRunningSession(ctx)
+func (c *Client) GetAllRunningSession(ctx context.Context) (sessions []*SessionDetails, err error) {
+	err = c.call(func() error {
+		sessions, err = c.amsClient.GetAllRunningSession(ctx)
+		return err
+	})
+	return sessions, err
+}
+
+// GetAllInstances gets the details of every instance from AMS
+func (c *Client) GetAllInstances(ctx context.Context) (instances []*InstanceDetails, err error) {
+	err = c.call(func() error {
+		instances, err = c.amsClient.GetAllInstances(ctx)
+		return err
+	})
+	return instances, err
+}
+
+// DeleteInstance deletes an instance directly on AMS
+func (c *Client) DeleteInstance(ctx context.Context, instanceID string) error {
+	return c.call(func() error {
+		return c.amsClient.DeleteInstance(ctx, instanceID)
+	})
+}
+
+// LaunchApp runs commands in order in the instance backing a session
+func (c *Client) LaunchApp(ctx context.Context, sessionID string, commands [][]string) error {
+	return c.call(func() error {
+		return c.amsClient.LaunchApp(ctx, sessionID, commands)
+	})
+}
+
+// SendInput injects an input event into a session through the gateway
+func (c *Client) SendInput(ctx context.Context, sessionID string, input Input) error {
+	return c.call(func() error {
+		return c.gatewayClient.SendInput(ctx, sessionID, input)
+	})
+}
+
+// ListApps retrieves all applications and their versions from AMS
+func (c *Client) ListApps(ctx context.Context) (apps []AppSummary, err error) {
+	err = c.call(func() error {
+		apps, err = c.amsClient.ListApps(ctx)
+		return err
+	})
+	return apps, err
+}
+
+// GetApp retrieves an application by name from AMS
+func (c *Client) GetApp(ctx context.Context, name string) (app *AppDetails, err error) {
+	err = c.call(func() error {
+		app, err = c.amsClient.GetApp(ctx, name)
+		return err
+	})
+	return app, err
 }
 
 // GetGatewayURL returns the gateway URL
@@ -47,3 +174,8 @@ func (c *Client) GetGatewayURL() string {
 func (c *Client) GetAuthToken() string {
 	return c.gatewayClient.GetAuthToken()
 }
+
+// GetReplicaID returns the ID this replica tags its instances with
+func (c *Client) GetReplicaID() string {
+	return c.replicaID
+}
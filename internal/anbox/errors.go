@@ -0,0 +1,98 @@
+package anbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorCategory classifies gateway/AMS failures so callers can react to them
+type ErrorCategory string
+
+const (
+	ErrorCategoryAuth           ErrorCategory = "auth"
+	ErrorCategoryNotFound       ErrorCategory = "not_found"
+	ErrorCategoryCapacity       ErrorCategory = "capacity"
+	ErrorCategoryInvalidRequest ErrorCategory = "invalid_request"
+	ErrorCategoryServer         ErrorCategory = "server"
+)
+
+// APIError is returned when the gateway or AMS answers with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Category   ErrorCategory
+	ErrorCode  int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d (%s), body: %s", e.StatusCode, e.Category, e.Message)
+}
+
+// Permanent reports whether retrying the same request is pointless
+func (e *APIError) Permanent() bool {
+	switch e.Category {
+	case ErrorCategoryAuth, ErrorCategoryNotFound, ErrorCategoryInvalidRequest:
+		return true
+	}
+	return false
+}
+
+// errorResponse represents the error body returned by the anbox APIs
+type errorResponse struct {
+	Type       string `json:"type"`
+	Error      string `json:"error"`
+	ErrorCode  int    `json:"error_code"`
+	StatusCode int    `json:"status_code"`
+}
+
+// newAPIError builds a categorized APIError from a failed response
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    string(body),
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != "" {
+		apiErr.Message = resp.Error
+		apiErr.ErrorCode = resp.ErrorCode
+	}
+
+	apiErr.Category = categorize(statusCode, strings.ToLower(apiErr.Message))
+	return apiErr
+}
+
+// categorize maps a status code and error message to an ErrorCategory
+func categorize(statusCode int, message string) ErrorCategory {
+	// The gateway reports a missing capacity with various status codes, so check the message first
+	for _, hint := range []string{"no capacity", "not enough", "no available node", "no node", "quota", "limit reached"} {
+		if strings.Contains(message, hint) {
+			return ErrorCategoryCapacity
+		}
+	}
+
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorCategoryAuth
+	case statusCode == http.StatusNotFound || strings.Contains(message, "not found") || strings.Contains(message, "does not exist"):
+		return ErrorCategoryNotFound
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusInsufficientStorage:
+		return ErrorCategoryCapacity
+	case statusCode >= 400 && statusCode < 500:
+		return ErrorCategoryInvalidRequest
+	default:
+		return ErrorCategoryServer
+	}
+}
+
+// ErrorCategoryOf returns the category of an APIError anywhere in err's chain
+func ErrorCategoryOf(err error) (ErrorCategory, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Category, true
+	}
+	return "", false
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type GatewayClient struct {
@@ -15,16 +17,19 @@ type GatewayClient struct {
 	client *http.Client
 }
 
-func NewGatewayClient(config AnboxConfig) *GatewayClient {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
+func NewGatewayClient(config AnboxConfig, opts ...ClientOption) *GatewayClient {
+	tr := newClientOptions(opts).transports.transport("gateway", config, &tls.Config{InsecureSkipVerify: true})
 	return &GatewayClient{
 		config: config,
 		client: &http.Client{Transport: tr},
 	}
 }
 
+// endpoint builds the URL of a gateway API resource, authenticated with the API token
+func (c *GatewayClient) endpoint(elems ...string) string {
+	return joinURL(c.config.Address, append([]string{basePathOrDefault(c.config.BasePath)}, elems...)...) + "?api_token=" + c.config.Token
+}
+
 // GetGatewayURL returns the gateway URL of the Anbox client
 func (c *GatewayClient) GetGatewayURL() string {
 	return c.config.Address
@@ -37,7 +42,7 @@ func (c *GatewayClient) GetAuthToken() string {
 
 // Create creates a new Anbox streaming session
 func (c *GatewayClient) Create(ctx context.Context, req CreateSessionRequest) (*SessionDetails, error) {
-	url := fmt.Sprintf("%s/1.0/sessions?api_token=%s", c.config.Address, c.config.Token)
+	url := c.endpoint("sessions")
 
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -55,11 +60,11 @@ func (c *GatewayClient) Create(ctx context.Context, req CreateSessionRequest) (*
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer response.Body.Close()
+	defer closeBody(response.Body)
 
 	if response.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(response.Body)
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", response.StatusCode, string(bodyBytes))
+		return nil, newAPIError(response.StatusCode, bodyBytes)
 	}
 
 	var result CreateSessionResponse
@@ -70,9 +75,10 @@ func (c *GatewayClient) Create(ctx context.Context, req CreateSessionRequest) (*
 	return &result.Metadata, nil
 }
 
-// CreateAsync creates a new Anbox streaming session asynchronously
+// CreateAsync creates a new Anbox streaming session asynchronously.
+// Gateways answer 201 Created, or 202 Accepted with an operation handle that is tracked when OperationTimeout is set.
 func (c *GatewayClient) CreateAsync(ctx context.Context, req CreateSessionRequest) error {
-	url := fmt.Sprintf("%s/1.0/sessions?api_token=%s", c.config.Address, c.config.Token)
+	url := c.endpoint("sessions")
 
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -90,20 +96,128 @@ func (c *GatewayClient) CreateAsync(ctx context.Context, req CreateSessionReques
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusCreated {
+	defer closeBody(response.Body)
+
+	switch response.StatusCode {
+	case http.StatusCreated:
+	case http.StatusAccepted:
+		// The session exists once the operation finishes, an undecodable body only means it cannot be tracked
+		var result asyncResponse
+		if err := json.NewDecoder(response.Body).Decode(&result); err == nil {
+			c.trackCreate(req, result.Operation)
+		}
+	default:
 		bodyBytes, _ := io.ReadAll(response.Body)
-		return fmt.Errorf("unexpected status code: %d, body: %s", response.StatusCode, string(bodyBytes))
+		return newAPIError(response.StatusCode, bodyBytes)
 	}
 
 	// We don't return the session details since it's async
 	return nil
 }
 
-// Delete deletes an existing session
+// GetSession returns the gateway's view of a session, a session the gateway no longer knows is an ErrorCategoryNotFound APIError
+func (c *GatewayClient) GetSession(ctx context.Context, sessionID string) (*SessionDetails, error) {
+	url := c.endpoint("sessions", sessionID)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, newAPIError(response.StatusCode, bodyBytes)
+	}
+
+	var result CreateSessionResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result.Metadata, nil
+}
+
+// Join requests connection details scoped to a single session, so clients never see the API token
+func (c *GatewayClient) Join(ctx context.Context, sessionID string) (*JoinSessionDetails, error) {
+	url := c.endpoint("sessions", sessionID, "join")
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, newAPIError(response.StatusCode, bodyBytes)
+	}
+
+	var result JoinSessionResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result.Metadata, nil
+}
+
+// maxScreenshotSize bounds how much of a screenshot response is read
+const maxScreenshotSize = 16 << 20
+
+// ErrScreenshotTooLarge is returned when a screenshot exceeds maxScreenshotSize
+var ErrScreenshotTooLarge = errors.New("screenshot too large")
+
+// CaptureScreenshot returns the current frame of a session as an encoded PNG or JPEG image
+func (c *GatewayClient) CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error) {
+	url := c.endpoint(sessionPath(c.config.ScreenshotPath, DefaultScreenshotPath, sessionID)...)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Accept", "image/png, image/jpeg")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, newAPIError(response.StatusCode, bodyBytes)
+	}
+
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("unexpected screenshot content type: %s", contentType)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(response.Body, maxScreenshotSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read screenshot: %w", err)
+	}
+	if len(image) > maxScreenshotSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrScreenshotTooLarge, maxScreenshotSize)
+	}
+	return image, nil
+}
+
+// Delete deletes an existing session. A session the gateway no longer knows counts as deleted.
 func (c *GatewayClient) Delete(ctx context.Context, sessionID string) error {
-	url := fmt.Sprintf("%s/1.0/sessions/%s?api_token=%s", c.config.Address, sessionID, c.config.Token)
+	url := c.endpoint("sessions", sessionID)
 
 	request, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
@@ -114,11 +228,14 @@ func (c *GatewayClient) Delete(ctx context.Context, sessionID string) error {
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
-	defer response.Body.Close()
+	defer closeBody(response.Body)
 
+	if response.StatusCode == http.StatusNotFound {
+		return nil
+	}
 	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusAccepted {
 		bodyBytes, _ := io.ReadAll(response.Body)
-		return fmt.Errorf("failed to delete session (status code: %d): %s", response.StatusCode, string(bodyBytes))
+		return newAPIError(response.StatusCode, bodyBytes)
 	}
 	return nil
 }
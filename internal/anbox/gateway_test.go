@@ -2,9 +2,16 @@ package anbox
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRealGatewayClient(t *testing.T) {
@@ -155,6 +162,33 @@ func TestCreateSession_Success(t *testing.T) {
 	}
 }
 
+func TestDeleteSession_NotFound(t *testing.T) {
+	status, body := http.StatusNotFound, `{"error":"session not found"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+
+	// A session the gateway already dropped is deleted
+	if err := client.Delete(context.Background(), "gone-session-id"); err != nil {
+		t.Errorf("Expected a 404 to count as deleted, got %v", err)
+	}
+
+	// Other failures are API errors the breaker can classify
+	status, body = http.StatusInternalServerError, `{"error":"database unavailable"}`
+	err := client.Delete(context.Background(), "gone-session-id")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Category != ErrorCategoryServer {
+		t.Errorf("Expected a server APIError, got %v", err)
+	}
+}
+
 func TestDeleteSession_Success(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -191,3 +225,399 @@ func TestDeleteSession_Success(t *testing.T) {
 		t.Errorf("Expected no error, got %v", err)
 	}
 }
+
+func TestJoinSession_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.URL.Path != "/1.0/sessions/test-session-id/join" {
+			t.Errorf("Expected path '/1.0/sessions/test-session-id/join', got '%s'", r.URL.Path)
+		}
+		if r.URL.Query().Get("api_token") != "test-token" {
+			t.Error("Expected api_token in query parameters")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"type": "sync",
+			"status": "Success",
+			"status_code": 200,
+			"metadata": {
+				"signaling_url": "wss://gateway.example.com/1.0/sessions/test-session-id/sockets/client?token=scoped",
+				"stun_servers": [{"urls": ["turn:turn.example.com:3478"], "username": "user", "password": "pass"}]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+
+	details, err := client.Join(context.Background(), "test-session-id")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(details.SignalingURL, "token=scoped") {
+		t.Errorf("Expected scoped signaling URL, got '%s'", details.SignalingURL)
+	}
+	if strings.Contains(details.SignalingURL, "test-token") {
+		t.Errorf("Expected signaling URL not to contain the API token, got '%s'", details.SignalingURL)
+	}
+	if len(details.StunServers) != 1 || details.StunServers[0].Username != "user" {
+		t.Errorf("Expected scoped TURN credentials, got %+v", details.StunServers)
+	}
+}
+
+func TestCaptureScreenshot_Success(t *testing.T) {
+	frame := []byte("\x89PNG\r\n\x1a\nfake-frame")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
+		}
+		if r.URL.Path != "/1.0/sessions/test-session-id/screenshot" {
+			t.Errorf("Expected path '/1.0/sessions/test-session-id/screenshot', got '%s'", r.URL.Path)
+		}
+		if r.URL.Query().Get("api_token") != "test-token" {
+			t.Error("Expected api_token in query parameters")
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(frame)
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+
+	image, err := client.CaptureScreenshot(context.Background(), "test-session-id")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(image) != string(frame) {
+		t.Errorf("Expected the fixed frame, got %q", image)
+	}
+}
+
+func TestCaptureScreenshot_ConfiguredPathAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/frames/test-session-id":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg"))
+		case "/1.0/frames/too-large":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, maxScreenshotSize+1))
+		case "/1.0/frames/not-an-image":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address:        server.URL,
+		Token:          "test-token",
+		ScreenshotPath: "/frames/{id}",
+	})
+	ctx := context.Background()
+
+	if image, err := client.CaptureScreenshot(ctx, "test-session-id"); err != nil || string(image) != "jpeg" {
+		t.Errorf("Expected jpeg frame from the configured path, got %q, %v", image, err)
+	}
+	if _, err := client.CaptureScreenshot(ctx, "too-large"); !errors.Is(err, ErrScreenshotTooLarge) {
+		t.Errorf("Expected ErrScreenshotTooLarge for an oversized frame, got %v", err)
+	}
+	if _, err := client.CaptureScreenshot(ctx, "not-an-image"); err == nil {
+		t.Errorf("Expected error for a non-image response")
+	}
+	_, err := client.CaptureScreenshot(ctx, "missing")
+	if category, ok := ErrorCategoryOf(err); !ok || category != ErrorCategoryNotFound {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestSendInput_Payloads(t *testing.T) {
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/sessions/test-session-id/input" {
+			t.Errorf("Expected path /1.0/sessions/test-session-id/input, got %s", r.URL.Path)
+		}
+		if r.Method != "POST" {
+			t.Errorf("Expected POST method, got %s", r.Method)
+		}
+		if r.URL.Query().Get("api_token") != "test-token" {
+			t.Errorf("Expected api_token=test-token, got %s", r.URL.Query().Get("api_token"))
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON content type, got %s", r.Header.Get("Content-Type"))
+		}
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+		received = append(received, payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{Address: server.URL, Token: "test-token"})
+	inputs := []Input{
+		{Type: InputTap, X: 540, Y: 1200},
+		{Type: InputSwipe, X: 100, Y: 800, ToX: 900, ToY: 800, DurationMS: 300},
+		{Type: InputText, Text: "player one"},
+		{Type: InputTap, X: 0, Y: 0},
+		{Type: InputSwipe, X: 0, Y: 800, ToX: 900, ToY: 0},
+	}
+	for _, input := range inputs {
+		if err := client.SendInput(context.Background(), "test-session-id", input); err != nil {
+			t.Fatalf("Expected %s input to be sent, got %v", input.Type, err)
+		}
+	}
+
+	want := []map[string]any{
+		{"type": "tap", "x": 540.0, "y": 1200.0},
+		{"type": "swipe", "x": 100.0, "y": 800.0, "to_x": 900.0, "to_y": 800.0, "duration_ms": 300.0},
+		{"type": "text", "text": "player one"},
+		{"type": "tap", "x": 0.0, "y": 0.0},
+		{"type": "swipe", "x": 0.0, "y": 800.0, "to_x": 900.0, "to_y": 0.0},
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("Expected payloads %v, got %v", want, received)
+	}
+}
+
+func TestSendInput_ConfiguredPathAndErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/1.0/control/test-session-id" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "not found"}`))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address:   server.URL,
+		Token:     "test-token",
+		InputPath: "/control/{id}",
+	})
+	ctx := context.Background()
+	tap := Input{Type: InputTap, X: 1, Y: 2}
+
+	if err := client.SendInput(ctx, "test-session-id", tap); err != nil {
+		t.Errorf("Expected input to reach the configured path, got %v", err)
+	}
+	err := client.SendInput(ctx, "missing", tap)
+	if category, ok := ErrorCategoryOf(err); !ok || category != ErrorCategoryNotFound {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if err := client.SendInput(ctx, "test-session-id", Input{Type: "pinch"}); err == nil {
+		t.Errorf("Expected error for an unknown input type")
+	}
+	if err := client.SendInput(ctx, "test-session-id", Input{Type: InputText}); err == nil {
+		t.Errorf("Expected error for an empty text input")
+	}
+	if requests != 2 {
+		t.Errorf("Expected invalid inputs not to be sent, got %d requests", requests)
+	}
+}
+
+func TestCreateAsync_SendsTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CreateSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+
+		if GetTagValue(req.Tags, TagGame) != "idle_weapon" {
+			t.Errorf("Expected game tag 'idle_weapon', got tags %v", req.Tags)
+		}
+
+		if !IsManagedInstance(req.Tags) {
+			t.Errorf("Expected managed-by tag, got tags %v", req.Tags)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "test-session-id"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+
+	err := client.CreateAsync(context.Background(), CreateSessionRequest{
+		App:  "idle_weapon",
+		Tags: NewInstanceTags("idle_weapon", "replica-1"),
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestCreateSession_PrefixedBasePath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/anbox/1.0/sessions" {
+			t.Errorf("Expected path '/anbox/1.0/sessions', got '%s'", r.URL.Path)
+		}
+
+		if r.URL.Query().Get("api_token") != "test-token" {
+			t.Error("Expected api_token in query parameters")
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "test-session-id"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address:  server.URL + "/",
+		Token:    "test-token",
+		BasePath: "/anbox/1.0/",
+	})
+
+	if err := client.CreateAsync(context.Background(), CreateSessionRequest{App: "test-app"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestCreateSession_TypedErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		category   ErrorCategory
+		permanent  bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"type": "error", "error": "invalid api token", "error_code": 401}`, ErrorCategoryAuth, true},
+		{"app not found", http.StatusBadRequest, `{"type": "error", "error": "application idle_weapon not found", "error_code": 400}`, ErrorCategoryNotFound, true},
+		{"no capacity", http.StatusInternalServerError, `{"type": "error", "error": "No capacity left to launch instance", "error_code": 500}`, ErrorCategoryCapacity, false},
+		{"too many requests", http.StatusTooManyRequests, `slow down`, ErrorCategoryCapacity, false},
+		{"invalid request", http.StatusBadRequest, `{"type": "error", "error": "invalid screen density", "error_code": 400}`, ErrorCategoryInvalidRequest, true},
+		{"server error", http.StatusBadGateway, `<html>bad gateway</html>`, ErrorCategoryServer, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewGatewayClient(AnboxConfig{
+				Address: server.URL,
+				Token:   "test-token",
+			})
+
+			err := client.CreateAsync(context.Background(), CreateSessionRequest{App: "idle_weapon"})
+			category, ok := ErrorCategoryOf(err)
+			if !ok {
+				t.Fatalf("Expected an APIError, got %v", err)
+			}
+
+			if category != tt.category {
+				t.Errorf("Expected category %s, got %s", tt.category, category)
+			}
+
+			if err.(*APIError).Permanent() != tt.permanent {
+				t.Errorf("Expected permanent=%v for %v", tt.permanent, err)
+			}
+		})
+	}
+}
+
+func TestGatewayClient_ReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	newConns := 0
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			newConns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if err := client.Delete(ctx, "test-session-id"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if newConns != 1 {
+		t.Errorf("Expected repeated calls to reuse one connection, got %d connections", newConns)
+	}
+}
+
+func TestNewTransport_Defaults(t *testing.T) {
+	tr := newTransport(AnboxConfig{}, nil)
+	if tr.MaxIdleConns != DefaultMaxIdleConns || tr.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || tr.IdleConnTimeout != DefaultIdleConnTimeout {
+		t.Errorf("Expected default pooling, got %d/%d/%s", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+
+	tr = newTransport(AnboxConfig{MaxIdleConns: 10, MaxIdleConnsPerHost: 5, IdleConnTimeout: time.Second}, nil)
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 5 || tr.IdleConnTimeout != time.Second {
+		t.Errorf("Expected configured pooling, got %d/%d/%s", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/1.0/sessions/live" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type": "error", "error": "session not found", "error_code": 404, "status_code": 404}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "live", "app": "game", "status": "active"}}`))
+	}))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{Address: server.URL, Token: "test-token"})
+
+	details, err := client.GetSession(context.Background(), "live")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if details.ID != "live" || details.Status != "active" {
+		t.Errorf("Unexpected session details %+v", details)
+	}
+
+	_, err = client.GetSession(context.Background(), "gone")
+	if category, ok := ErrorCategoryOf(err); !ok || category != ErrorCategoryNotFound {
+		t.Errorf("Expected a not found error for an unknown session, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package anbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultInputPath is the gateway path input events of a session are posted to when none is configured
+const DefaultInputPath = "sessions/{id}/input"
+
+// InputType is the kind of an input event injected into a session
+type InputType string
+
+const (
+	InputTap   InputType = "tap"   // touch at X, Y
+	InputSwipe InputType = "swipe" // drag from X, Y to ToX, ToY within DurationMS
+	InputText  InputType = "text"  // type Text into the focused field
+)
+
+// Input is an event injected into a session over the gateway's control channel.
+// It is sent with the fields of its type only, coordinates of 0 included.
+type Input struct {
+	Type       InputType `json:"type"`
+	X          int       `json:"x"`
+	Y          int       `json:"y"`
+	ToX        int       `json:"to_x"`
+	ToY        int       `json:"to_y"`
+	DurationMS int       `json:"duration_ms,omitempty"`
+	Text       string    `json:"text,omitempty"`
+}
+
+// MarshalJSON encodes the fields of the input's type, so a tap at the screen edge keeps its 0 coordinate
+// while a text input carries no coordinates at all
+func (i Input) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{"type": i.Type}
+	switch i.Type {
+	case InputTap:
+		fields["x"], fields["y"] = i.X, i.Y
+	case InputSwipe:
+		fields["x"], fields["y"], fields["to_x"], fields["to_y"] = i.X, i.Y, i.ToX, i.ToY
+		if i.DurationMS != 0 {
+			fields["duration_ms"] = i.DurationMS
+		}
+	case InputText:
+		fields["text"] = i.Text
+	}
+	return json.Marshal(fields)
+}
+
+// Validate checks that the input is of a known type with non-negative coordinates
+func (i Input) Validate() error {
+	if i.X < 0 || i.Y < 0 || i.ToX < 0 || i.ToY < 0 || i.DurationMS < 0 {
+		return fmt.Errorf("%s input must not have negative coordinates or duration", i.Type)
+	}
+	switch i.Type {
+	case InputTap, InputSwipe:
+		return nil
+	case InputText:
+		if i.Text == "" {
+			return fmt.Errorf("text input must not be empty")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown input type %q", i.Type)
+}
+
+// SendInput injects an input event into a session over the gateway's control channel
+func (c *GatewayClient) SendInput(ctx context.Context, sessionID string, input Input) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	url := c.endpoint(sessionPath(c.config.InputPath, DefaultInputPath, sessionID)...)
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(response.Body)
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	}
+	bodyBytes, _ := io.ReadAll(response.Body)
+	return newAPIError(response.StatusCode, bodyBytes)
+}
@@ -0,0 +1,58 @@
+package anbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxInstanceNameLength is the longest instance name AMS accepts
+const MaxInstanceNameLength = 63
+
+// instanceNameShortIDLength is the number of hex characters that keep generated names unique
+const instanceNameShortIDLength = 8
+
+// instanceNamePrefixRE matches AMS instance names: lowercase letters, digits and hyphens, starting with a letter
+var instanceNamePrefixRE = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ValidateInstanceNamePrefix checks that names built from prefix are valid AMS instance names
+func ValidateInstanceNamePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if !instanceNamePrefixRE.MatchString(prefix) || strings.HasSuffix(prefix, "-") || strings.Contains(prefix, "--") {
+		return fmt.Errorf("instance name prefix %q must start with a lowercase letter and contain only lowercase letters, digits and single hyphens", prefix)
+	}
+	// Leave room for at least one character of the game and the short ID
+	if limit := MaxInstanceNameLength - instanceNameShortIDLength - 3; len(prefix) > limit {
+		return fmt.Errorf("instance name prefix %q is longer than %d characters", prefix, limit)
+	}
+	return nil
+}
+
+// NewInstanceName returns a name "<prefix>-<game>-<shortid>" for a new instance of game.
+// The game is lowercased with other characters turned into hyphens and shortened to fit MaxInstanceNameLength.
+func NewInstanceName(prefix, game string) string {
+	var id [instanceNameShortIDLength / 2]byte
+	_, _ = rand.Read(id[:])
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(game) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	slug := b.String()
+	if room := MaxInstanceNameLength - len(prefix) - instanceNameShortIDLength - 2; len(slug) > room {
+		slug = slug[:room]
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		return prefix + "-" + hex.EncodeToString(id[:])
+	}
+	return prefix + "-" + slug + "-" + hex.EncodeToString(id[:])
+}
@@ -0,0 +1,39 @@
+package anbox
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewInstanceName(t *testing.T) {
+	pattern := regexp.MustCompile(`^playable-idle-weapon-[0-9a-f]{8}$`)
+	name := NewInstanceName("playable", "idle_weapon")
+	if !pattern.MatchString(name) {
+		t.Errorf("Expected a name like playable-idle-weapon-<shortid>, got %q", name)
+	}
+	if other := NewInstanceName("playable", "idle_weapon"); other == name {
+		t.Errorf("Expected generated names to differ, got %q twice", name)
+	}
+
+	long := NewInstanceName("playable", strings.Repeat("Game ", 20))
+	if len(long) > MaxInstanceNameLength {
+		t.Errorf("Expected at most %d characters, got %d in %q", MaxInstanceNameLength, len(long), long)
+	}
+	if !regexp.MustCompile(`^playable-game-[a-z0-9-]*[a-z0-9]-[0-9a-f]{8}$`).MatchString(long) {
+		t.Errorf("Expected a shortened game in %q", long)
+	}
+}
+
+func TestValidateInstanceNamePrefix(t *testing.T) {
+	for _, prefix := range []string{"", "playable", "team-a2"} {
+		if err := ValidateInstanceNamePrefix(prefix); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", prefix, err)
+		}
+	}
+	for _, prefix := range []string{"Playable", "2playable", "play_able", "playable-", "play--able", strings.Repeat("a", 60)} {
+		if err := ValidateInstanceNamePrefix(prefix); err == nil {
+			t.Errorf("Expected %q to be rejected", prefix)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package anbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultOperationPollInterval is how often WaitOperation polls when OperationPollInterval is not set
+const DefaultOperationPollInterval = time.Second
+
+// ErrOperationFailed is returned by WaitOperation when the gateway reports the operation failed or was cancelled
+var ErrOperationFailed = errors.New("gateway operation failed")
+
+// Operation is a background gateway operation, such as an asynchronous session creation.
+// Status codes follow the gateway: 1xx while pending or running, 200 on success, 4xx on failure.
+type Operation struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Err        string `json:"err"`
+}
+
+// Done reports whether the operation finished, successfully or not
+func (o *Operation) Done() bool {
+	return o.StatusCode >= http.StatusOK
+}
+
+// Failed reports whether the operation finished without succeeding
+func (o *Operation) Failed() bool {
+	return o.Done() && o.StatusCode != http.StatusOK
+}
+
+// asyncResponse is the body of a 202 Accepted answer, operation is the URL path of the operation
+type asyncResponse struct {
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Operation  string `json:"operation"`
+}
+
+// operationResponse represents the API response when getting an operation
+type operationResponse struct {
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code"`
+	Metadata   Operation `json:"metadata"`
+}
+
+// operationID returns the ID of an operation handle, which is either a bare ID or a path like /1.0/operations/<id>
+func operationID(handle string) string {
+	return path.Base(handle)
+}
+
+// GetOperation returns the current state of a gateway operation
+func (c *GatewayClient) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	url := c.endpoint("operations", id)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer closeBody(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, newAPIError(response.StatusCode, bodyBytes)
+	}
+
+	var result operationResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.Metadata.ID == "" {
+		result.Metadata.ID = id
+	}
+	return &result.Metadata, nil
+}
+
+// WaitOperation polls a gateway operation until it finishes or ctx is done.
+// A failed or cancelled operation is returned together with an ErrOperationFailed error.
+func (c *GatewayClient) WaitOperation(ctx context.Context, id string) (*Operation, error) {
+	interval := c.config.OperationPollInterval
+	if interval <= 0 {
+		interval = DefaultOperationPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		op, err := c.GetOperation(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get operation %s: %w", id, err)
+		}
+		if op.Failed() {
+			return op, fmt.Errorf("%w: operation %s is %s: %s", ErrOperationFailed, id, op.Status, op.Err)
+		}
+		if op.Done() {
+			return op, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return op, fmt.Errorf("operation %s still %s: %w", id, op.Status, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackCreate follows the operation of an asynchronous session creation for up to OperationTimeout
+// and logs how it ended, OperationTimeout 0 leaves the operation untracked
+func (c *GatewayClient) trackCreate(req CreateSessionRequest, handle string) {
+	if c.config.OperationTimeout <= 0 || handle == "" {
+		return
+	}
+	id := operationID(handle)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.OperationTimeout)
+		defer cancel()
+
+		if _, err := c.WaitOperation(ctx, id); err != nil {
+			logger.Errorf("asynchronous creation of a session of app %s did not succeed: %v", req.App, err)
+			return
+		}
+		logger.Infof("asynchronous creation of a session of app %s succeeded, operation %s", req.App, id)
+	}()
+}
@@ -0,0 +1,122 @@
+package anbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// operationServer accepts session creations with 202 and reports operation op-1 as running for the first polls
+type operationServer struct {
+	mu          sync.Mutex
+	polls       int
+	runningFor  int
+	finalStatus string
+}
+
+func (s *operationServer) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/1.0/sessions":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/op-1"}`))
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/op-1":
+			s.mu.Lock()
+			s.polls++
+			polls := s.polls
+			s.mu.Unlock()
+
+			w.WriteHeader(http.StatusOK)
+			switch {
+			case polls <= s.runningFor:
+				w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "op-1", "status": "Running", "status_code": 103}}`))
+			case s.finalStatus == "Failure":
+				w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "op-1", "status": "Failure", "status_code": 400, "err": "no node could launch the instance"}}`))
+			default:
+				w.Write([]byte(`{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "op-1", "status": "Success", "status_code": 200}}`))
+			}
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func (s *operationServer) pollCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.polls
+}
+
+func TestCreateAsync_AcceptedWithOperation(t *testing.T) {
+	operations := &operationServer{runningFor: 2}
+	server := httptest.NewServer(operations.handler(t))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{
+		Address:               server.URL,
+		Token:                 "test-token",
+		OperationTimeout:      time.Second,
+		OperationPollInterval: time.Millisecond,
+	})
+
+	if err := client.CreateAsync(context.Background(), CreateSessionRequest{App: "idle_weapon"}); err != nil {
+		t.Fatalf("Expected 202 Accepted to succeed, got %v", err)
+	}
+
+	// The operation is followed in the background until it succeeds
+	deadline := time.Now().Add(time.Second)
+	for operations.pollCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if polls := operations.pollCount(); polls != 3 {
+		t.Errorf("Expected the operation to be polled until it succeeded after 3 polls, got %d", polls)
+	}
+}
+
+func TestCreateAsync_AcceptedUntracked(t *testing.T) {
+	operations := &operationServer{}
+	server := httptest.NewServer(operations.handler(t))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{Address: server.URL, Token: "test-token"})
+	if err := client.CreateAsync(context.Background(), CreateSessionRequest{App: "idle_weapon"}); err != nil {
+		t.Fatalf("Expected 202 Accepted to succeed, got %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if polls := operations.pollCount(); polls != 0 {
+		t.Errorf("Expected no polling without an operation timeout, got %d polls", polls)
+	}
+}
+
+func TestWaitOperation(t *testing.T) {
+	operations := &operationServer{runningFor: 1, finalStatus: "Failure"}
+	server := httptest.NewServer(operations.handler(t))
+	defer server.Close()
+
+	client := NewGatewayClient(AnboxConfig{Address: server.URL, Token: "test-token", OperationPollInterval: time.Millisecond})
+
+	op, err := client.WaitOperation(context.Background(), operationID("/1.0/operations/op-1"))
+	if !errors.Is(err, ErrOperationFailed) {
+		t.Fatalf("Expected ErrOperationFailed, got %v", err)
+	}
+	if op == nil || op.Status != "Failure" || op.Err != "no node could launch the instance" {
+		t.Errorf("Expected the failed operation, got %+v", op)
+	}
+
+	// A context that ends first stops the polling
+	operations = &operationServer{runningFor: 1 << 30}
+	slow := httptest.NewServer(operations.handler(t))
+	defer slow.Close()
+	client = NewGatewayClient(AnboxConfig{Address: slow.URL, Token: "test-token", OperationPollInterval: time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.WaitOperation(ctx, "op-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline error for an operation that keeps running, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package anbox
+
+import (
+	"strings"
+)
+
+// Instance tag keys used to attribute AMS instances
+const (
+	TagSession   = "session"
+	TagGame      = "game"
+	TagManagedBy = "managed-by"
+	TagReplica   = "replica"
+	TagProfile   = "profile"
+)
+
+// ManagedByValue is the managed-by tag value set on every instance we create
+const ManagedByValue = "playable-backend"
+
+// FormatTag formats a key/value pair as an instance tag
+func FormatTag(key, value string) string {
+	return key + "=" + value
+}
+
+// GetTagValue returns the value of the first tag with the given key, or "" if absent
+func GetTagValue(tags []string, key string) string {
+	prefix := key + "="
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			return strings.TrimPrefix(tag, prefix)
+		}
+	}
+	return ""
+}
+
+// NewInstanceTags returns the attribution tags for an instance created for the given game by the given replica
+func NewInstanceTags(game string, replicaID string) []string {
+	return []string{
+		FormatTag(TagGame, game),
+		FormatTag(TagManagedBy, ManagedByValue),
+		FormatTag(TagReplica, replicaID),
+	}
+}
+
+// IsManagedInstance reports whether the tags mark an instance as created by us
+func IsManagedInstance(tags []string) bool {
+	return GetTagValue(tags, TagManagedBy) == ManagedByValue
+}
@@ -0,0 +1,97 @@
+package anbox
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Transport defaults tuned for the sync fan-out, which hits the same AMS host once per instance
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 32
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newTransport creates an HTTP transport with keep-alive pooling tuned from the config
+func newTransport(cfg AnboxConfig, tlsConfig *tls.Config) *http.Transport {
+	maxIdleConns := cfg.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = DefaultMaxIdleConns
+	}
+	maxIdleConnsPerHost := cfg.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	idleConnTimeout := cfg.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+}
+
+// TransportPool hands out one transport per TLS identity, so the anbox clients of several farms share
+// connection pools. The gateway clients share one transport, the AMS clients one per client certificate.
+// Pooling settings come from the config of the first client asking for a transport.
+type TransportPool struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// NewTransportPool creates an empty transport pool
+func NewTransportPool() *TransportPool {
+	return &TransportPool{transports: make(map[string]*http.Transport)}
+}
+
+// transport returns the transport of key, creating it on first use. A nil pool creates a transport every time.
+func (p *TransportPool) transport(key string, cfg AnboxConfig, tlsConfig *tls.Config) *http.Transport {
+	if p == nil {
+		return newTransport(cfg, tlsConfig)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if tr, ok := p.transports[key]; ok {
+		return tr
+	}
+	tr := newTransport(cfg, tlsConfig)
+	p.transports[key] = tr
+	return tr
+}
+
+// ClientOption configures the anbox clients
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	transports *TransportPool
+}
+
+// WithTransportPool makes the clients take their transports from pool instead of creating their own
+func WithTransportPool(pool *TransportPool) ClientOption {
+	return func(o *clientOptions) {
+		o.transports = pool
+	}
+}
+
+func newClientOptions(opts []ClientOption) clientOptions {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// closeBody drains and closes a response body so the connection can be reused
+func closeBody(body io.ReadCloser) {
+	io.Copy(io.Discard, body)
+	body.Close()
+}
@@ -0,0 +1,101 @@
+package anbox
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed client certificate and its key to dir
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestTransportPool_SharesTransportsAcrossClients(t *testing.T) {
+	dir := t.TempDir()
+	certA, keyA := writeTestCert(t, dir, "farm-a")
+	certB, keyB := writeTestCert(t, dir, "farm-b")
+	farmA := AnboxConfig{Address: "https://gateway-a", Token: "token-a", AmsAddr: "ams-a", AmsCert: certA, AmsKey: keyA, ReplicaID: "replica-1"}
+	farmB := AnboxConfig{Address: "https://gateway-b", Token: "token-b", AmsAddr: "ams-b", AmsCert: certB, AmsKey: keyB, ReplicaID: "replica-1"}
+
+	pool := NewTransportPool()
+	clientA, err := NewClient(farmA, WithTransportPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	clientA2, err := NewClient(farmA, WithTransportPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	clientB, err := NewClient(farmB, WithTransportPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	transport := func(c *http.Client) http.RoundTripper { return c.Transport }
+	if transport(clientA.gatewayClient.client) != transport(clientB.gatewayClient.client) {
+		t.Errorf("Expected the gateway clients of both farms to share a transport")
+	}
+	if transport(clientA.amsClient.client) != transport(clientA2.amsClient.client) {
+		t.Errorf("Expected AMS clients with the same certificate to share a transport")
+	}
+	if transport(clientA.amsClient.client) == transport(clientB.amsClient.client) {
+		t.Errorf("Expected AMS clients with different certificates to use their own transports")
+	}
+	if transport(clientA.amsClient.client) == transport(clientA.gatewayClient.client) {
+		t.Errorf("Expected the AMS client not to use the gateway transport")
+	}
+
+	// Without a pool every client creates its own transport
+	standalone := NewGatewayClient(farmA)
+	if transport(standalone.client) == transport(clientA.gatewayClient.client) {
+		t.Errorf("Expected a client without a pool to create its own transport")
+	}
+}
+
+func TestNewClient_RequiresReplicaID(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "farm")
+	cfg := AnboxConfig{Address: "https://gateway", AmsAddr: "ams", AmsCert: cert, AmsKey: key}
+	if _, err := NewClient(cfg); err == nil {
+		t.Errorf("Expected a client without replica_id to be rejected")
+	}
+	cfg.ReplicaID = "replica-1"
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if client.GetReplicaID() != "replica-1" {
+		t.Errorf("Expected replica ID replica-1, got %s", client.GetReplicaID())
+	}
+}
@@ -1,11 +1,37 @@
 package anbox
 
+import "time"
+
 type AnboxConfig struct {
 	Address string `mapstructure:"address"`
 	Token   string `mapstructure:"token"`
 	AmsAddr string `mapstructure:"ams_address"`
 	AmsCert string `mapstructure:"ams_cert"`
 	AmsKey  string `mapstructure:"ams_key"`
+	// BasePath and AmsBasePath prefix every gateway/AMS API path, e.g. "/anbox/1.0" behind a proxy.
+	// Both default to DefaultBasePath.
+	BasePath    string `mapstructure:"base_path"`
+	AmsBasePath string `mapstructure:"ams_base_path"`
+	// BreakerThreshold consecutive upstream failures open the circuit breaker for BreakerOpenTimeout
+	BreakerThreshold   int           `mapstructure:"breaker_threshold"`
+	BreakerOpenTimeout time.Duration `mapstructure:"breaker_open_timeout"`
+	// HTTP keep-alive pooling for the gateway and AMS transports
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	// ReplicaID identifies this backend replica on a shared farm and is required. It must stay the same across
+	// restarts, instances tagged with another ID are never reaped as this replica's orphans.
+	ReplicaID string `mapstructure:"replica_id"`
+	// ScreenshotPath is the gateway path, relative to BasePath, that returns the current frame of
+	// a session. "{id}" is replaced by the session ID. Defaults to DefaultScreenshotPath.
+	ScreenshotPath string `mapstructure:"screenshot_path"`
+	// InputPath is the gateway path, relative to BasePath, input events of a session are posted to.
+	// "{id}" is replaced by the session ID. Defaults to DefaultInputPath.
+	InputPath string `mapstructure:"input_path"`
+	// OperationTimeout is how long the operation of an asynchronous creation answered with 202 Accepted is
+	// followed to log whether it succeeded, 0 leaves it untracked. It is polled every OperationPollInterval.
+	OperationTimeout      time.Duration `mapstructure:"operation_timeout"`
+	OperationPollInterval time.Duration `mapstructure:"operation_poll_interval"`
 }
 
 // Screen represents the display configuration for a session
@@ -18,6 +44,8 @@ type Screen struct {
 
 // CreateSessionRequest represents the request to create a new session
 type CreateSessionRequest struct {
+	// Name is the AMS instance name shown to operators, AMS generates one when empty
+	Name        string `json:"name,omitempty"`
 	App         string `json:"app"`
 	AppVersion  int    `json:"app_version"`
 	Ephemeral   bool   `json:"ephemeral"`
@@ -25,6 +53,9 @@ type CreateSessionRequest struct {
 	IdleTimeMin int    `json:"idle_time_min"`
 	Joinable    bool   `json:"joinable"`
 	Screen      Screen `json:"screen"`
+	// Tags are attached to the AMS instance backing the session, e.g. "game=idle_weapon".
+	// The gateway adds the "session=<id>" tag itself.
+	Tags []string `json:"tags,omitempty"`
 }
 
 // CreateSessionResponse represents the API response when creating a new session
@@ -38,11 +69,28 @@ type CreateSessionResponse struct {
 // SessionDetails represents the session information returned by the API
 type SessionDetails struct {
 	ID          string       `json:"id"`
+	App         string       `json:"app"`
 	Region      string       `json:"region"`
 	URL         string       `json:"url"`
 	StunServers []StunServer `json:"stun_servers"`
 	Status      string       `json:"status"`
 	Joinable    bool         `json:"joinable"`
+	Tags        []string     `json:"tags,omitempty"`
+}
+
+// JoinSessionResponse represents the API response when joining a session
+type JoinSessionResponse struct {
+	Type       string             `json:"type"`
+	Status     string             `json:"status"`
+	StatusCode int                `json:"status_code"`
+	Metadata   JoinSessionDetails `json:"metadata"`
+}
+
+// JoinSessionDetails holds the connection details scoped to a single session.
+// The signaling URL carries a short-lived token that only grants access to that session.
+type JoinSessionDetails struct {
+	SignalingURL string       `json:"signaling_url"`
+	StunServers  []StunServer `json:"stun_servers"`
 }
 
 // StunServer represents a STUN/TURN server configuration
@@ -111,6 +159,16 @@ type ListInstancesResponse struct {
 	Metadata   []string `json:"metadata"`
 }
 
+// ListInstanceDetailsResponse represents the response from AMS list instances API with recursion enabled
+type ListInstanceDetailsResponse struct {
+	Type       string            `json:"type"`
+	TotalSize  int               `json:"total_size"`
+	Status     string            `json:"status"`
+	StatusCode int               `json:"status_code"`
+	ErrorCode  int               `json:"error_code"`
+	Metadata   []InstanceDetails `json:"metadata"`
+}
+
 // InstanceDetailsResponse represents the response from AMS get instance details API
 type InstanceDetailsResponse struct {
 	Type       string          `json:"type"`
@@ -119,3 +177,50 @@ type InstanceDetailsResponse struct {
 	ErrorCode  int             `json:"error_code"`
 	Metadata   InstanceDetails `json:"metadata"`
 }
+
+// AppVersion represents a single version of an AMS application
+type AppVersion struct {
+	Number       int    `json:"number"`
+	Status       string `json:"status"`
+	Published    bool   `json:"published"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// AppDetails represents detailed information about an AMS application
+type AppDetails struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Status       string       `json:"status"`
+	Published    bool         `json:"published"`
+	InstanceType string       `json:"instance_type"`
+	Tags         []string     `json:"tags"`
+	Versions     []AppVersion `json:"versions"`
+}
+
+// AppSummary contains the essential information about an AMS application and its versions
+type AppSummary struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	Published     bool   `json:"published"`
+	LatestVersion int    `json:"latest_version"`
+	Versions      []int  `json:"versions"`
+}
+
+// ListAppsResponse represents the response from AMS list applications API with recursion enabled
+type ListAppsResponse struct {
+	Type       string       `json:"type"`
+	Status     string       `json:"status"`
+	StatusCode int          `json:"status_code"`
+	ErrorCode  int          `json:"error_code"`
+	Metadata   []AppDetails `json:"metadata"`
+}
+
+// AppDetailsResponse represents the response from AMS get application API
+type AppDetailsResponse struct {
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	StatusCode int        `json:"status_code"`
+	ErrorCode  int        `json:"error_code"`
+	Metadata   AppDetails `json:"metadata"`
+}
@@ -0,0 +1,47 @@
+package anbox
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultBasePath is the API version path used when no base path is configured
+const DefaultBasePath = "/1.0"
+
+// DefaultScreenshotPath is the gateway path of a session screenshot when none is configured
+const DefaultScreenshotPath = "sessions/{id}/screenshot"
+
+// joinURL joins a base URL and path elements with exactly one slash between each part
+func joinURL(base string, elems ...string) string {
+	result := strings.TrimRight(base, "/")
+	for _, elem := range elems {
+		elem = strings.Trim(elem, "/")
+		if elem == "" {
+			continue
+		}
+		result += "/" + elem
+	}
+	return result
+}
+
+// basePathOrDefault returns the configured base path or DefaultBasePath
+func basePathOrDefault(basePath string) string {
+	if basePath == "" {
+		return DefaultBasePath
+	}
+	return basePath
+}
+
+// instanceIDFromPath extracts the instance ID from an AMS resource path like "/1.0/instances/<id>"
+func instanceIDFromPath(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// sessionPath returns the path elements of a per-session gateway endpoint for sessionID,
+// path falling back to fallback when it is not configured
+func sessionPath(path, fallback, sessionID string) []string {
+	if path == "" {
+		path = fallback
+	}
+	return strings.Split(strings.ReplaceAll(path, "{id}", url.PathEscape(sessionID)), "/")
+}
@@ -0,0 +1,33 @@
+package anbox
+
+import "testing"
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base     string
+		elems    []string
+		expected string
+	}{
+		{"https://gateway.example.com", []string{"/1.0", "sessions"}, "https://gateway.example.com/1.0/sessions"},
+		{"https://gateway.example.com/", []string{"/anbox/1.0/", "/sessions/"}, "https://gateway.example.com/anbox/1.0/sessions"},
+		{"https://gateway.example.com//", []string{"", "1.0", "sessions", "abc"}, "https://gateway.example.com/1.0/sessions/abc"},
+	}
+
+	for _, tt := range tests {
+		if got := joinURL(tt.base, tt.elems...); got != tt.expected {
+			t.Errorf("joinURL(%q, %q) = %q, expected %q", tt.base, tt.elems, got, tt.expected)
+		}
+	}
+}
+
+func TestInstanceIDFromPath(t *testing.T) {
+	if id := instanceIDFromPath("/1.0/instances/abc"); id != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", id)
+	}
+	if id := instanceIDFromPath("/anbox/1.0/instances/abc"); id != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", id)
+	}
+	if id := instanceIDFromPath("/1.0/instances/"); id != "" {
+		t.Errorf("Expected empty ID, got '%s'", id)
+	}
+}
@@ -2,27 +2,64 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
 	"time"
 
 	"net/http"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
 	"github.com/letusgogo/playable-backend/internal/game"
+	"github.com/letusgogo/playable-backend/internal/session"
 	"github.com/letusgogo/quick/logger"
 	"github.com/letusgogo/quick/utils"
 )
 
 type ApiServiceConfig struct {
 	Address string `yaml:"address"`
+	// GzipMinSize is the smallest response that is gzip-compressed, negative disables compression
+	GzipMinSize int `yaml:"gzip_min_size"`
+	// DetectMaxBodySize is the largest detect request body in bytes, larger ones get a 413
+	DetectMaxBodySize int64 `yaml:"detect_max_body_size"`
+	// DefaultGame is served by unprefixed aliases such as /api/v1/acquire_cold, empty disables the aliases
+	DefaultGame string `yaml:"default_game"`
+	// Debug serves the /api/v1/debug endpoints
+	Debug bool `yaml:"debug"`
+	// AdminToken serves the pool maintenance endpoints to requests that carry it in AdminTokenHeader,
+	// empty leaves them out
+	AdminToken string `yaml:"admin_token"`
 }
 
 func NewApiServiceConfig() ApiServiceConfig {
 	return ApiServiceConfig{
-		Address: "0.0.0.0:2222",
+		Address:           "0.0.0.0:2222",
+		GzipMinSize:       DefaultGzipMinSize,
+		DetectMaxBodySize: DefaultDetectMaxBodySize,
 	}
 }
 
+// AnboxClient is the part of the anbox client the API exposes
+type AnboxClient interface {
+	ListApps(ctx context.Context) ([]anbox.AppSummary, error)
+	Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error)
+	BreakerState() anbox.BreakerState
+	BreakerTrips() int64
+}
+
+// sessionJoiner gets the connection details of an anbox session
+type sessionJoiner interface {
+	Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error)
+}
+
 type ApiService struct {
 	name      string
 	config    ApiServiceConfig
@@ -31,14 +68,16 @@ type ApiService struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	gameManager *game.Manager
+	anboxClient AnboxClient
 }
 
-func NewApiService(config ApiServiceConfig, gameManager *game.Manager) *ApiService {
+func NewApiService(config ApiServiceConfig, gameManager *game.Manager, anboxClient AnboxClient) *ApiService {
 	return &ApiService{
 		name:        "apiService",
 		config:      config,
 		ginServer:   utils.NewGinServer(config.Address),
 		gameManager: gameManager,
+		anboxClient: anboxClient,
 	}
 }
 
@@ -47,6 +86,12 @@ func (a *ApiService) Name() string {
 }
 
 func (a *ApiService) Init() error {
+	if a.config.DefaultGame != "" {
+		if _, ok := a.gameManager.GetGameInstance(context.Background(), a.config.DefaultGame); !ok {
+			return fmt.Errorf("default game %q is not configured", a.config.DefaultGame)
+		}
+	}
+
 	// Create context for graceful shutdown
 	a.ctx, a.cancel = context.WithCancel(context.Background())
 
@@ -59,30 +104,189 @@ func (a *ApiService) Init() error {
 func (a *ApiService) setupRoutes() {
 	// Apply CORS middleware to the entire Gin engine
 	a.ginServer.GinEngine().Use(cors.Default())
+	if a.config.GzipMinSize >= 0 {
+		a.ginServer.GinEngine().Use(gzipMiddleware(a.config.GzipMinSize))
+	}
 	v1 := a.ginServer.GinGroup("/api/v1")
 	v1.GET("/health", func(c *gin.Context) {
 		logger.GetLogger("apiService").Info("health check")
 		c.JSON(http.StatusOK, gin.H{"message": "ok"})
 	})
 
-	gameGroup := v1.Group("/games")
+	v1.GET("/readyz", a.readyz)
+	v1.GET("/openapi.json", a.openAPI)
+	v1.GET("/metrics", a.metrics)
+	v1.GET("/sessions", a.listAllSessions)
+	v1.GET("/pool_status", a.getPoolStatus)
+
+	anboxGroup := v1.Group("/anbox")
 	{
-		gameGroup.GET("/:game", a.getGameInstance)
-		gameGroup.GET("/:game/sessions", a.getGameInstanceSessions)
+		anboxGroup.GET("/apps", a.listAnboxApps)
+	}
+
+	if a.config.Debug {
+		v1.GET("/debug/health", a.debugHealth)
+	}
+
+	a.registerGameRoutes(v1.Group("/games", auditActor), "/:game")
+	if a.config.DefaultGame != "" {
+		// Single-game deployments can leave out the game
+		a.registerGameRoutes(v1.Group("", auditActor), "")
+	}
+
+	if a.config.AdminToken != "" {
+		a.registerAdminRoutes(v1.Group("/games", a.adminAuth, auditActor), "/:game")
+		if a.config.DefaultGame != "" {
+			a.registerAdminRoutes(v1.Group("", a.adminAuth, auditActor), "")
+		}
+	}
+}
+
+// registerGameRoutes adds the per-game endpoints under prefix, an empty prefix serves the default game
+func (a *ApiService) registerGameRoutes(group *gin.RouterGroup, prefix string) {
+	if prefix != "" {
+		// The game info and pool status stay under /games/<name>, /sessions lists the sessions of every game
+		group.GET(prefix, a.getGameInstance)
+		group.GET(prefix+"/sessions", a.getGameInstanceSessions)
+	}
+	group.GET(prefix+"/sessions/:id", a.getSession)
+	group.GET(prefix+"/sessions/:id/connect", a.getSessionConnection)
+	group.POST(prefix+"/sessions/:id/reconnect", a.reconnectSession)
+	group.GET(prefix+"/stats", a.getGameInstanceStats)
+
+	// Session management endpoints - simplified
+	group.POST(prefix+"/acquire_cold", a.acquireColdSession)
+	group.POST(prefix+"/set_warmed", a.setSessionWarmed)
+	group.POST(prefix+"/abandon_warming", a.abandonWarmingSession)
+	group.POST(prefix+"/acquire_warmed", a.acquireWarmedSession)
+	group.POST(prefix+"/release", a.releaseSession)
+	group.POST(prefix+"/heartbeat", a.heartbeatSession)
+	group.POST(prefix+"/extend", a.extendSession)
+	group.POST(prefix+"/metadata", a.setSessionMetadata)
+
+	group.POST(prefix+"/detect", maxBodySize(a.config.DetectMaxBodySize), a.detectStage)
+}
+
+// registerAdminRoutes adds the operator endpoints of a game under prefix, like registerGameRoutes
+func (a *ApiService) registerAdminRoutes(group *gin.RouterGroup, prefix string) {
+	// Pool maintenance, in-use sessions are not affected
+	group.POST(prefix+"/pause", a.pauseGame)
+	group.POST(prefix+"/resume", a.resumeGame)
+	group.POST(prefix+"/resize", a.resizeGame)
+}
+
+// adminAuth rejects requests without the configured admin token
+func (a *ApiService) adminAuth(c *gin.Context) {
+	token := c.GetHeader(AdminTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, CommonResponse{
+			Code:    401,
+			Message: "admin token required",
+		})
+		return
+	}
+	c.Next()
+}
+
+// gameInstance returns the game named by the :game path parameter, or the default game on the unprefixed aliases
+func (a *ApiService) gameInstance(c *gin.Context) (*game.GameInstance, bool) {
+	name := c.Param("game")
+	if name == "" {
+		name = a.config.DefaultGame
+	}
+	return a.gameManager.GetGameInstance(c.Request.Context(), name)
+}
+
+// readyz reports whether the service can serve sessions
+func (a *ApiService) readyz(c *gin.Context) {
+	status := ReadyzResponse{
+		Ready:        a.gameManager.IsRunning(),
+		GamesRunning: a.gameManager.IsRunning(),
+		BreakerState: string(a.anboxClient.BreakerState()),
+		DebugDump:    a.gameManager.DebugDumpStatus(),
+	}
+	for name, err := range a.gameManager.DegradedGames() {
+		if status.DegradedGames == nil {
+			status.DegradedGames = make(map[string]string)
+		}
+		status.DegradedGames[name] = err.Error()
+	}
+	// Only an open breaker of a farm that running games use keeps the replica from serving
+	for _, farm := range farmBreakers(a.gameManager) {
+		if status.FarmBreakers == nil {
+			status.FarmBreakers = make(map[string]string)
+		}
+		state := farm.breaker.BreakerState()
+		status.FarmBreakers[farm.Name] = string(state)
+		if state == anbox.BreakerOpen && farm.RunningGames > 0 {
+			status.Ready = false
+		}
+	}
+
+	if !status.Ready {
+		message := "not ready"
+		if !a.gameManager.IsRunning() {
+			message = "warming up"
+		}
+		c.JSON(http.StatusServiceUnavailable, CommonResponse{
+			Code:    503,
+			Message: message,
+			Data:    status,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    status,
+	})
+}
+
+// debugHealth reports the goroutine count and whether each game's sync loop is alive and making progress
+func (a *ApiService) debugHealth(c *gin.Context) {
+	resp := DebugHealthResponse{
+		Goroutines: runtime.NumGoroutine(),
+		Games:      make(map[string]*session.LoopHealth),
+	}
+	for name, instance := range a.gameManager.GetAllGameInstances(c.Request.Context()) {
+		sessionManager := instance.GetSessionManager()
+		if sessionManager == nil {
+			resp.Games[name] = nil
+			continue
+		}
+		health := sessionManager.LoopHealth()
+		resp.Games[name] = &health
+	}
 
-		// Session management endpoints - simplified
-		gameGroup.POST("/:game/acquire_cold", a.acquireColdSession)
-		gameGroup.POST("/:game/set_warmed", a.setSessionWarmed)
-		gameGroup.POST("/:game/acquire_warmed", a.acquireWarmedSession)
-		gameGroup.POST("/:game/release", a.releaseSession)
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    resp,
+	})
+}
 
-		gameGroup.POST("/:game/detect", a.detectStage)
+// listAnboxApps lists the applications and versions available on AMS
+func (a *ApiService) listAnboxApps(c *gin.Context) {
+	apps, err := a.anboxClient.ListApps(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
 	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    apps,
+	})
 }
 
 func (a *ApiService) detectStage(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -93,17 +297,50 @@ func (a *ApiService) detectStage(c *gin.Context) {
 	}
 
 	var req DetectStageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if !bindDetectRequest(c, &req) {
+		return
+	}
+
+	if gameConfig := gameInstance.GetConfig(); !gameConfig.ClientCanDetect(req.CurrentStageNum) {
+		message := fmt.Sprintf("unknown stage %d", req.CurrentStageNum)
+		if gameConfig.HasStage(req.CurrentStageNum) {
+			message = fmt.Sprintf("stage %d cannot be detected by clients", req.CurrentStageNum)
+		}
 		c.JSON(http.StatusBadRequest, CommonResponse{
 			Code:    400,
-			Message: "invalid request body",
+			Message: message,
+			Data:    UnknownStageResponse{ValidStages: gameConfig.ClientStageNumbers()},
+		})
+		return
+	}
+
+	returnCrop, err := strconv.ParseBool(c.DefaultQuery("return_crop", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: "invalid return_crop",
 			Data:    nil,
 		})
 		return
 	}
 
-	stageDetector := gameInstance.GetStageDetector(req.CurrentStageNum)
-	match, evidence, err := stageDetector.Detect(c.Request.Context(), game, req.CurrentStageNum, req.Image)
+	detection, err := runDetection(c.Request.Context(), gameInstance.GetStageDetector(req.CurrentStageNum), gameInstance.GetConfig().Name, &req, returnCrop)
+	if errors.Is(err, detector.ErrUnsupportedFormat) {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+	if errors.Is(err, detector.ErrFrameTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, CommonResponse{
+			Code:    413,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, CommonResponse{
 			Code:    500,
@@ -114,9 +351,20 @@ func (a *ApiService) detectStage(c *gin.Context) {
 	}
 
 	response := DetectStageResponse{
-		Match:    match,
+		Match:    detection.Match,
 		StageNum: req.CurrentStageNum,
-		Evidence: evidence,
+		Evidence: detection.Evidence,
+	}
+	var crop []byte
+	if returnCrop {
+		crop = detection.Frame
+	}
+	if wantsProtobuf(c) {
+		c.Data(http.StatusOK, ProtobufMIME, response.marshalProto(crop))
+		return
+	}
+	if crop != nil {
+		response.Crop = base64.StdEncoding.EncodeToString(crop)
 	}
 
 	c.JSON(http.StatusOK, CommonResponse{
@@ -126,9 +374,27 @@ func (a *ApiService) detectStage(c *gin.Context) {
 	})
 }
 
+// runDetection runs the stage detector on the frame of req, Detection.Frame is only certain to be set with returnCrop.
+// A decoded protobuf frame goes to the detector as is when it is an ImageDetector.
+func runDetection(ctx context.Context, stageDetector detector.StageChecker, game string, req *DetectStageRequest, returnCrop bool) (*detector.Detection, error) {
+	image := req.Image
+	if len(req.Frame) > 0 {
+		if imageDetector, ok := stageDetector.(detector.ImageDetector); ok {
+			return imageDetector.DetectImage(ctx, game, req.CurrentStageNum, req.Frame)
+		}
+		image = base64.StdEncoding.EncodeToString(req.Frame)
+	}
+	if frameDetector, ok := stageDetector.(detector.FrameDetector); ok && returnCrop {
+		return frameDetector.DetectFrame(ctx, game, req.CurrentStageNum, image)
+	}
+	detection := &detector.Detection{}
+	var err error
+	detection.Match, detection.Evidence, err = stageDetector.Detect(ctx, game, req.CurrentStageNum, image)
+	return detection, err
+}
+
 func (a *ApiService) getGameInstance(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusOK, gin.H{"error": "game not found"})
 		return
@@ -150,8 +416,7 @@ func (a *ApiService) getGameInstance(c *gin.Context) {
 }
 
 func (a *ApiService) getGameInstanceSessions(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -160,6 +425,9 @@ func (a *ApiService) getGameInstanceSessions(c *gin.Context) {
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
 
 	// Get pool status instead of listing sessions
 	poolStatus, err := gameInstance.GetSessionManager().PoolStatus(c.Request.Context())
@@ -179,34 +447,88 @@ func (a *ApiService) getGameInstanceSessions(c *gin.Context) {
 	})
 }
 
-// Start starts the API service
-func (a *ApiService) Start() error {
-
-	go func() {
-		if err := a.ginServer.Start(); err != nil {
-			logger.GetLogger("apiService").Errorf("failed to start gin server: %v", err)
-		}
-	}()
-	return nil
-}
+// listAllSessions returns a page of the sessions of every game, filtered by the game and status query parameters
+func (a *ApiService) listAllSessions(c *gin.Context) {
+	filter := game.SessionFilter{
+		Game:   c.Query("game"),
+		Status: session.SessionStatus(c.Query("status")),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: fmt.Sprintf("invalid status %q", filter.Status),
+			Data:    nil,
+		})
+		return
+	}
+	var err error
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: "invalid offset",
+			Data:    nil,
+		})
+		return
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || filter.Limit < 0 {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: "invalid limit",
+			Data:    nil,
+		})
+		return
+	}
 
-// StopGracefully stops the API service gracefully
-func (a *ApiService) StopGracefully(wait time.Duration) error {
-	logger.GetLogger("apiService").Info("stop api service")
+	page, err := a.gameManager.ListAllSessions(c.Request.Context(), filter)
+	if errors.Is(err, game.ErrGameNotFound) {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
 
-	// Cancel context to signal shutdown
-	if a.cancel != nil {
-		a.cancel()
+	resp := SessionListResponse{Sessions: make([]SessionResponse, 0, len(page.Sessions)), Total: page.Total, Offset: page.Offset, Limit: page.Limit}
+	for _, s := range page.Sessions {
+		resp.Sessions = append(resp.Sessions, NewSessionResponse(s, nil))
 	}
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    resp,
+	})
+}
 
-	// Stop gin server
-	return a.ginServer.Stop(wait)
+// getPoolStatus returns the pool status summed over every game, with each game's own status
+func (a *ApiService) getPoolStatus(c *gin.Context) {
+	status, err := a.gameManager.AggregatePoolStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    status,
+	})
 }
 
-// acquireColdSession 获取 cold session
-func (a *ApiService) acquireColdSession(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+// getSession returns a single session including its metadata
+func (a *ApiService) getSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -215,11 +537,14 @@ func (a *ApiService) acquireColdSession(c *gin.Context) {
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
 
-	session, err := gameInstance.GetSessionManager().AcquireCold(c.Request.Context())
+	session, err := gameInstance.GetSessionManager().GetSession(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, CommonResponse{
-			Code:    500,
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
 			Message: err.Error(),
 			Data:    nil,
 		})
@@ -229,14 +554,13 @@ func (a *ApiService) acquireColdSession(c *gin.Context) {
 	c.JSON(http.StatusOK, CommonResponse{
 		Code:    ErrNot,
 		Message: "success",
-		Data:    session,
+		Data:    NewSessionResponse(session, nil),
 	})
 }
 
-// setSessionWarmed 设置 session 为 warmed 状态
-func (a *ApiService) setSessionWarmed(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+// getSessionConnection returns the descriptor a client needs to open the stream of an in-use session
+func (a *ApiService) getSessionConnection(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -245,21 +569,25 @@ func (a *ApiService) setSessionWarmed(c *gin.Context) {
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
 
-	var req SetWarmedRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, CommonResponse{
-			Code:    400,
-			Message: "invalid request body",
+	sessionManager := gameInstance.GetSessionManager()
+	if _, err := sessionManager.GetSession(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: err.Error(),
 			Data:    nil,
 		})
 		return
 	}
 
-	err := gameInstance.GetSessionManager().SetWarmed(c.Request.Context(), req.SessionID)
+	info, err := sessionManager.GetConnectionInfo(c.Request.Context(), c.Param("id"), c.GetHeader(APIKeyHeader))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, CommonResponse{
-			Code:    500,
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
 			Message: err.Error(),
 			Data:    nil,
 		})
@@ -269,14 +597,13 @@ func (a *ApiService) setSessionWarmed(c *gin.Context) {
 	c.JSON(http.StatusOK, CommonResponse{
 		Code:    ErrNot,
 		Message: "success",
-		Data:    nil,
+		Data:    info,
 	})
 }
 
-// acquireWarmedSession 获取 warmed session
-func (a *ApiService) acquireWarmedSession(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+// reconnectSession gives a client whose stream dropped fresh connection details for its in-use session
+func (a *ApiService) reconnectSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -285,11 +612,25 @@ func (a *ApiService) acquireWarmedSession(c *gin.Context) {
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	if _, err := sessionManager.GetSession(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
 
-	session, err := gameInstance.GetSessionManager().AcquireWarmed(c.Request.Context())
+	info, err := sessionManager.Reconnect(c.Request.Context(), c.Param("id"), c.GetHeader(APIKeyHeader))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, CommonResponse{
-			Code:    500,
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
 			Message: err.Error(),
 			Data:    nil,
 		})
@@ -299,14 +640,13 @@ func (a *ApiService) acquireWarmedSession(c *gin.Context) {
 	c.JSON(http.StatusOK, CommonResponse{
 		Code:    ErrNot,
 		Message: "success",
-		Data:    session,
+		Data:    info,
 	})
 }
 
-// releaseSession 删除 session
-func (a *ApiService) releaseSession(c *gin.Context) {
-	game := c.Param("game")
-	gameInstance, ok := a.gameManager.GetGameInstance(c.Request.Context(), game)
+// setSessionMetadata merges client metadata into a session
+func (a *ApiService) setSessionMetadata(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
 	if !ok {
 		c.JSON(http.StatusNotFound, CommonResponse{
 			Code:    404,
@@ -315,18 +655,48 @@ func (a *ApiService) releaseSession(c *gin.Context) {
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
 
-	var req ReleaseRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, CommonResponse{
-			Code:    400,
-			Message: "invalid request body",
+	var req SetMetadataRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	if err := gameInstance.GetSessionManager().SetMetadata(c.Request.Context(), req.SessionID, req.Metadata); err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    nil,
+	})
+}
+
+// getGameInstanceStats returns the cumulative session counters of a game
+func (a *ApiService) getGameInstanceStats(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
 			Data:    nil,
 		})
 		return
 	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
 
-	err := gameInstance.GetSessionManager().Release(c.Request.Context(), req.SessionID)
+	stats, err := gameInstance.GetSessionManager().Stats(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, CommonResponse{
 			Code:    500,
@@ -339,6 +709,605 @@ func (a *ApiService) releaseSession(c *gin.Context) {
 	c.JSON(http.StatusOK, CommonResponse{
 		Code:    ErrNot,
 		Message: "success",
-		Data:    nil,
+		Data:    stats,
 	})
 }
+
+// pauseGame stops creating and handing out sessions of a game, for example during a farm maintenance window
+func (a *ApiService) pauseGame(c *gin.Context) {
+	a.setGamePaused(c, true)
+}
+
+// resumeGame undoes pauseGame
+func (a *ApiService) resumeGame(c *gin.Context) {
+	a.setGamePaused(c, false)
+}
+
+// resizeGame changes Min and Max of a game's pool until the next restart
+func (a *ApiService) resizeGame(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req ResizeRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	if err := sessionManager.Resize(c.Request.Context(), *req.Min, *req.Max); err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	poolStatus, err := sessionManager.PoolStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    poolStatus,
+	})
+}
+
+func (a *ApiService) setGamePaused(c *gin.Context, paused bool) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	var err error
+	if paused {
+		err = sessionManager.Pause(c.Request.Context())
+	} else {
+		err = sessionManager.Resume(c.Request.Context())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	poolStatus, err := sessionManager.PoolStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    poolStatus,
+	})
+}
+
+// Start starts the API service
+func (a *ApiService) Start() error {
+
+	go func() {
+		if err := a.ginServer.Start(); err != nil {
+			logger.GetLogger("apiService").Errorf("failed to start gin server: %v", err)
+		}
+	}()
+	return nil
+}
+
+// StopGracefully stops the API service gracefully
+func (a *ApiService) StopGracefully(wait time.Duration) error {
+	logger.GetLogger("apiService").Info("stop api service")
+
+	// Cancel context to signal shutdown
+	if a.cancel != nil {
+		a.cancel()
+	}
+
+	// Stop gin server
+	return a.ginServer.Stop(wait)
+}
+
+// acquireColdSession 获取 cold session
+func (a *ApiService) acquireColdSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req AcquireRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: "invalid request body",
+			Data:    nil,
+		})
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	session, err := sessionManager.AcquireCold(c.Request.Context(),
+		session.WithMetadata(req.Metadata),
+		session.WithIdempotencyKey(c.GetHeader(IdempotencyKeyHeader)),
+		session.WithAPIKey(c.GetHeader(APIKeyHeader)),
+		session.WithProfile(req.Profile),
+		session.WithWarmOwner(req.WarmWorker),
+	)
+	if err != nil {
+		acquireFailed(c, err)
+		return
+	}
+
+	resp, err := a.sessionResponse(c.Request.Context(), a.joinerFor(gameInstance), sessionManager, session, c.GetHeader(IdempotencyKeyHeader) != "")
+	if err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+	resp.WarmToken = session.WarmToken
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    resp,
+	})
+}
+
+// setSessionWarmed 设置 session 为 warmed 状态
+func (a *ApiService) setSessionWarmed(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req SetWarmedRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	err := gameInstance.GetSessionManager().SetWarmed(c.Request.Context(), req.SessionID, req.WarmToken)
+	if err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    nil,
+	})
+}
+
+// abandonWarmingSession 放弃正在 warming 的 session, 退回 cold 状态
+func (a *ApiService) abandonWarmingSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req AbandonWarmingRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	if err := gameInstance.GetSessionManager().AbandonWarming(c.Request.Context(), req.SessionID, req.WarmToken); err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    nil,
+	})
+}
+
+// acquireWarmedSession 获取 warmed session
+func (a *ApiService) acquireWarmedSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req AcquireRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, CommonResponse{
+			Code:    400,
+			Message: "invalid request body",
+			Data:    nil,
+		})
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	opts := []session.AcquireOption{
+		session.WithMetadata(req.Metadata),
+		session.WithIdempotencyKey(c.GetHeader(IdempotencyKeyHeader)),
+		session.WithAPIKey(c.GetHeader(APIKeyHeader)),
+	}
+	var acquired *session.Session
+	var err error
+	if req.SessionID != "" {
+		acquired, err = sessionManager.AcquireSpecific(c.Request.Context(), req.SessionID, opts...)
+	} else {
+		acquired, err = sessionManager.AcquireWarmed(c.Request.Context(), append(opts, session.WithProfile(req.Profile))...)
+	}
+	if err != nil {
+		acquireFailed(c, err)
+		return
+	}
+
+	resp, err := a.sessionResponse(c.Request.Context(), a.joinerFor(gameInstance), sessionManager, acquired, c.GetHeader(IdempotencyKeyHeader) != "")
+	if err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    resp,
+	})
+}
+
+// releaseSession 删除 session
+func (a *ApiService) releaseSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req ReleaseRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	err := gameInstance.GetSessionManager().Release(c.Request.Context(), req.SessionID, session.ReleaseClient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CommonResponse{
+			Code:    500,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    nil,
+	})
+}
+
+// heartbeatSession keeps an in-use session alive and tells the client when it is about to end
+func (a *ApiService) heartbeatSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req HeartbeatRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	if err := sessionManager.Heartbeat(c.Request.Context(), req.SessionID); err != nil {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	session, err := sessionManager.GetSession(c.Request.Context(), req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	resp := HeartbeatResponse{
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if !session.EndingAt.IsZero() {
+		resp.Draining = true
+		resp.EndingIn = int(time.Until(session.EndingAt).Round(time.Second).Seconds())
+		if resp.EndingIn < 0 {
+			resp.EndingIn = 0
+		}
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    resp,
+	})
+}
+
+// extendSession gives an in-use session more time, up to the game's max_in_use_duration
+func (a *ApiService) extendSession(c *gin.Context) {
+	gameInstance, ok := a.gameInstance(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: "game not found",
+			Data:    nil,
+		})
+		return
+	}
+	if !gameRunning(c, gameInstance) {
+		return
+	}
+
+	var req ExtendRequest
+	if !bindRequest(c, &req) {
+		return
+	}
+
+	sessionManager := gameInstance.GetSessionManager()
+	if err := sessionManager.Extend(c.Request.Context(), req.SessionID, time.Duration(req.Seconds)*time.Second); err != nil {
+		status := errorStatus(err)
+		c.JSON(status, CommonResponse{
+			Code:    status,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	session, err := sessionManager.GetSession(c.Request.Context(), req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, CommonResponse{
+			Code:    404,
+			Message: err.Error(),
+			Data:    nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CommonResponse{
+		Code:    ErrNot,
+		Message: "success",
+		Data:    ExtendResponse{SessionID: session.ID, ExpiresAt: session.ExpiresAt},
+	})
+}
+
+// acquireFailed writes the error of an acquire, when the pool is empty with a Retry-After header and an estimate
+// of when a session will likely be available
+func acquireFailed(c *gin.Context, err error) {
+	status := errorStatus(err)
+	resp := CommonResponse{
+		Code:    status,
+		Message: err.Error(),
+		Data:    nil,
+	}
+	var empty *session.PoolEmptyError
+	if errors.As(err, &empty) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(empty.RetryAfter.Seconds()))))
+		resp.Data = PoolEmptyResponse{
+			RetryAfterMs: empty.RetryAfter.Milliseconds(),
+			AvailableAt:  empty.AvailableAt,
+			Warming:      empty.Warming,
+			Booting:      empty.Booting,
+		}
+	}
+	c.JSON(status, resp)
+}
+
+// joinerFor returns the client of the farm gameInstance runs on, the default client without one
+func (a *ApiService) joinerFor(gameInstance *game.GameInstance) sessionJoiner {
+	if client := gameInstance.GetAnboxClient(); client != nil {
+		return client
+	}
+	return a.anboxClient
+}
+
+// sessionResponse joins an acquired session through joiner to get credentials scoped to it.
+// If the gateway refuses, the session is released rather than handed out without a way to connect.
+// retryable tells that the acquire carried an idempotency key, so a client retrying it gets the same session back.
+func (a *ApiService) sessionResponse(ctx context.Context, joiner sessionJoiner, sessionManager session.Manager, s *session.Session, retryable bool) (SessionResponse, error) {
+	anboxID := s.ID
+	if s.Anbox != nil {
+		anboxID = s.Anbox.ID
+	}
+
+	join, err := joiner.Join(ctx, anboxID)
+	if err != nil {
+		// After a hiccup a client retrying with its idempotency key gets the session again, so it is kept.
+		// Without a key a retry would take another session and this one would leak until its heartbeat times out.
+		var apiErr *anbox.APIError
+		transient := !errors.As(err, &apiErr) || !apiErr.Permanent()
+		if !transient || !retryable {
+			if releaseErr := sessionManager.Release(context.Background(), s.ID, session.ReleaseErrored); releaseErr != nil {
+				logger.GetLogger("apiService").Errorf("failed to release session %s after join failed: %v", s.ID, releaseErr)
+			}
+		}
+		if transient {
+			return SessionResponse{}, fmt.Errorf("failed to join session %s: %w: %w", s.ID, anbox.ErrUpstreamUnavailable, err)
+		}
+		return SessionResponse{}, fmt.Errorf("failed to join session %s: %w", s.ID, err)
+	}
+
+	resp := NewSessionResponse(s, join)
+	hint := sessionManager.ConnectHint(s)
+	resp.ConnectRetryAfterMs = hint.RetryAfter.Milliseconds()
+	resp.FreshlyReady = hint.Fresh
+	policy := sessionManager.HeartbeatPolicy()
+	resp.Heartbeat = &HeartbeatCapability{
+		Transports: []string{HeartbeatTransportHTTP},
+		IntervalMs: policy.Interval.Milliseconds(),
+		TimeoutMs:  policy.Timeout.Milliseconds(),
+	}
+	return resp, nil
+}
+
+// gameRunning writes a 503 and returns false when the game cannot serve sessions, e.g. it is still warming up or degraded
+func gameRunning(c *gin.Context, gameInstance *game.GameInstance) bool {
+	if gameInstance.IsRunning() {
+		return true
+	}
+
+	message := "game is not running"
+	if gameInstance.IsDegraded() {
+		message = "game is degraded: " + gameInstance.Failure().Error()
+	} else if !gameInstance.IsInitialized() {
+		message = "game is warming up"
+	}
+	c.JSON(http.StatusServiceUnavailable, CommonResponse{
+		Code:    503,
+		Message: message,
+		Data:    nil,
+	})
+	return false
+}
+
+// auditActor attributes the session transitions of a request to the caller's API key in the audit log
+func auditActor(c *gin.Context) {
+	actor := c.GetHeader(APIKeyHeader)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	c.Request = c.Request.WithContext(session.WithActor(c.Request.Context(), actor))
+	c.Next()
+}
+
+// bindOptionalJSON binds the request body into obj, treating an empty body as no fields set
+func bindOptionalJSON(c *gin.Context, obj any) error {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// errorStatus maps a session manager error to an HTTP status code
+func errorStatus(err error) int {
+	if errors.Is(err, session.ErrInvalidMetadata) || errors.Is(err, session.ErrUnknownProfile) || errors.Is(err, session.ErrInvalidResize) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, session.ErrQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, session.ErrInvalidWarmToken) || errors.Is(err, session.ErrNotSessionOwner) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, session.ErrSessionNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, session.ErrInvalidState) || errors.Is(err, session.ErrExtensionLimit) || errors.Is(err, session.ErrIdempotencyConflict) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, session.ErrWarmupFailed) {
+		return http.StatusBadGateway
+	}
+	if errors.Is(err, anbox.ErrUpstreamUnavailable) || errors.Is(err, session.ErrDraining) || errors.Is(err, session.ErrPaused) || errors.Is(err, session.ErrPoolEmpty) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
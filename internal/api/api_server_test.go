@@ -0,0 +1,938 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/game"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+func newTestGameManager(t testing.TB, gameConfigs []*game.GameConfig, anboxClient session.AnboxClient) *game.Manager {
+	t.Helper()
+	gameManager, err := game.NewManager(game.ManagerConfig{}, gameConfigs, anboxClient)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return gameManager
+}
+
+// fakeAnboxClient joins sessions with a token scoped to the session ID
+type fakeAnboxClient struct {
+	joinErr error
+	joined  []string
+}
+
+func (f *fakeAnboxClient) ListApps(ctx context.Context) ([]anbox.AppSummary, error) {
+	return nil, nil
+}
+
+func (f *fakeAnboxClient) Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error) {
+	f.joined = append(f.joined, sessionID)
+	if f.joinErr != nil {
+		return nil, f.joinErr
+	}
+	return &anbox.JoinSessionDetails{SignalingURL: "wss://gateway.example.com/" + sessionID + "?token=scoped-" + sessionID}, nil
+}
+
+func (f *fakeAnboxClient) BreakerState() anbox.BreakerState {
+	return anbox.BreakerClosed
+}
+
+func (f *fakeAnboxClient) BreakerTrips() int64 {
+	return 0
+}
+
+// fakeSessionManager records releases and gives a fixed connect hint, other methods are not used by these tests
+type fakeSessionManager struct {
+	session.Manager
+	released []string // session ID:release reason
+}
+
+func (f *fakeSessionManager) ConnectHint(s *session.Session) session.ConnectHint {
+	return session.ConnectHint{RetryAfter: 1500 * time.Millisecond, Fresh: true}
+}
+
+func (f *fakeSessionManager) HeartbeatPolicy() session.HeartbeatPolicy {
+	return session.HeartbeatPolicy{Interval: 10 * time.Second, Timeout: 30 * time.Second}
+}
+
+func (f *fakeSessionManager) Release(ctx context.Context, id string, reason session.ReleaseReason) error {
+	f.released = append(f.released, id+":"+string(reason))
+	return nil
+}
+
+func TestSessionResponse_UsesScopedToken(t *testing.T) {
+	anboxClient := &fakeAnboxClient{}
+	api := &ApiService{anboxClient: anboxClient}
+	s := &session.Session{
+		ID:        "session-1",
+		Status:    session.InUse,
+		AuthToken: "pool-wide-secret-token",
+		Anbox:     &anbox.SessionDetails{ID: "anbox-1"},
+	}
+
+	resp, err := api.sessionResponse(context.Background(), anboxClient, &fakeSessionManager{}, s, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(anboxClient.joined) != 1 || anboxClient.joined[0] != "anbox-1" {
+		t.Errorf("Expected anbox session anbox-1 to be joined, got %v", anboxClient.joined)
+	}
+	if resp.SignalingURL != "wss://gateway.example.com/anbox-1?token=scoped-anbox-1" {
+		t.Errorf("Expected scoped signaling URL, got %s", resp.SignalingURL)
+	}
+	if resp.ConnectRetryAfterMs != 1500 || !resp.FreshlyReady {
+		t.Errorf("Expected the connect hint of the session manager, got %dms fresh=%v", resp.ConnectRetryAfterMs, resp.FreshlyReady)
+	}
+	if hb := resp.Heartbeat; hb == nil || len(hb.Transports) != 1 || hb.Transports[0] != HeartbeatTransportHTTP || hb.IntervalMs != 10000 || hb.TimeoutMs != 30000 {
+		t.Errorf("Expected the http heartbeat every 10s with a 30s timeout, got %+v", resp.Heartbeat)
+	}
+}
+
+func TestSessionResponse_ReleasesOnJoinFailure(t *testing.T) {
+	anboxClient := &fakeAnboxClient{joinErr: &anbox.APIError{StatusCode: 404, Category: anbox.ErrorCategoryNotFound}}
+	api := &ApiService{anboxClient: anboxClient}
+	sessionManager := &fakeSessionManager{}
+	s := &session.Session{ID: "session-1", Status: session.Warming}
+
+	_, err := api.sessionResponse(context.Background(), anboxClient, sessionManager, s, true)
+	if err == nil {
+		t.Fatalf("Expected an error when the join fails")
+	}
+	if errorStatus(err) != http.StatusInternalServerError {
+		t.Errorf("Expected a permanent join failure to answer 500, got %d", errorStatus(err))
+	}
+	if len(sessionManager.released) != 1 || sessionManager.released[0] != "session-1:errored" {
+		t.Errorf("Expected session-1 to be released as errored, got %v", sessionManager.released)
+	}
+
+	// A transient failure answers 503, it keeps the session only for an acquire the client can retry with its idempotency key
+	for _, joinErr := range []error{errors.New("connection reset"), &anbox.APIError{StatusCode: 502, Category: anbox.ErrorCategoryServer}} {
+		anboxClient.joinErr = joinErr
+		for _, retryable := range []bool{true, false} {
+			sessionManager.released = nil
+			_, err := api.sessionResponse(context.Background(), anboxClient, sessionManager, s, retryable)
+			if errorStatus(err) != http.StatusServiceUnavailable {
+				t.Errorf("%v: expected 503, got %d", joinErr, errorStatus(err))
+			}
+			if retryable && len(sessionManager.released) != 0 {
+				t.Errorf("%v: expected the session to be kept for a retry with the idempotency key, got %v", joinErr, sessionManager.released)
+			}
+			if !retryable && (len(sessionManager.released) != 1 || sessionManager.released[0] != "session-1:errored") {
+				t.Errorf("%v: expected the session to be released without an idempotency key, got %v", joinErr, sessionManager.released)
+			}
+		}
+	}
+}
+
+func init() {
+	detector.RegisterMethod("api-test-match", detector.MethodFunc(func(ctx context.Context, stage *detector.Stage, frame detector.Frame) (bool, string, error) {
+		return true, "matched", nil
+	}))
+}
+
+// testFrame returns a small PNG frame
+func testFrame(t testing.TB) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func detect(t *testing.T, query string) DetectStageResponse {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name:   "test-game",
+		Stages: []*detector.Stage{{Number: 1, Reco: detector.Reco{Method: "api-test-match"}}},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.POST("/:game/detect", api.detectStage)
+
+	body, _ := json.Marshal(DetectStageRequest{CurrentStageNum: 1, Image: base64.StdEncoding.EncodeToString(testFrame(t))})
+	req := httptest.NewRequest(http.MethodPost, "/test-game/detect"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data DetectStageResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Data
+}
+
+func TestDetectStage_ReturnCrop(t *testing.T) {
+	resp := detect(t, "")
+	if !resp.Match || resp.Evidence != "api-test-match: matched" {
+		t.Errorf("Expected a match, got %+v", resp)
+	}
+	if resp.Crop != "" {
+		t.Errorf("Expected no crop by default, got %q", resp.Crop)
+	}
+
+	resp = detect(t, "?return_crop=true")
+	crop, err := base64.StdEncoding.DecodeString(resp.Crop)
+	if err != nil {
+		t.Fatalf("Expected a base64 crop, got %v", err)
+	}
+	if !bytes.Equal(crop, testFrame(t)) {
+		t.Errorf("Expected the frame the detector used, got %d bytes", len(crop))
+	}
+}
+
+func TestHandlers_UninitializedGameReturns503(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+	api := &ApiService{gameManager: gameManager, anboxClient: &fakeAnboxClient{}}
+
+	// No recovery middleware, a nil session manager dereference would panic the test
+	engine := gin.New()
+	engine.GET("/readyz", api.readyz)
+	engine.GET("/:game/sessions", api.getGameInstanceSessions)
+	engine.GET("/:game/stats", api.getGameInstanceStats)
+	engine.POST("/:game/acquire_cold", api.acquireColdSession)
+	engine.POST("/:game/acquire_warmed", api.acquireWarmedSession)
+	engine.POST("/:game/heartbeat", api.heartbeatSession)
+	engine.GET("/:game/sessions/:id/connect", api.getSessionConnection)
+	engine.POST("/:game/sessions/:id/reconnect", api.reconnectSession)
+	engine.POST("/:game/pause", api.pauseGame)
+	engine.POST("/:game/resume", api.resumeGame)
+	engine.POST("/:game/resize", api.resizeGame)
+	engine.POST("/:game/extend", api.extendSession)
+
+	for _, tc := range []struct{ method, path, message string }{
+		{http.MethodGet, "/readyz", "warming up"},
+		{http.MethodGet, "/test-game/sessions", "game is warming up"},
+		{http.MethodGet, "/test-game/stats", "game is warming up"},
+		{http.MethodPost, "/test-game/acquire_cold", "game is warming up"},
+		{http.MethodPost, "/test-game/acquire_warmed", "game is warming up"},
+		{http.MethodPost, "/test-game/heartbeat", "game is warming up"},
+		{http.MethodGet, "/test-game/sessions/session-1/connect", "game is warming up"},
+		{http.MethodPost, "/test-game/sessions/session-1/reconnect", "game is warming up"},
+		{http.MethodPost, "/test-game/pause", "game is warming up"},
+		{http.MethodPost, "/test-game/resume", "game is warming up"},
+		{http.MethodPost, "/test-game/resize", "game is warming up"},
+		{http.MethodPost, "/test-game/extend", "game is warming up"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader([]byte(`{"session_id":"session-1"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503, got %d", tc.method, tc.path, rec.Code)
+			continue
+		}
+		var resp CommonResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", tc.method, tc.path, err)
+		}
+		if resp.Message != tc.message {
+			t.Errorf("%s %s: expected message %q, got %q", tc.method, tc.path, tc.message, resp.Message)
+		}
+	}
+}
+
+// breakerAnboxClient is a farm client whose breaker is in state after opening trips times
+type breakerAnboxClient struct {
+	*specAnboxClient
+	state anbox.BreakerState
+	trips int64
+}
+
+func (f *breakerAnboxClient) BreakerState() anbox.BreakerState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+func (f *breakerAnboxClient) BreakerTrips() int64 {
+	return f.trips
+}
+
+func (f *breakerAnboxClient) setState(state anbox.BreakerState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = state
+}
+
+// startFarmGame runs test-game on the eu farm, the anbox block serves no game
+func startFarmGame(t *testing.T, defaultClient, euClient *breakerAnboxClient) *game.Manager {
+	t.Helper()
+	gameManager, err := game.NewManager(game.ManagerConfig{}, []*game.GameConfig{{
+		Name:          "test-game",
+		Farm:          "eu",
+		SessionConfig: &game.SessionConfig{Max: 4, SessionTTL: 10 * time.Minute},
+	}}, defaultClient, game.WithFarms(map[string]session.AnboxClient{"eu": euClient}))
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := gameManager.Init(ctx); err != nil {
+		t.Fatalf("Failed to init games: %v", err)
+	}
+	if err := gameManager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start games: %v", err)
+	}
+	t.Cleanup(func() { gameManager.Stop(context.Background()) })
+	return gameManager
+}
+
+func TestReadyz_FarmBreakers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultClient := &breakerAnboxClient{specAnboxClient: &specAnboxClient{}, state: anbox.BreakerOpen}
+	euClient := &breakerAnboxClient{specAnboxClient: &specAnboxClient{}, state: anbox.BreakerClosed}
+	api := &ApiService{gameManager: startFarmGame(t, defaultClient, euClient), anboxClient: defaultClient}
+	engine := gin.New()
+	engine.GET("/readyz", api.readyz)
+
+	readyz := func() (int, ReadyzResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp struct {
+			Data ReadyzResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec.Code, resp.Data
+	}
+
+	// The open breaker of the anbox block does not matter, no game runs on it
+	code, status := readyz()
+	if code != http.StatusOK || !status.Ready {
+		t.Errorf("Expected to be ready with only an unused farm tripped, got %d %+v", code, status)
+	}
+	if status.FarmBreakers["default"] != "open" || status.FarmBreakers["eu"] != "closed" {
+		t.Errorf("Expected the breaker of every farm, got %v", status.FarmBreakers)
+	}
+
+	euClient.setState(anbox.BreakerOpen)
+	if code, status := readyz(); code != http.StatusServiceUnavailable || status.Ready {
+		t.Errorf("Expected not to be ready with the farm of a running game tripped, got %d %+v", code, status)
+	}
+}
+
+func TestMetrics_Breaker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultClient := &breakerAnboxClient{specAnboxClient: &specAnboxClient{}, state: anbox.BreakerClosed}
+	euClient := &breakerAnboxClient{specAnboxClient: &specAnboxClient{}, state: anbox.BreakerOpen, trips: 3}
+	gameManager, err := game.NewManager(game.ManagerConfig{}, []*game.GameConfig{{Name: "test-game", Farm: "eu"}},
+		defaultClient, game.WithFarms(map[string]session.AnboxClient{"eu": euClient}))
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	api := &ApiService{gameManager: gameManager, anboxClient: defaultClient}
+	engine := gin.New()
+	engine.GET("/metrics", api.metrics)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != metricsContentType {
+		t.Errorf("Expected the Prometheus text format, got %s", rec.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`playable_anbox_breaker_state{farm="default",state="closed"} 1`,
+		`playable_anbox_breaker_state{farm="default",state="open"} 0`,
+		`playable_anbox_breaker_state{farm="eu",state="open"} 1`,
+		`playable_anbox_breaker_trips_total{farm="default"} 0`,
+		`playable_anbox_breaker_trips_total{farm="eu"} 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("Expected metric line %q in:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestMetrics_PoolSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	api := &ApiService{gameManager: startSpecGame(t, &specAnboxClient{}), anboxClient: &fakeAnboxClient{}}
+	engine := gin.New()
+	engine.GET("/metrics", api.metrics)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{
+		"# TYPE playable_pool_sessions gauge",
+		`playable_pool_sessions{state="cold"} 1`,
+		`playable_pool_sessions{state="warming"} 0`,
+		`playable_pool_sessions{state="warmed"} 0`,
+		`playable_pool_sessions{state="in_use"} 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("Expected metric line %q in:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestRegisterGameRoutes_DefaultGame(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+	api := &ApiService{config: ApiServiceConfig{DefaultGame: "test-game"}, gameManager: gameManager, anboxClient: &fakeAnboxClient{}}
+
+	engine := gin.New()
+	v1 := engine.Group("/api/v1")
+	api.registerGameRoutes(v1.Group("/games"), "/:game")
+	api.registerGameRoutes(v1, "")
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/acquire_cold", http.StatusServiceUnavailable},
+		{"/api/v1/games/test-game/acquire_cold", http.StatusServiceUnavailable},
+		{"/api/v1/games/other-game/acquire_cold", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code {
+			t.Errorf("POST %s: expected %d, got %d: %s", tc.path, tc.code, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestListAllSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.GET("/sessions", api.listAllSessions)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusOK},
+		{"?game=test-game&status=in_use&offset=0&limit=50", http.StatusOK},
+		{"?status=sleeping", http.StatusBadRequest},
+		{"?offset=-1", http.StatusBadRequest},
+		{"?limit=many", http.StatusBadRequest},
+		{"?game=other-game", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("GET /sessions%s: expected %d, got %d: %s", tc.query, tc.code, rec.Code, rec.Body.String())
+		}
+	}
+
+	// A game that is still warming up has no sessions yet
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions?limit=50", nil))
+	var resp struct {
+		Data SessionListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Sessions == nil || len(resp.Data.Sessions) != 0 || resp.Data.Total != 0 || resp.Data.Limit != 50 {
+		t.Errorf("Expected an empty page with limit 50, got %+v", resp.Data)
+	}
+}
+
+func TestListAllSessions_IncludesMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := startSpecGame(t, &specAnboxClient{})
+	instance, _ := gameManager.GetGameInstance(context.Background(), "test-game")
+	if err := instance.GetSessionManager().SetMetadata(context.Background(), "session-1", map[string]string{"player": "p-7"}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.GET("/sessions", api.listAllSessions)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions", nil))
+	var resp struct {
+		Data SessionListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data.Sessions) != 1 || resp.Data.Sessions[0].Metadata["player"] != "p-7" {
+		t.Errorf("Expected the listed session to carry its metadata, got %+v", resp.Data.Sessions)
+	}
+}
+
+func TestInit_DefaultGame(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+	config := NewApiServiceConfig()
+	config.DefaultGame = "test-game"
+	api := NewApiService(config, gameManager, &fakeAnboxClient{})
+
+	// The aliases must not clash with the routes outside any game
+	if err := api.Init(); err != nil {
+		t.Fatalf("Failed to init with a default game: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	api.ginServer.GinEngine().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil))
+	var resp struct {
+		Data SessionListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.Data.Sessions == nil {
+		t.Errorf("Expected /sessions to list the sessions of every game, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestInit_UnknownDefaultGame(t *testing.T) {
+	gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+	config := NewApiServiceConfig()
+	config.DefaultGame = "missing-game"
+	api := NewApiService(config, gameManager, &fakeAnboxClient{})
+
+	if err := api.Init(); err == nil || err.Error() != `default game "missing-game" is not configured` {
+		t.Errorf("Expected an error for a default game that is not configured, got %v", err)
+	}
+}
+
+func TestDebugHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := startSpecGame(t, &specAnboxClient{})
+	get := func(debug bool) *httptest.ResponseRecorder {
+		config := NewApiServiceConfig()
+		config.Debug = debug
+		api := NewApiService(config, gameManager, &fakeAnboxClient{})
+		if err := api.Init(); err != nil {
+			t.Fatalf("Failed to init: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		api.ginServer.GinEngine().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/debug/health", nil))
+		return rec
+	}
+
+	if rec := get(false); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected no debug endpoint without debug, got %d", rec.Code)
+	}
+
+	rec := get(true)
+	var resp struct {
+		Data DebugHealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected the debug health, got %d: %s", rec.Code, rec.Body.String())
+	}
+	health := resp.Data.Games["test-game"]
+	if resp.Data.Goroutines == 0 || health == nil || !health.SyncAlive || health.SyncStale {
+		t.Errorf("Expected a live sync loop for test-game, got %s", rec.Body.String())
+	}
+}
+
+func TestAdminRoutes_RequireToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := startSpecGame(t, &specAnboxClient{})
+	pause := func(adminToken, token string) *httptest.ResponseRecorder {
+		config := NewApiServiceConfig()
+		config.AdminToken = adminToken
+		api := NewApiService(config, gameManager, &fakeAnboxClient{})
+		if err := api.Init(); err != nil {
+			t.Fatalf("Failed to init: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/games/test-game/pause", nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		api.ginServer.GinEngine().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := pause("", "admin-secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected no admin endpoints without an admin token, got %d", rec.Code)
+	}
+	if rec := pause("admin-secret", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 without the admin token, got %d", rec.Code)
+	}
+	if rec := pause("admin-secret", "guess"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 for a wrong admin token, got %d", rec.Code)
+	}
+	if rec := pause("admin-secret", "admin-secret"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the pause with the admin token, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDetectStage_UnknownStageIs400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name: "test-game",
+		Stages: []*detector.Stage{
+			{Number: 2, Reco: detector.Reco{Method: "api-test-match"}},
+			{Number: 1, Reco: detector.Reco{Method: "api-test-match"}},
+		},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.POST("/:game/detect", api.detectStage)
+
+	body, _ := json.Marshal(DetectStageRequest{CurrentStageNum: 7, Image: base64.StdEncoding.EncodeToString([]byte("frame-bytes"))})
+	req := httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an unknown stage, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Message string               `json:"message"`
+		Data    UnknownStageResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Message != "unknown stage 7" {
+		t.Errorf("Expected message %q, got %q", "unknown stage 7", resp.Message)
+	}
+	if len(resp.Data.ValidStages) != 2 || resp.Data.ValidStages[0] != 1 || resp.Data.ValidStages[1] != 2 {
+		t.Errorf("Expected valid stages [1 2], got %v", resp.Data.ValidStages)
+	}
+}
+
+func TestDetectStage_ClientStages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name: "test-game",
+		Stages: []*detector.Stage{
+			{Number: 1, Reco: detector.Reco{Method: "api-test-match"}},
+			{Number: 2, Reco: detector.Reco{Method: "api-test-match"}},
+			{Number: 3, Reco: detector.Reco{Method: "api-test-match"}},
+		},
+		ClientStages: []int{3, 1},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.POST("/:game/detect", api.detectStage)
+
+	tests := []struct {
+		stage   int
+		code    int
+		message string
+	}{
+		{stage: 1, code: http.StatusOK},
+		{stage: 3, code: http.StatusOK},
+		{stage: 2, code: http.StatusBadRequest, message: "stage 2 cannot be detected by clients"},
+		{stage: 7, code: http.StatusBadRequest, message: "unknown stage 7"},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(DetectStageRequest{CurrentStageNum: tt.stage, Image: base64.StdEncoding.EncodeToString(testFrame(t))})
+		req := httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("stage %d: expected status %d, got %d: %s", tt.stage, tt.code, rec.Code, rec.Body.String())
+			continue
+		}
+		if tt.code == http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Message string               `json:"message"`
+			Data    UnknownStageResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Message != tt.message {
+			t.Errorf("stage %d: expected message %q, got %q", tt.stage, tt.message, resp.Message)
+		}
+		if len(resp.Data.ValidStages) != 2 || resp.Data.ValidStages[0] != 1 || resp.Data.ValidStages[1] != 3 {
+			t.Errorf("stage %d: expected valid stages [1 3], got %v", tt.stage, resp.Data.ValidStages)
+		}
+	}
+}
+
+func TestReconnectSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	anboxClient := &specAnboxClient{}
+	api := &ApiService{gameManager: startSpecGame(t, anboxClient), anboxClient: anboxClient}
+	engine := gin.New()
+	engine.POST("/:game/acquire_cold", api.acquireColdSession)
+	engine.POST("/:game/set_warmed", api.setSessionWarmed)
+	engine.POST("/:game/acquire_warmed", api.acquireWarmedSession)
+	engine.POST("/:game/release", api.releaseSession)
+	engine.POST("/:game/sessions/:id/reconnect", api.reconnectSession)
+	engine.GET("/:game/sessions/:id/connect", api.getSessionConnection)
+
+	request := func(method, apiKey, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var encoded []byte
+		if body != nil {
+			encoded, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, "/test-game/"+path, bytes.NewReader(encoded))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return request(http.MethodPost, "", path, body)
+	}
+
+	// A cold session cannot be reconnected to
+	rec := post("acquire_cold", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to acquire cold: %d %s", rec.Code, rec.Body.String())
+	}
+	var acquired struct {
+		Data SessionResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &acquired); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec := post("sessions/session-1/reconnect", nil); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a warming session, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("acquire_warmed", AcquireRequest{SessionID: "session-1"}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 acquiring a warming session by ID, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("set_warmed", SetWarmedRequest{SessionID: "session-1", WarmToken: "someone-else"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another caller's warm token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("set_warmed", SetWarmedRequest{SessionID: "session-1", WarmToken: acquired.Data.WarmToken}); rec.Code != http.StatusOK {
+		t.Fatalf("Failed to set warmed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("acquire_warmed", AcquireRequest{SessionID: "session-2"}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 acquiring an unknown session by ID, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := request(http.MethodPost, "partner-a", "acquire_warmed", AcquireRequest{SessionID: "session-1"}); rec.Code != http.StatusOK {
+		t.Fatalf("Failed to acquire warmed session-1: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Only the acquiring API key gets the join token
+	for _, key := range []string{"", "partner-b"} {
+		if rec := request(http.MethodPost, key, "sessions/session-1/reconnect", nil); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 reconnecting with key %q, got %d: %s", key, rec.Code, rec.Body.String())
+		}
+		if rec := request(http.MethodGet, key, "sessions/session-1/connect", nil); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 connecting with key %q, got %d: %s", key, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := request(http.MethodGet, "partner-a", "sessions/session-1/connect", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the acquiring key to connect, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = request(http.MethodPost, "partner-a", "sessions/session-1/reconnect", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected reconnect to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data session.ConnectionInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.SessionID != "session-1" || resp.Data.GatewayURL == "" || resp.Data.ExpiresAt.IsZero() {
+		t.Errorf("Expected fresh connection info of session-1, got %+v", resp.Data)
+	}
+
+	// Once released the session is gone
+	post("release", ReleaseRequest{SessionID: "session-1"})
+	if rec := post("sessions/session-1/reconnect", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a released session, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlers_InvalidBodiesListFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	anboxClient := &specAnboxClient{}
+	api := &ApiService{gameManager: startSpecGame(t, anboxClient), anboxClient: anboxClient}
+	engine := gin.New()
+	engine.POST("/:game/set_warmed", api.setSessionWarmed)
+	engine.POST("/:game/release", api.releaseSession)
+	engine.POST("/:game/detect", api.detectStage)
+	engine.POST("/:game/extend", api.extendSession)
+	engine.POST("/:game/resize", api.resizeGame)
+
+	for _, tc := range []struct {
+		path, body string
+		fields     []FieldError
+	}{
+		{"set_warmed", "", []FieldError{{"session_id", "session_id is required"}, {"warm_token", "warm_token is required"}}},
+		{"release", "{}", []FieldError{{"session_id", "session_id is required"}}},
+		{"release", `{"session_id": 1}`, []FieldError{{"session_id", "session_id must be a string"}}},
+		{"detect", `{"currentStageNum": 1}`, []FieldError{{"image", "image is required"}}},
+		{"extend", "", []FieldError{{"session_id", "session_id is required"}, {"seconds", "seconds must be greater than 0"}}},
+		{"resize", `{"min": 1}`, []FieldError{{"max", "max is required"}}},
+		{"release", "{", []FieldError{{"", "body is not valid JSON"}}},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/test-game/"+tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %q: expected 400, got %d: %s", tc.path, tc.body, rec.Code, rec.Body.String())
+			continue
+		}
+		var resp struct {
+			Message string                 `json:"message"`
+			Data    InvalidRequestResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %q: failed to decode response: %v", tc.path, tc.body, err)
+		}
+		if !slices.Equal(resp.Data.Fields, tc.fields) {
+			t.Errorf("%s %q: expected fields %+v, got %+v (%s)", tc.path, tc.body, tc.fields, resp.Data.Fields, resp.Message)
+		}
+	}
+}
+
+func TestAcquire_PoolEmptyRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	anboxClient := &specAnboxClient{}
+	api := &ApiService{gameManager: startSpecGame(t, anboxClient), anboxClient: anboxClient}
+	engine := gin.New()
+	engine.POST("/:game/acquire_cold", api.acquireColdSession)
+	engine.POST("/:game/acquire_warmed", api.acquireWarmedSession)
+
+	acquire := func(path string, code int) (int, PoolEmptyResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/test-game/"+path, nil))
+		if rec.Code != code {
+			t.Fatalf("POST %s: expected %d, got %d: %s", path, code, rec.Code, rec.Body.String())
+		}
+		if code == http.StatusOK {
+			return 0, PoolEmptyResponse{}
+		}
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		if err != nil {
+			t.Fatalf("POST %s: expected a Retry-After header in seconds, got %q", path, rec.Header().Get("Retry-After"))
+		}
+		var resp struct {
+			Data PoolEmptyResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("POST %s: failed to decode response: %v", path, err)
+		}
+		if resp.Data.RetryAfterMs <= 0 || resp.Data.AvailableAt.IsZero() {
+			t.Errorf("POST %s: expected an availability estimate, got %+v", path, resp.Data)
+		}
+		return retryAfter, resp.Data
+	}
+
+	// session-1 is the only session and still cold, nothing is warming
+	idle, _ := acquire("acquire_warmed", http.StatusServiceUnavailable)
+	if idle != 30 {
+		t.Errorf("Expected the default 30s Retry-After with nothing warming, got %d", idle)
+	}
+
+	acquire("acquire_cold", http.StatusOK)
+	warming, data := acquire("acquire_warmed", http.StatusServiceUnavailable)
+	if warming >= idle || data.Warming != 1 {
+		t.Errorf("Expected a Retry-After shorter than %ds while session-1 warms, got %ds %+v", idle, warming, data)
+	}
+
+	if cold, _ := acquire("acquire_cold", http.StatusServiceUnavailable); cold != idle {
+		t.Errorf("Expected the default Retry-After for cold sessions with nothing booting, got %d", cold)
+	}
+}
+
+func TestGetGameInstance_RedactsSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name: "test-game",
+		SessionConfig: &game.SessionConfig{
+			StarvationWebhook: "https://hooks.example.com/starved?token=starvation-token",
+			GuaranteeWebhook:  "https://hooks.example.com/breach?token=guarantee-token",
+		},
+		Runtime: &game.Runtime{OverURL: "https://over.example.com", OverSecret: "over-secret"},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.GET("/:game", api.getGameInstance)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test-game", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, secret := range []string{"over-secret", "starvation-token", "guarantee-token"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("Expected %s to be redacted from %s", secret, rec.Body.String())
+		}
+	}
+	if !strings.Contains(rec.Body.String(), "https://over.example.com") {
+		t.Errorf("Expected the rest of the config to be served, got %s", rec.Body.String())
+	}
+}
+
+func TestAcquireCold_TransientJoinFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		idempotencyKey string
+		wantDeleted    bool
+	}{
+		{"with idempotency key", "acquire-1", false},
+		{"without idempotency key", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			anboxClient := &specAnboxClient{}
+			api := &ApiService{gameManager: startSpecGame(t, anboxClient), anboxClient: anboxClient}
+			engine := gin.New()
+			engine.POST("/:game/acquire_cold", api.acquireColdSession)
+
+			anboxClient.mu.Lock()
+			anboxClient.joinErr = errors.New("connection reset")
+			anboxClient.mu.Unlock()
+			req := httptest.NewRequest(http.MethodPost, "/test-game/acquire_cold", nil)
+			if tc.idempotencyKey != "" {
+				req.Header.Set(IdempotencyKeyHeader, tc.idempotencyKey)
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Expected 503 for a transient join failure, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// Only a client that can retry for the same session keeps it, otherwise it goes back to the farm
+			anboxClient.mu.Lock()
+			deleted := anboxClient.deleted
+			anboxClient.mu.Unlock()
+			if deleted != tc.wantDeleted {
+				t.Errorf("Expected the session deleted=%v, got %v", tc.wantDeleted, deleted)
+			}
+		})
+	}
+}
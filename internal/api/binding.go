@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError names a request field that is missing or invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InvalidRequestResponse is the data of a 400 answering a request body that failed validation
+type InvalidRequestResponse struct {
+	Fields []FieldError `json:"fields"`
+}
+
+// bindRequest binds the JSON body into obj and validates its binding tags. It answers 400 listing the
+// offending fields, or 413 for an oversized body, and returns false when the request was rejected.
+// An empty body is validated as an empty object, so it reports every required field.
+func bindRequest(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if errors.Is(err, io.EOF) {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err == nil {
+		return true
+	}
+	if isBodyTooLarge(err) {
+		abortBodyTooLarge(c)
+		return false
+	}
+	abortInvalidRequest(c, fieldErrors(obj, err))
+	return false
+}
+
+// abortInvalidRequest answers 400 listing the offending fields
+func abortInvalidRequest(c *gin.Context, fields []FieldError) {
+	message := "invalid request body"
+	if len(fields) > 0 {
+		messages := make([]string, len(fields))
+		for i, field := range fields {
+			messages[i] = field.Message
+		}
+		message += ": " + strings.Join(messages, ", ")
+	}
+	c.JSON(http.StatusBadRequest, CommonResponse{
+		Code:    400,
+		Message: message,
+		Data:    InvalidRequestResponse{Fields: fields},
+	})
+}
+
+// fieldErrors turns a binding error into the fields it is about, named as in the JSON body
+func fieldErrors(obj any, err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			name := jsonFieldName(obj, fe.StructField())
+			fields = append(fields, FieldError{Field: name, Message: validationMessage(name, fe)})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type)}}
+	}
+	return []FieldError{{Field: "", Message: "body is not valid JSON"}}
+}
+
+// validationMessage describes a failed binding tag in words
+func validationMessage(name string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return name + " is required"
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", name, fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s must be at least %s", name, fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", name, fe.Tag())
+	}
+}
+
+// jsonFieldName returns the JSON name of the struct field of obj, the Go name when it has no json tag
+func jsonFieldName(obj any, structField string) string {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	field, ok := t.FieldByName(structField)
+	if !ok {
+		return structField
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return structField
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultDetectMaxBodySize is the largest detect request body accepted, 8 MiB
+const DefaultDetectMaxBodySize = 8 << 20
+
+// maxBodySize caps the request body at limit bytes, counted after gzip decompression.
+// Requests that declare a larger Content-Length are rejected before reading anything.
+func maxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			abortBodyTooLarge(c)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the maxBodySize limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func abortBodyTooLarge(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, CommonResponse{
+		Code:    413,
+		Message: "request body too large",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/game"
+)
+
+func newBodyLimitTestEngine(t *testing.T, limit int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name:   "test-game",
+		Stages: []*detector.Stage{{Number: 1, Reco: detector.Reco{Method: "api-test-match"}}},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.Use(gzipMiddleware(DefaultGzipMinSize))
+	engine.POST("/:game/detect", maxBodySize(limit), api.detectStage)
+	return engine
+}
+
+func detectBody(t *testing.T, size int) []byte {
+	t.Helper()
+	body, err := json.Marshal(DetectStageRequest{CurrentStageNum: 1, Image: strings.Repeat("A", size)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestDetectStage_RejectsOversizedBody(t *testing.T) {
+	engine := newBodyLimitTestEngine(t, 1024)
+
+	req := httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(detectBody(t, 4096)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized body, got %d", rec.Code)
+	}
+
+	// A body without Content-Length is cut off while reading
+	req = httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(detectBody(t, 4096)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized chunked body, got %d", rec.Code)
+	}
+}
+
+func TestDetectStage_LimitsDecompressedBody(t *testing.T) {
+	engine := newBodyLimitTestEngine(t, 1024)
+
+	// Highly compressible, so the gzip body is far below the limit while the JSON is not
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(detectBody(t, 1<<20))
+	writer.Close()
+	if compressed.Len() >= 1024*10 {
+		t.Fatalf("Expected a small compressed body, got %d bytes", compressed.Len())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/test-game/detect", &compressed)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body that decompresses past the limit, got %d", rec.Code)
+	}
+}
+
+func TestDetectStage_AcceptsBodyUnderLimit(t *testing.T) {
+	engine := newBodyLimitTestEngine(t, DefaultDetectMaxBodySize)
+
+	body, _ := json.Marshal(DetectStageRequest{CurrentStageNum: 1, Image: base64.StdEncoding.EncodeToString(testFrame(t))})
+	req := httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a small body, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
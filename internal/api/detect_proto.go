@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtobufMIME is the content type of the protobuf detect messages defined in detect.proto
+const ProtobufMIME = binding.MIMEPROTOBUF
+
+// Field numbers of detect.proto, TestDetectProtoFieldNumbers checks them against the file
+const (
+	detectRequestStageField protowire.Number = 1
+	detectRequestImageField protowire.Number = 2
+
+	detectResponseMatchField    protowire.Number = 1
+	detectResponseStageField    protowire.Number = 2
+	detectResponseEvidenceField protowire.Number = 3
+	detectResponseCropField     protowire.Number = 4
+)
+
+// errInvalidProtobuf is returned for a body that is not a valid DetectStageRequest message
+var errInvalidProtobuf = errors.New("body is not valid protobuf")
+
+// bindDetectRequest binds a detect request encoded as JSON or, by its Content-Type, as protobuf.
+// It answers like bindRequest and returns false when the request was rejected.
+func bindDetectRequest(c *gin.Context, req *DetectStageRequest) bool {
+	if c.ContentType() != ProtobufMIME {
+		return bindRequest(c, req)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = req.unmarshalProto(body)
+	}
+	if err == nil && len(req.Frame) == 0 {
+		abortInvalidRequest(c, []FieldError{{Field: "image", Message: "image is required"}})
+		return false
+	}
+	if err == nil {
+		return true
+	}
+	if isBodyTooLarge(err) {
+		abortBodyTooLarge(c)
+		return false
+	}
+	if errors.Is(err, errInvalidProtobuf) {
+		abortInvalidRequest(c, []FieldError{{Field: "", Message: err.Error()}})
+		return false
+	}
+	abortInvalidRequest(c, fieldErrors(req, err))
+	return false
+}
+
+// wantsProtobuf reports whether the Accept header asks for protobuf rather than JSON, JSON is the default
+func wantsProtobuf(c *gin.Context) bool {
+	return c.NegotiateFormat(binding.MIMEJSON, ProtobufMIME) == ProtobufMIME
+}
+
+// unmarshalProto decodes a DetectStageRequest message into r, the image goes to Frame as sent
+func (r *DetectStageRequest) unmarshalProto(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", errInvalidProtobuf, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == detectRequestStageField && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			r.CurrentStageNum = int(int32(v))
+		case num == detectRequestImageField && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			r.Frame = v
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: field %d: %v", errInvalidProtobuf, num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// marshalProto encodes r as a DetectStageResponse message, crop is the raw region instead of the base64 Crop
+func (r *DetectStageResponse) marshalProto(crop []byte) []byte {
+	var b []byte
+	if r.Match {
+		b = protowire.AppendTag(b, detectResponseMatchField, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	if r.StageNum != 0 {
+		b = protowire.AppendTag(b, detectResponseStageField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(int32(r.StageNum))))
+	}
+	if r.Evidence != "" {
+		b = protowire.AppendTag(b, detectResponseEvidenceField, protowire.BytesType)
+		b = protowire.AppendString(b, r.Evidence)
+	}
+	if len(crop) > 0 {
+		b = protowire.AppendTag(b, detectResponseCropField, protowire.BytesType)
+		b = protowire.AppendBytes(b, crop)
+	}
+	return b
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/game"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func newDetectEngine(tb testing.TB) *gin.Engine {
+	tb.Helper()
+	gin.SetMode(gin.TestMode)
+	gameManager := newTestGameManager(tb, []*game.GameConfig{{
+		Name:   "test-game",
+		Stages: []*detector.Stage{{Number: 1, Reco: detector.Reco{Method: "api-test-match"}}},
+	}}, nil)
+	api := &ApiService{gameManager: gameManager}
+	engine := gin.New()
+	engine.POST("/:game/detect", api.detectStage)
+	return engine
+}
+
+// protoDetectRequest encodes a DetectStageRequest message of detect.proto
+func protoDetectRequest(stage int, image []byte) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, detectRequestStageField, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(stage))
+	if image != nil {
+		b = protowire.AppendTag(b, detectRequestImageField, protowire.BytesType)
+		b = protowire.AppendBytes(b, image)
+	}
+	return b
+}
+
+// decodeProtoDetectResponse decodes a DetectStageResponse message of detect.proto
+func decodeProtoDetectResponse(tb testing.TB, b []byte) (DetectStageResponse, []byte) {
+	tb.Helper()
+	var resp DetectStageResponse
+	var crop []byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			tb.Fatalf("Invalid protobuf response: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch num {
+		case detectResponseMatchField:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			resp.Match = v != 0
+		case detectResponseStageField:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			resp.StageNum = int(v)
+		case detectResponseEvidenceField:
+			resp.Evidence, n = protowire.ConsumeString(b)
+		case detectResponseCropField:
+			crop, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			tb.Fatalf("Invalid protobuf field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return resp, crop
+}
+
+func TestDetectStage_ContentNegotiation(t *testing.T) {
+	engine := newDetectEngine(t)
+	frame := testFrame(t)
+	jsonBody, _ := json.Marshal(DetectStageRequest{CurrentStageNum: 1, Image: base64.StdEncoding.EncodeToString(frame)})
+	protoBody := protoDetectRequest(1, frame)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		accept      string
+		wantProto   bool
+	}{
+		{"json", jsonBody, "application/json", "", false},
+		{"json any", jsonBody, "application/json", "*/*", false},
+		{"protobuf request json response", protoBody, ProtobufMIME, "", false},
+		{"protobuf", protoBody, ProtobufMIME, ProtobufMIME, true},
+		{"json request protobuf response", jsonBody, "application/json", ProtobufMIME + ", application/json;q=0.5", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/test-game/detect?return_crop=true", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.name, rec.Code, rec.Body.String())
+		}
+
+		var resp DetectStageResponse
+		var crop []byte
+		if tt.wantProto {
+			if got := rec.Header().Get("Content-Type"); got != ProtobufMIME {
+				t.Errorf("%s: expected a protobuf response, got %q", tt.name, got)
+			}
+			resp, crop = decodeProtoDetectResponse(t, rec.Body.Bytes())
+		} else {
+			var envelope struct {
+				Data DetectStageResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("%s: failed to decode JSON response: %v", tt.name, err)
+			}
+			resp = envelope.Data
+			crop, _ = base64.StdEncoding.DecodeString(resp.Crop)
+		}
+		if !resp.Match || resp.StageNum != 1 || resp.Evidence != "api-test-match: matched" {
+			t.Errorf("%s: expected a match of stage 1, got %+v", tt.name, resp)
+		}
+		if !bytes.Equal(crop, frame) {
+			t.Errorf("%s: expected the frame as crop, got %d bytes", tt.name, len(crop))
+		}
+	}
+}
+
+func TestDetectStage_InvalidProtobuf(t *testing.T) {
+	engine := newDetectEngine(t)
+	tests := []struct {
+		name    string
+		body    []byte
+		message string
+	}{
+		{"truncated", []byte{0x12, 0x05, 0x01}, "invalid request body: body is not valid protobuf: field 2: unexpected EOF"},
+		{"missing image", protoDetectRequest(1, nil), "invalid request body: image is required"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/test-game/detect", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", ProtobufMIME)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		var resp CommonResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.name, err)
+		}
+		if rec.Code != http.StatusBadRequest || resp.Message != tt.message {
+			t.Errorf("%s: expected 400 %q, got %d %q", tt.name, tt.message, rec.Code, resp.Message)
+		}
+	}
+}
+
+// imageChecker records what it was asked to detect on
+type imageChecker struct {
+	image  []byte
+	base64 string
+}
+
+func (c *imageChecker) Detect(ctx context.Context, game string, currentStageNum int, imgBase64 string) (bool, string, error) {
+	c.base64 = imgBase64
+	return true, "base64", nil
+}
+
+func (c *imageChecker) DetectImage(ctx context.Context, game string, currentStageNum int, image []byte) (*detector.Detection, error) {
+	c.image = image
+	return &detector.Detection{Match: true, Evidence: "image"}, nil
+}
+
+func TestRunDetection_ProtobufFrameStaysDecoded(t *testing.T) {
+	frame := []byte("\x89PNG frame")
+	checker := &imageChecker{}
+	detection, err := runDetection(context.Background(), checker, "test-game", &DetectStageRequest{CurrentStageNum: 1, Frame: frame}, false)
+	if err != nil || detection.Evidence != "image" {
+		t.Fatalf("Expected the frame to go to DetectImage, got %+v %v", detection, err)
+	}
+	if !bytes.Equal(checker.image, frame) || checker.base64 != "" {
+		t.Errorf("Expected the frame as sent without a base64 round-trip, got %q and %q", checker.image, checker.base64)
+	}
+
+	// JSON requests keep their base64 image
+	image := base64.StdEncoding.EncodeToString(frame)
+	if detection, err := runDetection(context.Background(), checker, "test-game", &DetectStageRequest{CurrentStageNum: 1, Image: image}, false); err != nil || detection.Evidence != "base64" || checker.base64 != image {
+		t.Errorf("Expected the base64 image to go to Detect, got %+v %v", detection, err)
+	}
+}
+
+// TestDetectProtoFieldNumbers keeps the hand-written field numbers in sync with detect.proto
+func TestDetectProtoFieldNumbers(t *testing.T) {
+	proto, err := os.ReadFile("detect.proto")
+	if err != nil {
+		t.Fatalf("Failed to read detect.proto: %v", err)
+	}
+	fields := make(map[string]protowire.Number)
+	message := regexp.MustCompile(`(?s)message (\w+) \{(.*?)\n\}`)
+	field := regexp.MustCompile(`(?m)^\s*\w+ (\w+) = (\d+);`)
+	for _, m := range message.FindAllStringSubmatch(string(proto), -1) {
+		for _, f := range field.FindAllStringSubmatch(m[2], -1) {
+			num, _ := strconv.Atoi(f[2])
+			fields[m[1]+"."+f[1]] = protowire.Number(num)
+		}
+	}
+
+	want := map[string]protowire.Number{
+		"DetectStageRequest.current_stage_num": detectRequestStageField,
+		"DetectStageRequest.image":             detectRequestImageField,
+		"DetectStageResponse.match":            detectResponseMatchField,
+		"DetectStageResponse.stage_num":        detectResponseStageField,
+		"DetectStageResponse.evidence":         detectResponseEvidenceField,
+		"DetectStageResponse.crop":             detectResponseCropField,
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Expected the fields of detect.proto to be %v, got %v", want, fields)
+	}
+}
+
+// BenchmarkDetectStage_Encoding compares a detect round-trip, encoding the request and decoding the response included
+func BenchmarkDetectStage_Encoding(b *testing.B) {
+	engine := newDetectEngine(b)
+	frame := testFrame(b)
+
+	b.Run("json", func(b *testing.B) {
+		for range b.N {
+			body, _ := json.Marshal(DetectStageRequest{CurrentStageNum: 1, Image: base64.StdEncoding.EncodeToString(frame)})
+			req := httptest.NewRequest(http.MethodPost, "/test-game/detect?return_crop=true", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			var resp struct {
+				Data DetectStageResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !resp.Data.Match {
+				b.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+			}
+			if _, err := base64.StdEncoding.DecodeString(resp.Data.Crop); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("protobuf", func(b *testing.B) {
+		for range b.N {
+			req := httptest.NewRequest(http.MethodPost, "/test-game/detect?return_crop=true", bytes.NewReader(protoDetectRequest(1, frame)))
+			req.Header.Set("Content-Type", ProtobufMIME)
+			req.Header.Set("Accept", ProtobufMIME)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if resp, _ := decodeProtoDetectResponse(b, rec.Body.Bytes()); !resp.Match {
+				b.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipMinSize is the smallest response body that gets compressed
+const DefaultGzipMinSize = 1024
+
+// gzipMiddleware decompresses gzip request bodies and compresses responses of at
+// least minSize bytes for clients that accept gzip. Upgrade requests are left alone
+// so WebSocket handshakes keep working.
+func gzipMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") && c.Request.Body != nil {
+			reader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, CommonResponse{
+					Code:    400,
+					Message: "invalid gzip request body",
+					Data:    nil,
+				})
+				return
+			}
+			defer reader.Close()
+			c.Request.Body = reader
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.ContentLength = -1
+		}
+
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &gzipWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = writer
+		c.Header("Vary", "Accept-Encoding")
+		defer writer.finish()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows a gzip response. An explicit gzip
+// entry wins over "*", and a q-value of 0 refuses the coding.
+func acceptsGzip(header string) bool {
+	wildcard := false
+	for _, entry := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		if coding == "*" {
+			wildcard = accepted
+			continue
+		}
+		return accepted
+	}
+	return wildcard
+}
+
+// gzipWriter buffers the response until it reaches minSize, then switches to gzip.
+// Smaller responses are written uncompressed when the handler is done.
+type gzipWriter struct {
+	gin.ResponseWriter
+	minSize int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() < w.minSize {
+		return len(data), nil
+	}
+
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf.Reset()
+	return len(data), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// finish flushes whatever the handler wrote
+func (w *gzipWriter) finish() {
+	if w.gz != nil {
+		w.gz.Close()
+		return
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+	}
+}
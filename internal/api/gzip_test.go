@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newGzipTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(gzipMiddleware(DefaultGzipMinSize))
+	engine.GET("/list", func(c *gin.Context) {
+		items := make([]string, 500)
+		for i := range items {
+			items[i] = "session-with-a-reasonably-long-identifier"
+		}
+		c.JSON(http.StatusOK, CommonResponse{Code: ErrNot, Message: "success", Data: items})
+	})
+	engine.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, CommonResponse{Code: ErrNot, Message: "success"})
+	})
+	engine.POST("/echo", func(c *gin.Context) {
+		var req DetectStageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, CommonResponse{Code: 400, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, CommonResponse{Code: ErrNot, Message: "success", Data: req.Image})
+	})
+	return engine
+}
+
+func TestGzipMiddleware_CompressesLargeResponses(t *testing.T) {
+	engine := newGzipTestEngine()
+
+	req := httptest.NewRequest(http.MethodGet, "/list", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip-encoded response, got headers %v", rec.Header())
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	var resp CommonResponse
+	if err := json.NewDecoder(reader).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode gzip body: %v", err)
+	}
+	if items, ok := resp.Data.([]any); !ok || len(items) != 500 {
+		t.Errorf("Expected 500 items after decompression, got %v", resp.Data)
+	}
+}
+
+func TestGzipMiddleware_SkipsSmallAndUnsupported(t *testing.T) {
+	engine := newGzipTestEngine()
+
+	req := httptest.NewRequest(http.MethodGet, "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected small response not to be compressed")
+	}
+	if !strings.Contains(rec.Body.String(), `"success"`) {
+		t.Errorf("Expected plain JSON body, got %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/list", nil)
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no compression without Accept-Encoding")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0, deflate", false},
+		{"x-gzip;q=1", true},
+		{"*", true},
+		{"*;q=0", false},
+		{"gzip;q=0, *", false},
+		{"deflate", false},
+		{"gzipped", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipMiddleware_DecompressesRequests(t *testing.T) {
+	engine := newGzipTestEngine()
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	io.WriteString(gz, `{"currentStageNum": 1, "image": "aGVsbG8="}`)
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "aGVsbG8=") {
+		t.Errorf("Expected gzip request body to be decoded, got %d %s", rec.Code, rec.Body.String())
+	}
+}
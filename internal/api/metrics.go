@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/game"
+	"github.com/letusgogo/playable-backend/internal/session"
+	"github.com/letusgogo/quick/logger"
+)
+
+// metricsContentType is the Prometheus text exposition format /metrics answers in
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metrics serves the gauges and counters of the service in the Prometheus text exposition format
+func (a *ApiService) metrics(c *gin.Context) {
+	var b strings.Builder
+
+	farms := farmBreakers(a.gameManager)
+	metricHeader(&b, "playable_anbox_breaker_state", "gauge", "State of the circuit breaker guarding the anbox calls of a farm, 1 for the current one")
+	for _, farm := range farms {
+		state := farm.breaker.BreakerState()
+		for _, s := range []anbox.BreakerState{anbox.BreakerClosed, anbox.BreakerOpen, anbox.BreakerHalfOpen} {
+			fmt.Fprintf(&b, "playable_anbox_breaker_state{farm=%q,state=%q} %d\n", farm.Name, s, boolMetric(s == state))
+		}
+	}
+	metricHeader(&b, "playable_anbox_breaker_trips_total", "counter", "Times the circuit breaker guarding the anbox calls of a farm opened")
+	for _, farm := range farms {
+		fmt.Fprintf(&b, "playable_anbox_breaker_trips_total{farm=%q} %d\n", farm.Name, farm.breaker.BreakerTrips())
+	}
+
+	// The pool gauge is left out rather than failing the scrape when a game cannot report its pool
+	if pool, err := a.gameManager.AggregatePoolStatus(c.Request.Context()); err == nil {
+		metricHeader(&b, "playable_pool_sessions", "gauge", "Sessions in the pools of all games by state")
+		for _, s := range []struct {
+			state session.SessionStatus
+			count int
+		}{{session.Cold, pool.Cold}, {session.Warming, pool.Warming}, {session.Warmed, pool.Warmed}, {session.InUse, pool.InUse}} {
+			fmt.Fprintf(&b, "playable_pool_sessions{state=%q} %d\n", s.state, s.count)
+		}
+	} else {
+		logger.Warnf("metrics are served without the pool gauge: %v", err)
+	}
+
+	c.Data(http.StatusOK, metricsContentType, []byte(b.String()))
+}
+
+// breaker reports the state of the circuit breaker a farm's anbox client calls through
+type breaker interface {
+	BreakerState() anbox.BreakerState
+	BreakerTrips() int64
+}
+
+// farmBreaker is a farm of the game manager whose client has a breaker
+type farmBreaker struct {
+	game.Farm
+	breaker breaker
+}
+
+// farmBreakers returns the farms whose clients report a breaker, clients without one are never tripped
+func farmBreakers(gameManager *game.Manager) []farmBreaker {
+	var farms []farmBreaker
+	for _, farm := range gameManager.Farms() {
+		if b, ok := farm.Client.(breaker); ok {
+			farms = append(farms, farmBreaker{Farm: farm, breaker: b})
+		}
+	}
+	return farms
+}
+
+// metricHeader writes the HELP and TYPE lines of a metric
+func metricHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func boolMetric(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
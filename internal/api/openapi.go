@@ -0,0 +1,391 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/game"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+// OpenAPIVersion is the OpenAPI revision of the document served at /api/v1/openapi.json
+const OpenAPIVersion = "3.0.3"
+
+// apiRoute documents one /api/v1 route. Request is the type of the JSON body and Response the type of
+// CommonResponse.Data on success, nil for none. Errors lists the error statuses that may carry data.
+type apiRoute struct {
+	Method   string
+	Path     string // relative to /api/v1 in gin syntax, :param segments become path parameters
+	Summary  string
+	Query    []apiParam
+	Request  reflect.Type
+	Response reflect.Type
+	Errors   map[int]reflect.Type
+	// Bare is set for routes that answer with Response itself instead of a CommonResponse
+	Bare bool
+	// Text is set for routes that answer with plain text in place of JSON
+	Text bool
+}
+
+// apiParam is a query parameter of a route
+type apiParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// healthResponse is the body of /health
+type healthResponse struct {
+	Message string `json:"message"`
+}
+
+// serviceRoutes are the routes outside any game
+var serviceRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "/health", Summary: "Liveness check", Response: reflect.TypeFor[healthResponse](), Bare: true},
+	{Method: http.MethodGet, Path: "/readyz", Summary: "Readiness of the games and the gateway", Response: reflect.TypeFor[ReadyzResponse](),
+		Errors: map[int]reflect.Type{http.StatusServiceUnavailable: reflect.TypeFor[ReadyzResponse]()}},
+	{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document", Response: reflect.TypeFor[map[string]any](), Bare: true},
+	{Method: http.MethodGet, Path: "/metrics", Summary: "Metrics in the Prometheus text format", Text: true},
+	{Method: http.MethodGet, Path: "/sessions", Summary: "Page of the sessions of every game", Response: reflect.TypeFor[SessionListResponse](),
+		Query: []apiParam{
+			{Name: "game", Type: "string", Description: "only sessions of this game"},
+			{Name: "status", Type: "string", Description: "only sessions in this status"},
+			{Name: "offset", Type: "integer", Description: "sessions to skip"},
+			{Name: "limit", Type: "integer", Description: "page size, capped by the server"},
+		}},
+	{Method: http.MethodGet, Path: "/pool_status", Summary: "Pool status summed over every game, with each game's own", Response: reflect.TypeFor[game.AggregatePoolStatus]()},
+	{Method: http.MethodGet, Path: "/anbox/apps", Summary: "Applications available on AMS", Response: reflect.TypeFor[[]anbox.AppSummary]()},
+}
+
+// debugRoutes are only registered with Debug set
+var debugRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "/debug/health", Summary: "Goroutines and the sync loop health of every game", Response: reflect.TypeFor[DebugHealthResponse]()},
+}
+
+// gameRoutes are the routes registerGameRoutes adds, relative to the game prefix
+var gameRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "", Summary: "Status of the game", Response: reflect.TypeFor[*game.GameInstanceStatus]()},
+	{Method: http.MethodGet, Path: "/sessions", Summary: "Pool status of the game", Response: reflect.TypeFor[session.PoolStatus]()},
+	{Method: http.MethodGet, Path: "/sessions/:id", Summary: "A session including its metadata", Response: reflect.TypeFor[SessionResponse]()},
+	{Method: http.MethodGet, Path: "/sessions/:id/connect", Summary: "Connection descriptor of an in-use session, for the API key that acquired it", Response: reflect.TypeFor[session.ConnectionInfo]()},
+	{Method: http.MethodPost, Path: "/sessions/:id/reconnect", Summary: "Fresh connection descriptor of an in-use session whose stream dropped, for the API key that acquired it", Response: reflect.TypeFor[session.ConnectionInfo]()},
+	{Method: http.MethodGet, Path: "/stats", Summary: "Cumulative session counters", Response: reflect.TypeFor[session.Stats]()},
+	{Method: http.MethodPost, Path: "/acquire_cold", Summary: "Acquire a cold session to warm up", Request: reflect.TypeFor[AcquireRequest](), Response: reflect.TypeFor[SessionResponse](),
+		Errors: map[int]reflect.Type{http.StatusServiceUnavailable: reflect.TypeFor[*PoolEmptyResponse]()}},
+	{Method: http.MethodPost, Path: "/set_warmed", Summary: "Mark a warming session warmed", Request: reflect.TypeFor[SetWarmedRequest]()},
+	{Method: http.MethodPost, Path: "/abandon_warming", Summary: "Put a warming session back to cold", Request: reflect.TypeFor[AbandonWarmingRequest]()},
+	{Method: http.MethodPost, Path: "/acquire_warmed", Summary: "Acquire a warmed session to play", Request: reflect.TypeFor[AcquireRequest](), Response: reflect.TypeFor[SessionResponse](),
+		Errors: map[int]reflect.Type{http.StatusServiceUnavailable: reflect.TypeFor[*PoolEmptyResponse]()}},
+	{Method: http.MethodPost, Path: "/release", Summary: "Release a session", Request: reflect.TypeFor[ReleaseRequest]()},
+	{Method: http.MethodPost, Path: "/heartbeat", Summary: "Keep an in-use session alive", Request: reflect.TypeFor[HeartbeatRequest](), Response: reflect.TypeFor[HeartbeatResponse]()},
+	{Method: http.MethodPost, Path: "/extend", Summary: "Give an in-use session more time", Request: reflect.TypeFor[ExtendRequest](), Response: reflect.TypeFor[ExtendResponse]()},
+	{Method: http.MethodPost, Path: "/metadata", Summary: "Merge client metadata into a session", Request: reflect.TypeFor[SetMetadataRequest]()},
+	{Method: http.MethodPost, Path: "/detect", Summary: "Detect whether a frame shows a stage", Request: reflect.TypeFor[DetectStageRequest](), Response: reflect.TypeFor[DetectStageResponse](),
+		Query:  []apiParam{{Name: "return_crop", Type: "boolean", Description: "return the region the detector ran on"}},
+		Errors: map[int]reflect.Type{http.StatusBadRequest: reflect.TypeFor[*UnknownStageResponse]()}},
+}
+
+// adminRoutes are the routes registerAdminRoutes adds, only with AdminToken set
+var adminRoutes = []apiRoute{
+	{Method: http.MethodPost, Path: "/pause", Summary: "Stop creating and handing out sessions", Response: reflect.TypeFor[session.PoolStatus]()},
+	{Method: http.MethodPost, Path: "/resume", Summary: "Undo pause", Response: reflect.TypeFor[session.PoolStatus]()},
+	{Method: http.MethodPost, Path: "/resize", Summary: "Change the pool bounds until the next restart", Request: reflect.TypeFor[ResizeRequest](), Response: reflect.TypeFor[session.PoolStatus]()},
+}
+
+// routes lists every /api/v1 route the service registers
+func (a *ApiService) routes() []apiRoute {
+	routes := append([]apiRoute(nil), serviceRoutes...)
+	for _, route := range gameRoutes {
+		route.Path = "/games/:game" + route.Path
+		routes = append(routes, route)
+	}
+	if a.config.Debug {
+		routes = append(routes, debugRoutes...)
+	}
+	if a.config.DefaultGame != "" {
+		for _, route := range gameRoutes {
+			// The game info and pool status are only served under /games/<name>
+			if route.Path != "" && route.Path != "/sessions" {
+				routes = append(routes, route)
+			}
+		}
+	}
+	if a.config.AdminToken != "" {
+		for _, route := range adminRoutes {
+			if a.config.DefaultGame != "" {
+				routes = append(routes, route)
+			}
+			route.Path = "/games/:game" + route.Path
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// openAPI serves the OpenAPI document of the API
+func (a *ApiService) openAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, a.openAPIDocument())
+}
+
+// openAPIDocument builds the OpenAPI document of the registered routes, the schemas are derived from the DTOs
+func (a *ApiService) openAPIDocument() map[string]any {
+	schemas := newSchemaRegistry()
+	paths := make(map[string]map[string]any)
+	for _, route := range a.routes() {
+		specPath, params := openAPIPath("/api/v1" + route.Path)
+		for _, p := range route.Query {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      map[string]any{"type": p.Type},
+			})
+		}
+
+		operation := map[string]any{
+			"summary":   route.Summary,
+			"responses": routeResponses(schemas, route),
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"content": map[string]any{"application/json": map[string]any{"schema": schemas.schema(route.Request)}},
+			}
+		}
+
+		if paths[specPath] == nil {
+			paths[specPath] = make(map[string]any)
+		}
+		paths[specPath][strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": OpenAPIVersion,
+		"info": map[string]any{
+			"title":   "playable-backend",
+			"version": "v1",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas.components},
+	}
+}
+
+// routeResponses documents the success response of a route and its CommonResponse errors
+func routeResponses(schemas *schemaRegistry, route apiRoute) map[string]any {
+	var success map[string]any
+	if route.Text {
+		return map[string]any{
+			"200":     map[string]any{"description": "success", "content": map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}},
+			"default": jsonResponse("error", schemas.schema(reflect.TypeFor[CommonResponse]())),
+		}
+	}
+	if route.Bare {
+		success = schemas.schema(route.Response)
+	} else {
+		success = envelopeSchema(schemas, route.Response)
+	}
+	responses := map[string]any{
+		"200":     jsonResponse("success", success),
+		"default": jsonResponse("error", schemas.schema(reflect.TypeFor[CommonResponse]())),
+	}
+	for status, data := range route.Errors {
+		responses[strconv.Itoa(status)] = jsonResponse(http.StatusText(status), envelopeSchema(schemas, data))
+	}
+	return responses
+}
+
+func jsonResponse(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+// envelopeSchema is a CommonResponse whose data is of type data, always null when data is nil
+func envelopeSchema(schemas *schemaRegistry, data reflect.Type) map[string]any {
+	dataSchema := map[string]any{"nullable": true, "enum": []any{nil}}
+	if data != nil {
+		dataSchema = schemas.schema(data)
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "integer"},
+			"message": map[string]any{"type": "string"},
+			"data":    dataSchema,
+		},
+		"required": []string{"code", "message", "data"},
+	}
+}
+
+// openAPIPath turns a gin path into an OpenAPI path and its path parameters
+func openAPIPath(ginPath string) (string, []map[string]any) {
+	var params []map[string]any
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// schemaRegistry derives JSON schemas from Go types the way encoding/json encodes them.
+// Named structs become components referenced by name, qualified by package when two share a name.
+type schemaRegistry struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: make(map[string]any), names: make(map[reflect.Type]string)}
+}
+
+// schema returns the schema of values of type t
+func (r *schemaRegistry) schema(t reflect.Type) map[string]any {
+	// Pointers, slices, maps and interfaces encode nil as null
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	var schema map[string]any
+	switch {
+	case t == timeType:
+		schema = map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		schema = map[string]any{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		schema = map[string]any{"type": "string"}
+	default:
+		schema, nullable = r.kindSchema(t, nullable)
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+func (r *schemaRegistry) kindSchema(t reflect.Type, nullable bool) (map[string]any, bool) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nullable
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nullable
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nullable
+	case reflect.String:
+		return map[string]any{"type": "string"}, nullable
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}, true
+		}
+		return map[string]any{"type": "array", "items": r.schema(t.Elem())}, true
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": r.schema(t.Elem())}, nullable
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": r.schema(t.Elem())}, true
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t), nullable
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + r.component(t)}
+		if nullable {
+			// Siblings of $ref are ignored, so a nullable reference wraps it
+			return map[string]any{"allOf": []any{ref}}, true
+		}
+		return ref, false
+	default:
+		// Interfaces can hold anything
+		return map[string]any{}, true
+	}
+}
+
+// component registers the named struct t and returns its component name
+func (r *schemaRegistry) component(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := r.components[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	r.names[t] = name
+	// Register before building the properties so recursive types refer to themselves
+	r.components[name] = map[string]any{}
+	r.components[name] = r.structSchema(t)
+	return name
+}
+
+// structSchema lists the fields encoding/json writes, fields without omitempty are always present
+func (r *schemaRegistry) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	r.addFields(t, properties, &required, true)
+	sort.Strings(required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the fields of t, present tells whether they are written at all, which a nil embedded pointer is not
+func (r *schemaRegistry) addFields(t reflect.Type, properties map[string]any, required *[]string, present bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Untagged embedded structs are inlined
+		fieldType, embeddedPresent := field.Type, present
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType, embeddedPresent = fieldType.Elem(), false
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			r.addFields(fieldType, properties, required, embeddedPresent)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = r.schema(field.Type)
+		if present && !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/game"
+)
+
+// specAnboxClient runs a single session session-1 of test-game until it is deleted
+type specAnboxClient struct {
+	mu      sync.Mutex
+	deleted bool
+	joinErr error
+}
+
+func (f *specAnboxClient) Create(ctx context.Context, req anbox.CreateSessionRequest) (*anbox.SessionDetails, error) {
+	return nil, fmt.Errorf("no capacity")
+}
+
+func (f *specAnboxClient) CreateAsync(ctx context.Context, req anbox.CreateSessionRequest) error {
+	return fmt.Errorf("no capacity")
+}
+
+func (f *specAnboxClient) Delete(ctx context.Context, sessionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = true
+	return nil
+}
+
+func (f *specAnboxClient) CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error) {
+	return nil, fmt.Errorf("no screenshot for session %s", sessionID)
+}
+
+func (f *specAnboxClient) Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.joinErr != nil {
+		return nil, f.joinErr
+	}
+	return &anbox.JoinSessionDetails{
+		SignalingURL: "wss://gateway.example.com/" + sessionID + "?token=scoped-" + sessionID,
+		StunServers:  []anbox.StunServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+	}, nil
+}
+
+func (f *specAnboxClient) GetSession(ctx context.Context, sessionID string) (*anbox.SessionDetails, error) {
+	return &anbox.SessionDetails{ID: sessionID, App: "test-game", Status: "active"}, nil
+}
+
+func (f *specAnboxClient) GetAllRunningSession(ctx context.Context) ([]*anbox.SessionDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.deleted {
+		return nil, nil
+	}
+	return []*anbox.SessionDetails{{ID: "session-1", App: "test-game", Status: "active"}}, nil
+}
+
+func (f *specAnboxClient) GetAllInstances(ctx context.Context) ([]*anbox.InstanceDetails, error) {
+	return nil, nil
+}
+
+func (f *specAnboxClient) DeleteInstance(ctx context.Context, instanceID string) error {
+	return nil
+}
+
+func (f *specAnboxClient) GetApp(ctx context.Context, name string) (*anbox.AppDetails, error) {
+	return &anbox.AppDetails{Name: name}, nil
+}
+
+func (f *specAnboxClient) GetGatewayURL() string { return "https://gateway.example.com" }
+func (f *specAnboxClient) GetAuthToken() string  { return "pool-wide-secret-token" }
+func (f *specAnboxClient) GetReplicaID() string  { return "replica-1" }
+func (f *specAnboxClient) Available() bool       { return true }
+
+func (f *specAnboxClient) ListApps(ctx context.Context) ([]anbox.AppSummary, error) {
+	return []anbox.AppSummary{{ID: "app-1", Name: "test-game", Status: "ready", Published: true, LatestVersion: 2, Versions: []int{1, 2}}}, nil
+}
+
+func (f *specAnboxClient) BreakerState() anbox.BreakerState {
+	return anbox.BreakerClosed
+}
+
+func (f *specAnboxClient) BreakerTrips() int64 {
+	return 0
+}
+
+// schemaValidator checks decoded JSON against the schemas of an OpenAPI document.
+// Objects must not carry properties their schema does not list, so an undocumented field fails as well.
+type schemaValidator struct {
+	components map[string]any
+	errs       []string
+}
+
+func (v *schemaValidator) validate(schema map[string]any, value any, at string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		component, ok := v.components[name].(map[string]any)
+		if !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: unknown schema %s", at, ref))
+			return
+		}
+		v.validate(component, value, at)
+		return
+	}
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable && len(schema) > 0 {
+			v.errs = append(v.errs, fmt.Sprintf("%s: null is not allowed", at))
+		}
+		return
+	}
+	if _, ok := schema["enum"]; ok {
+		// The only enum in the document is the always-null data of routes without a response
+		v.errs = append(v.errs, fmt.Sprintf("%s: expected null, got %v", at, value))
+		return
+	}
+	for i, sub := range asSlice(schema["allOf"]) {
+		v.validate(sub.(map[string]any), value, fmt.Sprintf("%s(allOf %d)", at, i))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected an object, got %T", at, value))
+			return
+		}
+		for _, name := range asSlice(schema["required"]) {
+			if _, ok := object[name.(string)]; !ok {
+				v.errs = append(v.errs, fmt.Sprintf("%s: missing required property %s", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		additional, hasAdditional := schema["additionalProperties"].(map[string]any)
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]any); ok {
+				v.validate(property, field, at+"."+name)
+			} else if hasAdditional {
+				v.validate(additional, field, at+"."+name)
+			} else {
+				v.errs = append(v.errs, fmt.Sprintf("%s: undocumented property %s", at, name))
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected an array, got %T", at, value))
+			return
+		}
+		for i, item := range items {
+			v.validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i))
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected a string, got %T", at, value))
+			return
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				v.errs = append(v.errs, fmt.Sprintf("%s: expected a date-time, got %q", at, s))
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected an integer, got %v", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected a number, got %T", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.errs = append(v.errs, fmt.Sprintf("%s: expected a boolean, got %T", at, value))
+		}
+	}
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// lookup walks the decoded document along keys
+func lookup(doc any, keys ...string) (map[string]any, bool) {
+	for _, key := range keys {
+		object, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		doc = object[key]
+	}
+	object, ok := doc.(map[string]any)
+	return object, ok
+}
+
+// fetchOpenAPI returns the document the service serves
+func fetchOpenAPI(t *testing.T, engine *gin.Engine) map[string]any {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the OpenAPI document, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to decode the OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPI_DocumentsRegisteredRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		defaultGame string
+		debug       bool
+		adminToken  string
+	}{{"", false, ""}, {"test-game", false, ""}, {"", true, ""}, {"", false, "admin-secret"}, {"test-game", false, "admin-secret"}} {
+		gameManager := newTestGameManager(t, []*game.GameConfig{{Name: "test-game"}}, nil)
+		config := NewApiServiceConfig()
+		config.DefaultGame = tt.defaultGame
+		config.Debug = tt.debug
+		config.AdminToken = tt.adminToken
+		api := NewApiService(config, gameManager, &fakeAnboxClient{})
+		if err := api.Init(); err != nil {
+			t.Fatalf("Failed to init: %v", err)
+		}
+		doc := fetchOpenAPI(t, api.ginServer.GinEngine())
+
+		var registered, documented []string
+		for _, route := range api.ginServer.GinEngine().Routes() {
+			specPath, _ := openAPIPath(route.Path)
+			registered = append(registered, route.Method+" "+specPath)
+		}
+		paths, _ := lookup(doc, "paths")
+		for specPath, item := range paths {
+			for method := range item.(map[string]any) {
+				documented = append(documented, strings.ToUpper(method)+" "+specPath)
+			}
+		}
+		sort.Strings(registered)
+		sort.Strings(documented)
+		if strings.Join(registered, "\n") != strings.Join(documented, "\n") {
+			t.Errorf("default game %q, debug %t, admin token %q: expected the document to list the registered routes\nregistered:\n%s\ndocumented:\n%s",
+				tt.defaultGame, tt.debug, tt.adminToken, strings.Join(registered, "\n"), strings.Join(documented, "\n"))
+		}
+	}
+}
+
+// startSpecGame runs test-game on anboxClient until the test ends and waits for session-1 to be synced
+func startSpecGame(t *testing.T, anboxClient *specAnboxClient) *game.Manager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	gameManager := newTestGameManager(t, []*game.GameConfig{{
+		Name:          "test-game",
+		SessionConfig: &game.SessionConfig{Max: 4, SessionTTL: 10 * time.Minute},
+		Stages:        []*detector.Stage{{Number: 1, Reco: detector.Reco{Method: "api-test-match"}}},
+	}}, anboxClient)
+	if err := gameManager.Init(ctx); err != nil {
+		t.Fatalf("Failed to init games: %v", err)
+	}
+	if err := gameManager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start games: %v", err)
+	}
+	t.Cleanup(func() { gameManager.Stop(context.Background()) })
+
+	// Wait for the startup sync to adopt session-1
+	instance, _ := gameManager.GetGameInstance(ctx, "test-game")
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := instance.GetSessionManager().PoolStatus(ctx)
+		if err == nil && status.Cold == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected session-1 to be synced, got %+v", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return gameManager
+}
+
+func TestOpenAPI_ResponsesMatchSchemas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	anboxClient := &specAnboxClient{}
+	gameManager := startSpecGame(t, anboxClient)
+
+	config := NewApiServiceConfig()
+	config.Debug = true
+	config.AdminToken = "admin-secret"
+	api := NewApiService(config, gameManager, anboxClient)
+	if err := api.Init(); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	engine := api.ginServer.GinEngine()
+	doc := fetchOpenAPI(t, engine)
+	components, _ := lookup(doc, "components", "schemas")
+	validator := &schemaValidator{components: components}
+
+	frame := base64.StdEncoding.EncodeToString(testFrame(t))
+	// Bodies are encoded when their step runs, the warm token is filled in from the acquire_cold answer
+	setWarmed := &SetWarmedRequest{SessionID: "session-1"}
+	abandon := &AbandonWarmingRequest{SessionID: "session-1"}
+	steps := []struct {
+		method, route, path string
+		body                any
+		code                int
+	}{
+		{http.MethodGet, "/api/v1/health", "/api/v1/health", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/readyz", "/api/v1/readyz", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/openapi.json", "/api/v1/openapi.json", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/metrics", "/api/v1/metrics", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/anbox/apps", "/api/v1/anbox/apps", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/debug/health", "/api/v1/debug/health", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/games/{game}", "/api/v1/games/test-game", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/games/{game}/sessions", "/api/v1/games/test-game/sessions", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/games/{game}/stats", "/api/v1/games/test-game/stats", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/acquire_cold", "/api/v1/games/test-game/acquire_cold", AcquireRequest{Metadata: map[string]string{"campaign": "spring"}}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/abandon_warming", "/api/v1/games/test-game/abandon_warming", abandon, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/acquire_cold", "/api/v1/games/test-game/acquire_cold", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/set_warmed", "/api/v1/games/test-game/set_warmed", setWarmed, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/acquire_warmed", "/api/v1/games/test-game/acquire_warmed", AcquireRequest{}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/acquire_warmed", "/api/v1/games/test-game/acquire_warmed", nil, http.StatusServiceUnavailable},
+		{http.MethodGet, "/api/v1/sessions", "/api/v1/sessions?game=test-game&status=in_use", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/pool_status", "/api/v1/pool_status", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/games/{game}/sessions/{id}", "/api/v1/games/test-game/sessions/session-1", nil, http.StatusOK},
+		{http.MethodGet, "/api/v1/games/{game}/sessions/{id}/connect", "/api/v1/games/test-game/sessions/session-1/connect", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/sessions/{id}/reconnect", "/api/v1/games/test-game/sessions/session-1/reconnect", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/heartbeat", "/api/v1/games/test-game/heartbeat", HeartbeatRequest{SessionID: "session-1"}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/extend", "/api/v1/games/test-game/extend", ExtendRequest{SessionID: "session-1", Seconds: 60}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/metadata", "/api/v1/games/test-game/metadata", SetMetadataRequest{SessionID: "session-1", Metadata: map[string]string{"level": "2"}}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/detect", "/api/v1/games/test-game/detect?return_crop=true", DetectStageRequest{CurrentStageNum: 1, Image: frame}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/detect", "/api/v1/games/test-game/detect", DetectStageRequest{CurrentStageNum: 7, Image: frame}, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/games/{game}/pause", "/api/v1/games/test-game/pause", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/resume", "/api/v1/games/test-game/resume", nil, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/resize", "/api/v1/games/test-game/resize", map[string]int{"min": 0, "max": 4}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/release", "/api/v1/games/test-game/release", ReleaseRequest{SessionID: "session-1"}, http.StatusOK},
+		{http.MethodPost, "/api/v1/games/{game}/heartbeat", "/api/v1/games/test-game/heartbeat", HeartbeatRequest{SessionID: "session-1"}, http.StatusNotFound},
+	}
+
+	exercised := make(map[string]bool)
+	for _, step := range steps {
+		name := step.method + " " + step.path
+		operation, ok := lookup(doc, "paths", step.route, strings.ToLower(step.method))
+		if !ok {
+			t.Errorf("%s: route %s is not documented", name, step.route)
+			continue
+		}
+		exercised[step.method+" "+step.route] = true
+
+		var body []byte
+		if step.body != nil {
+			body, _ = json.Marshal(step.body)
+			var decoded any
+			json.Unmarshal(body, &decoded)
+			if schema, ok := lookup(operation, "requestBody", "content", "application/json", "schema"); !ok {
+				t.Errorf("%s: sends a body the document does not describe", name)
+			} else {
+				validator.validate(schema, decoded, name+" request")
+			}
+		}
+		req := httptest.NewRequest(step.method, step.path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(AdminTokenHeader, "admin-secret")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if rec.Code != step.code {
+			t.Errorf("%s: expected %d, got %d: %s", name, step.code, rec.Code, rec.Body.String())
+			continue
+		}
+
+		responses, _ := lookup(operation, "responses")
+		key := fmt.Sprint(step.code)
+		if _, ok := responses[key]; !ok {
+			key = "default"
+		}
+		if _, text := lookup(responses, key, "content", "text/plain"); text {
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+				t.Errorf("%s: expected a text/plain answer, got %s", name, rec.Header().Get("Content-Type"))
+			}
+			continue
+		}
+		schema, ok := lookup(responses, key, "content", "application/json", "schema")
+		if !ok {
+			t.Errorf("%s: no schema for status %d", name, step.code)
+			continue
+		}
+		var decoded any
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", name, err)
+		}
+		validator.validate(schema, decoded, name)
+		if data, ok := lookup(decoded, "data"); ok {
+			if token, ok := data["warm_token"].(string); ok {
+				setWarmed.WarmToken = token
+				abandon.WarmToken = token
+			}
+		}
+	}
+	for _, err := range validator.errs {
+		t.Error(err)
+	}
+
+	paths, _ := lookup(doc, "paths")
+	for specPath, item := range paths {
+		for method := range item.(map[string]any) {
+			if !exercised[strings.ToUpper(method)+" "+specPath] {
+				t.Errorf("Route %s %s is documented but not exercised", strings.ToUpper(method), specPath)
+			}
+		}
+	}
+}
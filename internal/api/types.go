@@ -1,9 +1,27 @@
 package api
 
+import (
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
 var (
 	ErrNot = 200
 )
 
+// IdempotencyKeyHeader lets clients retry an acquire without consuming another session
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// APIKeyHeader identifies the partner an acquire is made for, used for per-key session quotas and
+// required again to get the connection details of the session
+const APIKeyHeader = "X-API-Key"
+
+// AdminTokenHeader carries the admin token the pool maintenance endpoints require
+const AdminTokenHeader = "X-Admin-Token"
+
 type CommonResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -14,21 +32,173 @@ type CreateSessionRequest struct {
 	Game string `json:"game"`
 }
 
-type SetWarmedRequest struct {
+// AcquireRequest is the optional body of the acquire endpoints
+type AcquireRequest struct {
+	Metadata map[string]string `json:"metadata"`
+	// Profile names the screen profile to acquire, the game's default profile when empty
+	Profile string `json:"profile"`
+	// WarmWorker identifies the warm worker calling acquire_cold, its retries with the same API key return the
+	// session it is warming
+	WarmWorker string `json:"warm_worker"`
+	// SessionID makes acquire_warmed hand out that warmed session rather than any, e.g. for orchestrated
+	// assignment or a sticky reconnect. Profile does not apply then.
 	SessionID string `json:"session_id"`
 }
 
+type SetMetadataRequest struct {
+	SessionID string            `json:"session_id" binding:"required"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// ResizeRequest sets the pool bounds of a running game, both are required
+type ResizeRequest struct {
+	Min *int `json:"min" binding:"required"`
+	Max *int `json:"max" binding:"required"`
+}
+
+type SetWarmedRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	// WarmToken is the warm_token of the acquire_cold response, only its caller may mark the session warmed
+	WarmToken string `json:"warm_token" binding:"required"`
+}
+
+// SessionResponse is the client view of a session, it never carries the pool-wide gateway token.
+// SignalingURL and StunServers come from joining the session and only grant access to it.
+type SessionResponse struct {
+	ID           string             `json:"id"`
+	Game         string             `json:"game"`
+	Status       string             `json:"status"`
+	SignalingURL string             `json:"signaling_url"`
+	StunServers  []anbox.StunServer `json:"stun_servers"`
+	ExpiresAt    time.Time          `json:"expires_at"`
+	Metadata     map[string]string  `json:"metadata"` // always present, empty for a session without any
+	Profile      string             `json:"profile,omitempty"`
+	// ConnectRetryAfterMs is how long a client should wait before retrying a failed connect, set on acquire.
+	// FreshlyReady is set when the session only just became ready and the gateway may still refuse joins.
+	ConnectRetryAfterMs int64 `json:"connect_retry_after_ms,omitempty"`
+	FreshlyReady        bool  `json:"freshly_ready,omitempty"`
+	// Heartbeat tells the client how to keep the session alive, set on acquire
+	Heartbeat *HeartbeatCapability `json:"heartbeat,omitempty"`
+	// WarmToken must be passed to set_warmed, set on acquire_cold
+	WarmToken string `json:"warm_token,omitempty"`
+}
+
+// PoolEmptyResponse is the data of an acquire that found the pool empty, sent with a Retry-After header.
+// AvailableAt estimates when a session will likely be available from the sessions warming or booting.
+type PoolEmptyResponse struct {
+	RetryAfterMs int64     `json:"retry_after_ms"`
+	AvailableAt  time.Time `json:"available_at"`
+	Warming      int       `json:"warming"`
+	Booting      int       `json:"booting"`
+}
+
+// SessionListResponse is a page of sessions across games
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+	Total    int               `json:"total"` // sessions matching the filters on all pages
+	Offset   int               `json:"offset"`
+	Limit    int               `json:"limit"`
+}
+
+// HeartbeatTransportHTTP is POST .../heartbeat, plain HTTP works behind proxies that block WebSockets
+const HeartbeatTransportHTTP = "http"
+
+// HeartbeatCapability advertises the heartbeat transports a client may pick from and how often to beat
+type HeartbeatCapability struct {
+	Transports []string `json:"transports"`
+	IntervalMs int64    `json:"interval_ms"`
+	TimeoutMs  int64    `json:"timeout_ms"` // the session is released after this long without a heartbeat
+}
+
+// NewSessionResponse builds the client view of a session from its scoped join details
+func NewSessionResponse(s *session.Session, join *anbox.JoinSessionDetails) SessionResponse {
+	resp := SessionResponse{
+		ID:        s.ID,
+		Game:      s.Game,
+		Status:    string(s.Status),
+		ExpiresAt: s.ExpiresAt,
+		Metadata:  s.Metadata,
+		Profile:   s.Profile,
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	if join != nil {
+		resp.SignalingURL = join.SignalingURL
+		resp.StunServers = join.StunServers
+	}
+	return resp
+}
+
+type HeartbeatRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+}
+
+type HeartbeatResponse struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Draining is set when the backend is shutting down and the session ends in EndingIn seconds
+	Draining bool `json:"draining"`
+	EndingIn int  `json:"ending_in_seconds"`
+}
+
+// ExtendRequest asks for Seconds more of an in-use session
+type ExtendRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	Seconds   int    `json:"seconds" binding:"gt=0"`
+}
+
+type ExtendResponse struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AbandonWarmingRequest struct {
+	SessionID string `json:"session_id" binding:"required"`
+	// WarmToken is the warm_token of the acquire_cold response, only its caller may abandon the warm-up
+	WarmToken string `json:"warm_token" binding:"required"`
+}
+
 type ReleaseRequest struct {
-	SessionID string `json:"session_id"`
+	SessionID string `json:"session_id" binding:"required"`
 }
 
 type DetectStageRequest struct {
 	CurrentStageNum int    `json:"currentStageNum"`
-	Image           string `json:"image"`
+	Image           string `json:"image" binding:"required"`
+	// Frame is the image of a protobuf request, which arrives decoded and leaves Image empty
+	Frame []byte `json:"-"`
 }
 
 type DetectStageResponse struct {
 	Match    bool   `json:"match"`
 	StageNum int    `json:"stage_num"`
 	Evidence string `json:"evidence"`
+	// Crop is the base64 PNG region the detector ran on, only set when the request asks for return_crop
+	Crop string `json:"crop,omitempty"`
+}
+
+// UnknownStageResponse lists the stages clients may detect, returned when detect names another one
+type UnknownStageResponse struct {
+	ValidStages []int `json:"valid_stages"`
+}
+
+type ReadyzResponse struct {
+	Ready        bool   `json:"ready"`
+	GamesRunning bool   `json:"games_running"`
+	BreakerState string `json:"breaker_state"` // of the anbox block
+	// FarmBreakers maps every anbox farm, the anbox block as "default", to the state of its breaker.
+	// The replica is not ready while the breaker of a farm running games use is open.
+	FarmBreakers map[string]string `json:"farm_breakers,omitempty"`
+	// DegradedGames maps the games that failed to init or start to the reason
+	DegradedGames map[string]string `json:"degraded_games,omitempty"`
+	// DebugDump reports whether detection frames are dumped, paused while the dump directory is over its cap
+	DebugDump detector.DumpStatus `json:"debug_dump"`
+}
+
+// DebugHealthResponse is the body of /debug/health
+type DebugHealthResponse struct {
+	Goroutines int `json:"goroutines"`
+	// Games maps every game to the health of its sync loop, null for games whose session manager is not initialized
+	Games map[string]*session.LoopHealth `json:"games"`
 }
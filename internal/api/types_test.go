@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+func TestNewSessionResponse_OmitsAuthToken(t *testing.T) {
+	s := &session.Session{
+		ID:         "session-1",
+		Game:       "test-game",
+		Status:     session.InUse,
+		GatewayURL: "https://gateway.example.com:4000",
+		AuthToken:  "pool-wide-secret-token",
+		ExpiresAt:  time.Now().Add(time.Minute),
+		Anbox:      &anbox.SessionDetails{ID: "session-1"},
+	}
+	join := &anbox.JoinSessionDetails{
+		SignalingURL: "wss://gateway.example.com:4000/1.0/sessions/session-1/sockets/client?token=scoped",
+		StunServers:  []anbox.StunServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+	}
+
+	body, err := json.Marshal(CommonResponse{Code: ErrNot, Message: "success", Data: NewSessionResponse(s, join)})
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+
+	if strings.Contains(string(body), s.AuthToken) {
+		t.Errorf("Expected auth token to be absent from the response, got %s", body)
+	}
+
+	var decoded struct {
+		Data SessionResponse `json:"data"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if decoded.Data.ID != "session-1" || decoded.Data.Status != "in_use" {
+		t.Errorf("Expected session-1 in_use, got %+v", decoded.Data)
+	}
+	if decoded.Data.SignalingURL != join.SignalingURL {
+		t.Errorf("Expected signaling URL %s, got %s", join.SignalingURL, decoded.Data.SignalingURL)
+	}
+	if len(decoded.Data.StunServers) != 1 {
+		t.Errorf("Expected stun servers to be passed through, got %+v", decoded.Data.StunServers)
+	}
+}
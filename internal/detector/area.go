@@ -0,0 +1,121 @@
+package detector
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// IsZero reports whether the area is unset, an unset area covers the whole frame
+func (a Area) IsZero() bool {
+	return a.X == 0 && a.Y == 0 && a.Width == 0 && a.Height == 0
+}
+
+// Ratio returns the area expressed as fractions of the frame
+func (a Area) Ratio() (Area, error) {
+	switch a.Unit {
+	case "", AreaUnitRatio:
+		return a, nil
+	case AreaUnitPixel:
+		if a.RefWidth <= 0 || a.RefHeight <= 0 {
+			return Area{}, fmt.Errorf("pixel area %s needs a positive ref_width and ref_height, got %dx%d", a, a.RefWidth, a.RefHeight)
+		}
+		refWidth, refHeight := float64(a.RefWidth), float64(a.RefHeight)
+		return Area{
+			Clue:   a.Clue,
+			X:      a.X / refWidth,
+			Y:      a.Y / refHeight,
+			Width:  a.Width / refWidth,
+			Height: a.Height / refHeight,
+			Unit:   AreaUnitRatio,
+		}, nil
+	default:
+		return Area{}, fmt.Errorf("area %s has unknown unit %q, expected %s or %s", a, a.Unit, AreaUnitRatio, AreaUnitPixel)
+	}
+}
+
+// Validate checks that the area is a non-empty region inside the frame
+func (a Area) Validate() error {
+	if a.IsZero() {
+		return nil
+	}
+	ratio, err := a.Ratio()
+	if err != nil {
+		return err
+	}
+	if a.Unit == AreaUnitPixel {
+		if err := ratio.Validate(); err != nil {
+			return fmt.Errorf("pixel area %s on %dx%d reference: %w", a, a.RefWidth, a.RefHeight, err)
+		}
+		return nil
+	}
+	for _, v := range []float64{a.X, a.Y, a.Width, a.Height} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("area %s has a non-finite coordinate", a)
+		}
+	}
+	if a.X < 0 || a.Y < 0 {
+		return fmt.Errorf("area %s must start inside the frame, x and y must not be negative", a)
+	}
+	if a.Width <= 0 || a.Height <= 0 {
+		return fmt.Errorf("area %s must have a positive width and height", a)
+	}
+	if a.X+a.Width > 1 || a.Y+a.Height > 1 {
+		return fmt.Errorf("area %s must end inside the frame, x+width and y+height must not exceed 1", a)
+	}
+	return nil
+}
+
+func (a Area) String() string {
+	return fmt.Sprintf("%q (x=%g y=%g width=%g height=%g)", a.Clue, a.X, a.Y, a.Width, a.Height)
+}
+
+// Rect converts the area to pixels of bounds, scaling pixel areas from their reference resolution and clamping to the frame.
+// It returns an error instead of an empty rectangle when nothing of the area lies inside the frame.
+func (a Area) Rect(bounds image.Rectangle) (image.Rectangle, error) {
+	if a.IsZero() {
+		return bounds, nil
+	}
+	a, err := a.Ratio()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	if bounds.Empty() {
+		return image.Rectangle{}, fmt.Errorf("cannot crop area %s from an empty frame", a)
+	}
+	if !(a.Width > 0 && a.Height > 0) {
+		return image.Rectangle{}, fmt.Errorf("area %s must have a positive width and height", a)
+	}
+
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	rect := image.Rect(
+		bounds.Min.X+int(math.Floor(a.X*width)),
+		bounds.Min.Y+int(math.Floor(a.Y*height)),
+		bounds.Min.X+int(math.Ceil((a.X+a.Width)*width)),
+		bounds.Min.Y+int(math.Ceil((a.Y+a.Height)*height)),
+	).Intersect(bounds)
+	if rect.Empty() {
+		return image.Rectangle{}, fmt.Errorf("area %s lies outside the %dx%d frame", a, bounds.Dx(), bounds.Dy())
+	}
+	return rect, nil
+}
+
+// Crop returns the part of img covered by the area
+func (a Area) Crop(img image.Image) (image.Image, error) {
+	rect, err := a.Rect(img.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	if rect == img.Bounds() {
+		return img, nil
+	}
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect), nil
+	}
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	return cropped, nil
+}
@@ -0,0 +1,213 @@
+package detector
+
+import (
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestArea_Validate(t *testing.T) {
+	valid := []Area{
+		{},
+		{X: 0.15, Y: 0.09, Width: 0.7, Height: 0.08},
+		{X: 0, Y: 0, Width: 1, Height: 1},
+	}
+	for _, a := range valid {
+		if err := a.Validate(); err != nil {
+			t.Errorf("expected %s to be valid, got %v", a, err)
+		}
+	}
+
+	invalid := []Area{
+		{X: 1.2, Y: 0.1, Width: 0.1, Height: 0.1},
+		{X: 0.5, Y: 0.1, Width: 0.6, Height: 0.1},
+		{X: 0.1, Y: 0.95, Width: 0.1, Height: 0.1},
+		{X: -0.1, Y: 0.1, Width: 0.5, Height: 0.1},
+		{X: 0.1, Y: -0.1, Width: 0.5, Height: 0.1},
+		{X: 0.1, Y: 0.1, Width: -0.5, Height: 0.1},
+		{X: 0.1, Y: 0.1, Width: 0.5, Height: 0},
+		{X: math.NaN(), Y: 0.1, Width: 0.5, Height: 0.1},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected %s to be rejected", a)
+		}
+	}
+}
+
+func TestArea_Rect(t *testing.T) {
+	bounds := image.Rect(0, 0, 720, 1240)
+
+	rect, err := Area{X: 0.15, Y: 0.09, Width: 0.7, Height: 0.08}.Rect(bounds)
+	if err != nil {
+		t.Fatalf("Rect failed: %v", err)
+	}
+	if want := image.Rect(108, 111, 612, 211); rect != want {
+		t.Errorf("expected %v, got %v", want, rect)
+	}
+
+	if rect, err := (Area{}).Rect(bounds); err != nil || rect != bounds {
+		t.Errorf("expected an unset area to cover the frame, got %v, %v", rect, err)
+	}
+}
+
+func TestArea_RectClampsOutOfRange(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+
+	// Over range and negative areas are clamped to the part inside the frame
+	rect, err := Area{X: 0.8, Y: 0.5, Width: 0.5, Height: 0.2}.Rect(bounds)
+	if err != nil {
+		t.Fatalf("Rect failed: %v", err)
+	}
+	if want := image.Rect(80, 50, 100, 70); rect != want {
+		t.Errorf("expected %v, got %v", want, rect)
+	}
+	rect, err = Area{X: -0.2, Y: -0.2, Width: 0.5, Height: 0.5}.Rect(bounds)
+	if err != nil {
+		t.Fatalf("Rect failed: %v", err)
+	}
+	if want := image.Rect(0, 0, 30, 30); rect != want {
+		t.Errorf("expected %v, got %v", want, rect)
+	}
+
+	// Areas entirely outside the frame or empty are errors rather than panics
+	for _, a := range []Area{
+		{X: 1.2, Y: 0.1, Width: 0.5, Height: 0.1},
+		{X: -1, Y: 0.1, Width: 0.5, Height: 0.1},
+		{X: 0.1, Y: 0.1, Width: -0.5, Height: 0.1},
+	} {
+		if _, err := a.Rect(bounds); err == nil {
+			t.Errorf("expected %s to fail", a)
+		}
+		if _, err := a.Crop(image.NewRGBA(bounds)); err == nil {
+			t.Errorf("expected cropping %s to fail", a)
+		}
+	}
+	if _, err := (Area{X: 0.1, Y: 0.1, Width: 0.5, Height: 0.5}).Rect(image.Rectangle{}); err == nil {
+		t.Error("expected an empty frame to fail")
+	}
+}
+
+func TestArea_Crop(t *testing.T) {
+	img := noisyText("LEVEL", 2, 0)
+	cropped, err := Area{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5}.Crop(img)
+	if err != nil {
+		t.Fatalf("Crop failed: %v", err)
+	}
+	b := img.Bounds()
+	if got, want := cropped.Bounds().Size(), image.Pt(b.Dx()-b.Dx()/2, b.Dy()-b.Dy()/2); got != want {
+		t.Errorf("expected size %v, got %v", want, got)
+	}
+	if got, want := cropped.At(cropped.Bounds().Min.X, cropped.Bounds().Min.Y), img.At(b.Dx()/2, b.Dy()/2); got != want {
+		t.Errorf("expected the crop to start at the area origin, got %v want %v", got, want)
+	}
+}
+
+func TestArea_PixelUnitMatchesRatio(t *testing.T) {
+	ratio := Area{Clue: "upgrade", X: 0.15, Y: 0.09, Width: 0.7, Height: 0.08}
+	pixel := Area{Clue: "upgrade", Unit: AreaUnitPixel, RefWidth: 720, RefHeight: 1240, X: 108, Y: 111.6, Width: 504, Height: 99.2}
+
+	if err := pixel.Validate(); err != nil {
+		t.Fatalf("expected %s to be valid, got %v", pixel, err)
+	}
+
+	// The same crop on the reference resolution and on a frame at another resolution
+	for _, bounds := range []image.Rectangle{image.Rect(0, 0, 720, 1240), image.Rect(0, 0, 360, 620)} {
+		want, err := ratio.Rect(bounds)
+		if err != nil {
+			t.Fatalf("Rect failed: %v", err)
+		}
+		got, err := pixel.Rect(bounds)
+		if err != nil {
+			t.Fatalf("Rect failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("frame %v: expected pixel area to crop %v, got %v", bounds, want, got)
+		}
+	}
+}
+
+func TestArea_PixelUnitValidate(t *testing.T) {
+	invalid := []Area{
+		{Unit: AreaUnitPixel, X: 10, Y: 10, Width: 100, Height: 20},
+		{Unit: AreaUnitPixel, RefWidth: 720, X: 10, Y: 10, Width: 100, Height: 20},
+		{Unit: AreaUnitPixel, RefWidth: 720, RefHeight: 1240, X: 700, Y: 10, Width: 100, Height: 20},
+		{Unit: "percent", X: 10, Y: 10, Width: 10, Height: 10},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected %s unit %q ref %dx%d to be rejected", a, a.Unit, a.RefWidth, a.RefHeight)
+		}
+		if _, err := a.Rect(image.Rect(0, 0, 720, 1240)); a.RefHeight == 0 && err == nil {
+			t.Errorf("expected %s without a reference resolution to fail to crop", a)
+		}
+	}
+
+	if err := (Area{Unit: AreaUnitRatio, X: 0.1, Y: 0.1, Width: 0.5, Height: 0.5}).Validate(); err != nil {
+		t.Errorf("expected an explicit ratio area to be valid, got %v", err)
+	}
+}
+
+// darkMethod matches frames that are mostly dark and remembers the size of the frame it saw
+type darkMethod struct {
+	size image.Point
+}
+
+func (m *darkMethod) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	img, err := frame.Image()
+	if err != nil {
+		return false, "", err
+	}
+	bounds := img.Bounds()
+	m.size = bounds.Size()
+	var total uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			total += uint64(r >> 8)
+		}
+	}
+	return total/uint64(bounds.Dx()*bounds.Dy()) < 128, "dark", nil
+}
+
+func TestDefaultOcrDetector_CropsToArea(t *testing.T) {
+	method := &darkMethod{}
+	name := t.Name() + "/dark"
+	RegisterMethod(name, method)
+
+	// A light frame with a dark band down its left 30%
+	frame := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			if x < 30 {
+				c = color.RGBA{A: 255}
+			}
+			frame.SetRGBA(x, y, c)
+		}
+	}
+	encoded := base64.StdEncoding.EncodeToString(encodePNG(t, frame))
+	reco := Reco{Methods: []string{name}}
+	stages := []*Stage{
+		{Number: 1, Reco: reco},
+		{Number: 2, Area: Area{Clue: "band", X: 0, Y: 0.25, Width: 0.3, Height: 0.5}, Reco: reco},
+	}
+	detector := NewDefaultOcrDetector(stages, nil, nil)
+	ctx := context.Background()
+
+	if match, _, err := detector.Detect(ctx, "test-game", 1, encoded); err != nil || match {
+		t.Errorf("expected the whole frame not to match, got %v, %v", match, err)
+	}
+	if method.size != (image.Point{X: 100, Y: 80}) {
+		t.Errorf("expected the whole frame without an area, got %v", method.size)
+	}
+	if match, _, err := detector.Detect(ctx, "test-game", 2, encoded); err != nil || !match {
+		t.Errorf("expected the cropped band to match, got %v, %v", match, err)
+	}
+	if method.size != (image.Point{X: 30, Y: 40}) {
+		t.Errorf("expected the method to see only the area, got %v", method.size)
+	}
+}
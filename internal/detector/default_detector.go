@@ -6,33 +6,53 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"os"
 	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/letusgogo/quick/logger"
 )
 
-func NewDefaultOcrDetector(stages []*Stage) StageChecker {
+// NewDefaultOcrDetector creates an OCR detector, preprocess applies to stages whose reco does not set its own.
+// Frames are dumped through dumper, nil disables dumping.
+func NewDefaultOcrDetector(stages []*Stage, preprocess *Preprocess, dumper *Dumper) StageChecker {
 	stageMap := make(map[int]*Stage)
 	for _, stage := range stages {
 		stageMap[stage.Number] = stage
 	}
 	return &DefaultOcrDetector{
-		stageMap: stageMap,
+		stageMap:   stageMap,
+		preprocess: preprocess,
+		dumper:     dumper,
 	}
 }
 
 type DefaultOcrDetector struct {
-	stageMap map[int]*Stage
+	stageMap   map[int]*Stage
+	preprocess *Preprocess
+	dumper     *Dumper
+}
+
+// preprocessFor returns the preprocessing steps for a stage
+func (d *DefaultOcrDetector) preprocessFor(stage *Stage) *Preprocess {
+	if stage.Reco.Preprocess != nil {
+		return stage.Reco.Preprocess
+	}
+	return d.preprocess
 }
 
 func (d *DefaultOcrDetector) Detect(ctx context.Context, game string, currentStageNum int, imgBase64 string) (match bool, evidence string, err error) {
-	stage, ok := d.stageMap[currentStageNum]
-	if !ok {
-		return false, "", fmt.Errorf("stage %d not found", currentStageNum)
+	detection, err := d.DetectFrame(ctx, game, currentStageNum, imgBase64)
+	if err != nil {
+		return false, "", err
+	}
+	return detection.Match, detection.Evidence, nil
+}
+
+// DetectFrame detects the stage and returns the frame the detection methods ran on
+func (d *DefaultOcrDetector) DetectFrame(ctx context.Context, game string, currentStageNum int, imgBase64 string) (*Detection, error) {
+	if _, ok := d.stageMap[currentStageNum]; !ok {
+		return nil, fmt.Errorf("stage %d not found", currentStageNum)
 	}
 
 	// Remove data URL prefix if present (e.g., "data:image/png;base64,")
@@ -45,57 +65,70 @@ func (d *DefaultOcrDetector) Detect(ctx context.Context, game string, currentSta
 		}
 	}
 
+	if n := base64.StdEncoding.DecodedLen(len(base64Data)); n > MaxFrameBytes {
+		return nil, fmt.Errorf("%w: %d bytes decoded, limit is %d", ErrFrameTooLarge, n, MaxFrameBytes)
+	}
+
 	// Decode base64 image
 	imageData, err := base64.StdEncoding.DecodeString(base64Data)
 	if err != nil {
 		logger.Errorf("Error decoding base64 image: %v", err)
-		return false, "", fmt.Errorf("failed to decode base64 image: %w", err)
+		return nil, fmt.Errorf("failed to decode base64 image: %w", err)
 	}
+	return d.DetectImage(ctx, game, currentStageNum, imageData)
+}
 
-	debugMode := true
+// DetectImage detects the stage on a decoded frame and returns the frame the detection methods ran on
+func (d *DefaultOcrDetector) DetectImage(ctx context.Context, game string, currentStageNum int, imageData []byte) (*Detection, error) {
+	stage, ok := d.stageMap[currentStageNum]
+	if !ok {
+		return nil, fmt.Errorf("stage %d not found", currentStageNum)
+	}
+	if len(imageData) > MaxFrameBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrFrameTooLarge, len(imageData), MaxFrameBytes)
+	}
 
-	var tempImagePath string
+	// The methods only see the stage area. The preprocessed image is handed to them as is, they need not decode the PNG again.
+	processed, imageData, err := d.preprocessFor(stage).applyArea(imageData, stage.Area)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preprocess image: %w", err)
+	}
+	format, err := DetectFormat(imageData)
+	if err != nil {
+		return nil, err
+	}
 
-	// Only create and write image file if debug mode is enabled
-	if debugMode {
-		// Create image file for logging
-		logDir := "logging/game_stage_imgs"
-		timestamp := time.Now().Unix()
-		tempImagePath = filepath.Join(logDir, fmt.Sprintf("cropped_screenshot_%s_%d_%s.png", game, timestamp))
+	// Frames go to the debug dump when it is enabled and under its cap. Otherwise they are only written
+	// to a temporary file once a method asks for one.
+	dumpPath, dumped, err := d.dumper.Write(game, currentStageNum, imageData, formatExt(format))
+	if err != nil {
+		logger.Errorf("Error dumping frame: %v", err)
+		return nil, err
+	}
+	if !dumped {
+		dumpPath = ""
+	}
+	frame := newFrame(imageData, format, processed, dumpPath)
+	defer frame.release()
 
-		// Ensure log directory exists
-		err = os.MkdirAll(logDir, 0755)
-		if err != nil {
-			logger.Errorf("Error creating log directory: %v", err)
-			return false, "", fmt.Errorf("failed to create log directory: %w", err)
-		}
+	match, evidence, err := runMethods(ctx, stage, frame)
+	if err != nil {
+		return nil, err
+	}
+	return &Detection{Match: match, Evidence: evidence, Frame: imageData, Format: format}, nil
+}
 
-		// Write image data to log file
-		err = os.WriteFile(tempImagePath, imageData, 0644)
-		if err != nil {
-			log.Printf("Error writing image to log file: %v", err)
-			return false, "", fmt.Errorf("failed to write image to log file: %w", err)
-		}
-	} else {
-		// In non-debug mode, create a temporary file for OCR processing only
-		tempFile, err := os.CreateTemp("", "ocr_temp_*.png")
-		if err != nil {
-			log.Printf("Error creating temporary file: %v", err)
-			return false, "", fmt.Errorf("failed to create temporary file: %w", err)
-		}
-		defer os.Remove(tempFile.Name()) // Clean up temp file
-		tempImagePath = tempFile.Name()
-
-		// Write image data to temporary file
-		err = os.WriteFile(tempImagePath, imageData, 0644)
-		if err != nil {
-			log.Printf("Error writing image to temporary file: %v", err)
-			return false, "", fmt.Errorf("failed to write image to temporary file: %w", err)
-		}
-		tempFile.Close()
+// detectOCR reads the frame with tesseract and matches the text against the stage keywords
+func detectOCR(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	path, err := frame.File()
+	if err != nil {
+		return false, "", err
+	}
+	if stage.Reco.MinConfidence > 0 {
+		return detectWithConfidence(path, stage.Reco)
 	}
 
-	ocrResult, err := runTesseractOCR(tempImagePath, "eng", 6)
+	ocrResult, err := runTesseractOCR(path, stage.Reco.lang(), stage.Reco.psm())
 	if err != nil {
 		return false, "", fmt.Errorf("failed to run tesseract ocr: %w", err)
 	}
@@ -103,7 +136,7 @@ func (d *DefaultOcrDetector) Detect(ctx context.Context, game string, currentSta
 		return false, "", fmt.Errorf("ocr result is empty")
 	}
 
-	match, _, matchedKeyword := analyzeTextForKeywordWithExactMatch(ocrResult, stage.Reco.Matchs)
+	match, matchedKeyword := stage.Reco.MatchText(ocrResult)
 	if !match {
 		return false, "", nil
 	}
@@ -111,6 +144,58 @@ func (d *DefaultOcrDetector) Detect(ctx context.Context, game string, currentSta
 	return true, matchedKeyword, nil
 }
 
+// allKeywordsMethod reads the frame with tesseract like detectOCR, but the stage keywords only match when the text
+// contains every one of them. The stage's groups still match as they do for detectOCR.
+type allKeywordsMethod struct{}
+
+func (allKeywordsMethod) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	return detectOCR(ctx, allKeywordsStage(stage), frame)
+}
+
+// ValidateReco rejects a reco without keywords, there would be nothing to require
+func (allKeywordsMethod) ValidateReco(r Reco) error {
+	if len(r.Matchs) == 0 {
+		return fmt.Errorf("needs matchs to require all of")
+	}
+	return nil
+}
+
+// allKeywordsStage returns a copy of stage whose keywords form one more group that needs all of them
+func allKeywordsStage(stage *Stage) *Stage {
+	all := *stage
+	all.Reco.Matchs = nil
+	all.Reco.Groups = slices.Clone(stage.Reco.Groups)
+	if len(stage.Reco.Matchs) > 0 {
+		all.Reco.Groups = append(all.Reco.Groups, MatchGroup{Name: "all keywords", All: stage.Reco.Matchs})
+	}
+	return &all
+}
+
+// detectWithConfidence runs tesseract in TSV mode and rejects matches whose words were read with a mean confidence
+// below reco.MinConfidence
+func detectWithConfidence(imagePath string, reco Reco) (bool, string, error) {
+	ocrResult, err := runTesseractTSV(imagePath, reco.lang(), reco.psm())
+	if err != nil {
+		return false, "", fmt.Errorf("failed to run tesseract ocr: %w", err)
+	}
+	if ocrResult.Text == "" {
+		return false, "", fmt.Errorf("ocr result is empty")
+	}
+
+	match, matchedKeyword, terms := reco.matchTerms(ocrResult.Text)
+	if !match {
+		return false, "", nil
+	}
+	// Only the words that matched count, the rest of the screen may be read poorly
+	confidence := ocrResult.TermConfidence(terms)
+	if confidence < reco.MinConfidence {
+		logger.Infof("rejecting ocr match %q with confidence %.1f below %.1f", ocrResult.Text, confidence, reco.MinConfidence)
+		return false, "", nil
+	}
+
+	return true, fmt.Sprintf("%s confidence=%.1f", matchedKeyword, confidence), nil
+}
+
 // runTesseractOCR executes Tesseract OCR on the image file
 func runTesseractOCR(imagePath string, lang string, psm int) (string, error) {
 	// Check if Tesseract is installed
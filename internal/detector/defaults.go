@@ -0,0 +1,96 @@
+package detector
+
+import "fmt"
+
+const (
+	// DefaultLang is the tesseract language stages that set none read with
+	DefaultLang = "eng"
+	// DefaultPSM is the tesseract page segmentation mode stages that set none read with, a uniform block of text
+	DefaultPSM = 6
+	// maxPSM is the highest page segmentation mode tesseract knows
+	maxPSM = 13
+)
+
+const (
+	// MatchModeExact makes matchs equal the whole OCR text, the default
+	MatchModeExact = "exact"
+	// MatchModeContains makes matchs match as whole words anywhere in the OCR text
+	MatchModeContains = "contains"
+)
+
+// RecoDefaults are game-wide reco settings a stage inherits for every field it leaves empty
+type RecoDefaults struct {
+	Method    string `mapstructure:"method"`
+	Lang      string `mapstructure:"lang"`
+	PSM       int    `mapstructure:"psm"`
+	MatchMode string `mapstructure:"match_mode"`
+}
+
+// Validate checks that the defaults name a registered method and known settings
+func (d *RecoDefaults) Validate() error {
+	if d == nil {
+		return nil
+	}
+	if err := retired(d.Method); err != nil {
+		return fmt.Errorf("default %w", err)
+	}
+	if d.Method != "" {
+		if _, ok := LookupMethod(d.Method); !ok {
+			return fmt.Errorf("unknown default reco method %q, registered methods are %v", d.Method, Methods())
+		}
+	}
+	return validateOCRSettings(d.PSM, d.MatchMode)
+}
+
+// Inherit fills the method, lang, psm and match mode the reco leaves empty from d, a nil d changes nothing.
+// Method is only filled when Methods is empty too, since a chain takes precedence over it.
+func (r *Reco) Inherit(d *RecoDefaults) {
+	if d == nil {
+		return
+	}
+	if r.Method == "" && len(r.Methods) == 0 {
+		r.Method = d.Method
+	}
+	if r.Lang == "" {
+		r.Lang = d.Lang
+	}
+	if r.PSM == 0 {
+		r.PSM = d.PSM
+	}
+	if r.MatchMode == "" {
+		r.MatchMode = d.MatchMode
+	}
+}
+
+// ValidateOCR checks the reco's page segmentation mode and match mode
+func (r Reco) ValidateOCR() error {
+	return validateOCRSettings(r.PSM, r.MatchMode)
+}
+
+func validateOCRSettings(psm int, matchMode string) error {
+	if psm < 0 || psm > maxPSM {
+		return fmt.Errorf("psm must be between 0 and %d, got %d", maxPSM, psm)
+	}
+	switch matchMode {
+	case "", MatchModeExact, MatchModeContains:
+		return nil
+	default:
+		return fmt.Errorf("unknown match_mode %q, want %s or %s", matchMode, MatchModeExact, MatchModeContains)
+	}
+}
+
+// lang returns the tesseract language the reco reads with
+func (r Reco) lang() string {
+	if r.Lang != "" {
+		return r.Lang
+	}
+	return DefaultLang
+}
+
+// psm returns the tesseract page segmentation mode the reco reads with
+func (r Reco) psm() int {
+	if r.PSM > 0 {
+		return r.PSM
+	}
+	return DefaultPSM
+}
@@ -0,0 +1,236 @@
+package detector
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+const (
+	// DefaultDumpDir is where detection frames are written for debugging
+	DefaultDumpDir = "logging/game_stage_imgs"
+	// DefaultDumpMaxSize is the soft cap on the dump directory, 1 GiB
+	DefaultDumpMaxSize = 1 << 30
+	// DefaultDumpCheckInterval is how often the dump directory size is measured
+	DefaultDumpCheckInterval = time.Minute
+)
+
+// DumpConfig controls writing detection frames to disk for debugging
+type DumpConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"`
+	// MaxSize is the size in bytes above which dumping pauses until the directory shrinks again, 0 means unlimited
+	MaxSize       int64         `mapstructure:"max_size"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// SampleEvery dumps only every Nth frame offered, 0 or 1 dumps all of them
+	SampleEvery int `mapstructure:"sample_every"`
+	// MaxPerMinute caps the sampled frames written per minute, 0 means uncapped
+	MaxPerMinute int `mapstructure:"max_per_minute"`
+}
+
+// NewDumpConfig returns the dump config used when none is configured
+func NewDumpConfig() DumpConfig {
+	return DumpConfig{
+		Enabled:       true,
+		Dir:           DefaultDumpDir,
+		MaxSize:       DefaultDumpMaxSize,
+		CheckInterval: DefaultDumpCheckInterval,
+	}
+}
+
+// DumpStatus reports whether frames are currently being dumped
+type DumpStatus struct {
+	Enabled   bool   `json:"enabled"`
+	Dir       string `json:"dir,omitempty"`
+	UsedBytes int64  `json:"used_bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+	// Paused is set while the directory is over MaxBytes and frames are not written
+	Paused bool `json:"paused"`
+	// Skipped counts the frames left out by SampleEvery and MaxPerMinute
+	Skipped int64 `json:"skipped"`
+}
+
+// Dumper writes detection frames to the dump directory and stops writing while it is over its size cap
+type Dumper struct {
+	cfg DumpConfig
+
+	mu     sync.Mutex
+	used   int64
+	paused bool
+	// offered counts the frames Write was given while dumping, minuteStart and minuteCount the writes of the current minute
+	offered     int64
+	skipped     int64
+	minuteStart time.Time
+	minuteCount int
+	now         func() time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDumper creates a dumper for cfg
+func NewDumper(cfg DumpConfig) *Dumper {
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultDumpDir
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultDumpCheckInterval
+	}
+	return &Dumper{cfg: cfg, now: time.Now}
+}
+
+// Start measures the dump directory now and then every check interval
+func (d *Dumper) Start() {
+	if d == nil || !d.cfg.Enabled || d.stop != nil {
+		return
+	}
+	d.Check()
+
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.Check()
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic check
+func (d *Dumper) Stop() {
+	if d == nil || d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+	d.stop = nil
+}
+
+// Check measures the dump directory and pauses or resumes dumping around the size cap
+func (d *Dumper) Check() {
+	if d == nil || !d.cfg.Enabled {
+		return
+	}
+
+	used, err := dirSize(d.cfg.Dir)
+	if err != nil {
+		logger.Warnf("failed to measure debug dump directory %s: %v", d.cfg.Dir, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.used = used
+	d.updatePausedLocked()
+}
+
+// updatePausedLocked logs only when dumping pauses or resumes, not on every check
+func (d *Dumper) updatePausedLocked() {
+	over := d.cfg.MaxSize > 0 && d.used >= d.cfg.MaxSize
+	if over && !d.paused {
+		logger.Warnf("debug dump directory %s holds %d bytes, over its %d byte cap, pausing frame dumps", d.cfg.Dir, d.used, d.cfg.MaxSize)
+	} else if !over && d.paused {
+		logger.Infof("debug dump directory %s is back under its %d byte cap, resuming frame dumps", d.cfg.Dir, d.cfg.MaxSize)
+	}
+	d.paused = over
+}
+
+// Write dumps a frame with the file extension ext and returns its path, ok is false when dumping is disabled or paused
+func (d *Dumper) Write(game string, stageNum int, data []byte, ext string) (path string, ok bool, err error) {
+	if d == nil || !d.cfg.Enabled {
+		return "", false, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused {
+		return "", false, nil
+	}
+	now := d.now()
+	if !d.sampleLocked(now) {
+		d.skipped++
+		return "", false, nil
+	}
+
+	if err := os.MkdirAll(d.cfg.Dir, 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	// The frame number keeps sampled frames of one second and stage apart
+	path = filepath.Join(d.cfg.Dir, fmt.Sprintf("cropped_screenshot_%s_%d_%d_%d%s", game, now.Unix(), stageNum, d.offered, ext))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", false, fmt.Errorf("failed to write image to log file: %w", err)
+	}
+
+	// Count the write right away so a burst between checks cannot run far past the cap
+	d.used += int64(len(data))
+	d.updatePausedLocked()
+	return path, true, nil
+}
+
+// sampleLocked counts a frame and reports whether SampleEvery and MaxPerMinute let it be written
+func (d *Dumper) sampleLocked(now time.Time) bool {
+	d.offered++
+	if d.cfg.SampleEvery > 1 && (d.offered-1)%int64(d.cfg.SampleEvery) != 0 {
+		return false
+	}
+	if d.cfg.MaxPerMinute <= 0 {
+		return true
+	}
+	if now.Sub(d.minuteStart) >= time.Minute {
+		d.minuteStart, d.minuteCount = now, 0
+	}
+	if d.minuteCount >= d.cfg.MaxPerMinute {
+		return false
+	}
+	d.minuteCount++
+	return true
+}
+
+// Status returns the dumper state
+func (d *Dumper) Status() DumpStatus {
+	if d == nil {
+		return DumpStatus{}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := DumpStatus{Enabled: d.cfg.Enabled, UsedBytes: d.used, MaxBytes: d.cfg.MaxSize, Paused: d.paused, Skipped: d.skipped}
+	if d.cfg.Enabled {
+		status.Dir = d.cfg.Dir
+	}
+	return status
+}
+
+// dirSize sums the sizes of the regular files under dir, a missing dir is empty
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
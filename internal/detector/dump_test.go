@@ -0,0 +1,134 @@
+package detector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDumper_PausesOverCapAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: dir, MaxSize: 100})
+	dumper.Check()
+
+	path, ok, err := dumper.Write("test-game", 1, make([]byte, 60), ".png")
+	if err != nil || !ok {
+		t.Fatalf("expected the first frame to be dumped, got %v, %v", ok, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected %s to exist: %v", path, err)
+	}
+	if dumper.Status().Paused {
+		t.Fatal("expected dumping to continue under the cap")
+	}
+
+	// The write that crosses the cap pauses dumping right away
+	if _, ok, err := dumper.Write("test-game", 2, make([]byte, 60), ".png"); err != nil || !ok {
+		t.Fatalf("expected the second frame to be dumped, got %v, %v", ok, err)
+	}
+	status := dumper.Status()
+	if !status.Paused || status.UsedBytes != 120 || status.MaxBytes != 100 || status.Dir != dir {
+		t.Fatalf("expected a paused status over the cap, got %+v", status)
+	}
+	if _, ok, err := dumper.Write("test-game", 3, make([]byte, 10), ".png"); err != nil || ok {
+		t.Errorf("expected no dump while paused, got %v, %v", ok, err)
+	}
+
+	// Freeing space resumes dumping on the next check
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dumper.Check()
+	if status := dumper.Status(); status.Paused || status.UsedBytes != 0 {
+		t.Errorf("expected dumping to resume after space was freed, got %+v", status)
+	}
+	if _, ok, err := dumper.Write("test-game", 4, make([]byte, 10), ".png"); err != nil || !ok {
+		t.Errorf("expected frames to be dumped again, got %v, %v", ok, err)
+	}
+}
+
+func TestDumper_CheckMeasuresExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.png"), make([]byte, 200), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: dir, MaxSize: 100})
+	dumper.Start()
+	defer dumper.Stop()
+
+	if status := dumper.Status(); !status.Paused || status.UsedBytes != 200 {
+		t.Errorf("expected a directory already over the cap to pause dumping, got %+v", status)
+	}
+}
+
+func TestDumper_Disabled(t *testing.T) {
+	var nilDumper *Dumper
+	for _, dumper := range []*Dumper{nilDumper, NewDumper(DumpConfig{Dir: t.TempDir()})} {
+		if _, ok, err := dumper.Write("test-game", 1, []byte("frame"), ".png"); err != nil || ok {
+			t.Errorf("expected a disabled dumper not to write, got %v, %v", ok, err)
+		}
+		if status := dumper.Status(); status.Enabled || status.Paused {
+			t.Errorf("expected a disabled status, got %+v", status)
+		}
+	}
+}
+
+func TestDumper_MissingDirIsEmpty(t *testing.T) {
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: filepath.Join(t.TempDir(), "not-yet"), MaxSize: 100})
+	dumper.Check()
+	if status := dumper.Status(); status.Paused || status.UsedBytes != 0 {
+		t.Errorf("expected a missing directory to count as empty, got %+v", status)
+	}
+}
+
+func TestDumper_SamplesEveryNthFrame(t *testing.T) {
+	dir := t.TempDir()
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: dir, SampleEvery: 10})
+
+	for i := 0; i < 200; i++ {
+		if _, _, err := dumper.Write("test-game", 1, []byte("frame"), ".png"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 20 {
+		t.Errorf("expected 1 in 10 of 200 frames to be dumped, got %d files", len(entries))
+	}
+	if status := dumper.Status(); status.Skipped != 180 {
+		t.Errorf("expected 180 skipped frames, got %+v", status)
+	}
+}
+
+func TestDumper_CapsFramesPerMinute(t *testing.T) {
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: t.TempDir(), MaxPerMinute: 3})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dumper.now = func() time.Time { return now }
+
+	written := 0
+	for i := 0; i < 10; i++ {
+		if _, ok, err := dumper.Write("test-game", 1, []byte("frame"), ".png"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		} else if ok {
+			written++
+		}
+	}
+	if written != 3 {
+		t.Errorf("expected 3 frames within the minute, got %d", written)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, err := dumper.Write("test-game", 1, []byte("frame"), ".png"); err != nil || !ok {
+		t.Errorf("expected a frame to be dumped in the next minute, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,43 @@
+package detector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// FormatPNG is the format of PNG frames and of every preprocessed frame
+	FormatPNG = "png"
+	// FormatJPEG is the format of JPEG frames
+	FormatJPEG = "jpeg"
+)
+
+// ErrUnsupportedFormat is returned for frames that are neither PNG nor JPEG
+var ErrUnsupportedFormat = errors.New("unsupported frame format")
+
+// DetectFormat returns the format of an encoded frame, sniffed from its bytes
+func DetectFormat(data []byte) (string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	switch format {
+	case FormatPNG, FormatJPEG:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// formatExt returns the file extension tesseract expects for format
+func formatExt(format string) string {
+	if format == FormatJPEG {
+		return ".jpg"
+	}
+	return ".png"
+}
@@ -0,0 +1,100 @@
+package detector
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, noisyText("LEVEL", 2, 0), nil); err != nil {
+		t.Fatalf("failed to encode jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"png", encodePNG(t, noisyText("LEVEL", 2, 0)), FormatPNG},
+		{"jpeg", encodeJPEG(t), FormatJPEG},
+	}
+	for _, c := range cases {
+		got, err := DetectFormat(c.data)
+		if err != nil {
+			t.Errorf("%s: DetectFormat failed: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: expected format %q, got %q", c.name, c.want, got)
+		}
+	}
+
+	if _, err := DetectFormat([]byte("not an image")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected %v for garbage, got %v", ErrUnsupportedFormat, err)
+	}
+}
+
+// frameMethod records the frame it was given
+type frameMethod struct {
+	frame   Frame
+	path    string
+	onDisk  []byte
+	readErr error
+}
+
+func (m *frameMethod) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	m.frame = frame
+	path, err := frame.File()
+	if err != nil {
+		m.readErr = err
+		return true, "seen", nil
+	}
+	m.path = path
+	m.onDisk, m.readErr = os.ReadFile(path)
+	return true, "seen", nil
+}
+
+func TestDefaultOcrDetector_JPEGFrame(t *testing.T) {
+	method := &frameMethod{}
+	name := t.Name() + "/frame"
+	RegisterMethod(name, method)
+
+	dir := t.TempDir()
+	dumper := NewDumper(DumpConfig{Enabled: true, Dir: dir})
+	stages := []*Stage{{Number: 1, Reco: Reco{Methods: []string{name}}}}
+	data := encodeJPEG(t)
+
+	detection, err := NewDefaultOcrDetector(stages, nil, dumper).(FrameDetector).DetectFrame(context.Background(), "test-game", 1, base64.StdEncoding.EncodeToString(data))
+	if err != nil {
+		t.Fatalf("DetectFrame failed: %v", err)
+	}
+	if detection.Format != FormatJPEG || method.frame.Format != FormatJPEG {
+		t.Errorf("expected format %q, got %q on the detection and %q on the frame", FormatJPEG, detection.Format, method.frame.Format)
+	}
+	if filepath.Ext(method.path) != ".jpg" || filepath.Dir(method.path) != dir {
+		t.Errorf("expected the frame dumped as .jpg under %s, got %s", dir, method.path)
+	}
+	if method.readErr != nil || !bytes.Equal(method.onDisk, data) {
+		t.Errorf("expected the jpeg bytes on disk, got %d bytes, %v", len(method.onDisk), method.readErr)
+	}
+}
+
+func TestDefaultOcrDetector_RejectsUnknownFormat(t *testing.T) {
+	stages := []*Stage{{Number: 1}}
+	image := base64.StdEncoding.EncodeToString([]byte("not an image"))
+	_, _, err := NewDefaultOcrDetector(stages, nil, nil).Detect(context.Background(), "test-game", 1, image)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedFormat, err)
+	}
+}
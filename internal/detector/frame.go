@@ -0,0 +1,106 @@
+package detector
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+)
+
+// Frame is the preprocessed image a detection method looks at.
+// The decoded image and the file on disk are made at most once per detection and shared by every method.
+type Frame struct {
+	Data   []byte // encoded image
+	Format string // FormatPNG or FormatJPEG
+	shared *frameShared
+}
+
+// frameShared holds what the methods of one detection share
+type frameShared struct {
+	decodeOnce sync.Once
+	img        image.Image
+	decodeErr  error
+
+	fileMu sync.Mutex
+	path   string
+	temp   bool // path is a temporary file of this frame, removed by release
+}
+
+// newFrame creates the frame of one detection, img is the already decoded image or nil and
+// path the file the frame was dumped to or empty
+func newFrame(data []byte, format string, img image.Image, path string) Frame {
+	shared := &frameShared{path: path}
+	if img != nil {
+		shared.decodeOnce.Do(func() { shared.img = img })
+	}
+	return Frame{Data: data, Format: format, shared: shared}
+}
+
+// Image returns the decoded frame, decoding it on first use
+func (f Frame) Image() (image.Image, error) {
+	if f.shared == nil {
+		return decodeFrame(f.Data)
+	}
+	f.shared.decodeOnce.Do(func() {
+		f.shared.img, f.shared.decodeErr = decodeFrame(f.Data)
+	})
+	return f.shared.img, f.shared.decodeErr
+}
+
+// File returns the frame written to disk with the extension of its format, for tools such as tesseract.
+// It is written on first use, methods working in memory never touch the disk.
+func (f Frame) File() (string, error) {
+	if f.shared == nil {
+		return "", fmt.Errorf("frame has no file")
+	}
+	f.shared.fileMu.Lock()
+	defer f.shared.fileMu.Unlock()
+	if f.shared.path != "" {
+		return f.shared.path, nil
+	}
+
+	file, err := os.CreateTemp("", "ocr_temp_*"+formatExt(f.Format))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_, err = file.Write(f.Data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write image to temporary file: %w", err)
+	}
+	f.shared.path = file.Name()
+	f.shared.temp = true
+	return f.shared.path, nil
+}
+
+// release removes the temporary file of the frame, dumped frames stay
+func (f Frame) release() {
+	if f.shared == nil {
+		return
+	}
+	f.shared.fileMu.Lock()
+	defer f.shared.fileMu.Unlock()
+	if f.shared.temp {
+		os.Remove(f.shared.path)
+		f.shared.path, f.shared.temp = "", false
+	}
+}
+
+func decodeFrame(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	if pixels := float64(cfg.Width) * float64(cfg.Height); pixels > MaxFramePixels {
+		return nil, fmt.Errorf("%w: %dx%d frame exceeds %d pixels", ErrFrameTooLarge, cfg.Width, cfg.Height, MaxFramePixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return img, nil
+}
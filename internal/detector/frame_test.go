@@ -0,0 +1,127 @@
+package detector
+
+import (
+	"context"
+	"encoding/base64"
+	"image"
+	"os"
+	"sync"
+	"testing"
+)
+
+// sharingMethod records the decoded image and file it got from the frame
+type sharingMethod struct {
+	mu     sync.Mutex
+	images []image.Image
+	paths  []string
+	file   bool // ask for the frame on disk
+}
+
+func (m *sharingMethod) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	img, err := frame.Image()
+	if err != nil {
+		return false, "", err
+	}
+	path := ""
+	if m.file {
+		if path, err = frame.File(); err != nil {
+			return false, "", err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.images = append(m.images, img)
+	m.paths = append(m.paths, path)
+	return false, "", nil
+}
+
+func TestDefaultOcrDetector_SharesFrameAcrossMethods(t *testing.T) {
+	memory, disk := &sharingMethod{}, &sharingMethod{file: true}
+	RegisterMethod(t.Name()+"/memory", memory)
+	RegisterMethod(t.Name()+"/disk", disk)
+	stages := []*Stage{{Number: 1, Reco: Reco{
+		Methods:    []string{t.Name() + "/memory", t.Name() + "/disk", t.Name() + "/disk"},
+		Preprocess: &Preprocess{Grayscale: true},
+	}}}
+	frame := base64.StdEncoding.EncodeToString(encodePNG(t, noisyText("LEVEL", 2, 0)))
+
+	if _, _, err := NewDefaultOcrDetector(stages, nil, nil).Detect(context.Background(), "test-game", 1, frame); err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+
+	images := append(memory.images, disk.images...)
+	if len(images) != 3 {
+		t.Fatalf("Expected 3 method calls, got %d", len(images))
+	}
+	if _, ok := images[0].(*image.Gray); !ok {
+		t.Errorf("Expected the preprocessed image, got %T", images[0])
+	}
+	for _, img := range images[1:] {
+		if img != images[0] {
+			t.Errorf("Expected every method to get the same decoded image")
+		}
+	}
+	if len(disk.paths) != 2 || disk.paths[0] == "" || disk.paths[0] != disk.paths[1] {
+		t.Fatalf("Expected both disk methods to share one file, got %v", disk.paths)
+	}
+	if _, err := os.Stat(disk.paths[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed after the detection, got %v", err)
+	}
+}
+
+func TestFrame_InMemoryMethodsWriteNoFile(t *testing.T) {
+	frame := newFrame(encodePNG(t, noisyText("LEVEL", 2, 0)), FormatPNG, nil, "")
+	if _, err := frame.Image(); err != nil {
+		t.Fatalf("Image failed: %v", err)
+	}
+	if frame.shared.path != "" {
+		t.Errorf("Expected no file for a frame only decoded, got %s", frame.shared.path)
+	}
+	frame.release()
+
+	// A dumped frame keeps its file
+	dumped := newFrame(nil, FormatPNG, nil, "dumped.png")
+	if path, _ := dumped.File(); path != "dumped.png" {
+		t.Errorf("Expected the dump path, got %s", path)
+	}
+	dumped.release()
+	if dumped.shared.path != "dumped.png" {
+		t.Errorf("Expected release to keep the dumped file")
+	}
+}
+
+// BenchmarkDetectFrame_MultiMethod runs a stage with three methods, "shared" is the detector's own frame and
+// "per_method" what every method did before: decode the frame and write its own file
+func BenchmarkDetectFrame_MultiMethod(b *testing.B) {
+	data := encodePNG(b, noisyText("LEVEL", 2, 0))
+
+	b.Run("shared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			frame := newFrame(data, FormatPNG, nil, "")
+			for m := 0; m < 3; m++ {
+				if _, err := frame.Image(); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := frame.File(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			frame.release()
+		}
+	})
+
+	b.Run("per_method", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for m := 0; m < 3; m++ {
+				if _, err := decodeFrame(data); err != nil {
+					b.Fatal(err)
+				}
+				frame := newFrame(data, FormatPNG, nil, "")
+				if _, err := frame.File(); err != nil {
+					b.Fatal(err)
+				}
+				frame.release()
+			}
+		}
+	})
+}
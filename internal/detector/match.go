@@ -0,0 +1,170 @@
+package detector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MatchGroup matches OCR text by the keywords it contains as whole words, ignoring case, whitespace and punctuation.
+// The text matches when it contains every All term, at least one Any term if Any is set, and no None term.
+type MatchGroup struct {
+	Name string   `mapstructure:"name"` // shown in the evidence, defaults to the group's position
+	All  []string `mapstructure:"all"`
+	Any  []string `mapstructure:"any"`
+	None []string `mapstructure:"none"`
+}
+
+// label names the group in evidence and errors
+func (g MatchGroup) label(index int) string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// Validate checks that the group has a positive term and no empty ones
+func (g MatchGroup) Validate() error {
+	if len(g.All) == 0 && len(g.Any) == 0 {
+		return fmt.Errorf("needs at least one all or any term")
+	}
+	for _, terms := range [][]string{g.All, g.Any, g.None} {
+		for _, term := range terms {
+			if len(ocrTokens(term)) == 0 {
+				return fmt.Errorf("has an empty term")
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether text satisfies the group, the evidence lists the terms that made it match
+func (g MatchGroup) Match(text string) (bool, string) {
+	match, evidence, _ := g.match(text)
+	return match, evidence
+}
+
+// match is Match that also returns the terms found in the text
+func (g MatchGroup) match(text string) (bool, string, []string) {
+	tokens := ocrTokens(text)
+	contains := func(term string) bool {
+		return containsTokens(tokens, ocrTokens(term))
+	}
+
+	for _, term := range g.None {
+		if contains(term) {
+			return false, "", nil
+		}
+	}
+	for _, term := range g.All {
+		if !contains(term) {
+			return false, "", nil
+		}
+	}
+
+	var parts []string
+	terms := append([]string(nil), g.All...)
+	if len(g.All) > 0 {
+		parts = append(parts, fmt.Sprintf("all %q", g.All))
+	}
+	if len(g.Any) > 0 {
+		hit := ""
+		for _, term := range g.Any {
+			if contains(term) {
+				hit = term
+				break
+			}
+		}
+		if hit == "" {
+			return false, "", nil
+		}
+		parts = append(parts, fmt.Sprintf("any %q", hit))
+		terms = append(terms, hit)
+	}
+	if len(g.None) > 0 {
+		parts = append(parts, fmt.Sprintf("none %q", g.None))
+	}
+	return true, strings.Join(parts, ", "), terms
+}
+
+// ValidateGroups checks every match group of the reco
+func (r Reco) ValidateGroups() error {
+	for i, group := range r.Groups {
+		if err := group.Validate(); err != nil {
+			return fmt.Errorf("match group %s %w", group.label(i), err)
+		}
+	}
+	return nil
+}
+
+// MatchText matches OCR text against Matchs, which must equal the whole text unless MatchMode is contains,
+// and then against each group in order
+func (r Reco) MatchText(text string) (bool, string) {
+	match, evidence, _ := r.matchTerms(text)
+	return match, evidence
+}
+
+// matchTerms is MatchText that also returns the terms found in the text, or nil when the whole text matched
+func (r Reco) matchTerms(text string) (bool, string, []string) {
+	if r.MatchMode == MatchModeContains {
+		tokens := ocrTokens(text)
+		for _, keyword := range r.Matchs {
+			if term := ocrTokens(keyword); len(term) > 0 && containsTokens(tokens, term) {
+				return true, fmt.Sprintf("contains %q", keyword), []string{keyword}
+			}
+		}
+	} else if match, _, keyword := analyzeTextForKeywordWithExactMatch(text, r.Matchs); match {
+		return true, keyword, nil
+	}
+	for i, group := range r.Groups {
+		if match, evidence, terms := group.match(text); match {
+			return true, fmt.Sprintf("group %s: %s", group.label(i), evidence), terms
+		}
+	}
+	return false, "", nil
+}
+
+// ocrTokens splits lowercased text into words at whitespace and punctuation, so terms match across OCR line
+// breaks but not inside other words. Scripts written without spaces, such as Chinese, give a token per character.
+func ocrTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// containsTokens reports whether term appears in tokens as a run of whole tokens
+func containsTokens(tokens, term []string) bool {
+	return tokenIndex(tokens, term) >= 0
+}
+
+// tokenIndex returns where term starts as a run of whole tokens in tokens, -1 when it does not appear
+func tokenIndex(tokens, term []string) int {
+	if len(term) == 0 {
+		return -1
+	}
+	for i := 0; i+len(term) <= len(tokens); i++ {
+		if slices.Equal(tokens[i:i+len(term)], term) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,84 @@
+package detector
+
+import "testing"
+
+func TestMatchGroup_Match(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		group MatchGroup
+		text  string
+		match bool
+	}{
+		{"all present", MatchGroup{All: []string{"level", "upgrade"}}, "Upgrade your\nLEVEL now", true},
+		{"all missing one", MatchGroup{All: []string{"level", "upgrade"}}, "Upgrade now", false},
+		{"any one present", MatchGroup{Any: []string{"victory", "you win"}}, "YOU WIN!", true},
+		{"any none present", MatchGroup{Any: []string{"victory", "you win"}}, "try again", false},
+		{"all and any", MatchGroup{All: []string{"level"}, Any: []string{"2", "3"}}, "level 3", true},
+		{"all without any", MatchGroup{All: []string{"level"}, Any: []string{"2", "3"}}, "level 1", false},
+		{"not excluded", MatchGroup{All: []string{"level"}, None: []string{"locked"}}, "level 2", true},
+		{"excluded", MatchGroup{All: []string{"level"}, None: []string{"locked"}}, "level 2 locked", false},
+		{"excluded only as a word", MatchGroup{All: []string{"level"}, None: []string{"locked"}}, "level unlocked", true},
+		{"any only as a word", MatchGroup{All: []string{"level"}, Any: []string{"2"}}, "level 12", false},
+		{"excluded across spaces", MatchGroup{Any: []string{"play"}, None: []string{"game over"}}, "play again? GAME  OVER", false},
+	} {
+		if match, _ := tc.group.Match(tc.text); match != tc.match {
+			t.Errorf("%s: expected match %v for %q", tc.name, tc.match, tc.text)
+		}
+	}
+}
+
+func TestReco_MatchText(t *testing.T) {
+	reco := Reco{
+		Matchs: []string{"Update"},
+		Groups: []MatchGroup{
+			{Name: "unlock", All: []string{"level", "unlocked"}, None: []string{"locked!"}},
+			{Any: []string{"victory", "you win"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		text     string
+		match    bool
+		evidence string
+	}{
+		// The flat list still needs the whole text to equal a keyword
+		{"update", true, "keyword_1"},
+		{"update now", false, ""},
+		{"Level 3 unlocked", true, `group unlock: all ["level" "unlocked"], none ["locked!"]`},
+		{"Level 3 locked!", false, ""},
+		{"Victory", true, `group #2: any "victory"`},
+	} {
+		match, evidence := reco.MatchText(tc.text)
+		if match != tc.match || evidence != tc.evidence {
+			t.Errorf("%q: expected %v %q, got %v %q", tc.text, tc.match, tc.evidence, match, evidence)
+		}
+	}
+}
+
+func TestReco_MatchTextContains(t *testing.T) {
+	reco := Reco{Matchs: []string{"level to"}, MatchMode: MatchModeContains}
+	if match, evidence := reco.MatchText("Upgrade LEVEL\nto 3"); !match || evidence != `contains "level to"` {
+		t.Errorf("Expected a contains match, got %v %q", match, evidence)
+	}
+	if match, _ := reco.MatchText("Upgrade now"); match {
+		t.Errorf("Expected no match without the keyword")
+	}
+	if match, _ := reco.MatchText("Levels to unlock"); match {
+		t.Errorf("Expected no match when the keyword is only part of a word")
+	}
+}
+
+func TestReco_ValidateGroups(t *testing.T) {
+	valid := Reco{Groups: []MatchGroup{{All: []string{"a"}, None: []string{"b"}}}}
+	if err := valid.ValidateGroups(); err != nil {
+		t.Errorf("Expected a valid group, got %v", err)
+	}
+	for _, group := range []MatchGroup{
+		{None: []string{"b"}},
+		{Any: []string{"a", " "}},
+	} {
+		if err := (Reco{Groups: []MatchGroup{group}}).ValidateGroups(); err == nil {
+			t.Errorf("Expected %+v to be rejected", group)
+		}
+	}
+}
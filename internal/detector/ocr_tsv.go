@@ -0,0 +1,138 @@
+package detector
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// tsvWordLevel is the tesseract TSV level of word rows
+const tsvWordLevel = 5
+
+// OcrResult is the text tesseract read and the mean confidence of its words
+type OcrResult struct {
+	Text       string
+	Confidence float64 // 0-100, mean over the recognized words
+	Words      []OcrWord
+}
+
+// OcrWord is a word tesseract read and its confidence
+type OcrWord struct {
+	Text       string
+	Confidence float64 // 0-100
+}
+
+// runTesseractTSV executes Tesseract OCR with TSV output on the image file
+func runTesseractTSV(imagePath string, lang string, psm int) (*OcrResult, error) {
+	if !isTesseractInstalled() {
+		return nil, fmt.Errorf("Tesseract OCR is not installed. Please install tesseract-ocr package")
+	}
+
+	cmd := exec.Command("tesseract", imagePath, "stdout", "-l", lang, "--psm", fmt.Sprint(psm), "-c", "tessedit_create_tsv=1")
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tesseract command failed: %w, stderr: %s", err, stderr.String())
+	}
+
+	return parseTesseractTSV(stdout.String())
+}
+
+// parseTesseractTSV joins the words of tesseract TSV output and averages their confidence
+func parseTesseractTSV(tsv string) (*OcrResult, error) {
+	lines := strings.Split(strings.TrimRight(tsv, "\n"), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return &OcrResult{}, nil
+	}
+
+	header := strings.Split(strings.TrimRight(lines[0], "\r"), "\t")
+	levelCol, confCol, textCol := -1, -1, -1
+	for i, name := range header {
+		switch name {
+		case "level":
+			levelCol = i
+		case "conf":
+			confCol = i
+		case "text":
+			textCol = i
+		}
+	}
+	if levelCol < 0 || confCol < 0 || textCol < 0 {
+		return nil, fmt.Errorf("tesseract tsv header is missing level, conf or text: %q", lines[0])
+	}
+
+	var words []string
+	var recognized []OcrWord
+	var total float64
+	for n, line := range lines[1:] {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) <= levelCol || len(fields) <= confCol {
+			continue
+		}
+		if level, err := strconv.Atoi(fields[levelCol]); err != nil || level != tsvWordLevel {
+			continue
+		}
+		text := ""
+		if len(fields) > textCol {
+			text = strings.TrimSpace(fields[textCol])
+		}
+		conf, err := strconv.ParseFloat(fields[confCol], 64)
+		if err != nil {
+			return nil, fmt.Errorf("tesseract tsv line %d has invalid confidence %q: %w", n+2, fields[confCol], err)
+		}
+		// Tesseract reports -1 for rows that hold no recognized text
+		if text == "" || conf < 0 {
+			continue
+		}
+		words = append(words, text)
+		recognized = append(recognized, OcrWord{Text: text, Confidence: conf})
+		total += conf
+	}
+
+	result := &OcrResult{Text: strings.Join(words, " "), Words: recognized}
+	if len(words) > 0 {
+		result.Confidence = total / float64(len(words))
+	}
+	return result, nil
+}
+
+// TermConfidence averages the confidence of the words the terms were read from, each term taking the
+// first run of words that holds it as whole tokens. Without terms, or when no run holds them, it is
+// the mean over all words.
+func (r *OcrResult) TermConfidence(terms []string) float64 {
+	// Tokens of the text, each remembering the word it came from
+	var tokens []string
+	var wordOf []int
+	for i, word := range r.Words {
+		for _, token := range ocrTokens(word.Text) {
+			tokens = append(tokens, token)
+			wordOf = append(wordOf, i)
+		}
+	}
+
+	matched := make(map[int]bool)
+	for _, term := range terms {
+		termTokens := ocrTokens(term)
+		start := tokenIndex(tokens, termTokens)
+		if start < 0 {
+			continue
+		}
+		for i := start; i < start+len(termTokens); i++ {
+			matched[wordOf[i]] = true
+		}
+	}
+	if len(matched) == 0 {
+		return r.Confidence
+	}
+	var total float64
+	for i := range matched {
+		total += r.Words[i].Confidence
+	}
+	return total / float64(len(matched))
+}
@@ -0,0 +1,83 @@
+package detector
+
+import (
+	"math"
+	"testing"
+)
+
+const sampleTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t504\t88\t-1\t\n" +
+	"2\t1\t1\t0\t0\t0\t24\t20\t461\t46\t-1\t\n" +
+	"3\t1\t1\t1\t0\t0\t24\t20\t461\t46\t-1\t\n" +
+	"4\t1\t1\t1\t1\t0\t24\t20\t461\t46\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t24\t20\t180\t46\t96.512344\tlevel\n" +
+	"5\t1\t1\t1\t1\t2\t220\t20\t60\t46\t89.487656\tto\n" +
+	"5\t1\t1\t1\t1\t3\t300\t20\t40\t46\t-1\t \n"
+
+func TestParseTesseractTSV(t *testing.T) {
+	result, err := parseTesseractTSV(sampleTSV)
+	if err != nil {
+		t.Fatalf("parseTesseractTSV failed: %v", err)
+	}
+	if result.Text != "level to" {
+		t.Errorf("expected text %q, got %q", "level to", result.Text)
+	}
+	if math.Abs(result.Confidence-93) > 1e-6 {
+		t.Errorf("expected confidence 93, got %f", result.Confidence)
+	}
+}
+
+func TestParseTesseractTSV_Empty(t *testing.T) {
+	for _, tsv := range []string{"", "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"} {
+		result, err := parseTesseractTSV(tsv)
+		if err != nil {
+			t.Fatalf("parseTesseractTSV failed: %v", err)
+		}
+		if result.Text != "" || result.Confidence != 0 {
+			t.Errorf("expected an empty result, got %+v", result)
+		}
+	}
+}
+
+func TestParseTesseractTSV_Invalid(t *testing.T) {
+	if _, err := parseTesseractTSV("level\tleft\ttop\n5\t1\t2\n"); err == nil {
+		t.Error("expected a header without conf and text to be rejected")
+	}
+	if _, err := parseTesseractTSV("level\tconf\ttext\n5\tabc\tlevel\n"); err == nil {
+		t.Error("expected an invalid confidence to be rejected")
+	}
+}
+
+func TestOcrResult_TermConfidence(t *testing.T) {
+	tsv := "level\tconf\ttext\n" +
+		"5\t20\tblurry\n" +
+		"5\t10\tbackground\n" +
+		"5\t90\tlevel\n" +
+		"5\t80\tup\n" +
+		"5\t30\tnoise\n"
+	result, err := parseTesseractTSV(tsv)
+	if err != nil {
+		t.Fatalf("parseTesseractTSV failed: %v", err)
+	}
+	if math.Abs(result.Confidence-46) > 1e-6 {
+		t.Fatalf("expected mean confidence 46, got %f", result.Confidence)
+	}
+
+	// A match on "level up" is as good as the two words it was read from
+	if got := result.TermConfidence([]string{"Level Up"}); math.Abs(got-85) > 1e-6 {
+		t.Errorf("expected confidence 85 over the matched words, got %f", got)
+	}
+	reco := Reco{MatchMode: MatchModeContains, Matchs: []string{"level up"}, MinConfidence: 60}
+	match, _, terms := reco.matchTerms(result.Text)
+	if !match || result.TermConfidence(terms) < reco.MinConfidence {
+		t.Errorf("expected a clearly read match to pass despite a poorly read screen, got %v %v", match, terms)
+	}
+
+	// Words shared by two terms count once, and the whole text counts without terms
+	if got := result.TermConfidence([]string{"level up", "up", "levelup"}); math.Abs(got-85) > 1e-6 {
+		t.Errorf("expected confidence 85 for overlapping terms, got %f", got)
+	}
+	if got := result.TermConfidence(nil); got != result.Confidence {
+		t.Errorf("expected the mean over all words without terms, got %f", got)
+	}
+}
@@ -0,0 +1,269 @@
+package detector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// MaxPreprocessScale caps the upscale factor so a bad config cannot blow up memory
+	MaxPreprocessScale = 8
+	// MaxFrameBytes is the largest encoded frame a detector accepts
+	MaxFrameBytes = 16 << 20
+	// MaxFramePixels is the largest frame a detector decodes, well above any device screen
+	MaxFramePixels = 32 << 20
+)
+
+// ErrFrameTooLarge is returned for frames over MaxFrameBytes or MaxFramePixels
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Preprocess describes the steps applied to a frame before OCR, the zero value leaves the frame untouched.
+// Steps run in the order downscale, grayscale, scale, contrast, threshold; contrast and threshold imply grayscale.
+// Detectors crop the frame to the stage area right after downscaling.
+type Preprocess struct {
+	// MaxDimension downscales frames whose longer side exceeds it to that size, keeping the aspect ratio so
+	// ratio and pixel areas still cover the same region. 0 disables it, smaller frames are left untouched.
+	MaxDimension int     `mapstructure:"max_dimension"`
+	Grayscale    bool    `mapstructure:"grayscale"`
+	Scale        float64 `mapstructure:"scale"`     // upscale factor, 0 or 1 keeps the size
+	Contrast     float64 `mapstructure:"contrast"`  // stretch around mid gray, 0 or 1 keeps the contrast
+	Threshold    int     `mapstructure:"threshold"` // binarize at this gray level (1-255), 0 disables
+}
+
+// Enabled reports whether p may change the frame at all
+func (p *Preprocess) Enabled() bool {
+	return p != nil && (p.MaxDimension > 0 || p.transforms())
+}
+
+// transforms reports whether p changes every frame, not only oversized ones
+func (p *Preprocess) transforms() bool {
+	return p.Grayscale || p.hasScale() || p.hasContrast() || p.Threshold != 0
+}
+
+// Validate checks the configured steps
+func (p *Preprocess) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Scale < 0 || p.Scale > MaxPreprocessScale {
+		return fmt.Errorf("preprocess scale must be between 0 and %d, got %g", MaxPreprocessScale, p.Scale)
+	}
+	if p.Contrast < 0 {
+		return fmt.Errorf("preprocess contrast must not be negative, got %g", p.Contrast)
+	}
+	if p.Threshold < 0 || p.Threshold > 255 {
+		return fmt.Errorf("preprocess threshold must be between 0 and 255, got %d", p.Threshold)
+	}
+	if p.MaxDimension < 0 {
+		return fmt.Errorf("preprocess max_dimension must not be negative, got %d", p.MaxDimension)
+	}
+	return nil
+}
+
+// downscale returns the factor shrinking a width x height frame to MaxDimension, 1 when it fits
+func (p *Preprocess) downscale(width, height int) float64 {
+	if longest := max(width, height); p.MaxDimension > 0 && longest > p.MaxDimension {
+		return float64(p.MaxDimension) / float64(longest)
+	}
+	return 1
+}
+
+func (p *Preprocess) hasScale() bool {
+	return p.Scale != 0 && p.Scale != 1
+}
+
+func (p *Preprocess) hasContrast() bool {
+	return p.Contrast != 0 && p.Contrast != 1
+}
+
+// Apply runs the steps on an encoded image and returns it encoded as PNG
+func (p *Preprocess) Apply(imageData []byte) ([]byte, error) {
+	_, data, err := p.apply(imageData)
+	return data, err
+}
+
+// apply is Apply that also returns the preprocessed image, nil when there are no steps
+func (p *Preprocess) apply(imageData []byte) (image.Image, []byte, error) {
+	return p.applyArea(imageData, Area{})
+}
+
+// applyArea is apply that crops the frame to area after downscaling it and before the other steps,
+// so they only work on the region the stage looks at. The zero area keeps the whole frame.
+func (p *Preprocess) applyArea(imageData []byte, area Area) (image.Image, []byte, error) {
+	if !p.Enabled() && area.IsZero() {
+		return nil, imageData, nil
+	}
+	if p == nil {
+		// Only the crop
+		p = &Preprocess{}
+	}
+
+	// Check the dimensions first, a small compressed image can decode to gigabytes of pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	downscale := p.downscale(cfg.Width, cfg.Height)
+	if downscale == 1 && !p.transforms() && area.IsZero() {
+		// Only downscaling is configured and the frame already fits
+		return nil, imageData, nil
+	}
+	pixels := float64(cfg.Width) * float64(cfg.Height)
+	if p.hasScale() {
+		pixels = max(pixels, pixels*downscale*downscale*p.Scale*p.Scale)
+	}
+	if pixels > MaxFramePixels {
+		return nil, nil, fmt.Errorf("%w: %dx%d frame scaled by %g exceeds %d pixels", ErrFrameTooLarge, cfg.Width, cfg.Height, max(p.Scale, 1), MaxFramePixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	img, err = p.applyImage(img, area)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode preprocessed image: %w", err)
+	}
+	return img, buf.Bytes(), nil
+}
+
+// ApplyImage runs the steps on a decoded image
+func (p *Preprocess) ApplyImage(img image.Image) image.Image {
+	img, _ = p.applyImage(img, Area{})
+	return img
+}
+
+// applyImage is ApplyImage that crops the image to area between downscaling and the other steps
+func (p *Preprocess) applyImage(img image.Image, area Area) (image.Image, error) {
+	if !p.Enabled() {
+		return area.Crop(img)
+	}
+
+	if factor := p.downscale(img.Bounds().Dx(), img.Bounds().Dy()); factor < 1 {
+		img = scaleBilinear(img, factor)
+	}
+	img, err := area.Crop(img)
+	if err != nil {
+		return nil, err
+	}
+	if p.Grayscale || p.hasContrast() || p.Threshold != 0 {
+		img = toGray(img)
+	}
+	if p.hasScale() {
+		img = scaleBilinear(img, p.Scale)
+	}
+	if gray, ok := img.(*image.Gray); ok {
+		if p.hasContrast() {
+			stretchContrast(gray, p.Contrast)
+		}
+		if p.Threshold != 0 {
+			binarize(gray, uint8(p.Threshold))
+		}
+	}
+	return img, nil
+}
+
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.Set(x-bounds.Min.X, y-bounds.Min.Y, img.At(x, y))
+		}
+	}
+	return gray
+}
+
+// scaleBilinear resizes img by factor, gray images stay gray and everything else becomes RGBA
+func scaleBilinear(img image.Image, factor float64) image.Image {
+	bounds := img.Bounds()
+	width := int(math.Round(float64(bounds.Dx()) * factor))
+	height := int(math.Round(float64(bounds.Dy()) * factor))
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	gray, isGray := img.(*image.Gray)
+	var out image.Image
+	var set func(x, y int, c [4]float64)
+	if isGray {
+		dst := image.NewGray(image.Rect(0, 0, width, height))
+		out = dst
+		set = func(x, y int, c [4]float64) { dst.SetGray(x, y, color.Gray{Y: clamp8(c[0])}) }
+	} else {
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		out = dst
+		set = func(x, y int, c [4]float64) {
+			dst.SetRGBA(x, y, color.RGBA{R: clamp8(c[0]), G: clamp8(c[1]), B: clamp8(c[2]), A: clamp8(c[3])})
+		}
+	}
+
+	sample := func(x, y int) [4]float64 {
+		x = min(max(x, 0), bounds.Dx()-1) + bounds.Min.X
+		y = min(max(y, 0), bounds.Dy()-1) + bounds.Min.Y
+		if isGray {
+			v := float64(gray.GrayAt(x, y).Y)
+			return [4]float64{v}
+		}
+		r, g, b, a := img.At(x, y).RGBA()
+		return [4]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8), float64(a >> 8)}
+	}
+
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		sy := (float64(y)+0.5)*scaleY - 0.5
+		y0 := int(math.Floor(sy))
+		fy := sy - float64(y0)
+		for x := 0; x < width; x++ {
+			sx := (float64(x)+0.5)*scaleX - 0.5
+			x0 := int(math.Floor(sx))
+			fx := sx - float64(x0)
+
+			c00, c10 := sample(x0, y0), sample(x0+1, y0)
+			c01, c11 := sample(x0, y0+1), sample(x0+1, y0+1)
+			var c [4]float64
+			for i := range c {
+				top := c00[i]*(1-fx) + c10[i]*fx
+				bottom := c01[i]*(1-fx) + c11[i]*fx
+				c[i] = top*(1-fy) + bottom*fy
+			}
+			set(x, y, c)
+		}
+	}
+	return out
+}
+
+func stretchContrast(gray *image.Gray, factor float64) {
+	for i, v := range gray.Pix {
+		gray.Pix[i] = clamp8((float64(v)-128)*factor + 128)
+	}
+}
+
+func binarize(gray *image.Gray, threshold uint8) {
+	for i, v := range gray.Pix {
+		if v >= threshold {
+			gray.Pix[i] = 255
+		} else {
+			gray.Pix[i] = 0
+		}
+	}
+}
+
+func clamp8(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 255)))
+}
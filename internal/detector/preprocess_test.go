@@ -0,0 +1,290 @@
+package detector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// glyphs is a 5x7 bitmap font covering the letters used by the tests
+var glyphs = map[rune][7]string{
+	'L': {"X....", "X....", "X....", "X....", "X....", "X....", "XXXXX"},
+	'E': {"XXXXX", "X....", "X....", "XXXX.", "X....", "X....", "XXXXX"},
+	'V': {"X...X", "X...X", "X...X", "X...X", "X...X", ".X.X.", "..X.."},
+}
+
+// noisyText renders dark gray text on a light colored background and sprinkles noise over it
+func noisyText(text string, cell int, noise float64) *image.RGBA {
+	margin := 4 * cell
+	width := margin*2 + len(text)*6*cell
+	height := margin*2 + 7*cell
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 200, G: 190, B: 170, A: 255})
+		}
+	}
+	for i, r := range text {
+		for row, line := range glyphs[r] {
+			for col, c := range line {
+				if c != 'X' {
+					continue
+				}
+				for dy := 0; dy < cell; dy++ {
+					for dx := 0; dx < cell; dx++ {
+						img.SetRGBA(margin+(i*6+col)*cell+dx, margin+row*cell+dy, color.RGBA{R: 60, G: 50, B: 40, A: 255})
+					}
+				}
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if rng.Float64() >= noise {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			shift := uint8(rng.Intn(40))
+			if rng.Intn(2) == 0 {
+				c.R, c.G, c.B = c.R-min(c.R, shift), c.G-min(c.G, shift), c.B-min(c.B, shift)
+			} else {
+				c.R, c.G, c.B = c.R+min(255-c.R, shift), c.G+min(255-c.G, shift), c.B+min(255-c.B, shift)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPreprocess_DisabledKeepsImage(t *testing.T) {
+	data := encodePNG(t, noisyText("LEVEL", 2, 0.2))
+
+	var nilPreprocess *Preprocess
+	for _, p := range []*Preprocess{nilPreprocess, {}, {Scale: 1, Contrast: 1}} {
+		if p.Enabled() {
+			t.Errorf("expected %+v to be disabled", p)
+		}
+		out, err := p.Apply(data)
+		if err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("expected %+v to return the image unchanged", p)
+		}
+	}
+}
+
+func TestPreprocess_Validate(t *testing.T) {
+	valid := []*Preprocess{nil, {}, {Grayscale: true, Scale: 2, Contrast: 1.5, Threshold: 128}, {MaxDimension: 1280}}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", p, err)
+		}
+	}
+
+	invalid := []*Preprocess{{Scale: -1}, {Scale: MaxPreprocessScale + 1}, {Contrast: -0.5}, {Threshold: 256}, {Threshold: -1}, {MaxDimension: -1}}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestPreprocess_ThresholdRemovesNoise(t *testing.T) {
+	src := noisyText("LEVEL", 2, 0.3)
+	p := &Preprocess{Threshold: 128}
+
+	out, err := p.Apply(encodePNG(t, src))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected a gray image, got %T", img)
+	}
+
+	// Every text pixel turns black and all the background noise turns white
+	clean := noisyText("LEVEL", 2, 0)
+	for y := 0; y < gray.Bounds().Dy(); y++ {
+		for x := 0; x < gray.Bounds().Dx(); x++ {
+			want := uint8(255)
+			if clean.RGBAAt(x, y).R < 128 {
+				want = 0
+			}
+			if got := gray.GrayAt(x, y).Y; got != want {
+				t.Fatalf("pixel (%d,%d): expected %d, got %d", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestPreprocess_Scale(t *testing.T) {
+	src := noisyText("LEVEL", 1, 0)
+
+	gray := (&Preprocess{Grayscale: true, Scale: 3}).ApplyImage(src)
+	if _, ok := gray.(*image.Gray); !ok {
+		t.Errorf("expected grayscale scaling to keep a gray image, got %T", gray)
+	}
+	if got, want := gray.Bounds().Size(), src.Bounds().Size().Mul(3); got != want {
+		t.Errorf("expected size %v, got %v", want, got)
+	}
+
+	colored := (&Preprocess{Scale: 2}).ApplyImage(src)
+	if _, ok := colored.(*image.RGBA); !ok {
+		t.Errorf("expected color scaling to return RGBA, got %T", colored)
+	}
+	if got, want := colored.Bounds().Size(), src.Bounds().Size().Mul(2); got != want {
+		t.Errorf("expected size %v, got %v", want, got)
+	}
+	// The background fills the first pixels so interpolation must keep its color
+	if got := colored.(*image.RGBA).RGBAAt(0, 0); got != (color.RGBA{R: 200, G: 190, B: 170, A: 255}) {
+		t.Errorf("unexpected background color %v", got)
+	}
+}
+
+func TestPreprocess_MaxDimensionDownscalesBeforeCropping(t *testing.T) {
+	// A 3x full-resolution frame of a 720x1240 screen with a black banner in the upgrade area
+	area := Area{Clue: "upgrade", Unit: AreaUnitPixel, RefWidth: 720, RefHeight: 1240, X: 108, Y: 111.6, Width: 504, Height: 99.2}
+	large := image.NewRGBA(image.Rect(0, 0, 2160, 3720))
+	banner, err := area.Rect(large.Bounds())
+	if err != nil {
+		t.Fatalf("Rect failed: %v", err)
+	}
+	for y := 0; y < 3720; y++ {
+		for x := 0; x < 2160; x++ {
+			c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			if (image.Point{X: x, Y: y}).In(banner) {
+				c = color.RGBA{A: 255}
+			}
+			large.SetRGBA(x, y, c)
+		}
+	}
+	p := &Preprocess{MaxDimension: 1240}
+	img, _, err := p.apply(encodePNG(t, large))
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got := img.Bounds().Size(); got != (image.Point{X: 720, Y: 1240}) {
+		t.Fatalf("expected the frame downscaled to 720x1240, got %v", got)
+	}
+
+	// The detector crops the downscaled frame, the area still lands on the banner
+	cropped, data, err := p.applyArea(encodePNG(t, large), area)
+	if err != nil {
+		t.Fatalf("applyArea failed: %v", err)
+	}
+	if got, want := cropped.Bounds(), image.Rect(108, 111, 612, 211); got != want {
+		t.Errorf("expected crop %v, got %v", want, got)
+	}
+	if decoded, err := png.Decode(bytes.NewReader(data)); err != nil || decoded.Bounds().Size() != (image.Point{X: 504, Y: 100}) {
+		t.Errorf("expected the encoded frame to hold only the crop, got %v", err)
+	}
+	// Away from its edges, which are blended with the background, the crop is the banner
+	inner := cropped.Bounds().Inset(2)
+	for y := inner.Min.Y; y < inner.Max.Y; y++ {
+		for x := inner.Min.X; x < inner.Max.X; x++ {
+			if r, _, _, _ := cropped.At(x, y).RGBA(); r != 0 {
+				t.Fatalf("expected the crop to hold the black banner, got %v at %d,%d", cropped.At(x, y), x, y)
+			}
+		}
+	}
+
+	// Frames that fit are passed on as they are
+	small := encodePNG(t, noisyText("LEVEL", 1, 0))
+	if img, data, err := p.apply(small); err != nil || img != nil || !bytes.Equal(data, small) {
+		t.Errorf("expected a frame within max_dimension to be left untouched, got %v", err)
+	}
+}
+
+func TestPreprocess_ContrastStretchesAroundMidGray(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 1))
+	gray.Pix = []uint8{100, 128, 160}
+
+	out := (&Preprocess{Contrast: 2}).ApplyImage(gray).(*image.Gray)
+	if got, want := out.Pix, []uint8{72, 128, 192}; !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPreprocess_ImprovesOCR(t *testing.T) {
+	if !isTesseractInstalled() {
+		t.Skip("tesseract is not installed")
+	}
+
+	src := noisyText("LEVEL", 3, 0.4)
+	ocr := func(data []byte) string {
+		path := filepath.Join(t.TempDir(), "frame.png")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+		text, err := runTesseractOCR(path, "eng", 7)
+		if err != nil {
+			t.Fatalf("tesseract failed: %v", err)
+		}
+		return text
+	}
+
+	raw := ocr(encodePNG(t, src))
+	processed, err := (&Preprocess{Grayscale: true, Scale: 2, Threshold: 128}).Apply(encodePNG(t, src))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	cleaned := ocr(processed)
+	t.Logf("raw OCR %q, preprocessed OCR %q", raw, cleaned)
+
+	if match, _, _ := analyzeTextForKeywordWithExactMatch(cleaned, []string{"LEVEL"}); !match {
+		t.Errorf("expected preprocessed OCR to read LEVEL, got %q", cleaned)
+	}
+}
+
+// pngHeader returns a PNG that declares width x height pixels but carries no image data
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 0 // 8-bit gray
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestPreprocess_RejectsOversizedFrames(t *testing.T) {
+	p := &Preprocess{Grayscale: true}
+	if _, err := p.Apply(pngHeader(100000, 100000)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected a huge declared frame to fail with ErrFrameTooLarge, got %v", err)
+	}
+
+	// Within the pixel limit on its own, but not once upscaled
+	scaled := &Preprocess{Scale: 8}
+	if _, err := scaled.Apply(pngHeader(2000, 2000)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected an upscale past the limit to fail with ErrFrameTooLarge, got %v", err)
+	}
+}
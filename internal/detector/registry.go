@@ -0,0 +1,151 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultMethod is used by stages that name no reco method
+const DefaultMethod = "ocr"
+
+// Method is a way of deciding whether a frame shows a stage
+type Method interface {
+	Match(ctx context.Context, stage *Stage, frame Frame) (match bool, evidence string, err error)
+}
+
+// MethodFunc adapts a function to a Method
+type MethodFunc func(ctx context.Context, stage *Stage, frame Frame) (bool, string, error)
+
+func (f MethodFunc) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	return f(ctx, stage, frame)
+}
+
+var (
+	methodsMu sync.RWMutex
+	methods   = make(map[string]Method)
+)
+
+// Only the OCR methods are built in. Others, such as template matching, are registered by the code that
+// provides them through RegisterMethod.
+func init() {
+	// ocrAny is the name existing game configs use for the OCR keyword match, ocrAll needs every keyword
+	for _, name := range []string{DefaultMethod, "ocrAny"} {
+		RegisterMethod(name, MethodFunc(detectOCR))
+	}
+	RegisterMethod("ocrAll", allKeywordsMethod{})
+}
+
+// retiredMethods are names that are no longer registered, with what to use instead. Game configs that still
+// name them fail validation rather than running with a different meaning.
+var retiredMethods = map[string]string{
+	// recoAnd matched any keyword despite its name
+	"recoAnd": `it matched any keyword, use "ocrAny" for that or "ocrAll" to need every keyword`,
+}
+
+// retired returns why a retired method name no longer validates, nil for any other name
+func retired(name string) error {
+	if hint, ok := retiredMethods[name]; ok {
+		return fmt.Errorf("reco method %q is retired, %s", name, hint)
+	}
+	return nil
+}
+
+// recoValidator is implemented by methods that need more of a reco config than any method does
+type recoValidator interface {
+	ValidateReco(r Reco) error
+}
+
+// RegisterMethod makes a detection method available to reco configs under name, it panics if name is taken
+func RegisterMethod(name string, method Method) {
+	methodsMu.Lock()
+	defer methodsMu.Unlock()
+	if method == nil {
+		panic("detector: RegisterMethod method is nil")
+	}
+	if _, dup := methods[name]; dup {
+		panic("detector: RegisterMethod called twice for method " + name)
+	}
+	methods[name] = method
+}
+
+// LookupMethod returns the detection method registered under name
+func LookupMethod(name string) (Method, bool) {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+	method, ok := methods[name]
+	return method, ok
+}
+
+// Methods returns the names of the registered detection methods
+func Methods() []string {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MethodChain returns the methods a stage tries in order
+func (r Reco) MethodChain() []string {
+	if len(r.Methods) > 0 {
+		return r.Methods
+	}
+	if r.Method != "" {
+		return []string{r.Method}
+	}
+	return []string{DefaultMethod}
+}
+
+// ValidateMethods checks that every method in the chain is registered and accepts the reco config
+func (r Reco) ValidateMethods() error {
+	for _, name := range r.MethodChain() {
+		if err := retired(name); err != nil {
+			return err
+		}
+		method, ok := LookupMethod(name)
+		if !ok {
+			return fmt.Errorf("unknown reco method %q, registered methods are %v", name, Methods())
+		}
+		if validator, ok := method.(recoValidator); ok {
+			if err := validator.ValidateReco(r); err != nil {
+				return fmt.Errorf("reco method %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runMethods tries the stage's methods in order and stops at the first match, the evidence names the method that hit.
+// A failing method falls through to the next one, its error is only returned when no method got to a verdict.
+func runMethods(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	var lastErr error
+	decided := false
+	for _, name := range stage.Reco.MethodChain() {
+		method, ok := LookupMethod(name)
+		if !ok {
+			return false, "", fmt.Errorf("unknown reco method %q", name)
+		}
+
+		match, evidence, err := method.Match(ctx, stage, frame)
+		if err != nil {
+			logger.Warnf("reco method %s failed for stage %d: %v", name, stage.Number, err)
+			lastErr = err
+			continue
+		}
+		decided = true
+		if match {
+			return true, fmt.Sprintf("%s: %s", name, evidence), nil
+		}
+	}
+	if !decided && lastErr != nil {
+		return false, "", lastErr
+	}
+	return false, "", nil
+}
@@ -0,0 +1,191 @@
+package detector
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// recordingMethod answers with a fixed verdict and counts its calls
+type recordingMethod struct {
+	match    bool
+	evidence string
+	err      error
+	calls    int
+}
+
+func (m *recordingMethod) Match(ctx context.Context, stage *Stage, frame Frame) (bool, string, error) {
+	m.calls++
+	return m.match, m.evidence, m.err
+}
+
+// registerTestMethods registers the methods under their names once per test binary
+func registerTestMethods(t *testing.T, named map[string]*recordingMethod) {
+	t.Helper()
+	for name, method := range named {
+		name := t.Name() + "/" + name
+		RegisterMethod(name, method)
+	}
+}
+
+func chain(t *testing.T, names ...string) []string {
+	full := make([]string, len(names))
+	for i, name := range names {
+		full[i] = t.Name() + "/" + name
+	}
+	return full
+}
+
+func TestRunMethods_FallsBackToSecondMethod(t *testing.T) {
+	ocr := &recordingMethod{match: false}
+	template := &recordingMethod{match: true, evidence: "score=0.93"}
+	expensive := &recordingMethod{match: true, evidence: "unused"}
+	registerTestMethods(t, map[string]*recordingMethod{"ocr": ocr, "template": template, "expensive": expensive})
+
+	stage := &Stage{Number: 1, Reco: Reco{Methods: chain(t, "ocr", "template", "expensive")}}
+	match, evidence, err := runMethods(context.Background(), stage, Frame{})
+	if err != nil {
+		t.Fatalf("runMethods failed: %v", err)
+	}
+	if !match {
+		t.Fatal("expected the second method to match")
+	}
+	if want := t.Name() + "/template: score=0.93"; evidence != want {
+		t.Errorf("expected evidence %q, got %q", want, evidence)
+	}
+	if ocr.calls != 1 || template.calls != 1 {
+		t.Errorf("expected both methods to run once, got %d and %d", ocr.calls, template.calls)
+	}
+	if expensive.calls != 0 {
+		t.Errorf("expected the chain to stop at the first match, the third method ran %d times", expensive.calls)
+	}
+}
+
+func TestRunMethods_FirstMatchShortCircuits(t *testing.T) {
+	first := &recordingMethod{match: true, evidence: "keyword_1"}
+	second := &recordingMethod{match: true}
+	registerTestMethods(t, map[string]*recordingMethod{"first": first, "second": second})
+
+	stage := &Stage{Number: 1, Reco: Reco{Methods: chain(t, "first", "second")}}
+	if match, _, err := runMethods(context.Background(), stage, Frame{}); err != nil || !match {
+		t.Fatalf("expected a match, got %v, %v", match, err)
+	}
+	if second.calls != 0 {
+		t.Errorf("expected the second method to be skipped, it ran %d times", second.calls)
+	}
+}
+
+func TestRunMethods_Errors(t *testing.T) {
+	boom := errors.New("tesseract missing")
+	failing := &recordingMethod{err: boom}
+	missing := &recordingMethod{match: false}
+	hit := &recordingMethod{match: true, evidence: "ok"}
+	registerTestMethods(t, map[string]*recordingMethod{"failing": failing, "missing": missing, "hit": hit})
+
+	// A failing method falls through to the next one
+	stage := &Stage{Number: 1, Reco: Reco{Methods: chain(t, "failing", "hit")}}
+	if match, _, err := runMethods(context.Background(), stage, Frame{}); err != nil || !match {
+		t.Errorf("expected the fallback to match, got %v, %v", match, err)
+	}
+
+	// A miss after a failure is a plain no-match
+	stage.Reco.Methods = chain(t, "failing", "missing")
+	if match, _, err := runMethods(context.Background(), stage, Frame{}); err != nil || match {
+		t.Errorf("expected no match without error, got %v, %v", match, err)
+	}
+
+	// The error surfaces when no method got to a verdict
+	stage.Reco.Methods = chain(t, "failing")
+	if _, _, err := runMethods(context.Background(), stage, Frame{}); !errors.Is(err, boom) {
+		t.Errorf("expected %v, got %v", boom, err)
+	}
+
+	stage.Reco.Methods = []string{"no-such-method"}
+	if _, _, err := runMethods(context.Background(), stage, Frame{}); err == nil {
+		t.Error("expected an unknown method to fail")
+	}
+}
+
+func TestReco_MethodChain(t *testing.T) {
+	cases := []struct {
+		reco Reco
+		want []string
+	}{
+		{Reco{}, []string{DefaultMethod}},
+		{Reco{Method: "ocrAny"}, []string{"ocrAny"}},
+		{Reco{Method: "ocrAny", Methods: []string{"ocr", "ocrAll"}, Matchs: []string{"level"}}, []string{"ocr", "ocrAll"}},
+	}
+	for _, c := range cases {
+		got := c.reco.MethodChain()
+		if len(got) != len(c.want) {
+			t.Errorf("%+v: expected %v, got %v", c.reco, c.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%+v: expected %v, got %v", c.reco, c.want, got)
+			}
+		}
+		if err := c.reco.ValidateMethods(); err != nil {
+			t.Errorf("%+v: expected built-in methods to validate, got %v", c.reco, err)
+		}
+	}
+
+	if err := (Reco{Methods: []string{"ocr", "no-such-method"}}).ValidateMethods(); err == nil {
+		t.Error("expected an unknown method to fail validation")
+	}
+	if err := (Reco{Method: "recoAnd", Matchs: []string{"level"}}).ValidateMethods(); err == nil || !strings.Contains(err.Error(), "retired") {
+		t.Errorf("expected the retired recoAnd to fail validation, got %v", err)
+	}
+	groupsOnly := Reco{Method: "ocrAll", Groups: []MatchGroup{{All: []string{"level"}}}}
+	if err := groupsOnly.ValidateMethods(); err == nil {
+		t.Error("expected ocrAll without matchs to fail validation")
+	}
+}
+
+func TestRegisterMethod_PanicsOnDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering ocr twice to panic")
+		}
+	}()
+	RegisterMethod(DefaultMethod, &recordingMethod{})
+}
+
+func TestDefaultOcrDetector_RunsMethodChain(t *testing.T) {
+	first := &recordingMethod{match: false}
+	second := &recordingMethod{match: true, evidence: "found"}
+	registerTestMethods(t, map[string]*recordingMethod{"first": first, "second": second})
+
+	stages := []*Stage{{Number: 1, Reco: Reco{Methods: chain(t, "first", "second")}}}
+	image := base64.StdEncoding.EncodeToString(encodePNG(t, noisyText("LEVEL", 1, 0)))
+	match, evidence, err := NewDefaultOcrDetector(stages, nil, nil).Detect(context.Background(), "test-game", 1, image)
+	if err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+	if !match || evidence != t.Name()+"/second: found" {
+		t.Errorf("expected the second method to match, got %v %q", match, evidence)
+	}
+}
+
+func TestAllKeywordsStage(t *testing.T) {
+	stage := &Stage{Number: 2, Reco: Reco{Method: "ocrAll", Matchs: []string{"level", "up"}, Groups: []MatchGroup{{All: []string{"unlocked"}}}}}
+	all := allKeywordsStage(stage)
+	if len(stage.Reco.Matchs) != 2 || len(stage.Reco.Groups) != 1 {
+		t.Errorf("expected the stage to be left alone, got %+v", stage.Reco)
+	}
+	if match, _ := all.Reco.MatchText("unlocked"); !match {
+		t.Error("expected the stage's own groups to still match")
+	}
+	if match, _ := all.Reco.MatchText("menu"); match {
+		t.Error("expected text matching no group not to match")
+	}
+	if match, _ := all.Reco.MatchText("level up"); !match {
+		t.Error("expected text with every keyword to match")
+	}
+	if match, _ := all.Reco.MatchText("level"); match {
+		t.Error("expected text missing a keyword not to match")
+	}
+}
@@ -8,3 +8,21 @@ type StageChecker interface {
 	// 传入截图（整图或多区域），返回判定阶段以及命中细节
 	Detect(ctx context.Context, game string, currentStageNum int, imgBase64 string) (match bool, evidence string, err error)
 }
+
+// Detection is the outcome of a detection together with the frame the methods looked at
+type Detection struct {
+	Match    bool
+	Evidence string
+	Frame    []byte // the decoded and preprocessed image, PNG encoded when preprocessing ran
+	Format   string // format of Frame, FormatPNG or FormatJPEG
+}
+
+// FrameDetector is implemented by checkers that can return the exact frame they detected on
+type FrameDetector interface {
+	DetectFrame(ctx context.Context, game string, currentStageNum int, imgBase64 string) (*Detection, error)
+}
+
+// ImageDetector is implemented by checkers that take the frame already decoded, e.g. from a protobuf request
+type ImageDetector interface {
+	DetectImage(ctx context.Context, game string, currentStageNum int, image []byte) (*Detection, error)
+}
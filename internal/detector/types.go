@@ -2,17 +2,48 @@ package detector
 
 import "time"
 
+const (
+	// AreaUnitRatio expresses an area as fractions (0-1) of the frame, the default
+	AreaUnitRatio = "ratio"
+	// AreaUnitPixel expresses an area in pixels of a reference resolution
+	AreaUnitPixel = "pixel"
+)
+
 type Area struct {
 	Clue   string  `mapstructure:"clue"`
 	X      float64 `mapstructure:"x"`
 	Y      float64 `mapstructure:"y"`
 	Width  float64 `mapstructure:"width"`
 	Height float64 `mapstructure:"height"`
+	// Unit is ratio or pixel, empty means ratio
+	Unit string `mapstructure:"unit"`
+	// RefWidth and RefHeight are the resolution pixel areas are measured against
+	RefWidth  int `mapstructure:"ref_width"`
+	RefHeight int `mapstructure:"ref_height"`
 }
 
 type Reco struct {
-	Method string   `mapstructure:"method"`
-	Matchs []string `mapstructure:"matchs"`
+	Method string `mapstructure:"method"`
+	// Methods is an ordered fallback chain tried until one matches, it takes precedence over Method
+	Methods []string `mapstructure:"methods"`
+	Matchs  []string `mapstructure:"matchs"`
+	// MatchMode is exact, where a match must equal the whole OCR text, or contains, empty means exact
+	MatchMode string `mapstructure:"match_mode"`
+	// Lang and PSM are the tesseract language and page segmentation mode, empty means eng and 6
+	Lang string `mapstructure:"lang"`
+	PSM  int    `mapstructure:"psm"`
+	// Groups match OCR text by the keywords it contains, the stage matches when Matchs or any group does
+	Groups []MatchGroup `mapstructure:"groups"`
+	// MinConfidence switches OCR to tesseract TSV output and rejects matches whose mean word confidence (0-100) is lower, 0 keeps plain output
+	MinConfidence float64 `mapstructure:"min_confidence"`
+	// Preprocess overrides the game-wide preprocessing for this stage, nil falls back to it
+	Preprocess *Preprocess `mapstructure:"preprocess"`
+}
+
+// Reference is a screenshot the startup self-test runs a stage's detector on
+type Reference struct {
+	Image   string `mapstructure:"image"`    // path to a PNG or JPEG screenshot
+	NoMatch bool   `mapstructure:"no_match"` // the stage must not match the screenshot, by default it must
 }
 
 type Stage struct {
@@ -20,4 +51,6 @@ type Stage struct {
 	Interval time.Duration `mapstructure:"interval"`
 	Area     Area          `mapstructure:"area"`
 	Reco     Reco          `mapstructure:"reco"`
+	// References are checked by the game manager's self_test at startup
+	References []Reference `mapstructure:"references"`
 }
@@ -0,0 +1,120 @@
+package game
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+// capacityBudget shares GlobalMax sessions between the games by priority. Every game is entitled to
+// a share proportional to its priority, the remainder going to the highest priorities. A game may
+// borrow beyond its share what the others are not about to claim, never while a game of higher
+// priority still wants sessions.
+type capacityBudget struct {
+	mu      sync.Mutex
+	max     int
+	weights map[string]int
+	shares  map[string]int
+	usage   map[string]*session.PoolUsage // games that have not reported yet count as wanting
+}
+
+// newCapacityBudget creates the budget of max sessions shared between games
+func newCapacityBudget(max int, games []*GameConfig) *capacityBudget {
+	b := &capacityBudget{
+		max:     max,
+		weights: make(map[string]int, len(games)),
+		shares:  make(map[string]int, len(games)),
+		usage:   make(map[string]*session.PoolUsage, len(games)),
+	}
+
+	names := make([]string, 0, len(games))
+	sum := 0
+	for _, g := range games {
+		b.weights[g.Name] = g.priority()
+		sum += g.priority()
+		names = append(names, g.Name)
+	}
+	if sum == 0 {
+		return b
+	}
+
+	// Highest priority first, ties by name so the remainder always goes to the same games
+	sort.Slice(names, func(i, j int) bool {
+		if b.weights[names[i]] != b.weights[names[j]] {
+			return b.weights[names[i]] > b.weights[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	left := max
+	for _, name := range names {
+		b.shares[name] = max * b.weights[name] / sum
+		left -= b.shares[name]
+	}
+	for i := 0; i < left; i++ {
+		b.shares[names[i%len(names)]]++
+	}
+	return b
+}
+
+// Reserve records the usage of game and grants as many of n sessions as its priority allows
+func (b *capacityBudget) Reserve(game string, usage session.PoolUsage, n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.usage[game] = &usage
+	granted := 0
+	for granted < n && b.allowLocked(game) {
+		usage.Used++
+		granted++
+	}
+	return granted
+}
+
+// Report records the usage of game
+func (b *capacityBudget) Report(game string, usage session.PoolUsage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.usage[game] = &usage
+}
+
+// allowLocked reports whether game may create one more session. Callers must hold b.mu.
+func (b *capacityBudget) allowLocked(game string) bool {
+	total := 0
+	for _, usage := range b.usage {
+		total += usage.Used
+	}
+	if total >= b.max {
+		return false
+	}
+
+	used := 0
+	if usage, ok := b.usage[game]; ok {
+		used = usage.Used
+	}
+	if used < b.shares[game] {
+		return true
+	}
+
+	// Beyond its share a game only gets what the others still wanting will not claim
+	claimed := 0
+	for other, weight := range b.weights {
+		if other == game {
+			continue
+		}
+		usage, ok := b.usage[other]
+		if ok && !usage.Wanted {
+			continue
+		}
+		if weight > b.weights[game] {
+			return false
+		}
+		if ok {
+			claimed += max(b.shares[other]-usage.Used, 0)
+		} else {
+			claimed += b.shares[other]
+		}
+	}
+	return b.max-total > claimed
+}
@@ -0,0 +1,87 @@
+package game
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+func TestCapacityBudget_SharesByPriority(t *testing.T) {
+	high := newTestGameConfig("high")
+	high.Priority = 2
+	low := newTestGameConfig("low")
+	budget := newCapacityBudget(6, []*GameConfig{high, low})
+
+	if budget.shares["high"] != 4 || budget.shares["low"] != 2 {
+		t.Fatalf("Expected shares 4 and 2, got %v", budget.shares)
+	}
+
+	// Both pools want more than the budget: each gets its share and nothing beyond
+	if got := budget.Reserve("high", session.PoolUsage{Wanted: true}, 6); got != 4 {
+		t.Fatalf("Expected high to get its share of 4, got %d", got)
+	}
+	if got := budget.Reserve("low", session.PoolUsage{Wanted: true}, 6); got != 2 {
+		t.Fatalf("Expected low to get its share of 2, got %d", got)
+	}
+	if got := budget.Reserve("high", session.PoolUsage{Used: 4, Wanted: true}, 1); got != 0 {
+		t.Fatalf("Expected no room left, got %d", got)
+	}
+
+	// An idle low priority game lends its share
+	budget.Report("low", session.PoolUsage{Used: 0})
+	if got := budget.Reserve("high", session.PoolUsage{Used: 4, Wanted: true}, 6); got != 2 {
+		t.Fatalf("Expected high to borrow the 2 sessions low does not use, got %d", got)
+	}
+
+	// Once low wants sessions again, high can't grow past its share while low is below its own
+	budget.Report("high", session.PoolUsage{Used: 3, Wanted: true})
+	budget.Report("low", session.PoolUsage{Used: 0, Wanted: true})
+	if got := budget.Reserve("high", session.PoolUsage{Used: 4, Wanted: true}, 1); got != 0 {
+		t.Fatalf("Expected high to leave low's share alone, got %d", got)
+	}
+	if got := budget.Reserve("low", session.PoolUsage{Used: 0, Wanted: true}, 6); got != 2 {
+		t.Fatalf("Expected low to get the remaining 2 sessions, got %d", got)
+	}
+
+	// Beyond their shares the higher priority wins the free room
+	budget.Report("high", session.PoolUsage{Used: 4, Wanted: true})
+	budget.Report("low", session.PoolUsage{Used: 0, Wanted: true})
+	if got := budget.Reserve("low", session.PoolUsage{Used: 2, Wanted: true}, 1); got != 0 {
+		t.Fatalf("Expected low not to grow past its share while high wants sessions, got %d", got)
+	}
+}
+
+func TestManager_GlobalMaxWarmsGamesByPriority(t *testing.T) {
+	newGame := func(name string, priority int) *GameConfig {
+		g := newTestGameConfig(name)
+		g.Priority = priority
+		g.SessionConfig.Min = 5
+		g.SessionConfig.SyncInterval = time.Hour
+		g.SessionConfig.WarmupConcurrency = 5
+		return g
+	}
+	anboxClient := &MockAnboxClient{}
+	manager := newTestManager(t, ManagerConfig{GlobalMax: 6}, []*GameConfig{newGame("high", 2), newGame("low", 1)}, anboxClient)
+	ctx := context.Background()
+
+	if err := manager.Init(ctx); err != nil {
+		t.Fatalf("Failed to init manager: %v", err)
+	}
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for (anboxClient.Created("high") < 4 || anboxClient.Created("low") < 2) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Both games want 5 sessions, the budget of 6 splits 2:1
+	if high, low := anboxClient.Created("high"), anboxClient.Created("low"); high != 4 || low != 2 {
+		t.Fatalf("Expected warmup to create 4 high and 2 low priority sessions, got %d and %d", high, low)
+	}
+}
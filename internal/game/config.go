@@ -0,0 +1,158 @@
+package game
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+	"github.com/spf13/viper"
+)
+
+// LoadGameConfigs reads one game config per *.yaml file in dir, in file name order
+func LoadGameConfigs(dir string) ([]*GameConfig, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list game configs in %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	games := make([]*GameConfig, 0, len(files))
+	for _, file := range files {
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read game config %s: %w", file, err)
+		}
+
+		var gameConfig GameConfig
+		if err := v.Unmarshal(&gameConfig); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal game config %s: %w", file, err)
+		}
+		games = append(games, &gameConfig)
+	}
+
+	return games, nil
+}
+
+// ValidateGameConfigs checks that every game is named uniquely and has a usable session config and stage areas
+func ValidateGameConfigs(games []*GameConfig) error {
+	seen := make(map[string]bool, len(games))
+	for i, g := range games {
+		if g.Name == "" {
+			return fmt.Errorf("game #%d has no name", i)
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("game %s is configured more than once", g.Name)
+		}
+		seen[g.Name] = true
+
+		if g.Priority < 0 {
+			return fmt.Errorf("game %s has negative priority %d", g.Name, g.Priority)
+		}
+		if g.SessionConfig == nil {
+			return fmt.Errorf("game %s has no session_config", g.Name)
+		}
+		if g.SessionConfig.Min < 0 || g.SessionConfig.Max < g.SessionConfig.Min {
+			return fmt.Errorf("game %s needs 0 <= min <= max, got min %d max %d", g.Name, g.SessionConfig.Min, g.SessionConfig.Max)
+		}
+		if g.SessionConfig.MinReady < 0 || g.SessionConfig.Max < g.SessionConfig.MinReady {
+			return fmt.Errorf("game %s needs 0 <= min_ready <= max, got min_ready %d max %d", g.Name, g.SessionConfig.MinReady, g.SessionConfig.Max)
+		}
+		if err := validateScreenProfiles(g.SessionConfig); err != nil {
+			return fmt.Errorf("game %s: %w", g.Name, err)
+		}
+		if err := validateAnboxReaping(g.SessionConfig); err != nil {
+			return fmt.Errorf("game %s: %w", g.Name, err)
+		}
+		for _, stage := range g.Stages {
+			if err := stage.Area.Validate(); err != nil {
+				return fmt.Errorf("game %s stage %d: %w", g.Name, stage.Number, err)
+			}
+		}
+		for _, num := range g.ClientStages {
+			if !g.HasStage(num) {
+				return fmt.Errorf("game %s client_stages names stage %d, which is not configured", g.Name, num)
+			}
+		}
+	}
+	return nil
+}
+
+// validateScreenProfiles checks that profiles have unique names and their minima fit under max
+func validateScreenProfiles(cfg *SessionConfig) error {
+	names := make(map[string]bool, len(cfg.ScreenProfiles))
+	total := 0
+	for i, profile := range cfg.ScreenProfiles {
+		if profile.Name == "" {
+			return fmt.Errorf("screen profile #%d has no name", i)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("screen profile %s is configured more than once", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.Min < 0 || profile.MinReady < 0 || profile.MinWarmed < 0 {
+			return fmt.Errorf("screen profile %s min, min_ready and min_warmed must not be negative, got %d, %d and %d", profile.Name, profile.Min, profile.MinReady, profile.MinWarmed)
+		}
+		total += profile.Min
+	}
+	if total > cfg.Max {
+		return fmt.Errorf("screen profile minima add up to %d, more than max %d", total, cfg.Max)
+	}
+	return nil
+}
+
+// validateWarmedTargets checks that the warming workers can reach the min_warmed of the game and its profiles.
+// Warmed sessions only come from the cold ones the pool keeps, so a profile cannot hold more warmed than its
+// min or min_ready, the default profile counting the game's own. With the workers warming, their targets
+// together must cover min_warmed_guarantee, which counts warmed sessions of every profile.
+func validateWarmedTargets(cfg *SessionConfig) error {
+	type target struct {
+		name                     string
+		min, minReady, minWarmed int
+	}
+	targets := []target{{"min_warmed", cfg.Min, cfg.MinReady, cfg.MinWarmed}}
+	for i, profile := range cfg.ScreenProfiles {
+		if i == 0 {
+			// The default profile is warmed to the larger of both and filled by the game's min and min_ready
+			targets[0].minWarmed = max(targets[0].minWarmed, profile.MinWarmed)
+			targets[0].min = max(targets[0].min, profile.Min)
+			targets[0].minReady = max(targets[0].minReady, profile.MinReady)
+			continue
+		}
+		targets = append(targets, target{"screen profile " + profile.Name + " min_warmed", profile.Min, profile.MinReady, profile.MinWarmed})
+	}
+
+	total := 0
+	for _, t := range targets {
+		if kept := max(t.min, t.minReady); t.minWarmed > kept {
+			return fmt.Errorf("%s %d is more than the %d sessions min and min_ready keep", t.name, t.minWarmed, kept)
+		}
+		total += t.minWarmed
+	}
+	if total > 0 && cfg.WarmingWorkers == 0 {
+		return fmt.Errorf("min_warmed %d needs warming_workers to warm sessions", total)
+	}
+	if total > 0 && total < cfg.MinWarmedGuarantee {
+		return fmt.Errorf("warming workers keep %d sessions warmed, fewer than min_warmed_guarantee %d", total, cfg.MinWarmedGuarantee)
+	}
+	return nil
+}
+
+// validateAnboxReaping checks that the anbox-side idle reaping does not contradict itself or the pool's own.
+// An ephemeral session is deleted as soon as anbox stops it, so an idle_time_min meant to keep it around
+// would never apply. An idle_time_min under session_ttl lets anbox stop idle pool sessions first, the pool
+// then drops them as not running; that is only warned about.
+func validateAnboxReaping(cfg *SessionConfig) error {
+	if cfg.IdleTimeMin < 0 {
+		return fmt.Errorf("idle_time_min must not be negative, got %d", cfg.IdleTimeMin)
+	}
+	if cfg.Ephemeral && cfg.IdleTimeMin > 0 {
+		return fmt.Errorf("ephemeral sessions are deleted when their client disconnects, idle_time_min %d would never apply; set one of them", cfg.IdleTimeMin)
+	}
+	if idle := time.Duration(cfg.IdleTimeMin) * time.Minute; idle > 0 && idle < cfg.SessionTTL {
+		logger.Warnf("idle_time_min %s is shorter than session_ttl %s, anbox may stop pool sessions before they expire", idle, cfg.SessionTTL)
+	}
+	return nil
+}
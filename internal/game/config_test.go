@@ -0,0 +1,143 @@
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/detector"
+)
+
+func writeGameConfig(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", file, err)
+	}
+}
+
+func TestLoadGameConfigs(t *testing.T) {
+	dir := t.TempDir()
+	writeGameConfig(t, dir, "b.yaml", `
+name: game-b
+session_config:
+  min: 1
+  max: 3
+  session_ttl: 2m
+  screen_profiles:
+    - name: portrait
+      min: 1
+      width: 720
+      height: 1280
+    - name: landscape
+      width: 1280
+      height: 720
+`)
+	writeGameConfig(t, dir, "a.yaml", `
+name: game-a
+app_name: app-a
+session_config:
+  min: 0
+  max: 2
+`)
+	writeGameConfig(t, dir, "notes.txt", "not a game")
+
+	games, err := LoadGameConfigs(dir)
+	if err != nil {
+		t.Fatalf("Failed to load game configs: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("Expected 2 games, got %d", len(games))
+	}
+	if games[0].Name != "game-a" || games[0].AppName != "app-a" {
+		t.Errorf("Expected game-a with app-a first, got %+v", games[0])
+	}
+	if games[1].SessionConfig.SessionTTL != 2*time.Minute {
+		t.Errorf("Expected game-b session ttl 2m, got %s", games[1].SessionConfig.SessionTTL)
+	}
+	profiles := games[1].SessionConfig.ScreenProfiles
+	if len(profiles) != 2 || profiles[0].Name != "portrait" || profiles[0].Min != 1 || profiles[1].Width != 1280 || profiles[1].Height != 720 {
+		t.Errorf("Expected the portrait and landscape screen profiles, got %+v", profiles)
+	}
+}
+
+func TestValidateGameConfigs(t *testing.T) {
+	if err := ValidateGameConfigs([]*GameConfig{newTestGameConfig("game-a"), newTestGameConfig("game-b")}); err != nil {
+		t.Errorf("Expected valid configs, got %v", err)
+	}
+
+	if err := ValidateGameConfigs([]*GameConfig{newTestGameConfig("game-a"), newTestGameConfig("game-a")}); err == nil {
+		t.Errorf("Expected duplicate game names to be rejected")
+	}
+
+	if err := ValidateGameConfigs([]*GameConfig{{Name: "game-a"}}); err == nil {
+		t.Errorf("Expected a game without session config to be rejected")
+	}
+
+	invalid := newTestGameConfig("game-a")
+	invalid.SessionConfig.Min = 5
+	invalid.SessionConfig.Max = 2
+	if err := ValidateGameConfigs([]*GameConfig{invalid}); err == nil {
+		t.Errorf("Expected min > max to be rejected")
+	}
+
+	tooReady := newTestGameConfig("game-a")
+	tooReady.SessionConfig.MinReady = tooReady.SessionConfig.Max + 1
+	if err := ValidateGameConfigs([]*GameConfig{tooReady}); err == nil {
+		t.Errorf("Expected min_ready > max to be rejected")
+	}
+
+	for name, profiles := range map[string][]ScreenProfile{
+		"an unnamed profile":       {{Min: 1}},
+		"duplicate profile names":  {{Name: "portrait"}, {Name: "portrait"}},
+		"a negative profile min":   {{Name: "portrait", Min: -1}},
+		"profile minima above max": {{Name: "portrait", Min: 5}, {Name: "landscape", Min: 6}},
+	} {
+		badProfiles := newTestGameConfig("game-a")
+		badProfiles.SessionConfig.ScreenProfiles = profiles
+		if err := ValidateGameConfigs([]*GameConfig{badProfiles}); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	badArea := newTestGameConfig("game-a")
+	badArea.Stages = []*detector.Stage{{Number: 3, Area: detector.Area{Clue: "level", X: 1.2, Y: 0.1, Width: 0.5, Height: 0.1}}}
+	err := ValidateGameConfigs([]*GameConfig{badArea})
+	if err == nil || !strings.Contains(err.Error(), "stage 3") {
+		t.Errorf("Expected an out of range area to be rejected with its stage, got %v", err)
+	}
+
+	for name, reaping := range map[string]struct {
+		idleTimeMin int
+		ephemeral   bool
+	}{
+		"a negative idle_time_min":            {idleTimeMin: -1},
+		"ephemeral with an idle_time_min set": {idleTimeMin: 60, ephemeral: true},
+	} {
+		badReaping := newTestGameConfig("game-a")
+		badReaping.SessionConfig.IdleTimeMin = reaping.idleTimeMin
+		badReaping.SessionConfig.Ephemeral = reaping.ephemeral
+		if err := ValidateGameConfigs([]*GameConfig{badReaping}); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+	for _, reaping := range []struct {
+		idleTimeMin int
+		ephemeral   bool
+	}{{idleTimeMin: 60}, {ephemeral: true}} {
+		okReaping := newTestGameConfig("game-a")
+		okReaping.SessionConfig.IdleTimeMin = reaping.idleTimeMin
+		okReaping.SessionConfig.Ephemeral = reaping.ephemeral
+		if err := ValidateGameConfigs([]*GameConfig{okReaping}); err != nil {
+			t.Errorf("Expected idle_time_min %d ephemeral %v to be valid, got %v", reaping.idleTimeMin, reaping.ephemeral, err)
+		}
+	}
+
+	unknownClientStage := newTestGameConfig("game-a")
+	unknownClientStage.Stages = []*detector.Stage{{Number: 1}}
+	unknownClientStage.ClientStages = []int{1, 4}
+	if err := ValidateGameConfigs([]*GameConfig{unknownClientStage}); err == nil || !strings.Contains(err.Error(), "stage 4") {
+		t.Errorf("Expected a client stage that is not configured to be rejected, got %v", err)
+	}
+}
@@ -3,18 +3,42 @@ package game
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sync"
+	"time"
 
+	"github.com/letusgogo/playable-backend/internal/anbox"
 	"github.com/letusgogo/playable-backend/internal/detector"
 	"github.com/letusgogo/playable-backend/internal/session"
 )
 
+const (
+	// DefaultHeartbeatTimeout is used when a game does not configure heartbeat_timeout
+	DefaultHeartbeatTimeout = 5 * time.Minute
+	// DefaultSyncInterval is used when a game does not configure sync_interval
+	DefaultSyncInterval = 30 * time.Second
+)
+
 type GameInstance struct {
-	gameConfig     *GameConfig
-	name           string
-	anboxClient    session.AnboxClient
-	sessionManager session.Manager
+	gameConfig  *GameConfig
+	name        string
+	anboxClient session.AnboxClient
+	dumper      *detector.Dumper
+	auditSink   session.AuditSink      // nil disables the session audit log
+	capacity    session.CapacityBudget // shared with the other games, nil without a GlobalMax
+	releases    runnerReleases         // reports released sessions to the stage runner for their over callback
+
+	// lifecycleMu serializes Init, Start, Stop and Drain so they never hold mu across slow anbox calls
+	lifecycleMu sync.Mutex
+
+	// mu guards the fields below, which handlers read while the lifecycle methods run
+	mu             sync.RWMutex
+	sessionManager session.Manager // only set once Init succeeded
 	initialized    bool
 	running        bool
+	stageRunner    *stageRunner // set while server-side stage detection runs
+	// failure is why the instance failed to init or start, set when the manager runs it degraded
+	failure error
 }
 
 // NewGameInstance creates a new game instance with the given configuration
@@ -23,84 +47,413 @@ func NewGameInstance(gameConfig *GameConfig, anboxClient session.AnboxClient) *G
 		gameConfig:  gameConfig,
 		name:        gameConfig.Name,
 		anboxClient: anboxClient,
-		initialized: false,
-		running:     false,
 	}
 }
 
 // Init initializes the game instance's session manager
 func (g *GameInstance) Init(ctx context.Context) error {
-	if g.initialized {
+	g.lifecycleMu.Lock()
+	defer g.lifecycleMu.Unlock()
+
+	if g.IsInitialized() {
 		return fmt.Errorf("game instance %s already initialized", g.name)
 	}
 	if g.gameConfig.SessionConfig == nil {
 		return fmt.Errorf("session config is nil")
 	}
 
+	// Make sure the anbox application exists before creating any sessions for it
+	appName := g.gameConfig.GetAppName()
+	if _, err := g.anboxClient.GetApp(ctx, appName); err != nil {
+		return fmt.Errorf("game %s: anbox app %s is not available on AMS: %w", g.name, appName, err)
+	}
+
 	// Convert game session config to session manager config
 	sessionConfig := session.NewConfig()
 	sessionConfig.GameName = g.gameConfig.Name
+	sessionConfig.AppName = appName
 	sessionConfig.Min = g.gameConfig.SessionConfig.Min
 	sessionConfig.Max = g.gameConfig.SessionConfig.Max
+	sessionConfig.MinReady = g.gameConfig.SessionConfig.MinReady
 	sessionConfig.SessionTTL = g.gameConfig.SessionConfig.SessionTTL
-	sessionConfig.HeartbeatTimeout = g.gameConfig.SessionConfig.HeartbeatTimeout
-	sessionConfig.SyncInterval = g.gameConfig.SessionConfig.SyncInterval
+	sessionConfig.HeartbeatTimeout = DefaultHeartbeatTimeout
+	if g.gameConfig.SessionConfig.HeartbeatTimeout != 0 {
+		sessionConfig.HeartbeatTimeout = g.gameConfig.SessionConfig.HeartbeatTimeout
+	}
+	sessionConfig.SyncInterval = DefaultSyncInterval
+	if g.gameConfig.SessionConfig.SyncInterval != 0 {
+		sessionConfig.SyncInterval = g.gameConfig.SessionConfig.SyncInterval
+	}
+	sessionConfig.WarmupConcurrency = g.gameConfig.SessionConfig.WarmupConcurrency
+	sessionConfig.OrphanMaxAge = g.gameConfig.SessionConfig.OrphanMaxAge
+	sessionConfig.KeepErrored = g.gameConfig.SessionConfig.KeepErrored
+	if g.gameConfig.SessionConfig.MaxInUseDuration < 0 {
+		return fmt.Errorf("game %s max_in_use_duration must not be negative, got %s", g.name, g.gameConfig.SessionConfig.MaxInUseDuration)
+	}
+	sessionConfig.MaxInUseDuration = g.gameConfig.SessionConfig.MaxInUseDuration
+	if g.gameConfig.SessionConfig.CreateBackoff != 0 {
+		sessionConfig.CreateBackoff = g.gameConfig.SessionConfig.CreateBackoff
+	}
+	if g.gameConfig.SessionConfig.CreateBackoffMax != 0 {
+		sessionConfig.CreateBackoffMax = g.gameConfig.SessionConfig.CreateBackoffMax
+	}
+	if g.gameConfig.SessionConfig.CreateHaltTimeout < 0 {
+		return fmt.Errorf("game %s create_halt_timeout must not be negative, got %s", g.name, g.gameConfig.SessionConfig.CreateHaltTimeout)
+	}
+	if g.gameConfig.SessionConfig.CreateHaltTimeout != 0 {
+		sessionConfig.CreateHaltTimeout = g.gameConfig.SessionConfig.CreateHaltTimeout
+	}
+	// On-demand sessions skip warming, without a launch or warm-up actions clients would get the boot screen
+	if g.gameConfig.SessionConfig.OnDemand && !g.gameConfig.SessionConfig.LaunchApp && len(g.gameConfig.SessionConfig.WarmupActions) == 0 {
+		return fmt.Errorf("game %s on_demand needs launch_app or warmup_actions to warm sessions before they are handed out", g.name)
+	}
+	sessionConfig.OnDemand = g.gameConfig.SessionConfig.OnDemand
+	if g.gameConfig.SessionConfig.OnDemandTimeout != 0 {
+		sessionConfig.OnDemandTimeout = g.gameConfig.SessionConfig.OnDemandTimeout
+	}
+	if g.gameConfig.SessionConfig.CreateVerifyTimeout < 0 || g.gameConfig.SessionConfig.CreateVerifyInterval < 0 {
+		return fmt.Errorf("game %s create_verify_timeout and create_verify_interval must not be negative", g.name)
+	}
+	sessionConfig.CreateVerifyTimeout = g.gameConfig.SessionConfig.CreateVerifyTimeout
+	sessionConfig.CreateVerifyInterval = g.gameConfig.SessionConfig.CreateVerifyInterval
+	if g.gameConfig.SessionConfig.LaunchApp {
+		if _, ok := g.anboxClient.(session.AppLauncher); !ok {
+			return fmt.Errorf("game %s enables launch_app but its anbox client cannot launch apps", g.name)
+		}
+		if len(g.gameConfig.SessionConfig.LaunchCommands) == 0 {
+			return fmt.Errorf("game %s enables launch_app without launch_commands", g.name)
+		}
+	}
+	if g.gameConfig.SessionConfig.LaunchTimeout < 0 {
+		return fmt.Errorf("game %s launch_timeout must not be negative, got %s", g.name, g.gameConfig.SessionConfig.LaunchTimeout)
+	}
+	sessionConfig.LaunchApp = g.gameConfig.SessionConfig.LaunchApp
+	sessionConfig.LaunchCommands = g.gameConfig.SessionConfig.LaunchCommands
+	sessionConfig.LaunchTimeout = g.gameConfig.SessionConfig.LaunchTimeout
+	if g.gameConfig.SessionConfig.LaunchAttempts < 0 {
+		return fmt.Errorf("game %s launch_attempts must not be negative, got %d", g.name, g.gameConfig.SessionConfig.LaunchAttempts)
+	}
+	if g.gameConfig.SessionConfig.LaunchAttempts != 0 {
+		sessionConfig.LaunchAttempts = g.gameConfig.SessionConfig.LaunchAttempts
+	}
+	for i, action := range g.gameConfig.SessionConfig.WarmupActions {
+		if err := action.Validate(); err != nil {
+			return fmt.Errorf("game %s warmup_actions[%d]: %w", g.name, i, err)
+		}
+		if _, isInput := action.Input(); isInput && g.gameConfig.SessionConfig.WarmupInputViaGateway {
+			if _, ok := g.anboxClient.(session.InputSender); !ok {
+				return fmt.Errorf("game %s warmup_actions[%d] needs an anbox client that can send input", g.name, i)
+			}
+			continue
+		}
+		if _, ok := g.anboxClient.(session.AppLauncher); action.RunsInInstance() && !ok {
+			return fmt.Errorf("game %s warmup_actions[%d] needs an anbox client that can run commands", g.name, i)
+		}
+	}
+	if g.gameConfig.SessionConfig.WarmupTimeout < 0 {
+		return fmt.Errorf("game %s warmup_timeout must not be negative, got %s", g.name, g.gameConfig.SessionConfig.WarmupTimeout)
+	}
+	sessionConfig.WarmupActions = g.gameConfig.SessionConfig.WarmupActions
+	sessionConfig.WarmupTimeout = g.gameConfig.SessionConfig.WarmupTimeout
+	sessionConfig.WarmupInputViaGateway = g.gameConfig.SessionConfig.WarmupInputViaGateway
+	if g.gameConfig.SessionConfig.WarmingWorkers < 0 {
+		return fmt.Errorf("game %s warming_workers must not be negative, got %d", g.name, g.gameConfig.SessionConfig.WarmingWorkers)
+	}
+	if g.gameConfig.SessionConfig.MinWarmed < 0 {
+		return fmt.Errorf("game %s min_warmed must not be negative, got %d", g.name, g.gameConfig.SessionConfig.MinWarmed)
+	}
+	sessionConfig.WarmingWorkers = g.gameConfig.SessionConfig.WarmingWorkers
+	sessionConfig.MinWarmed = g.gameConfig.SessionConfig.MinWarmed
+	if g.gameConfig.SessionConfig.IdempotencyTTL != 0 {
+		sessionConfig.IdempotencyTTL = g.gameConfig.SessionConfig.IdempotencyTTL
+	}
+	if g.gameConfig.SessionConfig.MaxSessionsPerKey < 0 {
+		return fmt.Errorf("game %s max_sessions_per_key must not be negative, got %d", g.name, g.gameConfig.SessionConfig.MaxSessionsPerKey)
+	}
+	sessionConfig.MaxSessionsPerKey = g.gameConfig.SessionConfig.MaxSessionsPerKey
+	if g.gameConfig.SessionConfig.WarmingTimeout < 0 {
+		return fmt.Errorf("game %s warming_timeout must be positive, got %s", g.name, g.gameConfig.SessionConfig.WarmingTimeout)
+	}
+	if g.gameConfig.SessionConfig.WarmingTimeout != 0 {
+		sessionConfig.WarmingTimeout = g.gameConfig.SessionConfig.WarmingTimeout
+	}
+	if g.gameConfig.SessionConfig.MaxWarmingDuration < 0 {
+		return fmt.Errorf("game %s max_warming_duration must not be negative, got %s", g.name, g.gameConfig.SessionConfig.MaxWarmingDuration)
+	}
+	sessionConfig.MaxWarmingDuration = g.gameConfig.SessionConfig.MaxWarmingDuration
+	// Past the warming timeout the session is already back in the cold pool, a longer max would never fire
+	if sessionConfig.MaxWarmingDuration > 0 && sessionConfig.WarmingTimeout > 0 && sessionConfig.MaxWarmingDuration >= sessionConfig.WarmingTimeout {
+		return fmt.Errorf("game %s max_warming_duration %s must be shorter than warming_timeout %s", g.name, sessionConfig.MaxWarmingDuration, sessionConfig.WarmingTimeout)
+	}
+	sessionConfig.MaxWarmingAction = session.WarmingOverrunAction(g.gameConfig.SessionConfig.MaxWarmingAction)
+	if !sessionConfig.MaxWarmingAction.Valid() {
+		return fmt.Errorf("game %s has unknown max_warming_action %q", g.name, sessionConfig.MaxWarmingAction)
+	}
+	if g.gameConfig.SessionConfig.GracePeriod < 0 {
+		return fmt.Errorf("game %s grace_period must not be negative, got %s", g.name, g.gameConfig.SessionConfig.GracePeriod)
+	}
+	if g.gameConfig.SessionConfig.GracePeriod != 0 {
+		sessionConfig.GracePeriod = g.gameConfig.SessionConfig.GracePeriod
+	}
+	if g.gameConfig.SessionConfig.MaxColdAge < 0 {
+		return fmt.Errorf("game %s max_cold_age must not be negative, got %s", g.name, g.gameConfig.SessionConfig.MaxColdAge)
+	}
+	sessionConfig.MaxColdAge = g.gameConfig.SessionConfig.MaxColdAge
+	if g.gameConfig.SessionConfig.InUseAbsentSyncs < 0 {
+		return fmt.Errorf("game %s in_use_absent_syncs must not be negative, got %d", g.name, g.gameConfig.SessionConfig.InUseAbsentSyncs)
+	}
+	sessionConfig.InUseAbsentSyncs = g.gameConfig.SessionConfig.InUseAbsentSyncs
+	if err := anbox.ValidateInstanceNamePrefix(g.gameConfig.SessionConfig.InstanceNamePrefix); err != nil {
+		return fmt.Errorf("game %s: %w", g.name, err)
+	}
+	sessionConfig.InstanceNamePrefix = g.gameConfig.SessionConfig.InstanceNamePrefix
+	sessionConfig.IdleTimeMin = g.gameConfig.SessionConfig.IdleTimeMin
+	sessionConfig.Ephemeral = g.gameConfig.SessionConfig.Ephemeral
+	if g.gameConfig.SessionConfig.HealthSweepInterval < 0 || g.gameConfig.SessionConfig.HealthSweepConcurrency < 0 {
+		return fmt.Errorf("game %s health_sweep_interval and health_sweep_concurrency must not be negative", g.name)
+	}
+	sessionConfig.HealthSweepInterval = g.gameConfig.SessionConfig.HealthSweepInterval
+	if g.gameConfig.SessionConfig.HealthSweepConcurrency != 0 {
+		sessionConfig.HealthSweepConcurrency = g.gameConfig.SessionConfig.HealthSweepConcurrency
+	}
+	if g.gameConfig.SessionConfig.HealthAbsentSweeps < 0 {
+		return fmt.Errorf("game %s health_absent_sweeps must not be negative, got %d", g.name, g.gameConfig.SessionConfig.HealthAbsentSweeps)
+	}
+	if g.gameConfig.SessionConfig.HealthAbsentSweeps != 0 {
+		sessionConfig.HealthAbsentSweeps = g.gameConfig.SessionConfig.HealthAbsentSweeps
+	}
+	if g.gameConfig.SessionConfig.ConnectSettle < 0 || g.gameConfig.SessionConfig.ConnectRetryMin < 0 {
+		return fmt.Errorf("game %s connect_settle and connect_retry_min must not be negative", g.name)
+	}
+	if g.gameConfig.SessionConfig.ConnectSettle != 0 {
+		sessionConfig.ConnectSettle = g.gameConfig.SessionConfig.ConnectSettle
+	}
+	if g.gameConfig.SessionConfig.ConnectRetryMin != 0 {
+		sessionConfig.ConnectRetryMin = g.gameConfig.SessionConfig.ConnectRetryMin
+	}
+	if g.gameConfig.SessionConfig.EmptyRetryAfter < 0 {
+		return fmt.Errorf("game %s empty_retry_after must not be negative, got %s", g.name, g.gameConfig.SessionConfig.EmptyRetryAfter)
+	}
+	if g.gameConfig.SessionConfig.EmptyRetryAfter != 0 {
+		sessionConfig.EmptyRetryAfter = g.gameConfig.SessionConfig.EmptyRetryAfter
+	}
+	if g.gameConfig.SessionConfig.StarvationThreshold < 0 || g.gameConfig.SessionConfig.StarvationWindow < 0 {
+		return fmt.Errorf("game %s starvation_threshold and starvation_window must not be negative", g.name)
+	}
+	sessionConfig.StarvationThreshold = g.gameConfig.SessionConfig.StarvationThreshold
+	sessionConfig.StarvationWindow = g.gameConfig.SessionConfig.StarvationWindow
+	if webhook := g.gameConfig.SessionConfig.StarvationWebhook; webhook != "" && !isWebhookURL(webhook) {
+		return fmt.Errorf("game %s starvation_webhook must be an http or https URL, got %q", g.name, webhook)
+	}
+	if g.gameConfig.SessionConfig.MinWarmedGuarantee < 0 || g.gameConfig.SessionConfig.GuaranteeBreachAfter < 0 {
+		return fmt.Errorf("game %s min_warmed_guarantee and guarantee_breach_after must not be negative", g.name)
+	}
+	if g.gameConfig.SessionConfig.MinWarmedGuarantee > sessionConfig.Max {
+		return fmt.Errorf("game %s min_warmed_guarantee %d can never be met with max %d", g.name, g.gameConfig.SessionConfig.MinWarmedGuarantee, sessionConfig.Max)
+	}
+	sessionConfig.MinWarmedGuarantee = g.gameConfig.SessionConfig.MinWarmedGuarantee
+	if err := validateWarmedTargets(g.gameConfig.SessionConfig); err != nil {
+		return fmt.Errorf("game %s: %w", g.name, err)
+	}
+	if g.gameConfig.SessionConfig.GuaranteeBreachAfter != 0 {
+		sessionConfig.GuaranteeBreachAfter = g.gameConfig.SessionConfig.GuaranteeBreachAfter
+	}
+	if webhook := g.gameConfig.SessionConfig.GuaranteeWebhook; webhook != "" && !isWebhookURL(webhook) {
+		return fmt.Errorf("game %s guarantee_webhook must be an http or https URL, got %q", g.name, webhook)
+	}
+	sessionConfig.EvictionPolicy = session.EvictionPolicy(g.gameConfig.SessionConfig.EvictionPolicy)
+	if !sessionConfig.EvictionPolicy.Valid() {
+		return fmt.Errorf("game %s has unknown eviction_policy %q", g.name, sessionConfig.EvictionPolicy)
+	}
+	sessionConfig.DrainOrder = session.DrainOrder(g.gameConfig.SessionConfig.DrainOrder)
+	if !sessionConfig.DrainOrder.Valid() {
+		return fmt.Errorf("game %s has unknown drain_order %q", g.name, sessionConfig.DrainOrder)
+	}
+	if sessionConfig.HeartbeatTimeout < 0 {
+		return fmt.Errorf("game %s heartbeat_timeout must be positive, got %s", g.name, sessionConfig.HeartbeatTimeout)
+	}
+	if sessionConfig.SyncInterval < 0 {
+		return fmt.Errorf("game %s sync_interval must be positive, got %s", g.name, sessionConfig.SyncInterval)
+	}
+	if err := g.gameConfig.Preprocess.Validate(); err != nil {
+		return fmt.Errorf("game %s: %w", g.name, err)
+	}
+	if err := g.gameConfig.RecoDefaults.Validate(); err != nil {
+		return fmt.Errorf("game %s: %w", g.name, err)
+	}
+	g.inheritRecoDefaults()
+	for _, stage := range g.gameConfig.Stages {
+		if err := stage.Reco.Preprocess.Validate(); err != nil {
+			return fmt.Errorf("game %s stage %d: %w", g.name, stage.Number, err)
+		}
+		if err := stage.Reco.ValidateMethods(); err != nil {
+			return fmt.Errorf("game %s stage %d: %w", g.name, stage.Number, err)
+		}
+		if err := stage.Reco.ValidateGroups(); err != nil {
+			return fmt.Errorf("game %s stage %d: %w", g.name, stage.Number, err)
+		}
+		if err := stage.Reco.ValidateOCR(); err != nil {
+			return fmt.Errorf("game %s stage %d: %w", g.name, stage.Number, err)
+		}
+		if stage.Reco.MinConfidence < 0 || stage.Reco.MinConfidence > 100 {
+			return fmt.Errorf("game %s stage %d min_confidence must be between 0 and 100, got %g", g.name, stage.Number, stage.Reco.MinConfidence)
+		}
+	}
+	if g.gameConfig.ServerDetectionEnabled() {
+		if len(g.gameConfig.Stages) == 0 {
+			return fmt.Errorf("game %s enables server_detection without any stages", g.name)
+		}
+		for _, stage := range g.gameConfig.Stages {
+			if stage.Interval < MinStageInterval {
+				return fmt.Errorf("game %s stage %d interval must be at least %s with server_detection, got %s", g.name, stage.Number, MinStageInterval, stage.Interval)
+			}
+		}
+		if g.gameConfig.Runtime.DetectionConcurrency < 0 {
+			return fmt.Errorf("game %s detection_concurrency must not be negative, got %d", g.name, g.gameConfig.Runtime.DetectionConcurrency)
+		}
+		if g.gameConfig.Runtime.OverRetries < 0 {
+			return fmt.Errorf("game %s over_retries must not be negative, got %d", g.name, g.gameConfig.Runtime.OverRetries)
+		}
+	}
 	sessionConfig.ScreenConfig = &session.ScreenConfig{
 		Width:   g.gameConfig.SessionConfig.ScreenConfig.Width,
 		Height:  g.gameConfig.SessionConfig.ScreenConfig.Height,
 		Density: g.gameConfig.SessionConfig.ScreenConfig.Density,
 		Fps:     g.gameConfig.SessionConfig.ScreenConfig.Fps,
 	}
+	for _, profile := range g.gameConfig.SessionConfig.ScreenProfiles {
+		sessionConfig.ScreenProfiles = append(sessionConfig.ScreenProfiles, session.ScreenProfile{
+			Name:         profile.Name,
+			Min:          profile.Min,
+			MinReady:     profile.MinReady,
+			MinWarmed:    profile.MinWarmed,
+			ScreenConfig: session.ScreenConfig(profile.ScreenConfig),
+		})
+	}
 
-	// Create session manager
-	g.sessionManager = session.NewLocalSessionManager(sessionConfig, g.anboxClient)
+	// Create session manager, it is only published once initialized so handlers never see a half-built one
+	var opts []session.ManagerOption
+	if g.auditSink != nil {
+		opts = append(opts, session.WithAuditSink(g.auditSink))
+	}
+	if webhook := g.gameConfig.SessionConfig.StarvationWebhook; webhook != "" {
+		opts = append(opts, session.WithStarvationAlerter(session.NewWebhookAlerter(webhook)))
+	}
+	if webhook := g.gameConfig.SessionConfig.GuaranteeWebhook; webhook != "" {
+		opts = append(opts, session.WithGuaranteeNotifier(session.NewWebhookAlerter(webhook)))
+	}
+	if g.capacity != nil {
+		opts = append(opts, session.WithCapacityBudget(g.capacity))
+	}
+	if g.gameConfig.ServerDetectionEnabled() {
+		opts = append(opts, session.WithReleaseNotifier(&g.releases))
+	}
+	sessionManager := session.NewLocalSessionManager(sessionConfig, g.anboxClient, opts...)
 
 	// Initialize session manager
-	if err := g.sessionManager.Init(ctx, sessionConfig); err != nil {
+	if err := sessionManager.Init(ctx, sessionConfig); err != nil {
 		return fmt.Errorf("failed to initialize session manager for game %s: %w", g.name, err)
 	}
 
+	g.mu.Lock()
+	g.sessionManager = sessionManager
 	g.initialized = true
+	g.mu.Unlock()
 	return nil
 }
 
 // Start starts the game instance's session manager
 func (g *GameInstance) Start(ctx context.Context) error {
-	if !g.initialized {
+	g.lifecycleMu.Lock()
+	defer g.lifecycleMu.Unlock()
+
+	g.mu.RLock()
+	initialized, running, sessionManager := g.initialized, g.running, g.sessionManager
+	g.mu.RUnlock()
+
+	if !initialized {
 		return fmt.Errorf("game instance %s not initialized", g.name)
 	}
 
-	if g.running {
+	if running {
 		return fmt.Errorf("game instance %s already running", g.name)
 	}
 
-	if err := g.sessionManager.Start(ctx); err != nil {
+	if err := sessionManager.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start session manager for game %s: %w", g.name, err)
 	}
 
+	var runner *stageRunner
+	if g.gameConfig.ServerDetectionEnabled() {
+		runner = newStageRunner(g.name, g.gameConfig.Runtime, g.gameConfig.Stages, sessionManager, g.anboxClient, g.GetStageDetector)
+		runner.Start()
+		g.releases.runner.Store(runner)
+	}
+
+	g.mu.Lock()
+	g.stageRunner = runner
 	g.running = true
+	g.mu.Unlock()
 	return nil
 }
 
 // Stop stops the game instance's session manager
 func (g *GameInstance) Stop(ctx context.Context) error {
-	if !g.running {
+	g.lifecycleMu.Lock()
+	defer g.lifecycleMu.Unlock()
+
+	// Mark the instance stopped first so handlers stop handing out sessions while it shuts down
+	g.mu.Lock()
+	running, runner, sessionManager := g.running, g.stageRunner, g.sessionManager
+	g.running = false
+	g.stageRunner = nil
+	g.mu.Unlock()
+
+	if !running {
 		return nil
 	}
 
-	if err := g.sessionManager.Stop(ctx); err != nil {
+	if runner != nil {
+		g.releases.runner.Store(nil)
+		runner.Stop()
+	}
+
+	if err := sessionManager.Stop(ctx); err != nil {
 		return fmt.Errorf("failed to stop session manager for game %s: %w", g.name, err)
 	}
+	return nil
+}
 
-	g.running = false
+// Drain gives the game's in-use sessions a grace period before releasing them
+func (g *GameInstance) Drain(ctx context.Context, grace time.Duration) error {
+	g.lifecycleMu.Lock()
+	defer g.lifecycleMu.Unlock()
+
+	g.mu.RLock()
+	running, sessionManager := g.running, g.sessionManager
+	g.mu.RUnlock()
+	if !running {
+		return nil
+	}
+
+	if err := sessionManager.Drain(ctx, grace); err != nil {
+		return fmt.Errorf("failed to drain session manager for game %s: %w", g.name, err)
+	}
 	return nil
 }
 
-// GetSessionManager returns the session manager for this game instance
+// GetSessionManager returns the session manager for this game instance, nil until Init succeeded
 func (g *GameInstance) GetSessionManager() session.Manager {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	return g.sessionManager
 }
 
+// GetAnboxClient returns the client of the farm the game runs on
+func (g *GameInstance) GetAnboxClient() session.AnboxClient {
+	return g.anboxClient
+}
+
 // GetConfig returns the game configuration
 func (g *GameInstance) GetConfig() *GameConfig {
 	return g.gameConfig
@@ -108,34 +461,84 @@ func (g *GameInstance) GetConfig() *GameConfig {
 
 // IsInitialized returns whether the game instance is initialized
 func (g *GameInstance) IsInitialized() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	return g.initialized
 }
 
 // IsRunning returns whether the game instance is running
 func (g *GameInstance) IsRunning() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	return g.running
 }
 
+// IsDegraded returns whether the game instance failed to init or start
+func (g *GameInstance) IsDegraded() bool {
+	return g.Failure() != nil
+}
+
+// Failure returns why the game instance failed to init or start
+func (g *GameInstance) Failure() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.failure
+}
+
+// setFailure marks the instance degraded
+func (g *GameInstance) setFailure(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failure = err
+}
+
 func (g *GameInstance) GetInstanceStatus(ctx context.Context) (*GameInstanceStatus, error) {
-	poolStatus, err := g.sessionManager.PoolStatus(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return &GameInstanceStatus{
+	g.mu.RLock()
+	status := &GameInstanceStatus{
 		Name:        g.name,
 		Initialized: g.initialized,
 		Running:     g.running,
-		PoolStatus:  &poolStatus,
-		Config:      g.gameConfig,
-	}, nil
+		Degraded:    g.failure != nil,
+		Config:      g.gameConfig.redacted(),
+	}
+	if g.failure != nil {
+		status.Error = g.failure.Error()
+	}
+	sessionManager := g.sessionManager
+	g.mu.RUnlock()
+	if sessionManager == nil {
+		return status, nil
+	}
+
+	poolStatus, err := sessionManager.PoolStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.PoolStatus = &poolStatus
+	status.setSyncHealth(sessionManager.LoopHealth())
+	return status, nil
+}
+
+// inheritRecoDefaults fills the stage recos from the game's reco_defaults. It only fills empty fields,
+// so the self-test, which runs before Init, may call it as well.
+func (g *GameInstance) inheritRecoDefaults() {
+	for _, stage := range g.gameConfig.Stages {
+		stage.Reco.Inherit(g.gameConfig.RecoDefaults)
+	}
 }
 
 func (g *GameInstance) GetStageDetector(stageNum int) detector.StageChecker {
 	if stageNum == 1 {
-		return detector.NewDefaultOcrDetector(g.gameConfig.Stages)
+		return detector.NewDefaultOcrDetector(g.gameConfig.Stages, g.gameConfig.Preprocess, g.dumper)
 	} else if stageNum == 2 {
-		return detector.NewDefaultOcrDetector(g.gameConfig.Stages)
+		return detector.NewDefaultOcrDetector(g.gameConfig.Stages, g.gameConfig.Preprocess, g.dumper)
 	} else {
-		return detector.NewDefaultOcrDetector(g.gameConfig.Stages)
+		return detector.NewDefaultOcrDetector(g.gameConfig.Stages, g.gameConfig.Preprocess, g.dumper)
 	}
 }
+
+// isWebhookURL reports whether raw is an absolute http or https URL an alert can be posted to
+func isWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
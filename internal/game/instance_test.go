@@ -0,0 +1,446 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+// MockAnboxClient for testing
+type MockAnboxClient struct {
+	missingApps map[string]bool
+	mu          sync.Mutex
+	created     map[string]int // app name -> CreateAsync calls
+	listError   error          // fails listing the running sessions
+}
+
+func (m *MockAnboxClient) Create(ctx context.Context, req anbox.CreateSessionRequest) (*anbox.SessionDetails, error) {
+	return &anbox.SessionDetails{ID: "mock-session", App: req.App}, nil
+}
+
+func (m *MockAnboxClient) CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error) {
+	return nil, fmt.Errorf("no screenshot for session %s", sessionID)
+}
+
+func (m *MockAnboxClient) Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error) {
+	return &anbox.JoinSessionDetails{SignalingURL: "wss://gateway.example.com/" + sessionID + "?token=scoped-" + sessionID}, nil
+}
+
+func (m *MockAnboxClient) GetSession(ctx context.Context, sessionID string) (*anbox.SessionDetails, error) {
+	return &anbox.SessionDetails{ID: sessionID, Status: "active"}, nil
+}
+
+func (m *MockAnboxClient) CreateAsync(ctx context.Context, req anbox.CreateSessionRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.created == nil {
+		m.created = make(map[string]int)
+	}
+	m.created[req.App]++
+	return nil
+}
+
+// Created returns how many sessions of app were requested
+func (m *MockAnboxClient) Created(app string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.created[app]
+}
+
+func (m *MockAnboxClient) Delete(ctx context.Context, sessionID string) error {
+	return nil
+}
+
+func (m *MockAnboxClient) GetAllRunningSession(ctx context.Context) ([]*anbox.SessionDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return nil, m.listError
+}
+
+// setListError makes listing the running sessions fail with err, nil makes it succeed again
+func (m *MockAnboxClient) setListError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listError = err
+}
+
+func (m *MockAnboxClient) GetAllInstances(ctx context.Context) ([]*anbox.InstanceDetails, error) {
+	return nil, nil
+}
+
+func (m *MockAnboxClient) DeleteInstance(ctx context.Context, instanceID string) error {
+	return nil
+}
+
+func (m *MockAnboxClient) GetApp(ctx context.Context, name string) (*anbox.AppDetails, error) {
+	if m.missingApps[name] {
+		return nil, fmt.Errorf("%w: %s", anbox.ErrAppNotFound, name)
+	}
+	return &anbox.AppDetails{Name: name}, nil
+}
+
+func (m *MockAnboxClient) GetGatewayURL() string {
+	return "mock://gateway"
+}
+
+func (m *MockAnboxClient) GetAuthToken() string {
+	return "mock-token"
+}
+
+func (m *MockAnboxClient) GetReplicaID() string {
+	return "mock-replica"
+}
+
+func (m *MockAnboxClient) Available() bool {
+	return true
+}
+
+func newTestGameConfig(name string) *GameConfig {
+	return &GameConfig{
+		Name: name,
+		SessionConfig: &SessionConfig{
+			Min:        1,
+			Max:        10,
+			SessionTTL: 5 * time.Minute,
+			ScreenConfig: ScreenConfig{
+				Width:   720,
+				Height:  1240,
+				Density: 320,
+				Fps:     30,
+			},
+		},
+	}
+}
+
+func TestGameInstance_Init_PassesHeartbeatAndSyncInterval(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.HeartbeatTimeout = 30 * time.Second
+	gameConfig.SessionConfig.SyncInterval = 5 * time.Second
+
+	instance := NewGameInstance(gameConfig, &MockAnboxClient{})
+	if err := instance.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+
+	cfg := instance.GetSessionManager().(*session.LocalSessionManager).Config()
+	if cfg.HeartbeatTimeout != 30*time.Second {
+		t.Errorf("Expected heartbeat timeout 30s, got %s", cfg.HeartbeatTimeout)
+	}
+	if cfg.SyncInterval != 5*time.Second {
+		t.Errorf("Expected sync interval 5s, got %s", cfg.SyncInterval)
+	}
+}
+
+func TestGameInstance_Init_DefaultsHeartbeatAndSyncInterval(t *testing.T) {
+	instance := NewGameInstance(newTestGameConfig("test-game"), &MockAnboxClient{})
+	if err := instance.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+
+	cfg := instance.GetSessionManager().(*session.LocalSessionManager).Config()
+	if cfg.HeartbeatTimeout != DefaultHeartbeatTimeout {
+		t.Errorf("Expected default heartbeat timeout %s, got %s", DefaultHeartbeatTimeout, cfg.HeartbeatTimeout)
+	}
+	if cfg.SyncInterval != DefaultSyncInterval {
+		t.Errorf("Expected default sync interval %s, got %s", DefaultSyncInterval, cfg.SyncInterval)
+	}
+}
+
+func TestGameInstance_Init_RejectsNegativeDurations(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.HeartbeatTimeout = -time.Second
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+		t.Errorf("Expected error for negative heartbeat timeout, but got none")
+	}
+
+	gameConfig = newTestGameConfig("test-game")
+	gameConfig.SessionConfig.SyncInterval = -time.Second
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+		t.Errorf("Expected error for negative sync interval, but got none")
+	}
+}
+
+func TestGameInstance_Init_MaxWarmingDurationBelowWarmingTimeout(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.MaxWarmingDuration = 3 * time.Minute
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+		t.Errorf("Expected max_warming_duration past the default warming_timeout to be rejected")
+	}
+
+	gameConfig.SessionConfig.WarmingTimeout = 5 * time.Minute
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err != nil {
+		t.Errorf("Expected max_warming_duration below warming_timeout to be accepted, got %v", err)
+	}
+}
+
+func TestGameInstance_Init_ValidatesMinWarmed(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(cfg *SessionConfig)
+		ok        bool
+	}{
+		{"without warming workers", func(cfg *SessionConfig) { cfg.MinWarmed = 1 }, false},
+		{"profile without warming workers", func(cfg *SessionConfig) {
+			cfg.ScreenProfiles = []ScreenProfile{{Name: "portrait"}, {Name: "landscape", Min: 1, MinWarmed: 1}}
+		}, false},
+		{"above min and min_ready", func(cfg *SessionConfig) {
+			cfg.WarmingWorkers, cfg.MinReady, cfg.MinWarmed = 1, 2, 3
+		}, false},
+		{"profile above its min", func(cfg *SessionConfig) {
+			cfg.WarmingWorkers = 1
+			cfg.ScreenProfiles = []ScreenProfile{{Name: "portrait"}, {Name: "landscape", Min: 1, MinWarmed: 2}}
+		}, false},
+		{"below min_warmed_guarantee", func(cfg *SessionConfig) {
+			cfg.WarmingWorkers, cfg.MinReady, cfg.MinWarmed, cfg.MinWarmedGuarantee = 1, 2, 1, 2
+		}, false},
+		{"profiles cover min_warmed_guarantee", func(cfg *SessionConfig) {
+			cfg.WarmingWorkers, cfg.MinReady, cfg.MinWarmed, cfg.MinWarmedGuarantee = 1, 2, 1, 2
+			cfg.ScreenProfiles = []ScreenProfile{{Name: "portrait"}, {Name: "landscape", Min: 1, MinWarmed: 1}}
+		}, true},
+		{"within min_ready", func(cfg *SessionConfig) {
+			cfg.WarmingWorkers, cfg.MinReady, cfg.MinWarmed = 1, 2, 2
+		}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gameConfig := newTestGameConfig("test-game")
+			tc.configure(gameConfig.SessionConfig)
+			err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background())
+			if tc.ok && err != nil {
+				t.Errorf("Expected min_warmed to be accepted, got %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("Expected min_warmed to be rejected")
+			}
+		})
+	}
+}
+
+func TestGameInstance_Init_LaunchAppNeedsLauncher(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.LaunchApp = true
+	gameConfig.SessionConfig.LaunchCommands = [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+		t.Errorf("Expected launch_app to be rejected for a client that cannot launch apps")
+	}
+}
+
+func TestGameInstance_Init_OnDemandNeedsWarming(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.OnDemand = true
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+		t.Errorf("Expected on_demand without launch_app or warmup_actions to be rejected")
+	}
+
+	gameConfig.SessionConfig.WarmupActions = []session.WarmupAction{{Wait: time.Second}}
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err != nil {
+		t.Errorf("Expected on_demand with warmup_actions to be accepted, got %v", err)
+	}
+}
+
+func TestGameInstance_Init_ValidatesWarmupActions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		actions []session.WarmupAction
+		ok      bool
+	}{
+		{"wait only", []session.WarmupAction{{Wait: time.Second}}, true},
+		{"tap without runner", []session.WarmupAction{{Tap: []int{10, 20}}}, false},
+		{"tap with one coordinate", []session.WarmupAction{{Tap: []int{10}}}, false},
+		{"swipe with three values", []session.WarmupAction{{Swipe: []int{10, 20, 30}}}, false},
+		{"two kinds", []session.WarmupAction{{Wait: time.Second, Command: []string{"true"}}}, false},
+		{"empty", []session.WarmupAction{{}}, false},
+	} {
+		gameConfig := newTestGameConfig("test-game")
+		gameConfig.SessionConfig.WarmupActions = tc.actions
+		err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background())
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
+
+func TestGameInstance_Init_AppName(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	instance := NewGameInstance(gameConfig, &MockAnboxClient{})
+	if err := instance.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+	if cfg := instance.GetSessionManager().(*session.LocalSessionManager).Config(); cfg.AppName != "test-game" {
+		t.Errorf("Expected app name to default to game name, got %s", cfg.AppName)
+	}
+
+	gameConfig = newTestGameConfig("test-game")
+	gameConfig.AppName = "test-app"
+	instance = NewGameInstance(gameConfig, &MockAnboxClient{})
+	if err := instance.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+	if cfg := instance.GetSessionManager().(*session.LocalSessionManager).Config(); cfg.AppName != "test-app" {
+		t.Errorf("Expected app name test-app, got %s", cfg.AppName)
+	}
+}
+
+func TestGameInstance_Init_FailsWhenAppMissing(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.AppName = "missing-app"
+	instance := NewGameInstance(gameConfig, &MockAnboxClient{missingApps: map[string]bool{"missing-app": true}})
+
+	err := instance.Init(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error when the anbox app is missing, but got none")
+	}
+	if instance.IsInitialized() {
+		t.Errorf("Expected instance to stay uninitialized")
+	}
+	t.Logf("Init error: %v", err)
+}
+
+func TestGameInstance_Init_InheritsRecoDefaults(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.RecoDefaults = &detector.RecoDefaults{Method: "ocrAll", Lang: "chi_sim", PSM: 7, MatchMode: detector.MatchModeContains}
+	inheriting := &detector.Stage{Number: 1, Reco: detector.Reco{Matchs: []string{"level"}}}
+	overriding := &detector.Stage{Number: 2, Reco: detector.Reco{Method: "ocr", Lang: "eng", PSM: 11, MatchMode: detector.MatchModeExact}}
+	chained := &detector.Stage{Number: 3, Reco: detector.Reco{Methods: []string{"ocr", "ocrAny"}}}
+	gameConfig.Stages = []*detector.Stage{inheriting, overriding, chained}
+
+	if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+	want := detector.Reco{Method: "ocrAll", Matchs: []string{"level"}, Lang: "chi_sim", PSM: 7, MatchMode: detector.MatchModeContains}
+	if got := inheriting.Reco; got.Method != want.Method || got.Lang != want.Lang || got.PSM != want.PSM || got.MatchMode != want.MatchMode {
+		t.Errorf("Expected stage 1 to inherit %+v, got %+v", want, got)
+	}
+	if got := overriding.Reco; got.Method != "ocr" || got.Lang != "eng" || got.PSM != 11 || got.MatchMode != detector.MatchModeExact {
+		t.Errorf("Expected stage 2 to keep its own settings, got %+v", got)
+	}
+	if got := chained.Reco; got.Method != "" || !slices.Equal(got.MethodChain(), []string{"ocr", "ocrAny"}) {
+		t.Errorf("Expected stage 3 to keep its method chain, got %+v", got)
+	}
+}
+
+func TestGameInstance_Init_RejectsInvalidRecoDefaults(t *testing.T) {
+	for _, defaults := range []*detector.RecoDefaults{
+		{Method: "no-such-method"},
+		{PSM: 14},
+		{MatchMode: "fuzzy"},
+	} {
+		gameConfig := newTestGameConfig("test-game")
+		gameConfig.RecoDefaults = defaults
+		if err := NewGameInstance(gameConfig, &MockAnboxClient{}).Init(context.Background()); err == nil {
+			t.Errorf("Expected reco_defaults %+v to be rejected", defaults)
+		}
+	}
+}
+
+// Run with -race: status reads must not race with Init, Start and Stop
+func TestGameInstance_StatusReportsSyncFailures(t *testing.T) {
+	gameConfig := newTestGameConfig("test-game")
+	gameConfig.SessionConfig.Min = 0
+	gameConfig.SessionConfig.SyncInterval = 5 * time.Millisecond
+	anboxClient := &MockAnboxClient{}
+	instance := NewGameInstance(gameConfig, anboxClient)
+	ctx := context.Background()
+	if err := instance.Init(ctx); err != nil {
+		t.Fatalf("Failed to init game instance: %v", err)
+	}
+	if err := instance.Start(ctx); err != nil {
+		t.Fatalf("Failed to start game instance: %v", err)
+	}
+	defer instance.Stop(ctx)
+
+	waitForStatus := func(what string, ok func(*GameInstanceStatus) bool) *GameInstanceStatus {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			status, err := instance.GetInstanceStatus(ctx)
+			if err != nil {
+				t.Fatalf("Failed to get status: %v", err)
+			}
+			if ok(status) {
+				return status
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s, got %+v", what, status)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	synced := waitForStatus("a successful sync", func(s *GameInstanceStatus) bool { return s.LastSyncAt != nil })
+	if synced.LastSyncError != "" || synced.ConsecutiveSyncFailures != 0 {
+		t.Errorf("Expected no sync failures, got %+v", synced)
+	}
+
+	anboxClient.setListError(fmt.Errorf("AMS unreachable"))
+	failing := waitForStatus("failing syncs", func(s *GameInstanceStatus) bool { return s.ConsecutiveSyncFailures >= 2 })
+	if !failing.Running || !strings.Contains(failing.LastSyncError, "AMS unreachable") || failing.LastSyncAt == nil {
+		t.Errorf("Expected a running game failing to sync since its last sync, got %+v", failing)
+	}
+
+	anboxClient.setListError(nil)
+	recovered := waitForStatus("a sync to succeed again", func(s *GameInstanceStatus) bool { return s.ConsecutiveSyncFailures == 0 })
+	if recovered.LastSyncError != "" || !recovered.LastSyncAt.After(*failing.LastSyncAt) {
+		t.Errorf("Expected the recovery to clear the sync error, got %+v", recovered)
+	}
+}
+
+func TestGameInstance_ConcurrentStatusReads(t *testing.T) {
+	instance := NewGameInstance(newTestGameConfig("test-game"), &MockAnboxClient{})
+	ctx := context.Background()
+
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				running := instance.IsRunning()
+				if running && instance.GetSessionManager() == nil {
+					errs <- fmt.Errorf("running instance returned a nil session manager")
+					return
+				}
+				instance.IsInitialized()
+				instance.IsDegraded()
+				if _, err := instance.GetInstanceStatus(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	if err := instance.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := instance.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := instance.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if !instance.IsInitialized() || instance.IsRunning() {
+		t.Errorf("Expected an initialized, stopped instance")
+	}
+}
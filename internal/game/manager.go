@@ -2,79 +2,308 @@ package game
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/letusgogo/playable-backend/internal/detector"
 	"github.com/letusgogo/playable-backend/internal/session"
+	"github.com/letusgogo/quick/logger"
+	"golang.org/x/sync/errgroup"
 )
 
+// ManagerConfig controls how the manager reacts to games that fail to init or start
+type ManagerConfig struct {
+	// Strict aborts Init/Start on the first failing game. Otherwise failing games are
+	// marked degraded and the healthy ones keep running.
+	Strict bool `mapstructure:"strict"`
+	// DebugDump controls writing detection frames to disk, shared by every game
+	DebugDump detector.DumpConfig `mapstructure:"debug_dump"`
+	// AuditLog is the JSON-lines file every session transition of every game is appended to, empty disables it
+	AuditLog string `mapstructure:"audit_log"`
+	// InitConcurrency is how many games Init and Start work on at once, values <= 1 go one game at a time
+	InitConcurrency int `mapstructure:"init_concurrency"`
+	// SelfTest runs every stage's detector on its reference screenshots before a game is initialized.
+	// A reference that does not detect as expected fails startup in strict mode and is only logged otherwise.
+	SelfTest bool `mapstructure:"self_test"`
+	// GlobalMax caps the sessions of all games together on top of each game's max, shared by game priority.
+	// 0 leaves every game to its own max.
+	GlobalMax int `mapstructure:"global_max"`
+	// MaxGames is how many games NewManager accepts, each one runs its own pool and background loops.
+	// 0 means DefaultMaxGames.
+	MaxGames int `mapstructure:"max_games"`
+	// DeletePoolOnStop makes Stop delete the cold, warming and warmed sessions of every game, so they do not
+	// keep running on the farm after a clean shutdown. In-use sessions are left to Drain. Off keeps the pool
+	// for the next process to adopt.
+	DeletePoolOnStop bool `mapstructure:"delete_pool_on_stop"`
+}
+
+// DefaultMaxGames is how many games NewManager accepts when MaxGames is not set
+const DefaultMaxGames = 256
+
+// maxGames returns how many games NewManager accepts
+func (c *ManagerConfig) maxGames() int {
+	if c.MaxGames > 0 {
+		return c.MaxGames
+	}
+	return DefaultMaxGames
+}
+
+// NewManagerConfig returns the manager config with its defaults
+func NewManagerConfig() ManagerConfig {
+	return ManagerConfig{
+		DebugDump:       detector.NewDumpConfig(),
+		InitConcurrency: 8,
+	}
+}
+
 type Manager struct {
+	cfg           ManagerConfig
 	gameInstances map[string]*GameInstance
 	mu            sync.RWMutex
 	anboxClient   session.AnboxClient
+	farms         map[string]session.AnboxClient // the further farms by name, see WithFarms
+	dumper        *detector.Dumper
+	auditLog      *session.JSONLinesAuditSink // opened by Init when AuditLog is set
 	initialized   bool
 	running       bool
+	// initializing and starting are set while Init and Start work on the games without holding mu
+	initializing bool
+	starting     bool
+}
+
+// ManagerOption configures optional manager behavior
+type ManagerOption func(*managerOptions)
+
+type managerOptions struct {
+	farms map[string]session.AnboxClient
+}
+
+// WithFarms makes the games that name a farm use its client, by farm name. The others use the default client.
+func WithFarms(farms map[string]session.AnboxClient) ManagerOption {
+	return func(o *managerOptions) {
+		o.farms = farms
+	}
 }
 
-func NewManager(gameConfigs []*GameConfig, anboxClient session.AnboxClient) *Manager {
+// NewManager creates the instances of gameConfigs on anboxClient or the farm they name.
+// It fails when there are more than MaxGames, two games share a name or a game names an unknown farm.
+func NewManager(cfg ManagerConfig, gameConfigs []*GameConfig, anboxClient session.AnboxClient, opts ...ManagerOption) (*Manager, error) {
+	if len(gameConfigs) > cfg.maxGames() {
+		return nil, fmt.Errorf("%d games are configured, more than max_games %d", len(gameConfigs), cfg.maxGames())
+	}
+	var options managerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if _, ok := options.farms[DefaultFarm]; ok {
+		return nil, fmt.Errorf("anbox farm name %q is reserved for the anbox block", DefaultFarm)
+	}
+	clients := make(map[string]session.AnboxClient, len(gameConfigs))
+	for _, g := range gameConfigs {
+		if _, duplicate := clients[g.Name]; duplicate {
+			return nil, fmt.Errorf("game %s is configured more than once", g.Name)
+		}
+		clients[g.Name] = anboxClient
+		if g.Farm == "" {
+			continue
+		}
+		farmClient, ok := options.farms[g.Farm]
+		if !ok {
+			return nil, fmt.Errorf("game %s uses anbox farm %q, which is not configured", g.Name, g.Farm)
+		}
+		clients[g.Name] = farmClient
+	}
+	goroutines := 0
+	for _, g := range gameConfigs {
+		goroutines += backgroundGoroutines(g)
+	}
+	logger.Infof("game manager runs %d games with about %d background goroutines", len(gameConfigs), goroutines)
+
+	dumper := detector.NewDumper(cfg.DebugDump)
+	var capacity *capacityBudget
+	if cfg.GlobalMax > 0 {
+		capacity = newCapacityBudget(cfg.GlobalMax, gameConfigs)
+	}
 	gameInstances := make(map[string]*GameInstance)
 	for _, g := range gameConfigs {
-		gameInstances[g.Name] = NewGameInstance(g, anboxClient)
+		gameInstances[g.Name] = NewGameInstance(g, clients[g.Name])
+		gameInstances[g.Name].dumper = dumper
+		if capacity != nil {
+			gameInstances[g.Name].capacity = capacity
+		}
 	}
 	return &Manager{
+		cfg:           cfg,
 		gameInstances: gameInstances,
 		anboxClient:   anboxClient,
+		farms:         options.farms,
+		dumper:        dumper,
 		initialized:   false,
 		running:       false,
+	}, nil
+}
+
+// backgroundGoroutines is how many goroutines the game keeps running once started, not counting session creations
+func backgroundGoroutines(g *GameConfig) int {
+	n := 1 // sync loop
+	if g.SessionConfig != nil && g.SessionConfig.HealthSweepInterval > 0 {
+		n++
+	}
+	if g.SessionConfig != nil && g.SessionConfig.MinWarmedGuarantee > 0 {
+		n++
 	}
+	if g.ServerDetectionEnabled() {
+		n++ // stage runner watch, plus one per in-use session
+	}
+	return n
 }
 
-// Init initializes all game instances
+// Init initializes all game instances, InitConcurrency at a time
 func (m *Manager) Init(ctx context.Context) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.initialized {
+	if m.initialized || m.initializing {
+		m.mu.Unlock()
 		return fmt.Errorf("game manager already initialized")
 	}
 
-	// Initialize all game instances
-	for gameName, instance := range m.gameInstances {
+	if m.cfg.AuditLog != "" {
+		auditLog, err := session.NewJSONLinesAuditSink(m.cfg.AuditLog)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		m.auditLog = auditLog
+		for _, instance := range m.gameInstances {
+			instance.auditSink = auditLog
+		}
+	}
+	m.initializing = true
+	m.mu.Unlock()
+
+	// Initialize all game instances without holding mu, each init validates its app against the gateway
+	var errsMu sync.Mutex
+	var errs []error
+	err := m.forEachInstance(func(gameName string, instance *GameInstance) error {
+		if m.cfg.SelfTest {
+			if err := m.selfTest(ctx, instance); err != nil {
+				return err
+			}
+		}
 		if err := instance.Init(ctx); err != nil {
-			return fmt.Errorf("failed to initialize game instance %s: %w", gameName, err)
+			err = fmt.Errorf("failed to initialize game instance %s: %w", gameName, err)
+			if m.cfg.Strict {
+				return err
+			}
+			instance.setFailure(err)
+			logger.Errorf("game %s is degraded: %v", gameName, err)
+			errsMu.Lock()
+			errs = append(errs, err)
+			errsMu.Unlock()
 		}
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.initializing = false
+	if err != nil {
+		return err
+	}
+
+	if len(m.gameInstances) > 0 && len(errs) == len(m.gameInstances) {
+		return fmt.Errorf("no game instance could be initialized: %w", errors.Join(errs...))
 	}
 
 	m.initialized = true
+	m.logPlansLocked()
 	return nil
 }
 
-// Start starts all game instances
+// Start starts all game instances, InitConcurrency at a time
 func (m *Manager) Start(ctx context.Context) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if !m.initialized {
+		m.mu.Unlock()
 		return fmt.Errorf("game manager not initialized")
 	}
 
-	if m.running {
+	if m.running || m.starting {
+		m.mu.Unlock()
 		return fmt.Errorf("game manager already running")
 	}
+	m.starting = true
+	m.mu.Unlock()
 
-	// Start all game instances
-	for gameName, instance := range m.gameInstances {
+	// Start all game instances, skipping the ones that are already degraded
+	var mu sync.Mutex
+	started := 0
+	var errs []error
+	err := m.forEachInstance(func(gameName string, instance *GameInstance) error {
+		if instance.IsDegraded() {
+			return nil
+		}
 		if err := instance.Start(ctx); err != nil {
-			// If one instance fails to start, stop all already started instances
-			m.stopAllInstances(ctx)
-			return fmt.Errorf("failed to start game instance %s: %w", gameName, err)
+			err = fmt.Errorf("failed to start game instance %s: %w", gameName, err)
+			if m.cfg.Strict {
+				return err
+			}
+			instance.setFailure(err)
+			logger.Errorf("game %s is degraded: %v", gameName, err)
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			return nil
 		}
+		mu.Lock()
+		started++
+		mu.Unlock()
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.starting = false
+	if err != nil {
+		// If one instance fails to start, stop all already started instances
+		m.stopAllInstances(ctx)
+		return err
 	}
 
+	if len(m.gameInstances) > 0 && started == 0 {
+		return fmt.Errorf("no game instance could be started: %w", errors.Join(errs...))
+	}
+
+	m.dumper.Start()
 	m.running = true
 	return nil
 }
 
+// forEachInstance runs fn for every game instance on at most InitConcurrency goroutines.
+// After the first error the games not begun yet are skipped and that error is returned once the running calls finish.
+// The calls get no context of their own, Start hands ctx on to background loops that must outlive this call.
+func (m *Manager) forEachInstance(fn func(gameName string, instance *GameInstance) error) error {
+	var group errgroup.Group
+	group.SetLimit(max(m.cfg.InitConcurrency, 1))
+	var failed atomic.Bool
+	for gameName, instance := range m.gameInstances {
+		group.Go(func() error {
+			if failed.Load() {
+				return nil
+			}
+			if err := fn(gameName, instance); err != nil {
+				failed.Store(true)
+				return err
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
 // Stop stops all game instances
 func (m *Manager) Stop(ctx context.Context) error {
 	m.mu.Lock()
@@ -85,10 +314,66 @@ func (m *Manager) Stop(ctx context.Context) error {
 	}
 
 	m.stopAllInstances(ctx)
+	if m.cfg.DeletePoolOnStop {
+		m.deleteAllPools(ctx)
+	}
+	m.dumper.Stop()
+	if m.auditLog != nil {
+		if err := m.auditLog.Close(); err != nil {
+			logger.Errorf("failed to close audit log: %v", err)
+		}
+	}
 	m.running = false
 	return nil
 }
 
+// Drain drains all game instances in parallel, giving in-use sessions grace before they are released
+func (m *Manager) Drain(ctx context.Context, grace time.Duration) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.running {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0)
+	var errsMu sync.Mutex
+	for _, instance := range m.gameInstances {
+		wg.Add(1)
+		go func(instance *GameInstance) {
+			defer wg.Done()
+			if err := instance.Drain(ctx, grace); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+		}(instance)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// deleteAllPools deletes the pool sessions of every game in parallel, failures are logged
+func (m *Manager) deleteAllPools(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, instance := range m.gameInstances {
+		sessionManager := instance.GetSessionManager()
+		if sessionManager == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, sessionManager session.Manager) {
+			defer wg.Done()
+			if _, err := sessionManager.DeletePool(ctx); err != nil {
+				logger.Errorf("failed to delete the session pool of game %s: %v", name, err)
+			}
+		}(instance.name, sessionManager)
+	}
+	wg.Wait()
+}
+
 // stopAllInstances stops all instances (internal helper method)
 func (m *Manager) stopAllInstances(ctx context.Context) {
 	for _, instance := range m.gameInstances {
@@ -144,10 +429,15 @@ func (m *Manager) GetAllGameInstancesStatus(ctx context.Context) (map[string]Gam
 			Name:        instance.name,
 			Initialized: instance.IsInitialized(),
 			Running:     instance.IsRunning(),
+			Degraded:    instance.IsDegraded(),
+		}
+		if instance.IsDegraded() {
+			status.Error = instance.Failure().Error()
 		}
 
 		// Get pool status if instance is initialized
 		if instance.IsInitialized() {
+			status.setSyncHealth(instance.GetSessionManager().LoopHealth())
 			poolStatus, err := instance.GetSessionManager().PoolStatus(ctx)
 			if err != nil {
 				// Continue with other instances even if one fails
@@ -164,6 +454,62 @@ func (m *Manager) GetAllGameInstancesStatus(ctx context.Context) (map[string]Gam
 	return statuses, nil
 }
 
+// DefaultFarm names the anbox block among the Farms, games that name no farm run on it
+const DefaultFarm = "default"
+
+// Farm is an anbox farm with the number of running games that use it
+type Farm struct {
+	Name         string
+	Client       session.AnboxClient
+	RunningGames int
+}
+
+// Farms returns the anbox block as DefaultFarm and every farm configured with WithFarms, ordered by name
+func (m *Manager) Farms() []Farm {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	running := make(map[string]int)
+	for _, instance := range m.gameInstances {
+		if instance.IsRunning() {
+			running[farmName(instance.gameConfig)]++
+		}
+	}
+	farms := []Farm{{Name: DefaultFarm, Client: m.anboxClient, RunningGames: running[DefaultFarm]}}
+	for name, client := range m.farms {
+		farms = append(farms, Farm{Name: name, Client: client, RunningGames: running[name]})
+	}
+	sort.Slice(farms, func(i, j int) bool { return farms[i].Name < farms[j].Name })
+	return farms
+}
+
+// farmName is the farm g runs on, DefaultFarm for the anbox block
+func farmName(g *GameConfig) string {
+	if g.Farm == "" {
+		return DefaultFarm
+	}
+	return g.Farm
+}
+
+// DegradedGames returns the games that failed to init or start and why
+func (m *Manager) DegradedGames() map[string]error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	degraded := make(map[string]error)
+	for name, instance := range m.gameInstances {
+		if instance.IsDegraded() {
+			degraded[name] = instance.Failure()
+		}
+	}
+	return degraded
+}
+
+// DebugDumpStatus reports whether detection frames are being dumped to disk
+func (m *Manager) DebugDumpStatus() detector.DumpStatus {
+	return m.dumper.Status()
+}
+
 // IsInitialized returns whether the manager is initialized
 func (m *Manager) IsInitialized() bool {
 	m.mu.RLock()
@@ -0,0 +1,259 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+func newTestManager(t *testing.T, cfg ManagerConfig, gameConfigs []*GameConfig, anboxClient session.AnboxClient) *Manager {
+	t.Helper()
+	manager, err := NewManager(cfg, gameConfigs, anboxClient)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return manager
+}
+
+func newTestGameConfigs() []*GameConfig {
+	broken := newTestGameConfig("broken-game")
+	broken.AppName = "missing-app"
+	return []*GameConfig{newTestGameConfig("game-a"), newTestGameConfig("game-b"), broken}
+}
+
+func TestNewManager_RejectsMoreThanMaxGames(t *testing.T) {
+	games := []*GameConfig{newTestGameConfig("game-a"), newTestGameConfig("game-b"), newTestGameConfig("game-c")}
+	if _, err := NewManager(ManagerConfig{MaxGames: 3}, games, &MockAnboxClient{}); err != nil {
+		t.Fatalf("Expected 3 games to fit max_games 3, got %v", err)
+	}
+	if _, err := NewManager(ManagerConfig{MaxGames: 2}, games, &MockAnboxClient{}); err == nil || !strings.Contains(err.Error(), "max_games 2") {
+		t.Errorf("Expected 3 games to be rejected with max_games 2, got %v", err)
+	}
+
+	many := make([]*GameConfig, DefaultMaxGames+1)
+	for i := range many {
+		many[i] = newTestGameConfig(fmt.Sprintf("game-%d", i))
+	}
+	if _, err := NewManager(ManagerConfig{}, many, &MockAnboxClient{}); err == nil {
+		t.Errorf("Expected more than DefaultMaxGames games to be rejected without max_games")
+	}
+}
+
+func TestNewManager_RejectsDuplicateGameNames(t *testing.T) {
+	first := newTestGameConfig("idle_weapon")
+	second := newTestGameConfig("idle_weapon")
+	second.SessionConfig.Max = 20
+	games := []*GameConfig{first, newTestGameConfig("game-b"), second}
+	_, err := NewManager(ManagerConfig{}, games, &MockAnboxClient{})
+	if err == nil || !strings.Contains(err.Error(), "idle_weapon") {
+		t.Errorf("Expected a duplicated game name to be rejected naming it, got %v", err)
+	}
+}
+
+func TestManager_Plans(t *testing.T) {
+	ocrGame := newTestGameConfig("idle_weapon")
+	ocrGame.AppName = "idle_weapon_v2"
+	ocrGame.Farm = "eu"
+	ocrGame.SessionConfig.Max = 4
+	ocrGame.SessionConfig.ScreenProfiles = []ScreenProfile{{Name: "landscape", Min: 1, ScreenConfig: ScreenConfig{Width: 1280, Height: 720, Density: 240, Fps: 60}}}
+	ocrGame.RecoDefaults = &detector.RecoDefaults{Method: "ocrAny"}
+	ocrGame.Stages = []*detector.Stage{
+		{Number: 1},
+		{Number: 2, Reco: detector.Reco{Methods: []string{"ocr", "ocrAll"}}},
+	}
+	farms := WithFarms(map[string]session.AnboxClient{"eu": &MockAnboxClient{}})
+	manager, err := NewManager(ManagerConfig{}, []*GameConfig{ocrGame, newTestGameConfig("bare")}, &MockAnboxClient{}, farms)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if err := manager.Init(context.Background()); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	want := []GamePlan{
+		{Name: "bare", App: "bare", Min: 1, Max: 10, Screens: []string{"default 720x1240@320dpi/30fps"}},
+		{
+			Name: "idle_weapon", App: "idle_weapon_v2", Farm: "eu", Min: 1, Max: 4,
+			Screens: []string{"default 720x1240@320dpi/30fps", "landscape(min 1) 1280x720@240dpi/60fps"},
+			Stages:  []StagePlan{{Number: 1, Methods: []string{"ocrAny"}}, {Number: 2, Methods: []string{"ocr", "ocrAll"}}},
+		},
+	}
+	plans := manager.Plans()
+	if !reflect.DeepEqual(plans, want) {
+		t.Fatalf("Expected plans %+v, got %+v", want, plans)
+	}
+	line := "game=idle_weapon app=idle_weapon_v2 farm=eu min=1 max=4 screens=[default 720x1240@320dpi/30fps; landscape(min 1) 1280x720@240dpi/60fps] stages=2 methods=[1:ocrAny 2:ocr,ocrAll]"
+	if got := plans[1].String(); got != line {
+		t.Errorf("Expected log line %q, got %q", line, got)
+	}
+	if got := plans[0].String(); !strings.Contains(got, "farm=default") || !strings.Contains(got, "stages=0") {
+		t.Errorf("Expected the default farm and no stages, got %q", got)
+	}
+}
+
+func TestManager_GamesRunOnTheirFarms(t *testing.T) {
+	gameA, gameB := newTestGameConfig("game-a"), newTestGameConfig("game-b")
+	gameA.Farm, gameB.Farm = "farm-1", "farm-2"
+	local := newTestGameConfig("game-local")
+	defaultClient, farm1, farm2 := &MockAnboxClient{}, &MockAnboxClient{}, &MockAnboxClient{}
+	farms := WithFarms(map[string]session.AnboxClient{"farm-1": farm1, "farm-2": farm2})
+	manager, err := NewManager(ManagerConfig{}, []*GameConfig{gameA, gameB, local}, defaultClient, farms)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := manager.Init(ctx); err != nil {
+		t.Fatalf("Failed to init manager: %v", err)
+	}
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for (farm1.Created("game-a") == 0 || farm2.Created("game-b") == 0 || defaultClient.Created("game-local") == 0) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if farm1.Created("game-a") == 0 || farm2.Created("game-b") == 0 || defaultClient.Created("game-local") == 0 {
+		t.Fatalf("Expected every game to create sessions on its own farm")
+	}
+	if farm1.Created("game-b") != 0 || farm2.Created("game-a") != 0 || defaultClient.Created("game-a") != 0 || defaultClient.Created("game-b") != 0 {
+		t.Errorf("Expected no game to create sessions on another farm")
+	}
+
+	unknown := newTestGameConfig("game-c")
+	unknown.Farm = "farm-3"
+	if _, err := NewManager(ManagerConfig{}, []*GameConfig{gameA, unknown}, defaultClient, farms); err == nil || !strings.Contains(err.Error(), "farm-3") {
+		t.Errorf("Expected a game on an unknown farm to be rejected, got %v", err)
+	}
+}
+
+func TestManager_LenientStartRunsHealthyGames(t *testing.T) {
+	anboxClient := &MockAnboxClient{missingApps: map[string]bool{"missing-app": true}}
+	manager := newTestManager(t, ManagerConfig{}, newTestGameConfigs(), anboxClient)
+	ctx := context.Background()
+
+	if err := manager.Init(ctx); err != nil {
+		t.Fatalf("Expected lenient init to succeed, got %v", err)
+	}
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Expected lenient start to succeed, got %v", err)
+	}
+	defer manager.Stop(ctx)
+
+	for _, name := range []string{"game-a", "game-b"} {
+		instance, _ := manager.GetGameInstance(ctx, name)
+		if !instance.IsRunning() || instance.IsDegraded() {
+			t.Errorf("Expected %s to be running and healthy", name)
+		}
+	}
+
+	degraded := manager.DegradedGames()
+	if len(degraded) != 1 || degraded["broken-game"] == nil {
+		t.Fatalf("Expected only broken-game to be degraded, got %v", degraded)
+	}
+
+	statuses, err := manager.GetAllGameInstancesStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get statuses: %v", err)
+	}
+	status := statuses["broken-game"]
+	if !status.Degraded || status.Running || status.Error == "" {
+		t.Errorf("Expected broken-game status to be degraded with an error, got %+v", status)
+	}
+	if statuses["game-a"].Degraded {
+		t.Errorf("Expected game-a status not to be degraded")
+	}
+}
+
+func TestManager_StrictInitFailsOnAnyGame(t *testing.T) {
+	anboxClient := &MockAnboxClient{missingApps: map[string]bool{"missing-app": true}}
+	manager := newTestManager(t, ManagerConfig{Strict: true}, newTestGameConfigs(), anboxClient)
+
+	if err := manager.Init(context.Background()); err == nil {
+		t.Fatalf("Expected strict init to fail when one game fails")
+	}
+	if manager.IsInitialized() {
+		t.Errorf("Expected manager to stay uninitialized")
+	}
+}
+
+func TestManager_LenientInitFailsWhenAllGamesFail(t *testing.T) {
+	anboxClient := &MockAnboxClient{missingApps: map[string]bool{"game-a": true, "game-b": true, "missing-app": true}}
+	manager := newTestManager(t, ManagerConfig{}, newTestGameConfigs(), anboxClient)
+
+	if err := manager.Init(context.Background()); err == nil {
+		t.Fatalf("Expected init to fail when no game can be initialized")
+	}
+}
+
+// slowAppClient holds every app lookup until want lookups run at once or a second has passed, and records the peak
+type slowAppClient struct {
+	*MockAnboxClient
+	want int
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	all      chan struct{}
+}
+
+func (c *slowAppClient) GetApp(ctx context.Context, name string) (*anbox.AppDetails, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	if c.inFlight == c.want {
+		close(c.all)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.all:
+	case <-time.After(time.Second):
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return c.MockAnboxClient.GetApp(ctx, name)
+}
+
+func TestManager_InitRunsGamesConcurrently(t *testing.T) {
+	var games []*GameConfig
+	for i := 0; i < 4; i++ {
+		games = append(games, newTestGameConfig(fmt.Sprintf("game-%d", i)))
+	}
+
+	anboxClient := &slowAppClient{MockAnboxClient: &MockAnboxClient{}, want: len(games), all: make(chan struct{})}
+	manager := newTestManager(t, ManagerConfig{InitConcurrency: len(games)}, games, anboxClient)
+	start := time.Now()
+	if err := manager.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if anboxClient.peak != len(games) {
+		t.Errorf("Expected all %d games to initialize at once, peak was %d", len(games), anboxClient.peak)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected a concurrent init to finish quickly, took %s", elapsed)
+	}
+
+	// The pool size bounds the games initializing at once
+	anboxClient = &slowAppClient{MockAnboxClient: &MockAnboxClient{}, want: len(games), all: make(chan struct{})}
+	close(anboxClient.all)
+	manager = newTestManager(t, ManagerConfig{InitConcurrency: 2}, games, anboxClient)
+	if err := manager.Init(context.Background()); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if anboxClient.peak > 2 {
+		t.Errorf("Expected at most 2 games to initialize at once, peak was %d", anboxClient.peak)
+	}
+}
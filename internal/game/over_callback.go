@@ -0,0 +1,217 @@
+package game
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/session"
+	"github.com/letusgogo/quick/logger"
+)
+
+const (
+	// OverSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body keyed with the game's over_secret
+	OverSignatureHeader = "X-Playable-Signature"
+	// OverIdempotencyHeader carries OverCallback.ID, receivers drop deliveries they have already seen
+	OverIdempotencyHeader = "Idempotency-Key"
+	// OverReasonStagesPassed is the OverCallback reason once the session passed its last stage
+	OverReasonStagesPassed = "stages_passed"
+	// DefaultOverRetries is how often an over callback is retried when a game does not configure over_retries
+	DefaultOverRetries = 3
+
+	overCallbackTimeout   = 10 * time.Second
+	overCallbackRetryWait = time.Second
+)
+
+// OverCallback is the body posted to the game's over_url once a session passes its last stage,
+// or once it is released before it did
+type OverCallback struct {
+	ID        string            `json:"id"` // the same on every attempt, one per session
+	Game      string            `json:"game"`
+	SessionID string            `json:"session_id"`
+	Reason    string            `json:"reason"` // OverReasonStagesPassed, or the session.ReleaseReason of an earlier release
+	Stage     int               `json:"stage"`  // the last stage passed, 0 before the first
+	Evidence  string            `json:"evidence"`
+	Metadata  map[string]string `json:"metadata,omitempty"` // what the client stored on the session, such as the player ID
+	StartedAt time.Time         `json:"started_at"`         // when the session was acquired
+	OverAt    time.Time         `json:"over_at"`
+	Duration  time.Duration     `json:"duration_ns"`
+}
+
+// overNotifier posts signed over callbacks, retrying failed deliveries with the same body
+type overNotifier struct {
+	url        string
+	secret     []byte
+	retries    int
+	retryWait  time.Duration // doubled after every failed attempt
+	httpClient *http.Client
+}
+
+func newOverNotifier(runtime *Runtime) *overNotifier {
+	retries := runtime.OverRetries
+	if retries == 0 {
+		retries = DefaultOverRetries
+	}
+	return &overNotifier{
+		url:        runtime.OverURL,
+		secret:     []byte(runtime.OverSecret),
+		retries:    retries,
+		retryWait:  overCallbackRetryWait,
+		httpClient: &http.Client{Timeout: overCallbackTimeout},
+	}
+}
+
+// signOver returns the OverSignatureHeader value of body
+func signOver(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// stageProgress is how far a session got through the stages and whether its over callback went out
+type stageProgress struct {
+	stage    int // the last stage passed, 0 before the first
+	evidence string
+	over     bool
+}
+
+// notifyOver posts the OverCallback of a session that passed its last stage to the game's over_url.
+// Delivery outlives the session and stops with the runner.
+func (r *stageRunner) notifyOver(ctx context.Context, id string, stageNum int, evidence string) {
+	if r.over.url == "" {
+		return
+	}
+
+	callback := r.overCallback(id, OverReasonStagesPassed, stageNum, evidence)
+	if s, err := r.manager.GetSession(ctx, id); err == nil {
+		r.addSessionDetails(&callback, s)
+	} else {
+		logger.Warnf("over callback for session %s of game %s is sent without session details: %v", id, r.game, err)
+	}
+
+	if err := r.over.deliver(r.ctx, callback); err != nil {
+		logger.Warnf("over callback for session %s of game %s failed: %v", id, r.game, err)
+	}
+}
+
+// released posts the OverCallback of an in-use session released before it passed its last stage, with the reason
+// it was released. It runs with the session manager lock held, so delivery happens in the background.
+func (r *stageRunner) released(s session.Session, reason session.ReleaseReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress := r.progress[s.ID]
+	delete(r.progress, s.ID)
+	if r.over.url == "" || r.ctx == nil || r.ctx.Err() != nil || (progress != nil && progress.over) {
+		return
+	}
+	if progress == nil {
+		progress = &stageProgress{}
+	}
+
+	callback := r.overCallback(s.ID, string(reason), progress.stage, progress.evidence)
+	r.addSessionDetails(&callback, &s)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := r.over.deliver(r.ctx, callback); err != nil {
+			logger.Warnf("over callback for session %s of game %s failed: %v", s.ID, r.game, err)
+		}
+	}()
+}
+
+func (r *stageRunner) overCallback(id, reason string, stageNum int, evidence string) OverCallback {
+	return OverCallback{
+		ID:        r.game + ":" + id + ":over",
+		Game:      r.game,
+		SessionID: id,
+		Reason:    reason,
+		Stage:     stageNum,
+		Evidence:  evidence,
+		OverAt:    time.Now(),
+	}
+}
+
+// addSessionDetails fills in when the session was acquired and what the client stored on it
+func (r *stageRunner) addSessionDetails(callback *OverCallback, s *session.Session) {
+	callback.StartedAt = s.StatusChangedAt
+	callback.Duration = callback.OverAt.Sub(s.StatusChangedAt)
+	for k, v := range s.Metadata {
+		if k == StageMetadataKey {
+			continue
+		}
+		if callback.Metadata == nil {
+			callback.Metadata = make(map[string]string)
+		}
+		callback.Metadata[k] = v
+	}
+}
+
+// runnerReleases hands the sessions the manager releases to the stage runner while one runs
+type runnerReleases struct {
+	runner atomic.Pointer[stageRunner]
+}
+
+func (f *runnerReleases) Released(s session.Session, reason session.ReleaseReason) {
+	if r := f.runner.Load(); r != nil {
+		r.released(s, reason)
+	}
+}
+
+// deliver posts callback until the receiver accepts it, rejects it or the retries run out
+func (n *overNotifier) deliver(ctx context.Context, callback OverCallback) error {
+	body, err := json.Marshal(callback)
+	if err != nil {
+		return fmt.Errorf("failed to marshal over callback: %w", err)
+	}
+
+	wait := n.retryWait
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, callback.ID, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.retries {
+			return fmt.Errorf("attempt %d: %w", attempt+1, err)
+		}
+		logger.Warnf("over callback %s attempt %d failed, retrying in %s: %v", callback.ID, attempt+1, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped before attempt %d: %w", attempt+2, ctx.Err())
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post sends body once and reports whether a failure is worth retrying
+func (n *overNotifier) post(ctx context.Context, key string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(OverIdempotencyHeader, key)
+	if len(n.secret) > 0 {
+		req.Header.Set(OverSignatureHeader, signOver(n.secret, body))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// GamePlan is the effective setup of a game as resolved from its config, logged at startup to confirm a deploy
+type GamePlan struct {
+	Name    string      `json:"name"`
+	App     string      `json:"app"`
+	Farm    string      `json:"farm"` // empty for the anbox block
+	Min     int         `json:"min"`
+	Max     int         `json:"max"`
+	Screens []string    `json:"screens"` // the default screen first, then the profiles
+	Stages  []StagePlan `json:"stages"`
+}
+
+// StagePlan is a stage of a GamePlan with the detection methods it runs, in order
+type StagePlan struct {
+	Number  int      `json:"number"`
+	Methods []string `json:"methods"`
+}
+
+// Plan returns the effective setup of the game, stage methods include the inherited reco_defaults once Init ran
+func (g *GameInstance) Plan() GamePlan {
+	cfg := g.gameConfig
+	plan := GamePlan{
+		Name: g.name,
+		App:  cfg.GetAppName(),
+		Farm: cfg.Farm,
+	}
+	if cfg.SessionConfig != nil {
+		plan.Min, plan.Max = cfg.SessionConfig.Min, cfg.SessionConfig.Max
+		plan.Screens = append(plan.Screens, "default "+formatScreen(cfg.SessionConfig.ScreenConfig))
+		for _, profile := range cfg.SessionConfig.ScreenProfiles {
+			plan.Screens = append(plan.Screens, fmt.Sprintf("%s(min %d) %s", profile.Name, profile.Min, formatScreen(profile.ScreenConfig)))
+		}
+	}
+	for _, stage := range cfg.Stages {
+		plan.Stages = append(plan.Stages, StagePlan{Number: stage.Number, Methods: stage.Reco.MethodChain()})
+	}
+	return plan
+}
+
+// String formats the plan as one structured log line
+func (p GamePlan) String() string {
+	farm := p.Farm
+	if farm == "" {
+		farm = "default"
+	}
+	stages := make([]string, 0, len(p.Stages))
+	for _, stage := range p.Stages {
+		stages = append(stages, fmt.Sprintf("%d:%s", stage.Number, strings.Join(stage.Methods, ",")))
+	}
+	return fmt.Sprintf("game=%s app=%s farm=%s min=%d max=%d screens=[%s] stages=%d methods=[%s]",
+		p.Name, p.App, farm, p.Min, p.Max, strings.Join(p.Screens, "; "), len(p.Stages), strings.Join(stages, " "))
+}
+
+func formatScreen(s ScreenConfig) string {
+	return fmt.Sprintf("%dx%d@%ddpi/%dfps", s.Width, s.Height, s.Density, s.Fps)
+}
+
+// Plans returns the plan of every game, by name
+func (m *Manager) Plans() []GamePlan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.plansLocked()
+}
+
+func (m *Manager) plansLocked() []GamePlan {
+	plans := make([]GamePlan, 0, len(m.gameInstances))
+	for _, instance := range m.gameInstances {
+		plans = append(plans, instance.Plan())
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Name < plans[j].Name })
+	return plans
+}
+
+// logPlansLocked logs the plan of every game that initialized, degraded games were logged as such. Callers must hold m.mu.
+func (m *Manager) logPlansLocked() {
+	for _, plan := range m.plansLocked() {
+		if m.gameInstances[plan.Name].IsDegraded() {
+			continue
+		}
+		logger.Infof("pool plan: %s", plan)
+	}
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// ErrSelfTestFailed is returned when a stage reference screenshot does not detect as expected
+var ErrSelfTestFailed = errors.New("detector self-test failed")
+
+// ReferenceResult is the self-test outcome of one stage reference
+type ReferenceResult struct {
+	Stage    int
+	Image    string
+	Expected bool // whether the stage should match the reference
+	Match    bool
+	Evidence string
+	Err      error // the reference could not be read or detected on
+}
+
+// Passed reports whether the reference detected as expected
+func (r ReferenceResult) Passed() bool {
+	return r.Err == nil && r.Match == r.Expected
+}
+
+func (r ReferenceResult) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("stage %d reference %s: %v", r.Stage, r.Image, r.Err)
+	case r.Expected && !r.Match:
+		return fmt.Sprintf("stage %d reference %s: expected a match, got none", r.Stage, r.Image)
+	case !r.Expected && r.Match:
+		return fmt.Sprintf("stage %d reference %s: expected no match, got %s", r.Stage, r.Image, r.Evidence)
+	case r.Match:
+		return fmt.Sprintf("stage %d reference %s: matched as expected, %s", r.Stage, r.Image, r.Evidence)
+	default:
+		return fmt.Sprintf("stage %d reference %s: did not match, as expected", r.Stage, r.Image)
+	}
+}
+
+// SelfTest runs every stage's detector on the stage's reference screenshots.
+// The results cover every reference, the error lists the ones that did not detect as expected.
+func (g *GameInstance) SelfTest(ctx context.Context) ([]ReferenceResult, error) {
+	var results []ReferenceResult
+	var failures []error
+	g.inheritRecoDefaults()
+	for _, stage := range g.gameConfig.Stages {
+		for _, ref := range stage.References {
+			result := ReferenceResult{Stage: stage.Number, Image: ref.Image, Expected: !ref.NoMatch}
+			data, err := os.ReadFile(ref.Image)
+			if err != nil {
+				result.Err = fmt.Errorf("failed to read reference: %w", err)
+			} else {
+				imgBase64 := base64.StdEncoding.EncodeToString(data)
+				result.Match, result.Evidence, result.Err = g.GetStageDetector(stage.Number).Detect(ctx, g.name, stage.Number, imgBase64)
+			}
+
+			results = append(results, result)
+			if !result.Passed() {
+				failures = append(failures, errors.New(result.String()))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return results, fmt.Errorf("%w for game %s: %w", ErrSelfTestFailed, g.name, errors.Join(failures...))
+	}
+	return results, nil
+}
+
+// selfTest logs the self-test of instance, the failure is only returned in strict mode
+func (m *Manager) selfTest(ctx context.Context, instance *GameInstance) error {
+	results, err := instance.SelfTest(ctx)
+	for _, result := range results {
+		if result.Passed() {
+			logger.Infof("self-test of game %s: %s", instance.name, result)
+		} else {
+			logger.Errorf("self-test of game %s: %s", instance.name, result)
+		}
+	}
+	if err != nil && m.cfg.Strict {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package game
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/letusgogo/playable-backend/internal/detector"
+)
+
+func init() {
+	// selftest-red matches frames whose top left pixel is red
+	detector.RegisterMethod("selftest-red", detector.MethodFunc(func(ctx context.Context, stage *detector.Stage, frame detector.Frame) (bool, string, error) {
+		img, err := png.Decode(bytes.NewReader(frame.Data))
+		if err != nil {
+			return false, "", err
+		}
+		r, g, b, _ := img.At(0, 0).RGBA()
+		return r > 0 && g == 0 && b == 0, "red frame", nil
+	}))
+}
+
+// writeReference writes a small screenshot filled with c into dir
+func writeReference(t *testing.T, dir, name string, c color.Color) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode reference: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write reference: %v", err)
+	}
+	return path
+}
+
+func newSelfTestGameConfig(name string, refs ...detector.Reference) *GameConfig {
+	gameConfig := newTestGameConfig(name)
+	gameConfig.Stages = []*detector.Stage{{
+		Number:     1,
+		Reco:       detector.Reco{Method: "selftest-red"},
+		References: refs,
+	}}
+	return gameConfig
+}
+
+func TestGameInstance_SelfTest(t *testing.T) {
+	dir := t.TempDir()
+	red := writeReference(t, dir, "red.png", color.RGBA{R: 255, A: 255})
+	blue := writeReference(t, dir, "blue.png", color.RGBA{B: 255, A: 255})
+
+	instance := NewGameInstance(newSelfTestGameConfig("test-game",
+		detector.Reference{Image: red},
+		detector.Reference{Image: blue, NoMatch: true},
+	), &MockAnboxClient{})
+	results, err := instance.SelfTest(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the references to pass, got %v", err)
+	}
+	if len(results) != 2 || !results[0].Passed() || !results[1].Passed() {
+		t.Errorf("Expected two passing results, got %+v", results)
+	}
+
+	// A wrong expectation either way and an unreadable reference all fail
+	instance = NewGameInstance(newSelfTestGameConfig("test-game",
+		detector.Reference{Image: red},
+		detector.Reference{Image: blue},
+		detector.Reference{Image: red, NoMatch: true},
+		detector.Reference{Image: filepath.Join(dir, "missing.png")},
+	), &MockAnboxClient{})
+	results, err = instance.SelfTest(context.Background())
+	if !errors.Is(err, ErrSelfTestFailed) {
+		t.Fatalf("Expected ErrSelfTestFailed, got %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected a result per reference, got %d", len(results))
+	}
+	for i, passed := range []bool{true, false, false, false} {
+		if results[i].Passed() != passed {
+			t.Errorf("Reference %d: expected passed %v, got %+v", i, passed, results[i])
+		}
+	}
+	if results[3].Err == nil {
+		t.Errorf("Expected a read error for the missing reference")
+	}
+}
+
+func TestManager_SelfTestFailsStrictStartup(t *testing.T) {
+	blue := writeReference(t, t.TempDir(), "blue.png", color.RGBA{B: 255, A: 255})
+	gameConfigs := func() []*GameConfig {
+		return []*GameConfig{newSelfTestGameConfig("test-game", detector.Reference{Image: blue})}
+	}
+	ctx := context.Background()
+
+	manager := newTestManager(t, ManagerConfig{Strict: true, SelfTest: true}, gameConfigs(), &MockAnboxClient{})
+	if err := manager.Init(ctx); !errors.Is(err, ErrSelfTestFailed) {
+		t.Fatalf("Expected strict init to fail the self-test, got %v", err)
+	}
+
+	// Without strict mode the failure is only reported
+	manager = newTestManager(t, ManagerConfig{SelfTest: true}, gameConfigs(), &MockAnboxClient{})
+	if err := manager.Init(ctx); err != nil {
+		t.Fatalf("Expected lenient init to succeed, got %v", err)
+	}
+	instance, _ := manager.GetGameInstance(ctx, "test-game")
+	if !instance.IsInitialized() || instance.IsDegraded() {
+		t.Errorf("Expected the game to be initialized and healthy")
+	}
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+const (
+	// DefaultSessionListLimit is the page size of ListAllSessions when the filter sets none
+	DefaultSessionListLimit = 100
+	// MaxSessionListLimit bounds a page of ListAllSessions
+	MaxSessionListLimit = 500
+)
+
+// ErrGameNotFound is returned when a filter names a game the manager does not run
+var ErrGameNotFound = errors.New("game not found")
+
+// SessionFilter selects the sessions ListAllSessions returns, zero fields match everything
+type SessionFilter struct {
+	Game   string
+	Status session.SessionStatus
+	Offset int
+	Limit  int // DefaultSessionListLimit when 0, capped at MaxSessionListLimit
+}
+
+// SessionPage is one page of sessions across games, ordered by game and session ID
+type SessionPage struct {
+	Sessions []*session.Session
+	Total    int // sessions matching the filter on all pages
+	Offset   int
+	Limit    int
+}
+
+// ListAllSessions returns a page of the sessions of every game, each tagged with its game.
+// Games that are not initialized have no sessions to list and are skipped.
+func (m *Manager) ListAllSessions(ctx context.Context, filter SessionFilter) (SessionPage, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return SessionPage{}, fmt.Errorf("offset and limit must not be negative, got offset %d limit %d", filter.Offset, filter.Limit)
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultSessionListLimit
+	}
+	limit = min(limit, MaxSessionListLimit)
+
+	// Only hold mu to pick the instances, each instance holds its own lock just while copying its sessions
+	m.mu.RLock()
+	instances := make([]*GameInstance, 0, len(m.gameInstances))
+	for name, instance := range m.gameInstances {
+		if filter.Game == "" || name == filter.Game {
+			instances = append(instances, instance)
+		}
+	}
+	m.mu.RUnlock()
+	if filter.Game != "" && len(instances) == 0 {
+		return SessionPage{}, fmt.Errorf("%w: %s", ErrGameNotFound, filter.Game)
+	}
+
+	var statuses []session.SessionStatus
+	if filter.Status != "" {
+		statuses = append(statuses, filter.Status)
+	}
+	var all []*session.Session
+	for _, instance := range instances {
+		sessionManager := instance.GetSessionManager()
+		if sessionManager == nil {
+			continue
+		}
+		sessions, err := sessionManager.ListSessions(ctx, statuses...)
+		if err != nil {
+			return SessionPage{}, fmt.Errorf("failed to list sessions of game %s: %w", instance.name, err)
+		}
+		for _, s := range sessions {
+			s.Game = instance.name
+		}
+		all = append(all, sessions...)
+	}
+
+	// A stable order keeps pages from overlapping while sessions come and go
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Game != all[j].Game {
+			return all[i].Game < all[j].Game
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	page := SessionPage{Total: len(all), Offset: filter.Offset, Limit: limit}
+	if filter.Offset < len(all) {
+		page.Sessions = all[filter.Offset:min(filter.Offset+limit, len(all))]
+	}
+	return page, nil
+}
+
+// AggregatePoolStatus sums the pools of every initialized game, Games holds the status of each one
+type AggregatePoolStatus struct {
+	Total   int                           `json:"total"`
+	Cold    int                           `json:"cold"`
+	Warming int                           `json:"warming"`
+	Warmed  int                           `json:"warmed"`
+	InUse   int                           `json:"in_use"`
+	Games   map[string]session.PoolStatus `json:"games"`
+}
+
+// AggregatePoolStatus sums the pool status of every game in one pass, holding mu throughout so no game
+// is added or stopped halfway. Each game's counts are a snapshot taken under its own lock, one game after
+// another, so the sums are not a single instant across games: a session that changes state in a game
+// already counted only shows up in the next call. Games that are not initialized have no pool and are skipped.
+func (m *Manager) AggregatePoolStatus(ctx context.Context) (AggregatePoolStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	aggregate := AggregatePoolStatus{Games: make(map[string]session.PoolStatus, len(m.gameInstances))}
+	for name, instance := range m.gameInstances {
+		sessionManager := instance.GetSessionManager()
+		if sessionManager == nil {
+			continue
+		}
+		status, err := sessionManager.PoolStatus(ctx)
+		if err != nil {
+			return AggregatePoolStatus{}, fmt.Errorf("failed to get pool status of game %s: %w", name, err)
+		}
+		aggregate.Total += status.Total
+		aggregate.Cold += status.Cold
+		aggregate.Warming += status.Warming
+		aggregate.Warmed += status.Warmed
+		aggregate.InUse += status.InUse
+		aggregate.Games[name] = status
+	}
+	return aggregate, nil
+}
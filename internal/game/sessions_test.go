@@ -0,0 +1,154 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+func newListTestManager(t *testing.T) *Manager {
+	manager := newTestManager(t, ManagerConfig{}, []*GameConfig{newTestGameConfig("game-a"), newTestGameConfig("game-b"), newTestGameConfig("game-c")}, &MockAnboxClient{})
+	manager.gameInstances["game-a"].sessionManager = newFakeSessionManager(
+		&session.Session{ID: "a-1", Status: session.Cold},
+		&session.Session{ID: "a-2", Status: session.InUse, AuthToken: "pool-token"},
+		&session.Session{ID: "a-3", Status: session.Warmed},
+	)
+	manager.gameInstances["game-b"].sessionManager = newFakeSessionManager(
+		&session.Session{ID: "b-1", Status: session.InUse},
+		&session.Session{ID: "b-2", Status: session.InUse},
+	)
+	// game-c is not initialized and has no session manager
+	return manager
+}
+
+func sessionIDs(sessions []*session.Session) []string {
+	ids := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.Game+"/"+s.ID)
+	}
+	return ids
+}
+
+func TestManager_ListAllSessions(t *testing.T) {
+	manager := newListTestManager(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name   string
+		filter SessionFilter
+		ids    []string
+		total  int
+	}{
+		{"all", SessionFilter{}, []string{"game-a/a-1", "game-a/a-2", "game-a/a-3", "game-b/b-1", "game-b/b-2"}, 5},
+		{"by status", SessionFilter{Status: session.InUse}, []string{"game-a/a-2", "game-b/b-1", "game-b/b-2"}, 3},
+		{"by game", SessionFilter{Game: "game-b"}, []string{"game-b/b-1", "game-b/b-2"}, 2},
+		{"by game and status", SessionFilter{Game: "game-a", Status: session.Warmed}, []string{"game-a/a-3"}, 1},
+		{"uninitialized game", SessionFilter{Game: "game-c"}, []string{}, 0},
+		{"first page", SessionFilter{Limit: 2}, []string{"game-a/a-1", "game-a/a-2"}, 5},
+		{"next page", SessionFilter{Offset: 2, Limit: 2}, []string{"game-a/a-3", "game-b/b-1"}, 5},
+		{"past the end", SessionFilter{Offset: 10}, []string{}, 5},
+	} {
+		page, err := manager.ListAllSessions(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: failed to list sessions: %v", tc.name, err)
+		}
+		ids := sessionIDs(page.Sessions)
+		if page.Total != tc.total || len(ids) != len(tc.ids) {
+			t.Errorf("%s: expected %v of %d, got %v of %d", tc.name, tc.ids, tc.total, ids, page.Total)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tc.ids[i] {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.ids, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestManager_ListAllSessionsBounds(t *testing.T) {
+	manager := newListTestManager(t)
+	ctx := context.Background()
+
+	page, err := manager.ListAllSessions(ctx, SessionFilter{Limit: 10 * MaxSessionListLimit})
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if page.Limit != MaxSessionListLimit {
+		t.Errorf("Expected the limit to be capped at %d, got %d", MaxSessionListLimit, page.Limit)
+	}
+	if page, _ := manager.ListAllSessions(ctx, SessionFilter{}); page.Limit != DefaultSessionListLimit {
+		t.Errorf("Expected the default limit %d, got %d", DefaultSessionListLimit, page.Limit)
+	}
+	if _, err := manager.ListAllSessions(ctx, SessionFilter{Offset: -1}); err == nil {
+		t.Errorf("Expected a negative offset to be rejected")
+	}
+	if _, err := manager.ListAllSessions(ctx, SessionFilter{Game: "missing"}); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("Expected ErrGameNotFound, got %v", err)
+	}
+}
+
+func TestManager_AggregatePoolStatus(t *testing.T) {
+	manager := newListTestManager(t)
+	manager.gameInstances["game-c"].sessionManager = newFakeSessionManager(
+		&session.Session{ID: "c-1", Status: session.Cold},
+		&session.Session{ID: "c-2", Status: session.Cold},
+		&session.Session{ID: "c-3", Status: session.Warming},
+		&session.Session{ID: "c-4", Status: session.Warmed},
+		&session.Session{ID: "c-5", Status: session.InUse},
+		&session.Session{ID: "c-6", Status: session.InUse},
+	)
+	ctx := context.Background()
+
+	aggregate, err := manager.AggregatePoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to aggregate pool status: %v", err)
+	}
+	if aggregate.Total != 11 || aggregate.Cold != 3 || aggregate.Warming != 1 || aggregate.Warmed != 2 || aggregate.InUse != 5 {
+		t.Errorf("Expected 11 sessions, 3 cold, 1 warming, 2 warmed and 5 in use, got %+v", aggregate)
+	}
+	for name, total := range map[string]int{"game-a": 3, "game-b": 2, "game-c": 6} {
+		if aggregate.Games[name].Total != total {
+			t.Errorf("Expected %d sessions in %s, got %+v", total, name, aggregate.Games[name])
+		}
+	}
+
+	// Games without a pool are left out
+	manager.gameInstances["game-c"].sessionManager = nil
+	aggregate, err = manager.AggregatePoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to aggregate pool status: %v", err)
+	}
+	if _, included := aggregate.Games["game-c"]; included || aggregate.Total != 5 || len(aggregate.Games) != 2 {
+		t.Errorf("Expected only game-a and game-b with 5 sessions, got %+v", aggregate)
+	}
+}
+
+func TestManager_StopDeletesPools(t *testing.T) {
+	ctx := context.Background()
+	for _, deletePool := range []bool{false, true} {
+		manager := newListTestManager(t)
+		manager.cfg.DeletePoolOnStop = deletePool
+		manager.running = true
+		if err := manager.Stop(ctx); err != nil {
+			t.Fatalf("Stop failed: %v", err)
+		}
+
+		want := []string{"/a-1", "/a-2", "/a-3", "/b-1", "/b-2"}
+		if deletePool {
+			want = []string{"/a-2", "/b-1", "/b-2"}
+		}
+		var got []string
+		for _, name := range []string{"game-a", "game-b"} {
+			sessions, _ := manager.gameInstances[name].sessionManager.ListSessions(ctx)
+			got = append(got, sessionIDs(sessions)...)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("delete_pool_on_stop %v: expected sessions %v after stop, got %v", deletePool, want, got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package game
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/session"
+	"github.com/letusgogo/quick/logger"
+)
+
+const (
+	// DefaultDetectionConcurrency bounds concurrent captures and detections when a game does not configure detection_concurrency
+	DefaultDetectionConcurrency = 4
+	// DefaultDetectionWatchInterval is how often the runner looks for newly in-use or released sessions
+	DefaultDetectionWatchInterval = time.Second
+	// MinStageInterval is the shortest stage interval allowed with server-side detection
+	MinStageInterval = 100 * time.Millisecond
+	// StageMetadataKey is the session metadata key holding the stage being detected, or StageOver once every stage matched
+	StageMetadataKey = "stage"
+	// StageOver is the StageMetadataKey value after the last stage matched
+	StageOver = "over"
+)
+
+// stageRunner polls every in-use session of a game and drives it through its stages
+type stageRunner struct {
+	game          string
+	stages        []*detector.Stage
+	over          *overNotifier
+	manager       session.Manager
+	anboxClient   session.AnboxClient
+	detectorFor   func(stageNum int) detector.StageChecker
+	watchInterval time.Duration
+	sem           chan struct{}
+
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc
+	progress map[string]*stageProgress // of the in-use sessions, until they are released
+	ctx      context.Context           // ends when the runner stops, over callbacks are retried until then, even after release
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newStageRunner(game string, runtime *Runtime, stages []*detector.Stage, manager session.Manager, anboxClient session.AnboxClient, detectorFor func(stageNum int) detector.StageChecker) *stageRunner {
+	sorted := make([]*detector.Stage, len(stages))
+	copy(sorted, stages)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+
+	concurrency := runtime.DetectionConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDetectionConcurrency
+	}
+
+	return &stageRunner{
+		game:          game,
+		stages:        sorted,
+		over:          newOverNotifier(runtime),
+		manager:       manager,
+		anboxClient:   anboxClient,
+		detectorFor:   detectorFor,
+		watchInterval: DefaultDetectionWatchInterval,
+		sem:           make(chan struct{}, concurrency),
+		running:       make(map[string]context.CancelFunc),
+		progress:      make(map[string]*stageProgress),
+	}
+}
+
+// Start starts watching the game's sessions
+func (r *stageRunner) Start() {
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go r.watch(r.ctx)
+}
+
+// Stop stops every session goroutine and waits for them to return
+func (r *stageRunner) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+// watch starts a detection goroutine for each newly in-use session and stops the ones whose session went away
+func (r *stageRunner) watch(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		r.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *stageRunner) reconcile(ctx context.Context) {
+	sessions, err := r.manager.ListSessions(ctx, session.InUse)
+	if err != nil {
+		logger.Warnf("stage detection for game %s: failed to list sessions: %v", r.game, err)
+		return
+	}
+
+	inUse := make(map[string]bool)
+	for _, s := range sessions {
+		if s.Status == session.InUse && s.Anbox != nil {
+			inUse[s.ID] = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, cancel := range r.running {
+		if !inUse[id] {
+			cancel()
+			delete(r.running, id)
+		}
+	}
+	for id := range r.progress {
+		if !inUse[id] {
+			delete(r.progress, id)
+		}
+	}
+	for id := range inUse {
+		if _, ok := r.running[id]; ok {
+			continue
+		}
+		sessionCtx, cancel := context.WithCancel(ctx)
+		r.running[id] = cancel
+		r.wg.Add(1)
+		go r.run(sessionCtx, id)
+	}
+}
+
+// run detects the session's stages one after another and fires the over callback after the last one
+func (r *stageRunner) run(ctx context.Context, id string) {
+	defer r.wg.Done()
+
+	for i, stage := range r.stages {
+		r.setStage(ctx, id, strconv.Itoa(stage.Number))
+		evidence, ok := r.waitForStage(ctx, id, stage)
+		if !ok {
+			return
+		}
+		logger.Infof("session %s of game %s passed stage %d", id, r.game, stage.Number)
+		last := i == len(r.stages)-1
+		r.passStage(id, stage.Number, evidence, last)
+		if last {
+			r.setStage(ctx, id, StageOver)
+			r.notifyOver(ctx, id, stage.Number, evidence)
+		}
+	}
+}
+
+// waitForStage polls the session at the stage interval until the stage matches, it returns false once the session is gone
+func (r *stageRunner) waitForStage(ctx context.Context, id string, stage *detector.Stage) (string, bool) {
+	timer := time.NewTimer(stage.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-timer.C:
+		}
+
+		s, err := r.manager.GetSession(ctx, id)
+		if err != nil || s.Status != session.InUse || s.Anbox == nil {
+			return "", false
+		}
+
+		match, evidence, err := r.detect(ctx, s.Anbox.ID, stage.Number)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", false
+			}
+			logger.Warnf("stage detection for session %s of game %s stage %d failed: %v", id, r.game, stage.Number, err)
+		} else if match {
+			return evidence, true
+		}
+		timer.Reset(stage.Interval)
+	}
+}
+
+// detect captures a frame and runs the stage detector while holding a concurrency slot
+func (r *stageRunner) detect(ctx context.Context, anboxID string, stageNum int) (bool, string, error) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, "", ctx.Err()
+	}
+	defer func() { <-r.sem }()
+
+	image, err := r.anboxClient.CaptureScreenshot(ctx, anboxID)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	return r.detectorFor(stageNum).Detect(ctx, r.game, stageNum, base64.StdEncoding.EncodeToString(image))
+}
+
+// passStage records that the session passed a stage, over once it was the last one and released no longer calls back
+func (r *stageRunner) passStage(id string, stageNum int, evidence string, over bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress[id] = &stageProgress{stage: stageNum, evidence: evidence, over: over}
+}
+
+func (r *stageRunner) setStage(ctx context.Context, id, stage string) {
+	if err := r.manager.SetMetadata(ctx, id, map[string]string{StageMetadataKey: stage}); err != nil {
+		logger.Warnf("failed to record stage %s for session %s of game %s: %v", stage, id, r.game, err)
+	}
+}
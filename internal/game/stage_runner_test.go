@@ -0,0 +1,382 @@
+package game
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/playable-backend/internal/detector"
+	"github.com/letusgogo/playable-backend/internal/session"
+)
+
+// fakeSessionManager serves a fixed set of sessions to the stage runner
+type fakeSessionManager struct {
+	session.Manager
+
+	mu       sync.Mutex
+	sessions map[string]*session.Session
+}
+
+func newFakeSessionManager(sessions ...*session.Session) *fakeSessionManager {
+	m := &fakeSessionManager{sessions: make(map[string]*session.Session)}
+	for _, s := range sessions {
+		m.sessions[s.ID] = s
+	}
+	return m
+}
+
+func (m *fakeSessionManager) ListSessions(ctx context.Context, statuses ...session.SessionStatus) ([]*session.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := make([]*session.Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		if len(statuses) > 0 && !slices.Contains(statuses, s.Status) {
+			continue
+		}
+		copied := *s
+		sessions = append(sessions, &copied)
+	}
+	return sessions, nil
+}
+
+func (m *fakeSessionManager) DeletePool(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for id, s := range m.sessions {
+		if s.Status != session.InUse {
+			delete(m.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *fakeSessionManager) PoolStatus(ctx context.Context) (session.PoolStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := session.PoolStatus{Total: len(m.sessions)}
+	for _, s := range m.sessions {
+		switch s.Status {
+		case session.Cold:
+			status.Cold++
+		case session.Warming:
+			status.Warming++
+		case session.Warmed:
+			status.Warmed++
+		case session.InUse:
+			status.InUse++
+		}
+	}
+	return status, nil
+}
+
+func (m *fakeSessionManager) GetSession(ctx context.Context, id string) (*session.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *fakeSessionManager) SetMetadata(ctx context.Context, id string, kv map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+	metadata := make(map[string]string)
+	for k, v := range s.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range kv {
+		metadata[k] = v
+	}
+	s.Metadata = metadata
+	return nil
+}
+
+func (m *fakeSessionManager) Release(ctx context.Context, id string, reason session.ReleaseReason) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *fakeSessionManager) stage(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		return s.Metadata[StageMetadataKey]
+	}
+	return ""
+}
+
+// screenshotClient counts the frames captured per anbox session
+type screenshotClient struct {
+	MockAnboxClient
+
+	mu       sync.Mutex
+	captures map[string]int
+}
+
+func (c *screenshotClient) CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.captures[sessionID]++
+	return []byte("frame"), nil
+}
+
+func (c *screenshotClient) count(sessionID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.captures[sessionID]
+}
+
+// countingDetector matches a stage on its matchAfter-th detection
+type countingDetector struct {
+	mu         sync.Mutex
+	calls      map[int]int
+	matchAfter int
+}
+
+func (d *countingDetector) Detect(ctx context.Context, game string, currentStageNum int, imgBase64 string) (bool, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls[currentStageNum]++
+	if d.calls[currentStageNum] >= d.matchAfter {
+		return true, fmt.Sprintf("stage-%d", currentStageNum), nil
+	}
+	return false, "", nil
+}
+
+func newTestRunner(t *testing.T, manager session.Manager, client session.AnboxClient, stageDetector detector.StageChecker, overURL string) *stageRunner {
+	t.Helper()
+	stages := []*detector.Stage{
+		{Number: 2, Interval: 10 * time.Millisecond},
+		{Number: 1, Interval: 10 * time.Millisecond},
+	}
+	runtime := &Runtime{OverURL: overURL, ServerDetection: true, DetectionConcurrency: 1}
+	runner := newStageRunner("test-game", runtime, stages, manager, client, func(int) detector.StageChecker { return stageDetector })
+	runner.watchInterval = 10 * time.Millisecond
+	return runner
+}
+
+func inUseSession(id string) *session.Session {
+	return &session.Session{ID: id, Status: session.InUse, Anbox: &anbox.SessionDetails{ID: "anbox-" + id}}
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestStageRunner_DrivesSessionThroughStages(t *testing.T) {
+	callbacks := make(chan OverCallback, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cb OverCallback
+		if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+			t.Errorf("failed to decode over callback: %v", err)
+		}
+		callbacks <- cb
+	}))
+	defer server.Close()
+
+	manager := newFakeSessionManager(inUseSession("s1"), &session.Session{ID: "cold", Status: session.Cold, Anbox: &anbox.SessionDetails{ID: "anbox-cold"}})
+	client := &screenshotClient{captures: make(map[string]int)}
+	stageDetector := &countingDetector{calls: make(map[int]int), matchAfter: 2}
+	runner := newTestRunner(t, manager, client, stageDetector, server.URL)
+	runner.Start()
+	defer runner.Stop()
+
+	select {
+	case cb := <-callbacks:
+		if cb.Game != "test-game" || cb.SessionID != "s1" || cb.Stage != 2 || cb.Evidence != "stage-2" {
+			t.Errorf("unexpected over callback %+v", cb)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("over callback was not fired")
+	}
+
+	if got := manager.stage("s1"); got != StageOver {
+		t.Errorf("expected stage %q, got %q", StageOver, got)
+	}
+	// Stages run in number order, each needing two detections
+	if got := client.count("anbox-s1"); got != 4 {
+		t.Errorf("expected 4 captures, got %d", got)
+	}
+	if got := client.count("anbox-cold"); got != 0 {
+		t.Errorf("expected no captures of a cold session, got %d", got)
+	}
+}
+
+func TestStageRunner_OverCallbackIsSignedAndRetried(t *testing.T) {
+	type delivery struct {
+		body      []byte
+		signature string
+		key       string
+	}
+	deliveries := make(chan delivery, 4)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{body: body, signature: r.Header.Get(OverSignatureHeader), key: r.Header.Get(OverIdempotencyHeader)}
+		// The first attempt fails, the retry is accepted
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	acquired := time.Now().Add(-time.Minute)
+	s1 := inUseSession("s1")
+	s1.StatusChangedAt = acquired
+	s1.Metadata = map[string]string{"player": "p-42"}
+	manager := newFakeSessionManager(s1)
+	client := &screenshotClient{captures: make(map[string]int)}
+	stageDetector := &countingDetector{calls: make(map[int]int), matchAfter: 1}
+	runner := newTestRunner(t, manager, client, stageDetector, server.URL)
+	runner.over.secret = []byte("top-secret")
+	runner.over.retryWait = 5 * time.Millisecond
+	runner.Start()
+	defer runner.Stop()
+
+	var got []delivery
+	for len(got) < 2 {
+		select {
+		case d := <-deliveries:
+			got = append(got, d)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected a failed delivery and a retry, got %d deliveries", len(got))
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte("top-secret"))
+	mac.Write(got[0].body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got[0].signature != want {
+		t.Errorf("expected signature %s, got %s", want, got[0].signature)
+	}
+	if string(got[1].body) != string(got[0].body) || got[1].signature != got[0].signature || got[1].key != got[0].key {
+		t.Errorf("expected the retry to repeat the signed body and idempotency key")
+	}
+
+	var cb OverCallback
+	if err := json.Unmarshal(got[0].body, &cb); err != nil {
+		t.Fatalf("failed to decode over callback: %v", err)
+	}
+	if cb.ID == "" || got[0].key != cb.ID {
+		t.Errorf("expected idempotency key %q to match the callback ID %q", got[0].key, cb.ID)
+	}
+	if cb.Game != "test-game" || cb.SessionID != "s1" || cb.Reason != OverReasonStagesPassed || cb.Stage != 2 || cb.Evidence != "stage-2" {
+		t.Errorf("unexpected over callback %+v", cb)
+	}
+	if len(cb.Metadata) != 1 || cb.Metadata["player"] != "p-42" {
+		t.Errorf("expected the player metadata without the stage, got %v", cb.Metadata)
+	}
+	if drift := cb.Duration - cb.OverAt.Sub(cb.StartedAt); !cb.StartedAt.Equal(acquired) || cb.Duration < time.Minute || drift < -time.Millisecond || drift > time.Millisecond {
+		t.Errorf("unexpected timing started=%s over=%s duration=%s", cb.StartedAt, cb.OverAt, cb.Duration)
+	}
+
+	// The callback is accepted, nothing is sent again
+	time.Sleep(30 * time.Millisecond)
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestStageRunner_OverCallbackOnRelease(t *testing.T) {
+	callbacks := make(chan OverCallback, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cb OverCallback
+		if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+			t.Errorf("failed to decode over callback: %v", err)
+		}
+		callbacks <- cb
+	}))
+	defer server.Close()
+
+	s1 := inUseSession("s1")
+	s1.StatusChangedAt = time.Now().Add(-time.Minute)
+	s1.Metadata = map[string]string{"player": "p-42", StageMetadataKey: "1"}
+	manager := newFakeSessionManager(s1)
+	client := &screenshotClient{captures: make(map[string]int)}
+	stageDetector := &countingDetector{calls: make(map[int]int), matchAfter: 1 << 30}
+	runner := newTestRunner(t, manager, client, stageDetector, server.URL)
+	runner.Start()
+	defer runner.Stop()
+
+	// A session that timed out before passing a stage calls back with why it was released
+	runner.released(*s1, session.ReleaseHeartbeatTimeout)
+	select {
+	case cb := <-callbacks:
+		if cb.SessionID != "s1" || cb.Reason != string(session.ReleaseHeartbeatTimeout) || cb.Stage != 0 || cb.Evidence != "" {
+			t.Errorf("unexpected over callback %+v", cb)
+		}
+		if len(cb.Metadata) != 1 || cb.Metadata["player"] != "p-42" || cb.Duration < time.Minute {
+			t.Errorf("expected the session details in the callback, got %+v", cb)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("over callback was not fired on release")
+	}
+
+	// A session whose stages_passed callback went out is not called back again
+	runner.passStage("s2", 2, "stage-2", true)
+	runner.released(*inUseSession("s2"), session.ReleaseClient)
+	select {
+	case cb := <-callbacks:
+		t.Errorf("unexpected second over callback %+v", cb)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStageRunner_StopsWhenSessionReleased(t *testing.T) {
+	manager := newFakeSessionManager(inUseSession("s1"))
+	client := &screenshotClient{captures: make(map[string]int)}
+	stageDetector := &countingDetector{calls: make(map[int]int), matchAfter: 1 << 30}
+	runner := newTestRunner(t, manager, client, stageDetector, "")
+	runner.Start()
+	defer runner.Stop()
+
+	waitFor(t, func() bool { return client.count("anbox-s1") > 0 }, "session was never captured")
+	if got := manager.stage("s1"); got != "1" {
+		t.Errorf("expected stage 1, got %q", got)
+	}
+
+	if err := manager.Release(context.Background(), "s1", session.ReleaseClient); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		runner.mu.Lock()
+		defer runner.mu.Unlock()
+		return len(runner.running) == 0
+	}, "runner kept the released session")
+
+	captured := client.count("anbox-s1")
+	time.Sleep(50 * time.Millisecond)
+	if got := client.count("anbox-s1"); got != captured {
+		t.Errorf("expected no captures after release, got %d more", got-captured)
+	}
+}
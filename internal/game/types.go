@@ -1,6 +1,8 @@
 package game
 
 import (
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/letusgogo/playable-backend/internal/detector"
@@ -22,13 +24,41 @@ type Anbox struct {
 	Address    string `mapstructure:"address"`
 	Token      string `mapstructure:"token"`
 	AMSAddress string `mapstructure:"ams_address"`
+	ReplicaID  string `mapstructure:"replica_id"`
 }
 
 type GameConfig struct {
 	Name          string            `mapstructure:"name"`
+	AppName       string            `mapstructure:"app_name"` // Anbox application name, defaults to Name
+	Farm          string            `mapstructure:"farm"`     // anbox_farms entry the game runs on, the anbox block when empty
 	SessionConfig *SessionConfig    `mapstructure:"session_config"`
 	Runtime       *Runtime          `mapstructure:"runtime"`
 	Stages        []*detector.Stage `mapstructure:"stages"`
+	// ClientStages are the stages clients may detect, empty allows every stage.
+	// Stages left out are only reached through server detection or are transitions between the others.
+	ClientStages []int `mapstructure:"client_stages"`
+	// Preprocess is applied to frames before OCR for stages that do not set reco.preprocess, off when nil
+	Preprocess *detector.Preprocess `mapstructure:"preprocess"`
+	// RecoDefaults fill the method, lang, psm and match_mode of every stage reco that leaves them empty
+	RecoDefaults *detector.RecoDefaults `mapstructure:"reco_defaults"`
+	// Priority weighs the game's share of the game manager's GlobalMax against the other games, 0 counts as 1
+	Priority int `mapstructure:"priority"`
+}
+
+// GetAppName returns the anbox application backing the game
+func (g *GameConfig) GetAppName() string {
+	if g.AppName != "" {
+		return g.AppName
+	}
+	return g.Name
+}
+
+// priority returns the weight of the game's share of GlobalMax
+func (g *GameConfig) priority() int {
+	if g.Priority > 0 {
+		return g.Priority
+	}
+	return 1
 }
 
 type SessionConfig struct {
@@ -38,6 +68,94 @@ type SessionConfig struct {
 	HeartbeatTimeout time.Duration `mapstructure:"heartbeat_timeout"`
 	SyncInterval     time.Duration `mapstructure:"sync_interval"`
 	ScreenConfig     ScreenConfig  `mapstructure:"screen_config"`
+	// MinReady is the minimum number of cold or warmed sessions to keep, see session.Config.MinReady
+	MinReady int `mapstructure:"min_ready"`
+	// WarmupConcurrency is how many sessions may be created in parallel at startup
+	WarmupConcurrency int `mapstructure:"warmup_concurrency"`
+	// OrphanMaxAge is the age after which a managed instance unknown to the pool is reaped
+	OrphanMaxAge time.Duration `mapstructure:"orphan_max_age"`
+	// KeepErrored leaves instances in error or stopped state on AMS for inspection instead of reaping them
+	KeepErrored bool `mapstructure:"keep_errored"`
+	// MaxInUseDuration caps how far extensions push out an in-use session after its acquire, defaults to 2x SessionTTL
+	MaxInUseDuration time.Duration `mapstructure:"max_in_use_duration"`
+	// CreateBackoff is how long creation pauses after the gateway reports it is out of capacity
+	CreateBackoff time.Duration `mapstructure:"create_backoff"`
+	// CreateBackoffMax caps the backoff, which doubles with every creation failure in a row
+	CreateBackoffMax time.Duration `mapstructure:"create_backoff_max"`
+	// CreateHaltTimeout is how long creation stays halted after a permanent error before it is retried
+	CreateHaltTimeout time.Duration `mapstructure:"create_halt_timeout"`
+	// OnDemand creates a session on acquire when the pool has no warmed session, useful with Min=0.
+	// It needs LaunchApp or WarmupActions, which run before the session is handed out.
+	OnDemand bool `mapstructure:"on_demand"`
+	// OnDemandTimeout bounds how long an on-demand acquire waits for creation
+	OnDemandTimeout time.Duration `mapstructure:"on_demand_timeout"`
+	// CreateVerifyTimeout is how long an on-demand session may take to run after it was created, 0 does not wait.
+	// CreateVerifyInterval is how often it is checked meanwhile.
+	CreateVerifyTimeout  time.Duration `mapstructure:"create_verify_timeout"`
+	CreateVerifyInterval time.Duration `mapstructure:"create_verify_interval"`
+	// LaunchApp runs LaunchCommands in new sessions, e.g. am start -W, before they are handed out.
+	// LaunchTimeout bounds the commands of one session, LaunchAttempts how often they are tried.
+	LaunchApp      bool          `mapstructure:"launch_app"`
+	LaunchCommands [][]string    `mapstructure:"launch_commands"`
+	LaunchTimeout  time.Duration `mapstructure:"launch_timeout"`
+	LaunchAttempts int           `mapstructure:"launch_attempts"`
+	// WarmupActions tap, wait or run commands in a session on set_warmed, it is only warmed once they succeeded.
+	// WarmupTimeout bounds the actions of one session. WarmupInputViaGateway injects taps, swipes and text
+	// over the gateway's control channel rather than as input commands in the instance.
+	WarmupActions         []session.WarmupAction `mapstructure:"warmup_actions"`
+	WarmupTimeout         time.Duration          `mapstructure:"warmup_timeout"`
+	WarmupInputViaGateway bool                   `mapstructure:"warmup_input_via_gateway"`
+	// WarmingWorkers warm cold sessions on the backend, running the warm-up actions, until MinWarmed are warmed
+	WarmingWorkers int `mapstructure:"warming_workers"`
+	MinWarmed      int `mapstructure:"min_warmed"`
+	// EvictionPolicy is none, oldest_cold or oldest_idle, see session.EvictionPolicy
+	EvictionPolicy string `mapstructure:"eviction_policy"`
+	// DrainOrder is oldest_first or newest_first, see session.DrainOrder
+	DrainOrder string `mapstructure:"drain_order"`
+	// IdempotencyTTL is how long an acquire Idempotency-Key keeps returning the same session
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+	// MaxSessionsPerKey caps the sessions one partner API key may hold at once, 0 means unlimited
+	MaxSessionsPerKey int `mapstructure:"max_sessions_per_key"`
+	// WarmingTimeout reverts sessions stuck in warming to cold
+	WarmingTimeout time.Duration `mapstructure:"warming_timeout"`
+	// MaxWarmingDuration reclaims sessions warming for longer as broken, MaxWarmingAction is delete or revert
+	MaxWarmingDuration time.Duration `mapstructure:"max_warming_duration"`
+	MaxWarmingAction   string        `mapstructure:"max_warming_action"`
+	// GracePeriod keeps sessions that just changed state safe from expiry
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+	// MaxColdAge recycles cold sessions that have been ready for longer, 0 keeps them until session_ttl
+	MaxColdAge time.Duration `mapstructure:"max_cold_age"`
+	// InUseAbsentSyncs is how many consecutive syncs an in-use session may be missing from AMS before it is pruned
+	InUseAbsentSyncs int `mapstructure:"in_use_absent_syncs"`
+	// InstanceNamePrefix names created AMS instances "<prefix>-<game>-<shortid>"
+	InstanceNamePrefix string `mapstructure:"instance_name_prefix"`
+	// IdleTimeMin and Ephemeral override the anbox-side reaping of the game's sessions, see session.Config.IdleTimeMin
+	IdleTimeMin int  `mapstructure:"idle_time_min"`
+	Ephemeral   bool `mapstructure:"ephemeral"`
+	// HealthSweepInterval is how often cached sessions are checked against the gateway, 0 disables it
+	HealthSweepInterval time.Duration `mapstructure:"health_sweep_interval"`
+	// HealthSweepConcurrency bounds the gateway lookups a sweep runs at once
+	HealthSweepConcurrency int `mapstructure:"health_sweep_concurrency"`
+	// HealthAbsentSweeps is how many sweeps in a row the gateway must not know a session before it is reclaimed, 0 keeps the default of 2
+	HealthAbsentSweeps int `mapstructure:"health_absent_sweeps"`
+	// ScreenProfiles keeps a sub-pool per named screen, the first profile is used by acquires that name none
+	ScreenProfiles []ScreenProfile `mapstructure:"screen_profiles"`
+	// ConnectSettle is how long a new session may still refuse joins, acquires within it hint a longer connect retry
+	ConnectSettle time.Duration `mapstructure:"connect_settle"`
+	// ConnectRetryMin is the connect retry hint for sessions that settled long ago
+	ConnectRetryMin time.Duration `mapstructure:"connect_retry_min"`
+	// EmptyRetryAfter is the Retry-After of an acquire that found the pool empty with no session warming or booting
+	EmptyRetryAfter time.Duration `mapstructure:"empty_retry_after"`
+	// StarvationThreshold alerts when more acquires than this find the pool empty within StarvationWindow, 0 disables it.
+	// StarvationWebhook optionally receives each alert as a JSON POST.
+	StarvationThreshold int           `mapstructure:"starvation_threshold"`
+	StarvationWindow    time.Duration `mapstructure:"starvation_window"`
+	StarvationWebhook   string        `mapstructure:"starvation_webhook"`
+	// MinWarmedGuarantee reports a breach once fewer warmed sessions are ready for GuaranteeBreachAfter, 0 disables it.
+	// GuaranteeWebhook optionally receives each breach and recovery as a JSON POST.
+	MinWarmedGuarantee   int           `mapstructure:"min_warmed_guarantee"`
+	GuaranteeBreachAfter time.Duration `mapstructure:"guarantee_breach_after"`
+	GuaranteeWebhook     string        `mapstructure:"guarantee_webhook"`
 }
 
 type ScreenConfig struct {
@@ -47,9 +165,98 @@ type ScreenConfig struct {
 	Fps     int `mapstructure:"fps"`
 }
 
+// ScreenProfile is a named screen with its own minimum number of pooled sessions, see session.ScreenProfile
+type ScreenProfile struct {
+	Name         string `mapstructure:"name"`
+	Min          int    `mapstructure:"min"`
+	MinReady     int    `mapstructure:"min_ready"`
+	MinWarmed    int    `mapstructure:"min_warmed"`
+	ScreenConfig `mapstructure:",squash"`
+}
+
 type Runtime struct {
 	TimeOver time.Duration `mapstructure:"time_over"`
 	OverURL  string        `mapstructure:"over_url"`
+	// OverSecret signs over callbacks with HMAC-SHA256 in OverSignatureHeader, they are unsigned without it
+	OverSecret string `mapstructure:"over_secret"`
+	// OverRetries is how often a failed over callback is sent again, 0 means DefaultOverRetries
+	OverRetries int `mapstructure:"over_retries"`
+	// ServerDetection makes the backend capture and detect the stages of in-use sessions itself
+	ServerDetection bool `mapstructure:"server_detection"`
+	// DetectionConcurrency bounds the captures and detections running at once for the game
+	DetectionConcurrency int `mapstructure:"detection_concurrency"`
+}
+
+// HasStage reports whether the game configures stage number num
+func (g *GameConfig) HasStage(num int) bool {
+	for _, stage := range g.Stages {
+		if stage.Number == num {
+			return true
+		}
+	}
+	return false
+}
+
+// StageNumbers returns the configured stage numbers in ascending order
+func (g *GameConfig) StageNumbers() []int {
+	numbers := make([]int, 0, len(g.Stages))
+	for _, stage := range g.Stages {
+		numbers = append(numbers, stage.Number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// ClientCanDetect reports whether clients may detect stage number num
+func (g *GameConfig) ClientCanDetect(num int) bool {
+	if !g.HasStage(num) {
+		return false
+	}
+	return len(g.ClientStages) == 0 || slices.Contains(g.ClientStages, num)
+}
+
+// ClientStageNumbers returns the stage numbers clients may detect in ascending order
+func (g *GameConfig) ClientStageNumbers() []int {
+	if len(g.ClientStages) == 0 {
+		return g.StageNumbers()
+	}
+	numbers := slices.Clone(g.ClientStages)
+	sort.Ints(numbers)
+	return numbers
+}
+
+// redactedValue replaces configured secrets in a redacted config
+const redactedValue = "redacted"
+
+// redacted returns a copy of the config that is safe to serve, with the over secret and the alert webhooks,
+// which may carry credentials in their URLs, replaced by redactedValue
+func (g *GameConfig) redacted() *GameConfig {
+	copied := *g
+	if g.SessionConfig != nil {
+		sessionConfig := *g.SessionConfig
+		sessionConfig.StarvationWebhook = redact(sessionConfig.StarvationWebhook)
+		sessionConfig.GuaranteeWebhook = redact(sessionConfig.GuaranteeWebhook)
+		copied.SessionConfig = &sessionConfig
+	}
+	if g.Runtime != nil {
+		runtime := *g.Runtime
+		runtime.OverSecret = redact(runtime.OverSecret)
+		copied.Runtime = &runtime
+	}
+	return &copied
+}
+
+// redact hides a configured value, an unset one stays empty so it still shows the feature is off
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// ServerDetectionEnabled reports whether the game opted in to server-side stage detection
+func (g *GameConfig) ServerDetectionEnabled() bool {
+	return g.Runtime != nil && g.Runtime.ServerDetection
 }
 
 // GameInstanceStatus represents the status of a game instance
@@ -57,6 +264,22 @@ type GameInstanceStatus struct {
 	Name        string              `json:"name"`
 	Initialized bool                `json:"initialized"`
 	Running     bool                `json:"running"`
+	Degraded    bool                `json:"degraded"`
+	Error       string              `json:"error,omitempty"` // why a degraded game failed to init or start
 	PoolStatus  *session.PoolStatus `json:"pool_status,omitempty"`
-	Config      *GameConfig         `json:"config,omitempty"`
+	Config      *GameConfig         `json:"config,omitempty"` // redacted, see GameConfig.redacted
+	// LastSyncAt is when the background sync last succeeded, ConsecutiveSyncFailures how often it failed in a row
+	// since then and LastSyncError why. A running game can still be failing to sync.
+	LastSyncAt              *time.Time `json:"last_sync_at,omitempty"`
+	LastSyncError           string     `json:"last_sync_error,omitempty"`
+	ConsecutiveSyncFailures int        `json:"consecutive_sync_failures"`
+}
+
+// setSyncHealth fills in the sync fields from the loop health of the game's session manager
+func (s *GameInstanceStatus) setSyncHealth(health session.LoopHealth) {
+	s.LastSyncAt = health.LastSuccessAt
+	s.ConsecutiveSyncFailures = health.ConsecutiveFailures
+	if health.ConsecutiveFailures > 0 {
+		s.LastSyncError = health.LastError
+	}
 }
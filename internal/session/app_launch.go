@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultLaunchTimeout bounds the launch commands of one session when LaunchTimeout is not set
+const DefaultLaunchTimeout = 2 * time.Minute
+
+// AppLauncher is implemented by anbox clients that can run commands inside the instance of a session
+type AppLauncher interface {
+	// LaunchApp runs commands in order in the instance of the session, it returns once the last one finished
+	LaunchApp(ctx context.Context, sessionID string, commands [][]string) error
+}
+
+// launchTimeout returns how long the launch commands of one session may take
+func (c *Config) launchTimeout() time.Duration {
+	if c.LaunchTimeout > 0 {
+		return c.LaunchTimeout
+	}
+	return DefaultLaunchTimeout
+}
+
+// launchApp runs the launch commands in the session's instance, the anbox client must be an AppLauncher
+func (m *LocalSessionManager) launchApp(ctx context.Context, id string) error {
+	launcher, ok := m.anboxClient.(AppLauncher)
+	if !ok {
+		return fmt.Errorf("anbox client cannot launch apps")
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.launchTimeout())
+	defer cancel()
+	if err := launcher.LaunchApp(ctx, id, m.cfg.LaunchCommands); err != nil {
+		return fmt.Errorf("failed to launch app in session %s: %w", id, err)
+	}
+	return nil
+}
+
+// startLaunchesLocked launches the app in every synced session that is not launched yet. The sessions stay
+// out of AcquireCold until their launch completes, a failed launch is retried on the next sync until
+// LaunchAttempts failed. Callers must hold m.mu.
+func (m *LocalSessionManager) startLaunchesLocked(ctx context.Context) {
+	for _, session := range m.cache {
+		if session.AppLaunched || session.launching {
+			continue
+		}
+		session.launching = true
+		go m.launchSynced(ctx, session.ID)
+	}
+}
+
+// launchSynced launches the app of a synced session and marks it launched, so it can be acquired
+func (m *LocalSessionManager) launchSynced(ctx context.Context, id string) {
+	start := m.clock.Now()
+	err := m.launchApp(ctx, id)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, exists := m.cache[id]
+	if !exists {
+		return
+	}
+	session.launching = false
+	if err != nil {
+		session.launchFailures++
+		if m.cfg.LaunchAttempts > 0 && session.launchFailures >= m.cfg.LaunchAttempts {
+			logger.Warnf("reclaiming session %s of game %s whose app did not launch in %d attempts: %v", id, m.cfg.GameName, session.launchFailures, err)
+			m.removeLocked(session, SystemActor, "launch_failed", ReleaseErrored)
+			go func(id string) {
+				if err := m.deleteSession(context.Background(), id); err != nil {
+					logger.Errorf("failed to delete anbox session %s without a launched app: %v", id, err)
+				}
+			}(id)
+			return
+		}
+		logger.Warnf("app of session %s of game %s is not launched, retrying on the next sync: %v", id, m.cfg.GameName, err)
+		return
+	}
+	session.AppLaunched = true
+	session.ReadyAt = m.clock.Now()
+	logger.Infof("app of session %s of game %s launched in %s", id, m.cfg.GameName, m.clock.Now().Sub(start))
+}
+
+// launchedLocked reports whether the app of the session is launched, always true without LaunchApp.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) launchedLocked(session *Session) bool {
+	return !m.cfg.LaunchApp || session.AppLaunched
+}
+
+// launchingLocked counts the cold sessions whose app is still launching. Callers must hold m.mu.
+func (m *LocalSessionManager) launchingLocked() int {
+	if !m.cfg.LaunchApp {
+		return 0
+	}
+	n := 0
+	for _, session := range m.cache {
+		if session.Status == Cold && !session.AppLaunched {
+			n++
+		}
+	}
+	return n
+}
+
+// launchCreated launches the app of a session created on demand, a session whose launch fails is deleted
+func (m *LocalSessionManager) launchCreated(ctx context.Context, details *anbox.SessionDetails) (*anbox.SessionDetails, error) {
+	err := m.launchApp(ctx, details.ID)
+	if err == nil {
+		return details, nil
+	}
+
+	logger.Warnf("reclaiming session %s of game %s whose app did not launch: %v", details.ID, m.cfg.GameName, err)
+	go func(id string) {
+		if err := m.deleteSession(context.Background(), id); err != nil {
+			logger.Errorf("failed to delete anbox session %s without a launched app: %v", id, err)
+		}
+	}(details.ID)
+	return nil, err
+}
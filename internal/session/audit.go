@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// Deleted is the To state of audit events for sessions that left the pool
+const Deleted SessionStatus = "deleted"
+
+// SystemActor is the actor of transitions the manager makes on its own, e.g. expiry and sync
+const SystemActor = "system"
+
+// AuditEvent records one session state transition
+type AuditEvent struct {
+	Time      time.Time     `json:"time"`
+	SessionID string        `json:"session_id"`
+	Game      string        `json:"game"`
+	From      SessionStatus `json:"from"` // empty for a session entering the pool
+	To        SessionStatus `json:"to"`
+	Actor     string        `json:"actor"` // API key of the client or SystemActor
+	Reason    string        `json:"reason"`
+	// ReleaseReason is why the session left the pool, set on the events to Deleted
+	ReleaseReason ReleaseReason `json:"release_reason,omitempty"`
+}
+
+// AuditSink receives every session transition in the order they happen.
+// Record is called with the manager lock held and must not call back into the manager.
+type AuditSink interface {
+	Record(event AuditEvent)
+}
+
+// WithAuditSink makes the manager record every session transition to sink
+func WithAuditSink(sink AuditSink) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.audit = sink
+	}
+}
+
+type actorKey struct{}
+
+// WithActor attributes the session transitions made with ctx to actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or SystemActor
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// acquireActor attributes an acquire to the actor of ctx, falling back to the API key it was made with
+func acquireActor(ctx context.Context, options *acquireOptions) string {
+	if actor := ActorFromContext(ctx); actor != SystemActor || options.apiKey == "" {
+		return actor
+	}
+	return options.apiKey
+}
+
+// auditLocked records a transition of session to the audit sink. Callers must hold m.mu.
+func (m *LocalSessionManager) auditLocked(session *Session, from, to SessionStatus, actor, reason string) {
+	m.recordAuditLocked(session, AuditEvent{From: from, To: to, Actor: actor, Reason: reason})
+}
+
+// recordAuditLocked fills in the time, session and game of event and records it. Callers must hold m.mu.
+func (m *LocalSessionManager) recordAuditLocked(session *Session, event AuditEvent) {
+	if m.audit == nil {
+		return
+	}
+	event.Time = m.clock.Now()
+	event.SessionID = session.ID
+	event.Game = m.cfg.GameName
+	m.audit.Record(event)
+}
+
+// JSONLinesAuditSink appends audit events to a file, one JSON object per line
+type JSONLinesAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewJSONLinesAuditSink opens path for appending, creating it if needed
+func NewJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &JSONLinesAuditSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Record appends event to the file
+func (s *JSONLinesAuditSink) Record(event AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(event); err != nil {
+		logger.Errorf("failed to write audit event for session %s: %v", event.SessionID, err)
+	}
+}
+
+// Close closes the file
+func (s *JSONLinesAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// CreateSessions requests up to n new sessions of the default profile, WarmupConcurrency at a time. It stops early once
+// Max or the capacity budget is reached, also by sessions created concurrently, and when ctx is done.
+// It returns how many sessions were requested, they join the pool on a later sync.
+func (m *LocalSessionManager) CreateSessions(ctx context.Context, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot create %d sessions", n)
+	}
+	m.mu.RLock()
+	profile, concurrency := m.cfg.defaultProfile(), m.cfg.WarmupConcurrency
+	m.mu.RUnlock()
+
+	profiles := make([]string, n)
+	for i := range profiles {
+		profiles[i] = profile
+	}
+	requested := m.createBatch(ctx, profiles, concurrency)
+	return requested, ctx.Err()
+}
+
+// createBatch requests a session of each profile in order, at most concurrency at a time. Before every request it
+// re-checks under the lock that Max, the creations in flight and the capacity budget leave room, since other
+// goroutines may have created sessions meanwhile. It stops at the first one that does not fit or when ctx is done,
+// waits for the requests it started and returns how many succeeded.
+// Those sessions only reach the cache on a later sync, so they stay counted in pendingCreations until the batch
+// returns, a failed request gives its slot back right away.
+func (m *LocalSessionManager) createBatch(ctx context.Context, profiles []string, concurrency int) int {
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	var requested atomic.Int32
+
+	for i, profile := range profiles {
+		if !m.startBatchCreation(ctx, sem) {
+			logger.Infof("stopped creating sessions for game %s after %d of %d", m.cfg.GameName, i, len(profiles))
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if m.createNewSession(ctx, profile) {
+				requested.Add(1)
+				return
+			}
+			m.mu.Lock()
+			m.pendingCreations--
+			m.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	n := int(requested.Load())
+	m.mu.Lock()
+	m.pendingCreations -= n
+	m.mu.Unlock()
+	return n
+}
+
+// startBatchCreation waits for a slot in sem and claims a pending creation, it returns false without either
+// when ctx is done or no session may be created
+func (m *LocalSessionManager) startBatchCreation(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reason := m.createBlockedLocked(ctx); reason != "" {
+		<-sem
+		logger.Infof("not creating another session for game %s: %s", m.cfg.GameName, reason)
+		return false
+	}
+	m.pendingCreations++
+	return true
+}
+
+// createBlockedLocked tells why no session may be created right now, "" when one may. When one may it reserves
+// it in the capacity budget. Callers must hold m.mu.
+func (m *LocalSessionManager) createBlockedLocked(ctx context.Context) string {
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err().Error()
+	case m.draining:
+		return "draining"
+	case m.paused:
+		return "paused"
+	case !m.anboxClient.Available():
+		return "upstream unavailable"
+	case m.createHaltedLocked():
+		return "creation is halted"
+	case m.clock.Now().Before(m.createBackoffUntil):
+		return "creation is backing off"
+	case len(m.cache)+m.pendingCreations >= m.cfg.Max:
+		return fmt.Sprintf("the pool is at its max of %d", m.cfg.Max)
+	case m.reserveCapacityLocked(1) == 0:
+		return "the session budget shared with other games is used up"
+	}
+	return ""
+}
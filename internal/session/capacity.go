@@ -0,0 +1,46 @@
+package session
+
+// PoolUsage is what a pool reports to a CapacityBudget
+type PoolUsage struct {
+	Used   int  // sessions the pool holds, including instances still booting and creations in flight
+	Wanted bool // the pool is below its Min or MinReady and would create more
+}
+
+// CapacityBudget shares one session budget between the pools of several games.
+// Both methods are called with the manager lock held and must not call back into any manager.
+type CapacityBudget interface {
+	// Reserve records the usage of game and returns how many of n more sessions it may create,
+	// granted sessions count against the budget until the next usage of game is recorded
+	Reserve(game string, usage PoolUsage, n int) int
+	// Report records the usage of game without creating anything
+	Report(game string, usage PoolUsage)
+}
+
+// WithCapacityBudget makes the manager create sessions only within its share of budget, on top of Max
+func WithCapacityBudget(budget CapacityBudget) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.capacity = budget
+	}
+}
+
+// poolUsageLocked is the usage reported to the capacity budget. Callers must hold m.mu.
+func (m *LocalSessionManager) poolUsageLocked() PoolUsage {
+	_, wanted := m.profileToCreateLocked()
+	return PoolUsage{Used: len(m.cache) + m.booting + m.pendingCreations, Wanted: wanted}
+}
+
+// reserveCapacityLocked asks the capacity budget for n more sessions and returns how many were granted,
+// all of them without a budget. Callers must hold at least a read lock on m.mu.
+func (m *LocalSessionManager) reserveCapacityLocked(n int) int {
+	if m.capacity == nil {
+		return n
+	}
+	return m.capacity.Reserve(m.cfg.GameName, m.poolUsageLocked(), n)
+}
+
+// reportCapacityLocked tells the capacity budget how many sessions the pool holds. Callers must hold m.mu.
+func (m *LocalSessionManager) reportCapacityLocked() {
+	if m.capacity != nil {
+		m.capacity.Report(m.cfg.GameName, m.poolUsageLocked())
+	}
+}
@@ -0,0 +1,50 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the session manager the time, tests swap it for a FakeClock to control expiry
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when it is advanced
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a fake clock standing at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the fake time forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// ManagerOption configures a LocalSessionManager
+type ManagerOption func(*LocalSessionManager)
+
+// WithClock makes the manager read the time from clock instead of the system clock
+func WithClock(clock Clock) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.clock = clock
+	}
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+)
+
+// ErrNotSessionOwner is returned when a session's connection details are asked for with another API key
+// than the one that acquired it
+var ErrNotSessionOwner = errors.New("session is held by another api key")
+
+// ConnectionInfo is everything a client needs to open the stream of an in-use session.
+// The token and signaling URL are scoped to the session, the pool-wide gateway token never leaves the backend.
+type ConnectionInfo struct {
+	SessionID string `json:"session_id"`
+	// GatewayURL is the signaling URL to open, it already carries Token
+	GatewayURL  string             `json:"gateway_url"`
+	Token       string             `json:"token"`
+	StunServers []anbox.StunServer `json:"stun_servers"`
+	Screen      anbox.Screen       `json:"screen"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+}
+
+// GetConnectionInfo joins an in-use session and returns its connection descriptor.
+// apiKey must be the key the session was acquired with, the join token lets anyone onto the stream.
+func (m *LocalSessionManager) GetConnectionInfo(ctx context.Context, id, apiKey string) (ConnectionInfo, error) {
+	m.mu.RLock()
+	session, exists := m.cache[id]
+	if !exists {
+		m.mu.RUnlock()
+		return ConnectionInfo{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if session.Status != InUse {
+		status := session.Status
+		m.mu.RUnlock()
+		return ConnectionInfo{}, fmt.Errorf("%w: session %s is %s, not %s", ErrInvalidState, id, status, InUse)
+	}
+	if !heldBy(session, apiKey) {
+		m.mu.RUnlock()
+		return ConnectionInfo{}, fmt.Errorf("%w: session %s", ErrNotSessionOwner, id)
+	}
+	gatewayID := anboxID(session)
+	info := ConnectionInfo{
+		SessionID: session.ID,
+		Screen:    m.screen(session.Profile),
+		ExpiresAt: session.ExpiresAt,
+	}
+	m.mu.RUnlock()
+
+	// Join outside the lock, it is a gateway round trip
+	join, err := m.anboxClient.Join(ctx, gatewayID)
+	if err != nil {
+		return ConnectionInfo{}, fmt.Errorf("failed to join session %s: %w", id, err)
+	}
+	info.GatewayURL = join.SignalingURL
+	info.Token = scopedToken(join.SignalingURL)
+	info.StunServers = join.StunServers
+	return info, nil
+}
+
+// Reconnect joins an in-use session again for a client whose stream dropped, returning fresh credentials
+// and STUN/TURN servers. Like GetConnectionInfo it needs the acquiring apiKey. It restarts the heartbeat
+// window, the session keeps its ExpiresAt.
+func (m *LocalSessionManager) Reconnect(ctx context.Context, id, apiKey string) (ConnectionInfo, error) {
+	info, err := m.GetConnectionInfo(ctx, id, apiKey)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The session may have been released or reclaimed during the join
+	session, exists := m.cache[id]
+	if !exists {
+		return ConnectionInfo{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if session.Status != InUse {
+		return ConnectionInfo{}, fmt.Errorf("%w: session %s is %s, not %s", ErrInvalidState, id, session.Status, InUse)
+	}
+	session.LastHeartbeat = m.clock.Now()
+	info.ExpiresAt = session.ExpiresAt
+	return info, nil
+}
+
+// ConnectHint tells a client how aggressively to retry the WebRTC connect of an acquired session
+type ConnectHint struct {
+	RetryAfter time.Duration // wait this long before retrying a failed connect
+	Fresh      bool          // the session became ready within ConnectSettle, the gateway may still refuse joins
+}
+
+// ConnectHint derives the retry hint from how recently the session became ready, its ReadyAt:
+// the time left of ConnectSettle for fresh sessions, ConnectRetryMin for settled ones
+func (m *LocalSessionManager) ConnectHint(s *Session) ConnectHint {
+	hint := ConnectHint{RetryAfter: m.cfg.ConnectRetryMin}
+	if left := m.cfg.ConnectSettle - m.clock.Now().Sub(s.ReadyAt); left > 0 {
+		hint.Fresh = true
+		hint.RetryAfter = max(left, m.cfg.ConnectRetryMin)
+	}
+	return hint
+}
+
+// heldBy reports whether apiKey is the key the session was acquired with
+func heldBy(session *Session, apiKey string) bool {
+	return subtle.ConstantTimeCompare([]byte(session.APIKey), []byte(apiKey)) == 1
+}
+
+// scopedToken returns the token query parameter of a signaling URL
+func scopedToken(signalingURL string) string {
+	parsed, err := url.Parse(signalingURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Query().Get("token")
+}
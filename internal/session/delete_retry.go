@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultDeleteTimeout bounds the delete Release waits for, one that runs out is retried like any failed delete
+const DefaultDeleteTimeout = 30 * time.Second
+
+// deleteQueue remembers the anbox sessions whose delete failed after they left the cache, so they are not
+// leaked on the farm. It has its own lock as deletes run with and without m.mu held.
+type deleteQueue struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (q *deleteQueue) add(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ids == nil {
+		q.ids = make(map[string]bool)
+	}
+	q.ids[id] = true
+}
+
+func (q *deleteQueue) remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.ids, id)
+}
+
+// queued reports whether the delete of id failed and is waiting for a retry
+func (q *deleteQueue) queued(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.ids[id]
+}
+
+// pending returns the queued IDs in order
+func (q *deleteQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := make([]string, 0, len(q.ids))
+	for id := range q.ids {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// deleteSession deletes a gateway session, counted as in flight meanwhile. A failed delete, e.g. one the
+// circuit breaker rejected, is queued and retried every sync cycle until it succeeds.
+func (m *LocalSessionManager) deleteSession(ctx context.Context, id string) error {
+	m.loop.deleting.Add(1)
+	defer m.loop.deleting.Add(-1)
+	err := m.anboxClient.Delete(ctx, id)
+	if err != nil && !deletedAlready(err) {
+		m.deletes.add(id)
+	}
+	return err
+}
+
+// retryDeletes retries the deletes that failed before, the sessions are no longer cached
+func (m *LocalSessionManager) retryDeletes(ctx context.Context) {
+	for _, id := range m.deletes.pending() {
+		if !m.anboxClient.Available() {
+			return
+		}
+		m.loop.deleting.Add(1)
+		err := m.anboxClient.Delete(ctx, id)
+		m.loop.deleting.Add(-1)
+		if err != nil && !deletedAlready(err) {
+			logger.Warnf("retrying the delete of anbox session %s of game %s failed: %v", id, m.cfg.GameName, err)
+			continue
+		}
+		m.deletes.remove(id)
+		logger.Infof("deleted anbox session %s of game %s on retry", id, m.cfg.GameName)
+	}
+}
+
+// deletedAlready reports whether a delete failed because the gateway no longer knows the session
+func deletedAlready(err error) bool {
+	var apiErr *anbox.APIError
+	return errors.As(err, &apiErr) && apiErr.Category == anbox.ErrorCategoryNotFound
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultGuaranteeCheckInterval is how often the warmed count is compared against MinWarmedGuarantee
+const DefaultGuaranteeCheckInterval = time.Second
+
+// GuaranteeEventKind tells a breach of the warmed-session guarantee from its recovery
+type GuaranteeEventKind string
+
+const (
+	GuaranteeBreached  GuaranteeEventKind = "breached"  // warmed sessions stayed below the guarantee for GuaranteeBreachAfter
+	GuaranteeRecovered GuaranteeEventKind = "recovered" // warmed sessions are back at the guarantee after a breach
+)
+
+// GuaranteeEvent reports a breach of MinWarmedGuarantee or its recovery
+type GuaranteeEvent struct {
+	Time       time.Time          `json:"time"`
+	Game       string             `json:"game"`
+	Kind       GuaranteeEventKind `json:"kind"`
+	Warmed     int                `json:"warmed"`
+	Guarantee  int                `json:"guarantee"`
+	BelowSince time.Time          `json:"below_since"`
+	Duration   time.Duration      `json:"duration_ns"` // how long warmed sessions were below the guarantee so far
+}
+
+// GuaranteeNotifier receives the breach and recovery events of the warmed-session guarantee.
+// Notify is called with the manager lock held and must neither block nor call back into the manager.
+type GuaranteeNotifier interface {
+	Notify(event GuaranteeEvent)
+}
+
+// WithGuaranteeNotifier makes the manager send guarantee events to notifier, they are logged either way
+func WithGuaranteeNotifier(notifier GuaranteeNotifier) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.guarantee.notifier = notifier
+	}
+}
+
+// guaranteeMonitor remembers since when the warmed count is below MinWarmedGuarantee
+type guaranteeMonitor struct {
+	belowSince time.Time // zero while the guarantee is met
+	breached   bool      // the breach lasted GuaranteeBreachAfter and was reported
+	notifier   GuaranteeNotifier
+}
+
+// backgroundGuaranteeMonitor runs checkGuarantee every DefaultGuaranteeCheckInterval until the manager stops
+func (m *LocalSessionManager) backgroundGuaranteeMonitor(ctx context.Context) {
+	ticker := time.NewTicker(DefaultGuaranteeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.syncStopCh:
+			return
+		case <-ticker.C:
+			m.checkGuarantee()
+		}
+	}
+}
+
+// checkGuarantee reports a breach once warmed sessions stayed below MinWarmedGuarantee for GuaranteeBreachAfter
+// and a recovery once they are back. The guarantee is not checked while the pool is paused or draining.
+func (m *LocalSessionManager) checkGuarantee() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	guarantee := m.cfg.MinWarmedGuarantee
+	g := &m.guarantee
+	if guarantee <= 0 {
+		return
+	}
+	if m.paused || m.draining {
+		// Time spent paused does not count towards a breach, one already reported stays open
+		if !g.breached {
+			g.belowSince = time.Time{}
+		}
+		return
+	}
+
+	now := m.clock.Now()
+	warmed := m.countLocked(Warmed)
+	if warmed >= guarantee {
+		if g.breached {
+			m.notifyGuaranteeLocked(GuaranteeRecovered, now, warmed)
+			logger.Infof("warmed session guarantee recovered: game=%s warmed=%d guarantee=%d after=%s", m.cfg.GameName, warmed, guarantee, now.Sub(g.belowSince))
+		}
+		g.belowSince = time.Time{}
+		g.breached = false
+		return
+	}
+
+	if g.belowSince.IsZero() {
+		g.belowSince = now
+	}
+	if g.breached || now.Sub(g.belowSince) < m.cfg.GuaranteeBreachAfter {
+		return
+	}
+	g.breached = true
+	m.counters.guaranteeBreaches.Add(1)
+	m.notifyGuaranteeLocked(GuaranteeBreached, now, warmed)
+	logger.Warnf("warmed session guarantee breached: game=%s warmed=%d guarantee=%d for=%s", m.cfg.GameName, warmed, guarantee, now.Sub(g.belowSince))
+}
+
+// notifyGuaranteeLocked sends a guarantee event to the notifier. Callers must hold m.mu.
+func (m *LocalSessionManager) notifyGuaranteeLocked(kind GuaranteeEventKind, now time.Time, warmed int) {
+	if m.guarantee.notifier == nil {
+		return
+	}
+	m.guarantee.notifier.Notify(GuaranteeEvent{
+		Time:       now,
+		Game:       m.cfg.GameName,
+		Kind:       kind,
+		Warmed:     warmed,
+		Guarantee:  m.cfg.MinWarmedGuarantee,
+		BelowSince: m.guarantee.belowSince,
+		Duration:   now.Sub(m.guarantee.belowSince),
+	})
+}
+
+// countLocked counts the sessions in status. Callers must hold m.mu.
+func (m *LocalSessionManager) countLocked(status SessionStatus) int {
+	count := 0
+	for _, session := range m.cache {
+		if session.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// guaranteeBreachedSinceLocked is when the ongoing guarantee breach started, nil while none is reported.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) guaranteeBreachedSinceLocked() *time.Time {
+	if !m.guarantee.breached {
+		return nil
+	}
+	since := m.guarantee.belowSince
+	return &since
+}
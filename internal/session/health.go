@@ -0,0 +1,149 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/quick/logger"
+)
+
+// backgroundHealthSweep runs healthSweep every HealthSweepInterval until the manager stops
+func (m *LocalSessionManager) backgroundHealthSweep(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.HealthSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.syncStopCh:
+			return
+		case <-ticker.C:
+			m.healthSweep(ctx)
+		}
+	}
+}
+
+// gatewayAbsentReason is the reclaim reason of sessions the gateway no longer knows
+const gatewayAbsentReason = "gateway_session_absent"
+
+// healthSweep asks the gateway about every cached session and reclaims the ones it reports as failed or,
+// for HealthAbsentSweeps sweeps in a row, no longer knows
+func (m *LocalSessionManager) healthSweep(ctx context.Context) {
+	m.mu.RLock()
+	targets := make(map[string]string, len(m.cache))
+	for id, session := range m.cache {
+		targets[id] = anboxID(session)
+	}
+	m.mu.RUnlock()
+
+	concurrency := m.cfg.HealthSweepConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for id, gatewayID := range targets {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(id, gatewayID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reason, dead, checked := m.gatewaySessionDead(ctx, gatewayID)
+			switch {
+			case reason == gatewayAbsentReason:
+				m.sweptAbsent(id)
+			case dead:
+				m.reclaimDead(id, reason)
+			case checked:
+				m.sweptPresent(id)
+			}
+		}(id, gatewayID)
+	}
+	wg.Wait()
+}
+
+// gatewaySessionDead reports whether the gateway says a session is gone and whether it answered at all,
+// lookups that fail for other reasons keep the session
+func (m *LocalSessionManager) gatewaySessionDead(ctx context.Context, gatewayID string) (reason string, dead, checked bool) {
+	details, err := m.anboxClient.GetSession(ctx, gatewayID)
+	if err != nil {
+		if category, ok := anbox.ErrorCategoryOf(err); ok && category == anbox.ErrorCategoryNotFound {
+			return gatewayAbsentReason, true, true
+		}
+		logger.Warnf("health sweep could not check gateway session %s: %v", gatewayID, err)
+		return "", false, false
+	}
+	if isFailedGatewayStatus(details.Status) {
+		return "gateway_session_" + details.Status, true, true
+	}
+	return "", false, true
+}
+
+// sweptAbsent counts a sweep the gateway did not know the session and reclaims it after HealthAbsentSweeps in a row
+func (m *LocalSessionManager) sweptAbsent(id string) {
+	m.mu.Lock()
+	session, exists := m.cache[id]
+	if !exists {
+		m.mu.Unlock()
+		return
+	}
+	session.absentSweeps++
+	if session.absentSweeps < m.cfg.HealthAbsentSweeps {
+		logger.Warnf("gateway does not know session %s of game %s (%d/%d sweeps), keeping it", id, m.cfg.GameName, session.absentSweeps, m.cfg.HealthAbsentSweeps)
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+	m.reclaimDead(id, gatewayAbsentReason)
+}
+
+// sweptPresent resets the absences of a session the gateway knows again
+func (m *LocalSessionManager) sweptPresent(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, exists := m.cache[id]; exists {
+		session.absentSweeps = 0
+	}
+}
+
+// reclaimDead removes a session the gateway reported dead and deletes what is left of it. A failed delete is
+// queued by deleteSession and retried every sync cycle, so the instance is not leaked once the session is uncached.
+func (m *LocalSessionManager) reclaimDead(id, reason string) {
+	m.mu.Lock()
+	session, exists := m.cache[id]
+	if !exists {
+		m.mu.Unlock()
+		return
+	}
+	m.counters.healthMismatch.Add(1)
+	m.removeLocked(session, SystemActor, reason, ReleaseErrored)
+	m.mu.Unlock()
+
+	logger.Warnf("health sweep reclaimed %s session %s of game %s: %s", session.Status, id, m.cfg.GameName, reason)
+	if session.Anbox != nil {
+		if err := m.deleteSession(context.Background(), session.Anbox.ID); err != nil {
+			logger.Errorf("failed to delete dead anbox session %s: %v", session.Anbox.ID, err)
+		}
+	}
+}
+
+// isFailedGatewayStatus reports whether a gateway session status means it can no longer be streamed
+func isFailedGatewayStatus(status string) bool {
+	switch status {
+	case "error", "failed", "terminated", "stopped":
+		return true
+	}
+	return false
+}
+
+// anboxID returns the gateway ID of a session
+func anboxID(session *Session) string {
+	if session.Anbox != nil {
+		return session.Anbox.ID
+	}
+	return session.ID
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused for another operation or by another
+// caller, or the session it acquired moved on since
+var ErrIdempotencyConflict = errors.New("idempotency key conflict")
+
+// Acquire operations an idempotency key is bound to, AcquireSpecific and on-demand acquires are warmed acquires
+const (
+	opAcquireCold   = "acquire_cold"
+	opAcquireWarmed = "acquire_warmed"
+)
+
+// idempotentAcquire remembers which session an idempotency key acquired, for which operation and caller
+type idempotentAcquire struct {
+	sessionID string
+	operation string
+	apiKey    string
+	expiresAt time.Time
+}
+
+// WithIdempotencyKey makes a repeated acquire with the same key return the same session
+// instead of consuming another one, for as long as IdempotencyTTL
+func WithIdempotencyKey(key string) AcquireOption {
+	return func(o *acquireOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// replayLocked returns the session previously acquired with the key of options, if it is still around.
+// The replay must be the same operation by the same API key, for wantID the same session, and the session
+// must still be in the status the original acquire left it in, otherwise it fails with ErrIdempotencyConflict.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) replayLocked(options *acquireOptions, operation, wantID string) (*Session, bool, error) {
+	key := options.idempotencyKey
+	if key == "" {
+		return nil, false, nil
+	}
+	acquired, exists := m.idempotencyKeys[key]
+	if !exists || m.clock.Now().After(acquired.expiresAt) {
+		return nil, false, nil
+	}
+	session, exists := m.cache[acquired.sessionID]
+	if !exists {
+		return nil, false, nil
+	}
+
+	switch {
+	case acquired.apiKey != options.apiKey:
+		return nil, false, fmt.Errorf("%w: the key was used by another caller", ErrIdempotencyConflict)
+	case acquired.operation != operation:
+		return nil, false, fmt.Errorf("%w: the key was used for %s", ErrIdempotencyConflict, acquired.operation)
+	case wantID != "" && acquired.sessionID != wantID:
+		return nil, false, fmt.Errorf("%w: the key acquired another session", ErrIdempotencyConflict)
+	}
+	want := InUse
+	if operation == opAcquireCold {
+		want = Warming
+	}
+	if session.Status != want {
+		return nil, false, fmt.Errorf("%w: session %s acquired with the key is %s by now", ErrIdempotencyConflict, session.ID, session.Status)
+	}
+	return session.snapshot(), true, nil
+}
+
+// recordLocked remembers that the key of options acquired sessionID with operation. Callers must hold m.mu.
+func (m *LocalSessionManager) recordLocked(options *acquireOptions, operation, sessionID string) {
+	if options.idempotencyKey == "" {
+		return
+	}
+	m.idempotencyKeys[options.idempotencyKey] = idempotentAcquire{
+		sessionID: sessionID,
+		operation: operation,
+		apiKey:    options.apiKey,
+		expiresAt: m.clock.Now().Add(m.cfg.IdempotencyTTL),
+	}
+}
+
+// expireIdempotencyKeysLocked forgets keys older than IdempotencyTTL. Callers must hold m.mu.
+func (m *LocalSessionManager) expireIdempotencyKeysLocked(now time.Time) {
+	for key, acquired := range m.idempotencyKeys {
+		if now.After(acquired.expiresAt) {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+}
+
+// forgetIdempotencyKeysLocked drops the keys that acquired sessionID. Callers must hold m.mu.
+func (m *LocalSessionManager) forgetIdempotencyKeysLocked(sessionID string) {
+	for key, acquired := range m.idempotencyKeys {
+		if acquired.sessionID == sessionID {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package session
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -18,15 +21,67 @@ type LocalSessionManager struct {
 	cfg         *Config
 	syncStopCh  chan struct{}
 	started     bool
+	// creation is paused until createBackoffUntil after a capacity error,
+	// and halted entirely after a permanent error such as a missing app
+	createBackoffUntil time.Time
+	createHaltErr      error
+	createHaltedAt     time.Time
+	// createFailureStreak counts creation failures since the last success, each one doubles the backoff.
+	// createBackoffCapped is set once the backoff reached CreateBackoffMax, so that is only logged once.
+	createFailureStreak int
+	createBackoffCapped bool
+	// pendingCreations counts on-demand and batch creations in flight, they are not in the cache yet
+	pendingCreations int
+	// draining is set once Drain is called, no session is handed out or created afterwards
+	draining bool
+	// booting and errored are this replica's instances of the game AMS reported as not running on the last reap
+	booting int
+	errored map[string]bool
+	// paused is set between Pause and Resume, no session is handed out or created meanwhile
+	paused    bool
+	counters  counters
+	createdAt time.Time
+	// idempotencyKeys maps acquire idempotency keys to the session they acquired
+	idempotencyKeys map[string]idempotentAcquire
+	// clock is read for every expiry, timeout and backoff decision
+	clock Clock
+	// audit receives every session transition, nil disables auditing
+	audit AuditSink
+	// warmupRunner runs the warm-up actions in instances, nil runs them through the anbox client
+	warmupRunner WarmupRunner
+	// warmupEstimate is the moving average of how long warm-ups took, 0 until the first SetWarmed
+	warmupEstimate time.Duration
+	// starvation counts recent empty acquires, it has its own lock as they are recorded with and without m.mu
+	starvation starvationTracker
+	// capacity is the budget shared with the other games, nil when only Max applies
+	capacity CapacityBudget
+	// releaseReasons counts the sessions that left the pool by why they left
+	releaseReasons map[ReleaseReason]int64
+	// releases is told about every in-use session that leaves the pool, nil tells no one
+	releases ReleaseNotifier
+	// guarantee tracks breaches of MinWarmedGuarantee
+	guarantee guaranteeMonitor
+	// loop records the progress of backgroundSync and the creations and deletes in flight
+	loop loopTracker
+	// deletes queues the anbox sessions whose delete failed for a retry
+	deletes deleteQueue
 }
 
-func NewLocalSessionManager(cfg *Config, anboxClient AnboxClient) *LocalSessionManager {
-	return &LocalSessionManager{
-		cache:       make(map[string]*Session),
-		anboxClient: anboxClient,
-		cfg:         cfg,
-		syncStopCh:  make(chan struct{}),
+func NewLocalSessionManager(cfg *Config, anboxClient AnboxClient, opts ...ManagerOption) *LocalSessionManager {
+	m := &LocalSessionManager{
+		cache:           make(map[string]*Session),
+		idempotencyKeys: make(map[string]idempotentAcquire),
+		releaseReasons:  make(map[ReleaseReason]int64),
+		anboxClient:     anboxClient,
+		cfg:             cfg,
+		syncStopCh:      make(chan struct{}),
+		clock:           realClock{},
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.createdAt = m.clock.Now()
+	return m
 }
 
 // Init initializes the session manager with configuration
@@ -35,9 +90,18 @@ func (m *LocalSessionManager) Init(ctx context.Context, cfg *Config) error {
 	defer m.mu.Unlock()
 
 	m.cfg = cfg
+	// The new configuration may well fix what halted creation
+	m.createHaltErr = nil
 	return nil
 }
 
+// Config returns the configuration the session manager is running with
+func (m *LocalSessionManager) Config() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg
+}
+
 // Start begins the session management background processes
 func (m *LocalSessionManager) Start(ctx context.Context) error {
 	m.mu.Lock()
@@ -51,6 +115,12 @@ func (m *LocalSessionManager) Start(ctx context.Context) error {
 
 	// Start background sync goroutine for running sessions
 	go m.backgroundSync(ctx)
+	if m.cfg.HealthSweepInterval > 0 {
+		go m.backgroundHealthSweep(ctx)
+	}
+	if m.cfg.MinWarmedGuarantee > 0 {
+		go m.backgroundGuaranteeMonitor(ctx)
+	}
 
 	// Initial pool setup: sync existing sessions and ensure minimum
 	go func() {
@@ -58,8 +128,18 @@ func (m *LocalSessionManager) Start(ctx context.Context) error {
 		if err := m.syncRunningSession(context.Background()); err != nil {
 			logger.Errorf("failed to sync running sessions during startup: %v", err)
 		}
+		// Warming workers start once the synced sessions are there to be warmed
+		if m.cfg.warmsOnServer() {
+			for range m.cfg.WarmingWorkers {
+				go m.warmingWorker(ctx)
+			}
+		}
 
-		// Then ensure minimum pool size
+		// Then ensure minimum pool size, in parallel if warmup concurrency is configured
+		if m.cfg.WarmupConcurrency > 1 {
+			m.warmupPool(context.Background())
+			return
+		}
 		if err := m.ensureMinPoolSize(context.Background()); err != nil {
 			logger.Errorf("failed to ensure min pool size during startup: %v", err)
 		}
@@ -84,108 +164,415 @@ func (m *LocalSessionManager) Stop(ctx context.Context) error {
 }
 
 // AcquireCold gets a cold session and changes status cold -> warming
-func (m *LocalSessionManager) AcquireCold(ctx context.Context) (*Session, error) {
+func (m *LocalSessionManager) AcquireCold(ctx context.Context, opts ...AcquireOption) (*Session, error) {
+	options, err := newAcquireOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if options.profile, err = m.cfg.resolveProfile(options.profile); err != nil {
+		return nil, err
+	}
+	if !m.anboxClient.Available() {
+		return nil, anbox.ErrUpstreamUnavailable
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.draining {
+		return nil, ErrDraining
+	}
+	if m.paused {
+		return nil, ErrPaused
+	}
+
+	if session, replayed, err := m.replayLocked(options, opAcquireCold, ""); replayed || err != nil {
+		return session, err
+	}
+	// A retry by the same warm worker of the same API key gets the session it is already warming
+	if session := m.heldByOwnerLocked(options.warmOwner, options.apiKey, options.profile); session != nil {
+		session.LastHeartbeat = m.clock.Now()
+		return session.snapshot(), nil
+	}
+	if err := m.checkQuotaLocked(options.apiKey); err != nil {
+		return nil, err
+	}
+
 	// Find a cold session
 	for _, session := range m.cache {
-		if session.Status == Cold {
+		if session.Status == Cold && session.Profile == options.profile && m.launchedLocked(session) {
 			// Change status to warming
+			m.auditLocked(session, session.Status, Warming, acquireActor(ctx, options), "acquire_cold")
 			session.Status = Warming
-			session.LastHeartbeat = time.Now()
-			return session, nil
+			session.StatusChangedAt = m.clock.Now()
+			session.LastHeartbeat = m.clock.Now()
+			session.Metadata = mergeMetadata(session.Metadata, options.metadata)
+			session.APIKey = options.apiKey
+			session.WarmToken = newWarmToken()
+			session.WarmOwner = options.warmOwner
+			m.recordLocked(options, opAcquireCold, session.ID)
+			m.counters.acquireSuccess.Add(1)
+			return session.snapshot(), nil
 		}
 	}
 
-	return nil, fmt.Errorf("no cold sessions available")
+	m.recordAcquireEmpty()
+	return nil, m.poolEmptyLocked(Cold, options.profile, "no cold sessions available")
 }
 
-// SetWarmed changes session status from warming -> warmed
-func (m *LocalSessionManager) SetWarmed(ctx context.Context, id string) error {
+// SetWarmed changes session status from warming -> warmed, only for the caller holding the warm token
+// AcquireCold returned with the session. Repeating it with that token once the session is warmed succeeds.
+// With WarmupActions it returns once they ran, the session is reclaimed when one fails.
+func (m *LocalSessionManager) SetWarmed(ctx context.Context, id, warmToken string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	run, err := m.setWarmedLocked(ctx, id, warmToken)
+	m.mu.Unlock()
+	if err != nil || run == nil {
+		return err
+	}
+
+	// The warm-up runs on without the caller, a retry with the token gets its outcome
+	select {
+	case <-run.done:
+		return run.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
+// setWarmedLocked promotes the warming session to warmed, or starts its warm-up actions and returns the
+// run to wait for. Callers must hold m.mu.
+func (m *LocalSessionManager) setWarmedLocked(ctx context.Context, id, warmToken string) (*warmupRun, error) {
 	// Find session and check if it's warming
 	session, exists := m.cache[id]
 	if !exists {
-		return fmt.Errorf("session %s not found", id)
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
 	}
 
+	if warmedWithToken(session, warmToken) {
+		// A concurrent or retried call by the same warm worker, the session is already warmed
+		return nil, nil
+	}
 	if session.Status != Warming {
-		return fmt.Errorf("session %s is not in warming status, current status: %s", id, session.Status)
+		return nil, fmt.Errorf("%w: session %s is not in warming status, current status: %s", ErrInvalidState, id, session.Status)
+	}
+	if !validWarmToken(session, warmToken) {
+		return nil, fmt.Errorf("%w for session %s", ErrInvalidWarmToken, id)
+	}
+
+	if session.warmup != nil {
+		return session.warmup, nil
+	}
+	if len(m.cfg.WarmupActions) > 0 {
+		session.warmup = &warmupRun{done: make(chan struct{})}
+		go m.warmUp(context.WithoutCancel(ctx), id, warmToken, session.warmup)
+		return session.warmup, nil
 	}
 
-	// Change status to warmed
+	m.promoteLocked(ctx, session)
+	return nil, nil
+}
+
+// promoteLocked changes a warming session to warmed. Callers must hold m.mu.
+func (m *LocalSessionManager) promoteLocked(ctx context.Context, session *Session) {
+	m.auditLocked(session, session.Status, Warmed, ActorFromContext(ctx), "set_warmed")
+	m.observeWarmupLocked(m.clock.Now().Sub(session.StatusChangedAt))
 	session.Status = Warmed
-	session.LastHeartbeat = time.Now()
+	session.StatusChangedAt = m.clock.Now()
+	session.LastHeartbeat = m.clock.Now()
+	session.warmedToken = session.WarmToken
+	session.WarmToken = ""
+	session.WarmOwner = ""
+}
+
+// AbandonWarming changes session status from warming -> cold so another client can warm it,
+// without deleting the underlying anbox instance. Only the caller holding the warm token may abandon it,
+// and not while its warm-up actions still run against the instance.
+func (m *LocalSessionManager) AbandonWarming(ctx context.Context, id, warmToken string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	session, exists := m.cache[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if session.Status != Warming {
+		return fmt.Errorf("%w: session %s is not in warming status, current status: %s", ErrInvalidState, id, session.Status)
+	}
+	if !validWarmToken(session, warmToken) {
+		return fmt.Errorf("%w for session %s", ErrInvalidWarmToken, id)
+	}
+	if session.warmup != nil {
+		return fmt.Errorf("%w: session %s is running its warm-up actions", ErrInvalidState, id)
+	}
+
+	m.revertToColdLocked(session, ActorFromContext(ctx), "abandon_warming")
 	return nil
 }
 
-// AcquireWarmed gets a warmed session and changes status warmed -> in_use
-func (m *LocalSessionManager) AcquireWarmed(ctx context.Context) (*Session, error) {
+// AcquireWarmed gets a warmed session and changes status warmed -> in_use.
+// When the pool has no warmed session and OnDemand is enabled, a session is created synchronously.
+func (m *LocalSessionManager) AcquireWarmed(ctx context.Context, opts ...AcquireOption) (*Session, error) {
+	options, err := newAcquireOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if options.profile, err = m.cfg.resolveProfile(options.profile); err != nil {
+		return nil, err
+	}
+	if !m.anboxClient.Available() {
+		return nil, anbox.ErrUpstreamUnavailable
+	}
+
+	session, err := m.acquireWarmed(acquireActor(ctx, options), options)
+	if err == nil || errors.Is(err, ErrDraining) || errors.Is(err, ErrPaused) || errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrIdempotencyConflict) {
+		return session, err
+	}
+	if !m.cfg.OnDemand {
+		m.recordAcquireEmpty()
+		return nil, err
+	}
+	return m.acquireOnDemand(ctx, options)
+}
+
+// acquireWarmed hands out a warmed session from the pool
+func (m *LocalSessionManager) acquireWarmed(actor string, options *acquireOptions) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.draining {
+		return nil, ErrDraining
+	}
+	if m.paused {
+		return nil, ErrPaused
+	}
+
+	if session, replayed, err := m.replayLocked(options, opAcquireWarmed, ""); replayed || err != nil {
+		return session, err
+	}
+	if err := m.checkQuotaLocked(options.apiKey); err != nil {
+		return nil, err
+	}
+
 	// Find a warmed session
 	for _, session := range m.cache {
-		if session.Status == Warmed {
-			// Change status to in_use
-			session.Status = InUse
-			session.ExpiresAt = time.Now().Add(m.cfg.SessionTTL)
-			session.LastHeartbeat = time.Now()
-			return session, nil
+		if session.Status == Warmed && session.Profile == options.profile {
+			m.handOutLocked(session, actor, "acquire_warmed", options)
+			return session.snapshot(), nil
 		}
 	}
 
-	return nil, fmt.Errorf("no warmed sessions available")
+	return nil, m.poolEmptyLocked(Warmed, options.profile, "no warmed sessions available")
 }
 
-// Release deletes a session completely
-func (m *LocalSessionManager) Release(ctx context.Context, id string) error {
+// AcquireSpecific hands out the warmed session id, e.g. one an orchestrator picked for a player.
+// It fails with ErrSessionNotFound for an unknown session and ErrInvalidState for one that is not warmed.
+func (m *LocalSessionManager) AcquireSpecific(ctx context.Context, id string, opts ...AcquireOption) (*Session, error) {
+	options, err := newAcquireOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if !m.anboxClient.Available() {
+		return nil, anbox.ErrUpstreamUnavailable
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.draining {
+		return nil, ErrDraining
+	}
+	if m.paused {
+		return nil, ErrPaused
+	}
+	if session, replayed, err := m.replayLocked(options, opAcquireWarmed, id); replayed || err != nil {
+		return session, err
+	}
+
 	session, exists := m.cache[id]
 	if !exists {
-		return fmt.Errorf("session %s not found", id)
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if session.Status != Warmed {
+		return nil, fmt.Errorf("%w: session %s is %s, not warmed", ErrInvalidState, id, session.Status)
+	}
+	if err := m.checkQuotaLocked(options.apiKey); err != nil {
+		return nil, err
 	}
 
-	// Remove from cache
-	delete(m.cache, id)
+	m.handOutLocked(session, acquireActor(ctx, options), "acquire_specific", options)
+	return session.snapshot(), nil
+}
+
+// handOutLocked changes a warmed session to in_use for the acquire it was picked by.
+// Callers must hold m.mu, the same lock cleanupExpired takes so it sees the fresh heartbeat.
+func (m *LocalSessionManager) handOutLocked(session *Session, actor, transition string, options *acquireOptions) {
+	now := m.clock.Now()
+	m.auditLocked(session, session.Status, InUse, actor, transition)
+	session.Status = InUse
+	session.StatusChangedAt = now
+	session.ExpiresAt = now.Add(m.cfg.SessionTTL)
+	session.LastHeartbeat = now
+	session.Metadata = mergeMetadata(session.Metadata, options.metadata)
+	session.APIKey = options.apiKey
+	m.recordLocked(options, opAcquireWarmed, session.ID)
+	m.counters.acquireSuccess.Add(1)
+}
+
+// acquireOnDemand creates a session synchronously and hands it out as in_use.
+// It honours Max and the creation backoff the same way the background pool filling does.
+func (m *LocalSessionManager) acquireOnDemand(ctx context.Context, options *acquireOptions) (*Session, error) {
+	m.mu.Lock()
+	if m.draining {
+		m.mu.Unlock()
+		return nil, ErrDraining
+	}
+	if m.paused {
+		m.mu.Unlock()
+		return nil, ErrPaused
+	}
+	if total := len(m.cache) + m.pendingCreations; total >= m.cfg.Max && !m.evictLocked() {
+		err := m.poolEmptyLocked(Warmed, options.profile, "no warmed sessions available and session pool is at maximum capacity (%d)", m.cfg.Max)
+		m.mu.Unlock()
+		m.recordAcquireEmpty()
+		return nil, err
+	}
+	if m.createHaltedLocked() {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("session creation is halted: %w", m.createHaltErr)
+	}
+	if until := m.createBackoffUntil; m.clock.Now().Before(until) {
+		err := m.backoffEmptyLocked(options.profile, until)
+		m.mu.Unlock()
+		return nil, err
+	}
+	if m.reserveCapacityLocked(1) == 0 {
+		err := m.poolEmptyLocked(Warmed, options.profile, "no warmed sessions available and the session budget shared with other games is used up")
+		m.mu.Unlock()
+		m.recordAcquireEmpty()
+		return nil, err
+	}
+	m.pendingCreations++
+	m.mu.Unlock()
+
+	createCtx := ctx
+	if m.cfg.OnDemandTimeout > 0 {
+		var cancel context.CancelFunc
+		createCtx, cancel = context.WithTimeout(ctx, m.cfg.OnDemandTimeout)
+		defer cancel()
+	}
+
+	details, err := m.anboxClient.Create(createCtx, m.newCreateRequest(options.profile))
+	if err == nil && m.cfg.CreateVerifyTimeout > 0 {
+		// The gateway may answer while the session is still starting, it only counts once it runs
+		details, err = m.verifyCreated(ctx, details)
+	}
+	if err == nil && m.cfg.LaunchApp {
+		details, err = m.launchCreated(ctx, details)
+	}
+	if err == nil && len(m.cfg.WarmupActions) > 0 {
+		// The session skips the pool, it is warmed here so the client does not get the boot screen
+		details, err = m.warmUpCreated(ctx, details)
+	}
+
+	m.mu.Lock()
+	m.pendingCreations--
+	if err != nil {
+		m.mu.Unlock()
+		m.handleCreateError(err)
+		return nil, fmt.Errorf("failed to create on-demand session: %w", err)
+	}
+	defer m.mu.Unlock()
+	m.resetCreateBackoffLocked()
+
+	now := m.clock.Now()
+	session := &Session{
+		ID:              details.ID,
+		Game:            m.cfg.GameName,
+		Status:          Warmed,
+		Profile:         options.profile,
+		StatusChangedAt: now,
+		Anbox:           details,
+		GatewayURL:      m.anboxClient.GetGatewayURL(),
+		AuthToken:       m.anboxClient.GetAuthToken(),
+		ExpiresAt:       now.Add(m.cfg.SessionTTL),
+		LastHeartbeat:   now,
+		CreatedAt:       now,
+		ReadyAt:         now,
+		AppLaunched:     m.cfg.LaunchApp,
+	}
+	m.cache[session.ID] = session
+	m.counters.created.Add(1)
+	m.auditLocked(session, "", Warmed, acquireActor(ctx, options), "created_on_demand")
+
+	// A retry with the same key acquired while we were creating, keep the new session in the pool
+	if replay, replayed, err := m.replayLocked(options, opAcquireWarmed, ""); replayed || err != nil {
+		return replay, err
+	}
 
-	// Delete from anbox
-	if session.Anbox != nil {
-		// Use background context to avoid cancellation issues
-		return m.anboxClient.Delete(context.Background(), session.Anbox.ID)
+	m.auditLocked(session, session.Status, InUse, acquireActor(ctx, options), "acquire_warmed")
+	session.Status = InUse
+	session.StatusChangedAt = m.clock.Now()
+	session.Metadata = mergeMetadata(nil, options.metadata)
+	session.APIKey = options.apiKey
+	m.recordLocked(options, opAcquireWarmed, session.ID)
+	m.counters.acquireSuccess.Add(1)
+
+	logger.Infof("acquireOnDemand created session %s for game %s", session.ID, m.cfg.GameName)
+	return session.snapshot(), nil
+}
+
+// Release deletes a session completely, reason is recorded in the stats and the audit log
+func (m *LocalSessionManager) Release(ctx context.Context, id string, reason ReleaseReason) error {
+	m.mu.Lock()
+	session, exists := m.cache[id]
+	if !exists {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	// Remove from cache
+	m.counters.released.Add(1)
+	m.removeLocked(session, ActorFromContext(ctx), "release", reason)
+	details := session.Anbox
+	m.mu.Unlock()
+
+	// Delete from anbox without holding m.mu, a hung gateway must not stall the game. The caller going away
+	// does not cancel it, DefaultDeleteTimeout bounds it and deleteSession queues it for a retry when it fails.
+	if details != nil {
+		deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultDeleteTimeout)
+		defer cancel()
+		return m.deleteSession(deleteCtx, details.ID)
 	}
 
 	return nil
 }
 
-// GetSession retrieves a session by ID
+// GetSession returns a copy of the session id
 func (m *LocalSessionManager) GetSession(ctx context.Context, id string) (*Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	session, exists := m.cache[id]
 	if !exists {
-		return nil, fmt.Errorf("session %s not found", id)
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
 	}
 
-	return session, nil
+	return session.snapshot(), nil
 }
 
-// ListSessions returns all sessions with the specified status order by status
-func (m *LocalSessionManager) ListSessions(ctx context.Context) ([]*Session, error) {
+// ListSessions returns copies of the sessions in any of statuses, every session without statuses, ordered by status
+func (m *LocalSessionManager) ListSessions(ctx context.Context, statuses ...SessionStatus) ([]*Session, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	sessions := make([]*Session, 0)
+	sessions := make([]*Session, 0, len(m.cache))
 	for _, session := range m.cache {
-		sessions = append(sessions, session)
+		if len(statuses) > 0 && !slices.Contains(statuses, session.Status) {
+			continue
+		}
+		sessions = append(sessions, session.snapshot())
 	}
+	m.mu.RUnlock()
 
 	sort.Slice(sessions, func(i, j int) bool {
 		if sessions[i].Status == Cold {
@@ -225,24 +612,264 @@ func (m *LocalSessionManager) Heartbeat(ctx context.Context, id string) error {
 
 	session, exists := m.cache[id]
 	if !exists {
-		return fmt.Errorf("session %s not found", id)
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	session.LastHeartbeat = m.clock.Now()
+	return nil
+}
+
+// Extend pushes the ExpiresAt of an in-use session out by by, at most to MaxInUseDuration after it was acquired.
+// An extension that would pass the cap is shortened to it, one asked for at the cap fails with ErrExtensionLimit.
+func (m *LocalSessionManager) Extend(ctx context.Context, id string, by time.Duration) error {
+	if by <= 0 {
+		return fmt.Errorf("extension must be positive, got %s", by)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.draining {
+		return ErrDraining
+	}
+	session, exists := m.cache[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if session.Status != InUse {
+		return fmt.Errorf("%w: session %s is %s, not %s", ErrInvalidState, id, session.Status, InUse)
 	}
 
-	session.LastHeartbeat = time.Now()
+	limit := session.StatusChangedAt.Add(m.cfg.maxInUseDuration())
+	if !session.ExpiresAt.Before(limit) {
+		return fmt.Errorf("%w: session %s already expires at %s, %s after it was acquired", ErrExtensionLimit, id, session.ExpiresAt.Format(time.RFC3339), m.cfg.maxInUseDuration())
+	}
+	expiresAt := session.ExpiresAt.Add(by)
+	if expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	granted := expiresAt.Sub(session.ExpiresAt)
+	logger.Infof("extended session %s of game %s by %s to %s", id, m.cfg.GameName, granted, expiresAt.Format(time.RFC3339))
+	session.ExpiresAt = expiresAt
+	session.Extended += granted
 	return nil
 }
 
+// HeartbeatPolicy asks for a heartbeat every third of HeartbeatTimeout, so two lost beats do not release the session
+func (m *LocalSessionManager) HeartbeatPolicy() HeartbeatPolicy {
+	return HeartbeatPolicy{Interval: m.cfg.HeartbeatTimeout / 3, Timeout: m.cfg.HeartbeatTimeout}
+}
+
+// revertToColdLocked returns a warming session to the cold pool, dropping what its
+// previous client attached to it. Callers must hold m.mu.
+func (m *LocalSessionManager) revertToColdLocked(session *Session, actor, reason string) {
+	m.auditLocked(session, session.Status, Cold, actor, reason)
+	session.Status = Cold
+	session.StatusChangedAt = m.clock.Now()
+	session.Metadata = nil
+	session.APIKey = ""
+	session.WarmToken = ""
+	session.WarmOwner = ""
+	session.warmedToken = ""
+	session.warmup = nil
+	m.forgetIdempotencyKeysLocked(session.ID)
+}
+
+// SetMetadata merges kv into the session metadata, an empty value removes the key
+func (m *LocalSessionManager) SetMetadata(ctx context.Context, id string, kv map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.cache[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if err := validateMetadata(session.Metadata, kv); err != nil {
+		return err
+	}
+	session.Metadata = mergeMetadata(session.Metadata, kv)
+	return nil
+}
+
+// Drain stops handing out and creating sessions, marks in-use sessions as ending
+// after grace so heartbeating clients can wrap up, and releases them once the
+// grace window has passed or ctx is done. Pooled sessions are left alone.
+func (m *LocalSessionManager) Drain(ctx context.Context, grace time.Duration) error {
+	m.mu.Lock()
+	if m.draining {
+		m.mu.Unlock()
+		return fmt.Errorf("session manager is already draining")
+	}
+	m.draining = true
+
+	endingAt := m.clock.Now().Add(grace)
+	inUse := 0
+	for _, session := range m.cache {
+		if session.Status != InUse {
+			continue
+		}
+		session.EndingAt = endingAt
+		// Stop extending the TTL past the end of the grace window
+		if session.ExpiresAt.After(endingAt) {
+			session.ExpiresAt = endingAt
+		}
+		inUse++
+	}
+	m.mu.Unlock()
+
+	logger.Infof("draining game %s: %d in-use sessions end in %s", m.cfg.GameName, inUse, grace)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		logger.Warnf("drain of game %s interrupted, releasing in-use sessions now: %v", m.cfg.GameName, ctx.Err())
+	}
+
+	m.mu.RLock()
+	sessions := make([]*Session, 0, inUse)
+	for _, session := range m.cache {
+		if session.Status == InUse {
+			sessions = append(sessions, session)
+		}
+	}
+	// StatusChangedAt of an in-use session is when it was acquired
+	sort.Slice(sessions, func(i, j int) bool {
+		if m.cfg.DrainOrder == DrainNewestFirst {
+			return sessions[i].StatusChangedAt.After(sessions[j].StatusChangedAt)
+		}
+		return sessions[i].StatusChangedAt.Before(sessions[j].StatusChangedAt)
+	})
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	m.mu.RUnlock()
+
+	var errs []error
+	for _, id := range ids {
+		if err := m.Release(context.Background(), id, ReleaseDrain); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release session %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pause stops creating and handing out sessions, for example during a farm maintenance window.
+// Heartbeats, sync and release keep working so in-use sessions are not disturbed.
+func (m *LocalSessionManager) Pause(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.paused {
+		return nil
+	}
+	m.paused = true
+	logger.Infof("paused pool maintenance for game %s", m.cfg.GameName)
+	return nil
+}
+
+// Resume undoes Pause, the background sync refills the pool on its next tick
+func (m *LocalSessionManager) Resume(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.paused {
+		return nil
+	}
+	m.paused = false
+	logger.Infof("resumed pool maintenance for game %s", m.cfg.GameName)
+	return nil
+}
+
+// Resize changes Min and Max of the running pool, until the next restart reads the config file again.
+// Growing is picked up right away, a pool over the new Max shrinks as idle sessions expire or are released.
+func (m *LocalSessionManager) Resize(ctx context.Context, min, max int) error {
+	m.mu.Lock()
+	if err := m.checkResizeLocked(min, max); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	logger.Infof("resized session pool of game %s from min %d max %d to min %d max %d", m.cfg.GameName, m.cfg.Min, m.cfg.Max, min, max)
+	m.cfg.Min = min
+	m.cfg.Max = max
+	m.mu.Unlock()
+
+	// Start refilling now instead of on the next sync tick
+	return m.ensureMinPoolSize(ctx)
+}
+
+// checkResizeLocked validates new pool bounds against the config and the sessions in use. Callers must hold m.mu.
+func (m *LocalSessionManager) checkResizeLocked(min, max int) error {
+	if min < 0 || max < min {
+		return fmt.Errorf("%w: need 0 <= min <= max, got min %d max %d", ErrInvalidResize, min, max)
+	}
+	if max < m.cfg.MinReady {
+		return fmt.Errorf("%w: max %d is below min_ready %d", ErrInvalidResize, max, m.cfg.MinReady)
+	}
+	profileMin := 0
+	for _, p := range m.cfg.ScreenProfiles {
+		profileMin += p.Min
+	}
+	if max < profileMin {
+		return fmt.Errorf("%w: max %d is below the screen profile minima of %d", ErrInvalidResize, max, profileMin)
+	}
+	inUse := 0
+	for _, session := range m.cache {
+		if session.Status == InUse {
+			inUse++
+		}
+	}
+	if max < inUse {
+		return fmt.Errorf("%w: max %d is below the %d sessions in use", ErrInvalidResize, max, inUse)
+	}
+	return nil
+}
+
+// Stats returns the cumulative session counters since the manager was created
+func (m *LocalSessionManager) Stats(ctx context.Context) (Stats, error) {
+	stats := m.counters.snapshot(m.createdAt)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if usage := m.keyUsageByFingerprintLocked(); len(usage) > 0 {
+		stats.KeyUsage = usage
+	}
+	if len(m.releaseReasons) > 0 {
+		stats.ReleaseReasons = maps.Clone(m.releaseReasons)
+	}
+	stats.CreateFailureStreak = m.createFailureStreak
+	stats.GuaranteeBreachedSince = m.guaranteeBreachedSinceLocked()
+	if m.clock.Now().Before(m.createBackoffUntil) {
+		until := m.createBackoffUntil
+		stats.CreateBackoffUntil = &until
+	}
+	return stats, nil
+}
+
 // PoolStatus returns the current status of the session pool
 func (m *LocalSessionManager) PoolStatus(ctx context.Context) (PoolStatus, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	status := PoolStatus{Total: len(m.cache)}
+	status := PoolStatus{
+		Min:      m.cfg.Min,
+		Max:      m.cfg.Max,
+		Total:    len(m.cache),
+		Paused:   m.paused,
+		Booting:  m.booting,
+		Errored:  len(m.errored),
+		Profiles: m.profileStatusLocked(),
+	}
 
 	for _, session := range m.cache {
 		switch session.Status {
 		case Cold:
-			status.Cold++
+			if m.launchedLocked(session) {
+				status.Cold++
+			} else {
+				status.Launching++
+			}
 		case Warming:
 			status.Warming++
 		case Warmed:
@@ -265,75 +892,223 @@ func (m *LocalSessionManager) syncRunningSession(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Create a map of running session IDs for quick lookup
+	// Create a map of running session IDs for quick lookup, only adopting this game's instances.
+	// Instances reported in a failed state are not running, whatever the cache holds for them.
 	runningSessionMap := make(map[string]*anbox.SessionDetails)
+	failed := make(map[string]string)
 	for _, session := range runningSessionDetails {
+		if session.App != m.cfg.appName() {
+			continue
+		}
+		if isFailedInstanceStatus(session.Status) {
+			failed[session.ID] = session.Status
+			continue
+		}
 		runningSessionMap[session.ID] = session
 	}
 
-	// Add new running sessions that we don't have locally
+	// Add new running sessions that we don't have locally, except the released ones still waiting to be deleted
 	for sessionID, anboxSession := range runningSessionMap {
-		if _, exists := m.cache[sessionID]; !exists {
+		if _, exists := m.cache[sessionID]; !exists && !m.deletes.queued(sessionID) {
 			// Create new local session for running anbox session
 			session := &Session{
-				ID:            sessionID,
-				Game:          m.cfg.GameName,
-				GatewayURL:    m.anboxClient.GetGatewayURL(),
-				AuthToken:     m.anboxClient.GetAuthToken(),
-				Status:        Cold, // Start as cold, can be promoted later
-				Anbox:         anboxSession,
-				ExpiresAt:     time.Now().Add(m.cfg.SessionTTL),
-				LastHeartbeat: time.Now(),
-				CreatedAt:     time.Now(),
+				ID:              sessionID,
+				Game:            m.cfg.GameName,
+				GatewayURL:      m.anboxClient.GetGatewayURL(),
+				AuthToken:       m.anboxClient.GetAuthToken(),
+				Status:          Cold, // Start as cold, can be promoted later
+				Profile:         m.cfg.taggedProfile(anbox.GetTagValue(anboxSession.Tags, anbox.TagProfile)),
+				StatusChangedAt: m.clock.Now(),
+				Anbox:           anboxSession,
+				ExpiresAt:       m.clock.Now().Add(m.cfg.SessionTTL),
+				LastHeartbeat:   m.clock.Now(),
+				CreatedAt:       m.clock.Now(),
 			}
 
+			if !m.cfg.LaunchApp {
+				session.ReadyAt = session.CreatedAt
+			}
 			m.cache[sessionID] = session
+			m.auditLocked(session, "", Cold, SystemActor, "synced")
 		}
 	}
+	if m.cfg.LaunchApp {
+		m.startLaunchesLocked(ctx)
+	}
 
-	// Remove local sessions that are no longer running on AMS
-	for sessionID := range m.cache {
-		if _, exists := runningSessionMap[sessionID]; !exists {
-			// Session is no longer running, remove it
-			delete(m.cache, sessionID)
+	// Remove local sessions that are no longer running on AMS, so they are never handed out again.
+	// In-use sessions missing from the list are only pruned after InUseAbsentSyncs syncs in a row.
+	// Failed instances are left to reapOrphans, which deletes them unless KeepErrored.
+	for sessionID, session := range m.cache {
+		if _, exists := runningSessionMap[sessionID]; exists {
+			session.absentSyncs = 0
+			continue
 		}
+		reason := "not_running"
+		if status, reported := failed[sessionID]; reported {
+			logger.Warnf("session %s of game %s is %s on AMS while %s here, reclaiming it", sessionID, m.cfg.GameName, status, session.Status)
+			reason = "instance_" + status
+		} else if session.Status == InUse {
+			session.absentSyncs++
+			if session.absentSyncs < m.cfg.InUseAbsentSyncs {
+				logger.Warnf("in-use session %s of game %s is missing from AMS (%d/%d syncs), keeping it", sessionID, m.cfg.GameName, session.absentSyncs, m.cfg.InUseAbsentSyncs)
+				continue
+			}
+		}
+		m.removeLocked(session, SystemActor, reason, ReleaseErrored)
 	}
 
 	return nil
 }
 
+// reapOrphans counts the instances this replica created for the game that are not running and deletes
+// the ones unknown to the cache that are in a failed state, unless KeepErrored, or far older than any TTL
+func (m *LocalSessionManager) reapOrphans(ctx context.Context) error {
+	instances, err := m.anboxClient.GetAllInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get instances: %w", err)
+	}
+
+	replicaID := m.anboxClient.GetReplicaID()
+	maxAge := m.cfg.orphanMaxAge()
+	now := m.clock.Now()
+
+	m.mu.Lock()
+	orphans := make([]*anbox.InstanceDetails, 0)
+	booting := 0
+	errored := make(map[string]bool)
+	for _, instance := range instances {
+		// Only ever touch instances this replica created for this game
+		if !anbox.IsManagedInstance(instance.Tags) ||
+			anbox.GetTagValue(instance.Tags, anbox.TagReplica) != replicaID ||
+			anbox.GetTagValue(instance.Tags, anbox.TagGame) != m.cfg.GameName {
+			continue
+		}
+
+		failed := isFailedInstanceStatus(instance.Status)
+		if failed {
+			errored[instance.ID] = true
+			if !m.errored[instance.ID] {
+				logger.Warnf("instance %s of game %s is in %s state", instance.ID, m.cfg.GameName, instance.Status)
+			}
+		} else if isBootingInstanceStatus(instance.Status) {
+			booting++
+		}
+
+		sessionID := instance.ID
+		if extractedID := anbox.GetSessionIDFromTags(instance.Tags); extractedID != "" {
+			sessionID = extractedID
+		}
+		if _, exists := m.cache[sessionID]; exists {
+			continue
+		}
+
+		tooOld := maxAge > 0 && instance.CreatedAt > 0 && now.Sub(time.Unix(instance.CreatedAt, 0)) > maxAge
+		if (failed && !m.cfg.KeepErrored) || tooOld {
+			orphans = append(orphans, instance)
+		}
+	}
+	m.booting = booting
+	m.errored = errored
+	m.mu.Unlock()
+
+	for _, instance := range orphans {
+		logger.Warnf("reaping orphan instance %s of game %s (status: %s)", instance.ID, m.cfg.GameName, instance.Status)
+		if err := m.deleteInstance(ctx, instance.ID); err != nil {
+			logger.Errorf("failed to delete orphan instance %s: %v", instance.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// isFailedInstanceStatus reports whether an AMS instance status will never become running
+func isFailedInstanceStatus(status string) bool {
+	switch status {
+	case "error", "stopped", "unknown":
+		return true
+	}
+	return false
+}
+
+// isBootingInstanceStatus reports whether an AMS instance is still on its way to running
+func isBootingInstanceStatus(status string) bool {
+	switch status {
+	case "created", "prepared", "started":
+		return true
+	}
+	return false
+}
+
 // Helper methods
 
 func (m *LocalSessionManager) cleanupExpired() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	now := time.Now()
+	now := m.clock.Now()
+	m.expireIdempotencyKeysLocked(now)
 
 	// Check all sessions for expiration or heartbeat timeout
 	for sessionID, session := range m.cache {
-		shouldDelete := false
+		// A session warming for longer than MaxWarmingDuration sits on a broken instance
+		if session.Status == Warming && session.warmup == nil && m.cfg.MaxWarmingDuration > 0 && now.Sub(session.StatusChangedAt) > m.cfg.MaxWarmingDuration {
+			if m.cfg.MaxWarmingAction == WarmingOverrunRevert {
+				logger.Warnf("session %s was warming for longer than max %s, reverting to cold", sessionID, m.cfg.MaxWarmingDuration)
+				m.revertToColdLocked(session, SystemActor, "max_warming_duration")
+				continue
+			}
+			logger.Warnf("session %s was warming for longer than max %s, reclaiming it", sessionID, m.cfg.MaxWarmingDuration)
+			m.removeLocked(session, SystemActor, "max_warming_duration", ReleaseErrored)
+			go func(s *Session) {
+				if s.Anbox != nil {
+					if err := m.deleteSession(context.Background(), s.Anbox.ID); err != nil {
+						logger.Errorf("failed to delete anbox session %s that warmed too long: %v", s.Anbox.ID, err)
+					}
+				}
+			}(session)
+			continue
+		}
 
-		// Check cold sessions for expiration
-		if now.After(session.CreatedAt.Add(m.cfg.SessionTTL)) {
-			shouldDelete = true
+		// Put sessions whose client never finished warming back into the cold pool
+		// Sessions running their warm-up actions are bounded by WarmupTimeout instead
+		if session.Status == Warming && session.warmup == nil && m.cfg.WarmingTimeout > 0 && now.Sub(session.StatusChangedAt) > m.cfg.WarmingTimeout {
+			logger.Warnf("session %s was warming for longer than %s, reverting to cold", sessionID, m.cfg.WarmingTimeout)
+			m.revertToColdLocked(session, SystemActor, "warming_timeout")
+		}
+
+		// A session that just changed state, e.g. was handed to a client, is never reclaimed before its first heartbeat can arrive
+		if now.Sub(session.StatusChangedAt) < m.cfg.GracePeriod {
+			continue
+		}
+
+		reason, releaseReason := "", ReleaseReason("")
+
+		// In-use sessions expire at the ExpiresAt they were acquired or extended to, the others one TTL after creation
+		expiresAt := session.CreatedAt.Add(m.cfg.SessionTTL)
+		if session.Status == InUse && !session.ExpiresAt.IsZero() {
+			expiresAt = session.ExpiresAt
+		}
+		if now.After(expiresAt) {
+			reason, releaseReason = "ttl_expired", ReleaseExpired
 		}
 
 		// Check in-use sessions for heartbeat timeout
 		if session.Status == InUse || session.Status == Warmed {
 			if now.Sub(session.LastHeartbeat) > m.cfg.HeartbeatTimeout {
-				shouldDelete = true
+				reason, releaseReason = "heartbeat_timeout", ReleaseHeartbeatTimeout
 			}
 		}
 
-		if shouldDelete {
+		if reason != "" {
 			// Remove expired session and delete
-			delete(m.cache, sessionID)
+			m.counters.expired.Add(1)
+			m.removeLocked(session, SystemActor, reason, releaseReason)
 			logger.Warnf("session %s expired, deleting", sessionID)
 			// Delete from anbox in background
 			go func(s *Session) {
 				if s.Anbox != nil {
-					if err := m.anboxClient.Delete(context.Background(), s.Anbox.ID); err != nil {
+					if err := m.deleteSession(context.Background(), s.Anbox.ID); err != nil {
 						logger.Errorf("failed to delete anbox session %s: %v", s.Anbox.ID, err)
 					}
 				}
@@ -345,6 +1120,8 @@ func (m *LocalSessionManager) cleanupExpired() {
 func (m *LocalSessionManager) backgroundSync(ctx context.Context) {
 	ticker := time.NewTicker(m.cfg.SyncInterval)
 	defer ticker.Stop()
+	m.loop.loopStarted(m.clock.Now())
+	defer m.loop.loopStopped()
 
 	for {
 		select {
@@ -353,20 +1130,43 @@ func (m *LocalSessionManager) backgroundSync(ctx context.Context) {
 		case <-m.syncStopCh:
 			return
 		case <-ticker.C:
-			// Sync running sessions from AMS
-			if err := m.syncRunningSession(ctx); err != nil {
-				logger.Errorf("failed to sync running sessions: %v", err)
-			}
+			m.syncCycle(ctx)
+		}
+	}
+}
 
-			// Cleanup expired sessions
-			m.cleanupExpired()
+// syncCycle runs one round of the background sync and records how it went in the loop health
+func (m *LocalSessionManager) syncCycle(ctx context.Context) {
+	m.loop.cycleStart(m.clock.Now())
+	var cycleErr error
 
-			// Ensure minimum session pool size
-			if err := m.ensureMinPoolSize(ctx); err != nil {
-				logger.Errorf("failed to ensure min pool size: %v", err)
-			}
-		}
+	// Retry the deletes that failed, so released instances do not leak, before they could be listed as running
+	m.retryDeletes(ctx)
+
+	// Sync running sessions from AMS
+	if err := m.syncRunningSession(ctx); err != nil {
+		logger.Errorf("failed to sync running sessions: %v", err)
+		cycleErr = err
+	}
+
+	// Reap managed instances the cache doesn't know about that are broken or too old
+	if err := m.reapOrphans(ctx); err != nil {
+		logger.Errorf("failed to reap orphan instances: %v", err)
+		cycleErr = err
 	}
+
+	// Cleanup expired sessions
+	m.cleanupExpired()
+
+	// Replace a cold session that idled for too long
+	m.recycleCold()
+
+	// Ensure minimum session pool size
+	if err := m.ensureMinPoolSize(ctx); err != nil {
+		logger.Errorf("failed to ensure min pool size: %v", err)
+		cycleErr = err
+	}
+	m.loop.cycleEnd(m.clock.Now(), cycleErr)
 }
 
 // ensureMinPoolSize ensures the session pool has at least the minimum number of sessions
@@ -376,42 +1176,247 @@ func (m *LocalSessionManager) ensureMinPoolSize(ctx context.Context) error {
 
 	currentTotal := len(m.cache)
 
-	// If we already have enough sessions, no need to create more
-	if currentTotal >= m.cfg.Min {
+	// Let the budget shared with other games know what this pool holds and whether it wants more
+	m.reportCapacityLocked()
+
+	// If every profile, the pool as a whole and its ready inventory are at their minimum, no need to create more
+	profile, needed := m.profileToCreateLocked()
+	if !needed {
 		return nil
 	}
 
-	// Check if we've reached the maximum limit
-	if currentTotal >= m.cfg.Max {
+	// Check if we've reached the maximum limit, counting on-demand creations in flight
+	if currentTotal+m.pendingCreations >= m.cfg.Max {
 		logger.Warnf("session pool is at maximum capacity (%d), cannot create more sessions", m.cfg.Max)
 		return nil
 	}
 
+	// No point in refilling a pool that is shutting down or paused for maintenance
+	if m.draining || m.paused {
+		return nil
+	}
+
+	// Don't keep hitting the gateway when it told us creation can't succeed
+	if !m.anboxClient.Available() {
+		return nil
+	}
+	if m.createHaltedLocked() {
+		return nil
+	}
+	if m.clock.Now().Before(m.createBackoffUntil) {
+		return nil
+	}
+	if m.reserveCapacityLocked(1) == 0 {
+		return nil
+	}
+
 	// 每次只创建一个否则,会批量一起过期
-	go m.createNewSession(context.Background())
+	go m.createNewSession(context.Background(), profile)
 
 	return nil
 }
 
-// createNewSession creates a new session via anbox
-func (m *LocalSessionManager) createNewSession(ctx context.Context) {
-	req := anbox.CreateSessionRequest{
-		App:      m.cfg.GameName,
-		Joinable: true,
-		Screen: anbox.Screen{
-			Width:   m.cfg.ScreenConfig.Width,
-			Height:  m.cfg.ScreenConfig.Height,
-			Density: m.cfg.ScreenConfig.Density,
-			FPS:     m.cfg.ScreenConfig.Fps,
-		},
+// readyCountLocked counts the sessions of profile an acquire can hand out. Callers must hold m.mu.
+func (m *LocalSessionManager) readyCountLocked(profile string) int {
+	ready := 0
+	for _, session := range m.cache {
+		if session.Profile == profile && (session.Status == Cold || session.Status == Warmed) {
+			ready++
+		}
 	}
+	return ready
+}
 
-	// Create session asynchronously via anbox
-	if err := m.anboxClient.CreateAsync(ctx, req); err != nil {
-		logger.Errorf("createNewSession failed to create session for game %s: %v", m.cfg.GameName, err)
+// warmupPool requests enough sessions to reach Min at startup, running at most
+// WarmupConcurrency creations in parallel. Afterwards the background sync falls
+// back to the one-at-a-time throttle of ensureMinPoolSize.
+func (m *LocalSessionManager) warmupPool(ctx context.Context) {
+	m.mu.RLock()
+	plan := m.warmupPlanLocked()
+	concurrency := m.cfg.WarmupConcurrency
+	m.mu.RUnlock()
+
+	if len(plan) == 0 {
 		return
 	}
 
+	logger.Infof("warming up pool for game %s: creating %d sessions, %d at a time", m.cfg.GameName, len(plan), concurrency)
+	m.createBatch(ctx, plan, concurrency)
+}
+
+// evictLocked reclaims the least valuable idle session according to the eviction policy
+// and reports whether room was made. Callers must hold m.mu.
+func (m *LocalSessionManager) evictLocked() bool {
+	var victim *Session
+	for _, session := range m.cache {
+		if !m.evictable(session) {
+			continue
+		}
+		if victim == nil || evictsBefore(session, victim) {
+			victim = session
+		}
+	}
+	if victim == nil {
+		return false
+	}
+
+	m.counters.evicted.Add(1)
+	m.removeLocked(victim, SystemActor, "evicted", ReleaseEvicted)
+	logger.Infof("evicted %s session %s of game %s to make room under max %d", victim.Status, victim.ID, m.cfg.GameName, m.cfg.Max)
+
+	// Delete from anbox in background
+	go func(s *Session) {
+		if s.Anbox != nil {
+			if err := m.deleteSession(context.Background(), s.Anbox.ID); err != nil {
+				logger.Errorf("failed to delete evicted anbox session %s: %v", s.Anbox.ID, err)
+			}
+		}
+	}(victim)
+	return true
+}
+
+// evictable reports whether the eviction policy allows reclaiming the session
+func (m *LocalSessionManager) evictable(session *Session) bool {
+	switch m.cfg.EvictionPolicy {
+	case EvictOldestCold:
+		return session.Status == Cold
+	case EvictOldestIdle:
+		return session.Status == Cold || session.Status == Warmed
+	}
+	return false
+}
+
+// evictsBefore orders eviction candidates: cold before warmed, then oldest first
+func evictsBefore(a, b *Session) bool {
+	if a.Status != b.Status {
+		return a.Status == Cold
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// newCreateRequest builds the gateway request for a new session of this game, tagged with its screen profile
+func (m *LocalSessionManager) newCreateRequest(profile string) anbox.CreateSessionRequest {
+	name := ""
+	if m.cfg.InstanceNamePrefix != "" {
+		name = anbox.NewInstanceName(m.cfg.InstanceNamePrefix, m.cfg.GameName)
+	}
+	tags := anbox.NewInstanceTags(m.cfg.GameName, m.anboxClient.GetReplicaID())
+	if profile != "" {
+		tags = append(tags, anbox.FormatTag(anbox.TagProfile, profile))
+	}
+	return anbox.CreateSessionRequest{
+		Name:        name,
+		App:         m.cfg.appName(),
+		Ephemeral:   m.cfg.Ephemeral,
+		IdleTimeMin: m.cfg.IdleTimeMin,
+		Joinable:    true,
+		Screen:      m.screen(profile),
+		Tags:        tags,
+	}
+}
+
+// createNewSession creates a new session of profile via anbox
+func (m *LocalSessionManager) createNewSession(ctx context.Context, profile string) bool {
+	// Create session asynchronously via anbox
+	m.loop.creating.Add(1)
+	err := m.anboxClient.CreateAsync(ctx, m.newCreateRequest(profile))
+	m.loop.creating.Add(-1)
+	if err != nil && ctx.Err() != nil {
+		// Cancelled by the caller, not a failure of the gateway
+		logger.Infof("createNewSession cancelled creating a session for game %s: %v", m.cfg.GameName, err)
+		return false
+	}
+	if err != nil {
+		m.handleCreateError(err)
+		return false
+	}
+	m.counters.created.Add(1)
+
+	m.mu.Lock()
+	m.resetCreateBackoffLocked()
+	m.mu.Unlock()
+
 	logger.Infof("createNewSession requested new session creation for game %s", m.cfg.GameName)
 	// Note: The actual session will be picked up by the next sync cycle
+	return true
+}
+
+// handleCreateError halts creation on permanent errors and backs it off exponentially on the others.
+// Capacity errors back off right away, a single other error is retried on the next tick.
+// Only the first failure and reaching the backoff cap are logged, the streak is reported in Stats.
+func (m *LocalSessionManager) handleCreateError(err error) {
+	m.counters.createFailures.Add(1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.createFailureStreak++
+	var apiErr *anbox.APIError
+	if errors.As(err, &apiErr) && apiErr.Permanent() {
+		m.createHaltErr = err
+		m.createHaltedAt = m.clock.Now()
+		logger.Errorf("createNewSession stopped creating sessions for game %s after a permanent error: %v", m.cfg.GameName, err)
+		return
+	}
+
+	capacity := errors.As(err, &apiErr) && apiErr.Category == anbox.ErrorCategoryCapacity
+	doublings := m.createFailureStreak - 1
+	if !capacity {
+		doublings--
+	}
+	if doublings < 0 {
+		logger.Errorf("createNewSession failed to create session for game %s: %v", m.cfg.GameName, err)
+		return
+	}
+
+	backoff, capped := m.createBackoffAfter(doublings)
+	m.createBackoffUntil = m.clock.Now().Add(backoff)
+	switch {
+	case m.createFailureStreak == 1:
+		logger.Warnf("createNewSession backing off for %s, gateway has no capacity for game %s: %v", backoff, m.cfg.GameName, err)
+	case capped && !m.createBackoffCapped:
+		logger.Errorf("createNewSession keeps failing for game %s, %d failures in a row, retrying every %s until it succeeds: %v", m.cfg.GameName, m.createFailureStreak, backoff, err)
+	}
+	m.createBackoffCapped = capped
+}
+
+// createBackoffAfter doubles CreateBackoff doublings times, capped at CreateBackoffMax
+func (m *LocalSessionManager) createBackoffAfter(doublings int) (backoff time.Duration, capped bool) {
+	backoff = m.cfg.CreateBackoff
+	limit := m.cfg.CreateBackoffMax
+	if limit < backoff {
+		limit = backoff
+	}
+	for i := 0; i < doublings && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff >= limit {
+		return limit, true
+	}
+	return backoff, false
+}
+
+// resetCreateBackoffLocked clears the failure streak after a successful creation. Callers must hold m.mu.
+func (m *LocalSessionManager) resetCreateBackoffLocked() {
+	if m.createFailureStreak > 0 {
+		logger.Infof("createNewSession recovered for game %s after %d failures in a row", m.cfg.GameName, m.createFailureStreak)
+	}
+	m.createFailureStreak = 0
+	m.createBackoffCapped = false
+	m.createBackoffUntil = time.Time{}
+	m.createHaltErr = nil
+}
+
+// createHaltedLocked reports whether creation is halted by a permanent error, lifting the halt once
+// CreateHaltTimeout passed. Callers must hold m.mu.
+func (m *LocalSessionManager) createHaltedLocked() bool {
+	if m.createHaltErr == nil {
+		return false
+	}
+	if m.cfg.CreateHaltTimeout <= 0 || m.clock.Now().Sub(m.createHaltedAt) < m.cfg.CreateHaltTimeout {
+		return true
+	}
+	logger.Infof("createNewSession retrying for game %s, creation was halted for %s after: %v", m.cfg.GameName, m.cfg.CreateHaltTimeout, m.createHaltErr)
+	m.createHaltErr = nil
+	return false
 }
@@ -2,6 +2,19 @@ package session
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,37 +23,183 @@ import (
 
 // MockAnboxClient for testing
 type MockAnboxClient struct {
-	sessions    map[string]bool
+	mu          sync.Mutex
+	sessions    map[string]string // session ID -> app name
 	createError error
 	deleteError error
+	createDelay time.Duration
+	createCount int
+	lastCreate  anbox.CreateSessionRequest
+	instances   []*anbox.InstanceDetails
+	unavailable bool
+	deleted     []string // instance IDs deleted through AMS
+	// gatewayStatus overrides the status the gateway reports for a session, "absent" makes it unknown
+	// to the gateway and "unreachable" fails the lookup with a server error
+	gatewayStatus map[string]string
+	tags          map[string][]string // session ID -> tags AMS reports for a running session
+	// stall, when set, makes listing the running sessions hang until it is closed, listError makes it fail
+	stall chan struct{}
+	// deleteStall, when set, makes gateway deletes hang until it is closed or their context ends
+	deleteStall chan struct{}
+	listError   error
+	// createStatus overrides the status a synchronous create answers with, running by default
+	createStatus string
+	// instanceStatus overrides the status listing the running sessions reports for a session
+	instanceStatus map[string]string
 }
 
 func NewMockAnboxClient() *MockAnboxClient {
 	return &MockAnboxClient{
-		sessions: make(map[string]bool),
+		sessions: make(map[string]string),
 	}
 }
 
 func (m *MockAnboxClient) CreateAsync(ctx context.Context, req anbox.CreateSessionRequest) error {
+	time.Sleep(m.createDelay)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createCount++
+	m.lastCreate = req
 	return m.createError
 }
 
+func (m *MockAnboxClient) Create(ctx context.Context, req anbox.CreateSessionRequest) (*anbox.SessionDetails, error) {
+	select {
+	case <-time.After(m.createDelay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createCount++
+	m.lastCreate = req
+	if m.createError != nil {
+		return nil, m.createError
+	}
+	id := fmt.Sprintf("ondemand-%d", m.createCount)
+	m.sessions[id] = req.App
+	status := "running"
+	if m.createStatus != "" {
+		status = m.createStatus
+	}
+	return &anbox.SessionDetails{ID: id, App: req.App, Status: status, Joinable: true, Tags: req.Tags}, nil
+}
+
+func (m *MockAnboxClient) CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error) {
+	return nil, errors.New("screenshots are not supported by the mock")
+}
+
+func (m *MockAnboxClient) Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error) {
+	return &anbox.JoinSessionDetails{
+		SignalingURL: "wss://gateway.example.com/1.0/sessions/" + sessionID + "/sockets/client?token=scoped-" + sessionID,
+		StunServers:  []anbox.StunServer{{URLs: []string{"turn:turn.example.com:3478"}, Username: "user", Password: "pass"}},
+	}, nil
+}
+
+func (m *MockAnboxClient) GetSession(ctx context.Context, sessionID string) (*anbox.SessionDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	app, running := m.sessions[sessionID]
+	status, overridden := m.gatewayStatus[sessionID]
+	if !running || status == "absent" {
+		return nil, &anbox.APIError{StatusCode: 404, Category: anbox.ErrorCategoryNotFound, Message: "session not found"}
+	}
+	if status == "unreachable" {
+		return nil, &anbox.APIError{StatusCode: 502, Category: anbox.ErrorCategoryServer, Message: "bad gateway"}
+	}
+	if !overridden {
+		status = "active"
+	}
+	return &anbox.SessionDetails{ID: sessionID, App: app, Status: status}, nil
+}
+
+func (m *MockAnboxClient) SetGatewayStatus(id, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gatewayStatus == nil {
+		m.gatewayStatus = make(map[string]string)
+	}
+	m.gatewayStatus[id] = status
+}
+
+func (m *MockAnboxClient) AddRunningSession(id, app string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[id] = app
+}
+
+func (m *MockAnboxClient) CreateCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createCount
+}
+
 func (m *MockAnboxClient) Delete(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	stall := m.deleteStall
+	m.mu.Unlock()
+	if stall != nil {
+		select {
+		case <-stall:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.sessions, sessionID)
 	return m.deleteError
 }
 
 func (m *MockAnboxClient) GetAllRunningSession(ctx context.Context) ([]*anbox.SessionDetails, error) {
+	m.mu.Lock()
+	stall := m.stall
+	m.mu.Unlock()
+	if stall != nil {
+		<-stall
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listError != nil {
+		return nil, m.listError
+	}
 	var sessions []*anbox.SessionDetails
-	for id := range m.sessions {
+	for id, app := range m.sessions {
+		status := "running"
+		if override, ok := m.instanceStatus[id]; ok {
+			status = override
+		}
 		sessions = append(sessions, &anbox.SessionDetails{
 			ID:     id,
-			Status: "running",
+			App:    app,
+			Status: status,
+			Tags:   m.tags[id],
 		})
 	}
 	return sessions, nil
 }
 
+func (m *MockAnboxClient) GetAllInstances(ctx context.Context) ([]*anbox.InstanceDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances, nil
+}
+
+func (m *MockAnboxClient) DeleteInstance(ctx context.Context, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, instanceID)
+	return m.deleteError
+}
+
+func (m *MockAnboxClient) GetApp(ctx context.Context, name string) (*anbox.AppDetails, error) {
+	return &anbox.AppDetails{Name: name}, nil
+}
+
 func (m *MockAnboxClient) GetGatewayURL() string {
 	return "mock://gateway"
 }
@@ -49,6 +208,14 @@ func (m *MockAnboxClient) GetAuthToken() string {
 	return "mock-token"
 }
 
+func (m *MockAnboxClient) GetReplicaID() string {
+	return "mock-replica"
+}
+
+func (m *MockAnboxClient) Available() bool {
+	return !m.unavailable
+}
+
 func TestLocalSessionManager_StateTransitions(t *testing.T) {
 	cfg := &Config{
 		GameName:         "test-game",
@@ -97,7 +264,7 @@ func TestLocalSessionManager_StateTransitions(t *testing.T) {
 	}
 
 	// Test: SetWarmed (warming -> warmed)
-	err = manager.SetWarmed(ctx, coldSession.ID)
+	err = manager.SetWarmed(ctx, coldSession.ID, coldSession.WarmToken)
 	if err != nil {
 		t.Fatalf("Failed to set session as warmed: %v", err)
 	}
@@ -133,7 +300,7 @@ func TestLocalSessionManager_StateTransitions(t *testing.T) {
 	}
 
 	// Test: Release (delete session)
-	err = manager.Release(ctx, warmedSession.ID)
+	err = manager.Release(ctx, warmedSession.ID, ReleaseClient)
 	if err != nil {
 		t.Fatalf("Failed to release session: %v", err)
 	}
@@ -243,7 +410,7 @@ func TestLocalSessionManager_ListSessions(t *testing.T) {
 	manager.mu.Unlock()
 
 	// Test: ListSessions for Cold status
-	coldSessions, err := manager.ListSessions(ctx)
+	coldSessions, err := manager.ListSessions(ctx, Cold)
 	if err != nil {
 		t.Fatalf("Failed to list cold sessions: %v", err)
 	}
@@ -253,7 +420,7 @@ func TestLocalSessionManager_ListSessions(t *testing.T) {
 	}
 
 	// Test: ListSessions for Warmed status
-	warmedSessions, err := manager.ListSessions(ctx)
+	warmedSessions, err := manager.ListSessions(ctx, Warmed)
 	if err != nil {
 		t.Fatalf("Failed to list warmed sessions: %v", err)
 	}
@@ -291,7 +458,7 @@ func TestLocalSessionManager_ErrorHandling(t *testing.T) {
 	}
 
 	// Test: SetWarmed with non-existent session ID
-	err = manager.SetWarmed(ctx, "non-existent")
+	err = manager.SetWarmed(ctx, "non-existent", "")
 	if err == nil {
 		t.Errorf("Expected error for non-existent session, but got none")
 	}
@@ -308,3 +475,3678 @@ func TestLocalSessionManager_ErrorHandling(t *testing.T) {
 		t.Errorf("Expected error for non-existent session, but got none")
 	}
 }
+
+func TestLocalSessionManager_WarmupConcurrency(t *testing.T) {
+	cfg := &Config{
+		GameName:          "test-game",
+		Min:               20,
+		Max:               30,
+		SessionTTL:        5 * time.Minute,
+		HeartbeatTimeout:  1 * time.Minute,
+		SyncInterval:      time.Hour,
+		WarmupConcurrency: 10,
+		ScreenConfig: &ScreenConfig{
+			Width:   720,
+			Height:  1240,
+			Density: 320,
+			Fps:     30,
+		},
+	}
+
+	mockClient := NewMockAnboxClient()
+	mockClient.createDelay = 50 * time.Millisecond
+	manager := NewLocalSessionManager(cfg, mockClient)
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start session manager: %v", err)
+	}
+	defer manager.Stop(ctx)
+
+	// Sequential creation would take Min * createDelay = 1s
+	deadline := time.Now().Add(time.Second)
+	for mockClient.CreateCount() < cfg.Min && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	elapsed := time.Since(start)
+	if mockClient.CreateCount() != cfg.Min {
+		t.Fatalf("Expected %d sessions requested during warmup, got %d", cfg.Min, mockClient.CreateCount())
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("Expected warmup to reach Min in parallel, took %s", elapsed)
+	}
+	t.Logf("Warmup reached Min=%d in %s", cfg.Min, elapsed)
+}
+
+func TestLocalSessionManager_SyncOnlyAdoptsOwnGame(t *testing.T) {
+	newConfig := func(game string) *Config {
+		return &Config{
+			GameName:         game,
+			Min:              0,
+			Max:              10,
+			SessionTTL:       5 * time.Minute,
+			HeartbeatTimeout: 1 * time.Minute,
+			SyncInterval:     10 * time.Second,
+			ScreenConfig:     &ScreenConfig{Width: 720, Height: 1240, Density: 320, Fps: 30},
+		}
+	}
+
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("a-1", "game-a")
+	mockClient.AddRunningSession("a-2", "game-a")
+	mockClient.AddRunningSession("b-1", "game-b")
+	mockClient.AddRunningSession("untagged", "")
+
+	managerA := NewLocalSessionManager(newConfig("game-a"), mockClient)
+	managerB := NewLocalSessionManager(newConfig("game-b"), mockClient)
+
+	ctx := context.Background()
+	for _, manager := range []*LocalSessionManager{managerA, managerB} {
+		if err := manager.syncRunningSession(ctx); err != nil {
+			t.Fatalf("Failed to sync running sessions: %v", err)
+		}
+	}
+
+	expected := map[*LocalSessionManager][]string{
+		managerA: {"a-1", "a-2"},
+		managerB: {"b-1"},
+	}
+	for manager, ids := range expected {
+		sessions, err := manager.ListSessions(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != len(ids) {
+			t.Errorf("Expected %d sessions for %s, got %d", len(ids), manager.cfg.GameName, len(sessions))
+		}
+		for _, id := range ids {
+			if _, err := manager.GetSession(ctx, id); err != nil {
+				t.Errorf("Expected %s to adopt session %s: %v", manager.cfg.GameName, id, err)
+			}
+		}
+		for _, session := range sessions {
+			if session.Game != manager.cfg.GameName {
+				t.Errorf("Manager for %s adopted session %s of another game", manager.cfg.GameName, session.ID)
+			}
+		}
+	}
+}
+
+func TestLocalSessionManager_SyncUsesAppName(t *testing.T) {
+	cfg := &Config{
+		GameName:         "idle-weapon",
+		AppName:          "idle_weapon_app",
+		Min:              0,
+		Max:              10,
+		SessionTTL:       5 * time.Minute,
+		HeartbeatTimeout: 1 * time.Minute,
+		SyncInterval:     10 * time.Second,
+		ScreenConfig:     &ScreenConfig{Width: 720, Height: 1240, Density: 320, Fps: 30},
+	}
+
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("app-1", "idle_weapon_app")
+	mockClient.AddRunningSession("game-1", "idle-weapon")
+	manager := NewLocalSessionManager(cfg, mockClient)
+
+	ctx := context.Background()
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync running sessions: %v", err)
+	}
+
+	if _, err := manager.GetSession(ctx, "app-1"); err != nil {
+		t.Errorf("Expected session of app %s to be adopted: %v", cfg.AppName, err)
+	}
+	if _, err := manager.GetSession(ctx, "game-1"); err == nil {
+		t.Errorf("Expected session named after the game but not the app to be ignored")
+	}
+}
+
+func TestLocalSessionManager_CreateNewSessionTags(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	manager.createNewSession(context.Background(), "")
+
+	tags := mockClient.lastCreate.Tags
+	if anbox.GetTagValue(tags, anbox.TagGame) != "test-game" {
+		t.Errorf("Expected game tag 'test-game', got tags %v", tags)
+	}
+	if !anbox.IsManagedInstance(tags) {
+		t.Errorf("Expected managed-by tag, got tags %v", tags)
+	}
+	if name := mockClient.lastCreate.Name; name != "" {
+		t.Errorf("Expected no instance name without a prefix, got %q", name)
+	}
+
+	cfg.InstanceNamePrefix = "playable"
+	manager.createNewSession(context.Background(), "")
+	if name := mockClient.lastCreate.Name; !regexp.MustCompile(`^playable-test-game-[0-9a-f]{8}$`).MatchString(name) {
+		t.Errorf("Expected an instance name like playable-test-game-<shortid>, got %q", name)
+	}
+
+	if req := mockClient.lastCreate; req.IdleTimeMin != 0 || req.Ephemeral {
+		t.Errorf("Expected no anbox-side reaping by default, got idle_time_min %d ephemeral %v", req.IdleTimeMin, req.Ephemeral)
+	}
+	cfg.IdleTimeMin = 30
+	manager.createNewSession(context.Background(), "")
+	if req := mockClient.lastCreate; req.IdleTimeMin != 30 || req.Ephemeral {
+		t.Errorf("Expected idle_time_min 30 passed to anbox, got %d ephemeral %v", req.IdleTimeMin, req.Ephemeral)
+	}
+	cfg.IdleTimeMin, cfg.Ephemeral = 0, true
+	manager.createNewSession(context.Background(), "")
+	if req := mockClient.lastCreate; !req.Ephemeral {
+		t.Errorf("Expected ephemeral passed to anbox")
+	}
+}
+
+func TestLocalSessionManager_ReapOrphans(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+
+	ownTags := func(session string) []string {
+		return append(anbox.NewInstanceTags("test-game", "mock-replica"), anbox.FormatTag(anbox.TagSession, session))
+	}
+	now := time.Now()
+
+	mockClient := NewMockAnboxClient()
+	mockClient.instances = []*anbox.InstanceDetails{
+		// Reaped: ours and errored
+		{ID: "errored", Status: "error", CreatedAt: now.Unix(), Tags: ownTags("s-errored")},
+		// Reaped: ours and stuck booting far longer than any TTL
+		{ID: "stuck", Status: "started", CreatedAt: now.Add(-time.Hour).Unix(), Tags: ownTags("s-stuck")},
+		// Kept: ours but still booting
+		{ID: "booting", Status: "started", CreatedAt: now.Unix(), Tags: ownTags("s-booting")},
+		// Kept: ours, old, but known to the cache
+		{ID: "cached", Status: "running", CreatedAt: now.Add(-time.Hour).Unix(), Tags: ownTags("s-cached")},
+		// Kept: errored but created by another replica
+		{ID: "other-replica", Status: "error", CreatedAt: now.Unix(), Tags: anbox.NewInstanceTags("test-game", "other")},
+		// Kept: errored but belongs to another game
+		{ID: "other-game", Status: "error", CreatedAt: now.Unix(), Tags: anbox.NewInstanceTags("other-game", "mock-replica")},
+		// Kept: errored but not managed by us
+		{ID: "unmanaged", Status: "error", CreatedAt: now.Unix()},
+	}
+	manager := NewLocalSessionManager(cfg, mockClient)
+	manager.cache["s-cached"] = &Session{ID: "s-cached", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+
+	if err := manager.reapOrphans(context.Background()); err != nil {
+		t.Fatalf("Failed to reap orphans: %v", err)
+	}
+
+	expected := map[string]bool{"errored": true, "stuck": true}
+	if len(mockClient.deleted) != len(expected) {
+		t.Errorf("Expected %d reaped instances, got %v", len(expected), mockClient.deleted)
+	}
+	for _, id := range mockClient.deleted {
+		if !expected[id] {
+			t.Errorf("Instance %s should not have been reaped", id)
+		}
+	}
+}
+
+func TestLocalSessionManager_NonRunningInstances(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+	cfg.KeepErrored = true
+
+	ownTags := func(session string) []string {
+		return append(anbox.NewInstanceTags("test-game", "mock-replica"), anbox.FormatTag(anbox.TagSession, session))
+	}
+	now := time.Now()
+
+	mockClient := NewMockAnboxClient()
+	mockClient.instances = []*anbox.InstanceDetails{
+		{ID: "running", Status: "running", CreatedAt: now.Unix(), Tags: ownTags("s-running")},
+		{ID: "created", Status: "created", CreatedAt: now.Unix(), Tags: ownTags("s-created")},
+		{ID: "started", Status: "started", CreatedAt: now.Unix(), Tags: ownTags("s-started")},
+		{ID: "errored", Status: "error", CreatedAt: now.Unix(), Tags: ownTags("s-errored")},
+		{ID: "stopped", Status: "stopped", CreatedAt: now.Unix(), Tags: ownTags("s-stopped")},
+		// Not counted: another replica's
+		{ID: "other-replica", Status: "error", CreatedAt: now.Unix(), Tags: anbox.NewInstanceTags("test-game", "other")},
+	}
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	if err := manager.reapOrphans(ctx); err != nil {
+		t.Fatalf("Failed to reap orphans: %v", err)
+	}
+	status, _ := manager.PoolStatus(ctx)
+	if status.Booting != 2 || status.Errored != 2 {
+		t.Errorf("Expected 2 booting and 2 errored instances, got %d booting %d errored", status.Booting, status.Errored)
+	}
+	if len(mockClient.deleted) != 0 {
+		t.Errorf("Expected errored instances to be kept with keep_errored, got %v deleted", mockClient.deleted)
+	}
+
+	// Without keep_errored only the errored ones are reaped, booting ones are left to come up
+	cfg.KeepErrored = false
+	if err := manager.reapOrphans(ctx); err != nil {
+		t.Fatalf("Failed to reap orphans: %v", err)
+	}
+	expected := map[string]bool{"errored": true, "stopped": true}
+	if len(mockClient.deleted) != len(expected) {
+		t.Errorf("Expected %d reaped instances, got %v", len(expected), mockClient.deleted)
+	}
+	for _, id := range mockClient.deleted {
+		if !expected[id] {
+			t.Errorf("Instance %s should not have been reaped", id)
+		}
+	}
+
+	// Counts follow the farm once the instances are gone
+	mockClient.instances = mockClient.instances[:1]
+	if err := manager.reapOrphans(ctx); err != nil {
+		t.Fatalf("Failed to reap orphans: %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Booting != 0 || status.Errored != 0 {
+		t.Errorf("Expected no booting or errored instances, got %d booting %d errored", status.Booting, status.Errored)
+	}
+}
+
+func TestLocalSessionManager_CreateErrorHandling(t *testing.T) {
+	newManager := func(createErr error) (*LocalSessionManager, *MockAnboxClient) {
+		cfg := NewConfig()
+		cfg.GameName = "test-game"
+		cfg.CreateBackoff = time.Minute
+		mockClient := NewMockAnboxClient()
+		mockClient.createError = createErr
+		return NewLocalSessionManager(cfg, mockClient), mockClient
+	}
+	ctx := context.Background()
+
+	// Capacity errors back off creation
+	manager, mockClient := newManager(&anbox.APIError{StatusCode: 503, Category: anbox.ErrorCategoryCapacity})
+	manager.createNewSession(ctx, "")
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected creation to back off after a capacity error, got %d attempts", mockClient.CreateCount())
+	}
+	if manager.createHaltErr != nil {
+		t.Errorf("Expected capacity errors not to halt creation")
+	}
+
+	// Permanent errors halt creation
+	manager, mockClient = newManager(&anbox.APIError{StatusCode: 404, Category: anbox.ErrorCategoryNotFound})
+	manager.createNewSession(ctx, "")
+	if manager.createHaltErr == nil {
+		t.Fatalf("Expected a permanent error to halt creation")
+	}
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected no further creation after a permanent error, got %d attempts", mockClient.CreateCount())
+	}
+
+	// Other errors are retried on the next tick
+	manager, mockClient = newManager(errors.New("connection reset"))
+	manager.createNewSession(ctx, "")
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 2 {
+		t.Errorf("Expected transient errors to be retried, got %d attempts", mockClient.CreateCount())
+	}
+}
+
+func TestLocalSessionManager_CreateHaltIsLifted(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	clock := NewFakeClock(time.Now())
+	mockClient := NewMockAnboxClient()
+	mockClient.createError = &anbox.APIError{StatusCode: 404, Category: anbox.ErrorCategoryNotFound}
+	manager := NewLocalSessionManager(cfg, mockClient, WithClock(clock))
+	ctx := context.Background()
+
+	manager.createNewSession(ctx, "")
+	clock.Advance(cfg.CreateHaltTimeout - time.Second)
+	manager.mu.Lock()
+	halted := manager.createHaltedLocked()
+	manager.mu.Unlock()
+	if !halted {
+		t.Fatalf("Expected creation to stay halted within create_halt_timeout")
+	}
+
+	// The app was uploaded meanwhile, creation is tried again once the timeout passed
+	mockClient.mu.Lock()
+	mockClient.createError = nil
+	mockClient.mu.Unlock()
+	clock.Advance(time.Second)
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 2 {
+		t.Errorf("Expected creation to be retried after create_halt_timeout, got %d attempts", mockClient.CreateCount())
+	}
+	manager.mu.Lock()
+	lifted := manager.createHaltErr == nil
+	manager.mu.Unlock()
+	if !lifted {
+		t.Errorf("Expected the halt to be lifted")
+	}
+
+	// Init with a new configuration lifts a halt right away
+	mockClient.mu.Lock()
+	mockClient.createError = &anbox.APIError{StatusCode: 404, Category: anbox.ErrorCategoryNotFound}
+	mockClient.mu.Unlock()
+	manager.createNewSession(ctx, "")
+	if manager.createHaltErr == nil {
+		t.Fatalf("Expected a permanent error to halt creation")
+	}
+	if err := manager.Init(ctx, cfg); err != nil {
+		t.Fatalf("Failed to init session manager: %v", err)
+	}
+	if manager.createHaltErr != nil {
+		t.Errorf("Expected Init to lift the halt")
+	}
+}
+
+func TestLocalSessionManager_UpstreamUnavailable(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+
+	mockClient := NewMockAnboxClient()
+	mockClient.unavailable = true
+	manager := NewLocalSessionManager(cfg, mockClient)
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: time.Now(), LastHeartbeat: time.Now()}
+
+	ctx := context.Background()
+	if _, err := manager.AcquireCold(ctx); !errors.Is(err, anbox.ErrUpstreamUnavailable) {
+		t.Errorf("Expected ErrUpstreamUnavailable, got %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, anbox.ErrUpstreamUnavailable) {
+		t.Errorf("Expected ErrUpstreamUnavailable, got %v", err)
+	}
+
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 0 {
+		t.Errorf("Expected no creation while upstream is unavailable, got %d", mockClient.CreateCount())
+	}
+}
+
+func TestLocalSessionManager_AcquireWarmedOnDemand(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.Max = 1
+	cfg.OnDemand = true
+
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	// With headroom an empty pool creates a session synchronously
+	session, err := manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Expected on-demand acquire to succeed, got %v", err)
+	}
+	if session.Status != InUse {
+		t.Errorf("Expected on-demand session to be in_use, got %s", session.Status)
+	}
+	if _, exists := manager.cache[session.ID]; !exists {
+		t.Errorf("Expected on-demand session %s to be cached", session.ID)
+	}
+	if manager.pendingCreations != 0 {
+		t.Errorf("Expected no pending creations, got %d", manager.pendingCreations)
+	}
+
+	// Without headroom the acquire fails without calling the gateway
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Errorf("Expected on-demand acquire to fail at maximum capacity")
+	}
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected a single creation, got %d", mockClient.CreateCount())
+	}
+
+	// Without OnDemand an empty pool still fails
+	cfg.OnDemand = false
+	manager = NewLocalSessionManager(cfg, NewMockAnboxClient())
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Errorf("Expected acquire to fail with on-demand disabled")
+	}
+}
+
+func TestLocalSessionManager_AcquireWarmedOnDemandRunsWarmup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.Max = 2
+	cfg.OnDemand = true
+	cfg.WarmupActions = []WarmupAction{{Tap: []int{360, 1100}}}
+	runner := &recordingWarmupRunner{}
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient, WithWarmupRunner(runner))
+	ctx := context.Background()
+
+	// The created session is warmed before it is handed out
+	session, err := manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Expected on-demand acquire to succeed, got %v", err)
+	}
+	if ran := runner.ran(); len(ran) != 1 || ran[0] != session.ID+": tap [360 1100]" {
+		t.Errorf("Expected the warm-up to run in the on-demand session, got %v", ran)
+	}
+
+	// A session whose warm-up fails is not handed out
+	cfg.WarmupActions = []WarmupAction{{Command: []string{"false"}}}
+	runner.fail = "false"
+	if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, ErrWarmupFailed) {
+		t.Errorf("Expected the failed warm-up to fail the acquire, got %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Total != 1 {
+		t.Errorf("Expected only the first session to be cached, got %+v", status)
+	}
+}
+
+func TestLocalSessionManager_AcquireWarmedOnDemandErrors(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.Max = 2
+	cfg.OnDemand = true
+	cfg.OnDemandTimeout = 20 * time.Millisecond
+	cfg.CreateBackoff = time.Minute
+	ctx := context.Background()
+
+	// Creation that outlives the timeout fails the acquire
+	mockClient := NewMockAnboxClient()
+	mockClient.createDelay = time.Second
+	manager := NewLocalSessionManager(cfg, mockClient)
+	if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if len(manager.cache) != 0 || manager.pendingCreations != 0 {
+		t.Errorf("Expected no sessions after a failed on-demand creation")
+	}
+
+	// A capacity error backs off further on-demand creation
+	mockClient = NewMockAnboxClient()
+	mockClient.createError = &anbox.APIError{StatusCode: 503, Category: anbox.ErrorCategoryCapacity}
+	manager = NewLocalSessionManager(cfg, mockClient)
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Fatalf("Expected on-demand acquire to fail on a capacity error")
+	}
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Fatalf("Expected on-demand acquire to fail while backing off")
+	}
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected creation to back off after a capacity error, got %d attempts", mockClient.CreateCount())
+	}
+}
+
+// launchingAnboxClient is a MockAnboxClient whose app launches fail with err or complete once done is closed
+type launchingAnboxClient struct {
+	*MockAnboxClient
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+	launches []string
+}
+
+func (m *launchingAnboxClient) LaunchApp(ctx context.Context, sessionID string, commands [][]string) error {
+	m.mu.Lock()
+	m.launches = append(m.launches, sessionID)
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// launched reports whether the app of session id completed its launch
+func launched(manager *LocalSessionManager, id string) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	session, exists := manager.cache[id]
+	return exists && session.AppLaunched
+}
+
+func TestLocalSessionManager_LaunchAppBeforeCold(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.LaunchApp = true
+	cfg.LaunchCommands = [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	mockClient := &launchingAnboxClient{MockAnboxClient: NewMockAnboxClient(), done: make(chan struct{})}
+	mockClient.AddRunningSession("session-1", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	// Syncing again while the launch runs starts no second one
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	if _, err := manager.AcquireCold(ctx); !errors.Is(err, ErrPoolEmpty) {
+		t.Fatalf("Expected no cold session while the app launches, got %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Cold != 0 || status.Launching != 1 {
+		t.Errorf("Expected 1 launching and no cold session, got %+v", status)
+	}
+
+	close(mockClient.done)
+	deadline := time.Now().Add(time.Second)
+	for !launched(manager, "session-1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the app of session-1 to be launched")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Expected the launched session to be acquirable, got %v", err)
+	}
+	if session.ID != "session-1" {
+		t.Errorf("Expected session-1, got %s", session.ID)
+	}
+	mockClient.mu.Lock()
+	defer mockClient.mu.Unlock()
+	if len(mockClient.launches) != 1 {
+		t.Errorf("Expected a single launch, got %v", mockClient.launches)
+	}
+}
+
+func TestLocalSessionManager_LaunchAppRetriesOnNextSync(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.LaunchApp = true
+	cfg.LaunchCommands = [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	mockClient := &launchingAnboxClient{MockAnboxClient: NewMockAnboxClient(), done: make(chan struct{}), err: errors.New("instance not ready")}
+	close(mockClient.done)
+	mockClient.AddRunningSession("session-1", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		manager.mu.RLock()
+		failed := !manager.cache["session-1"].launching
+		manager.mu.RUnlock()
+		if failed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the failing launch to finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if launched(manager, "session-1") {
+		t.Fatalf("Expected a failed launch to leave the app unlaunched")
+	}
+
+	mockClient.mu.Lock()
+	mockClient.err = nil
+	mockClient.mu.Unlock()
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	for !launched(manager, "session-1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the next sync to launch the app")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLocalSessionManager_LaunchAppGivesUpAfterAttempts(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.LaunchApp = true
+	cfg.LaunchCommands = [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	cfg.LaunchAttempts = 2
+	mockClient := &launchingAnboxClient{MockAnboxClient: NewMockAnboxClient(), done: make(chan struct{}), err: errors.New("no such activity")}
+	close(mockClient.done)
+	mockClient.AddRunningSession("session-1", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	launchFailures := func() int {
+		manager.mu.RLock()
+		defer manager.mu.RUnlock()
+		if session, ok := manager.cache["session-1"]; ok && !session.launching {
+			return session.launchFailures
+		}
+		return -1
+	}
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for launchFailures() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the first launch to fail")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The second failure uses up the attempts, the session is reclaimed instead of retried forever
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	for {
+		manager.mu.RLock()
+		_, cached := manager.cache["session-1"]
+		manager.mu.RUnlock()
+		mockClient.MockAnboxClient.mu.Lock()
+		_, running := mockClient.sessions["session-1"]
+		mockClient.MockAnboxClient.mu.Unlock()
+		if !cached && !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the session to be reclaimed after %d failed launches", cfg.LaunchAttempts)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stats, _ := manager.Stats(ctx)
+	if stats.ReleaseReasons[ReleaseErrored] != 1 {
+		t.Errorf("Expected the reclaimed session counted as errored, got %v", stats.ReleaseReasons)
+	}
+}
+
+func TestLocalSessionManager_AcquireWarmedOnDemandVerifiesCreate(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.Max = 2
+	cfg.OnDemand = true
+	cfg.CreateVerifyTimeout = 200 * time.Millisecond
+	cfg.CreateVerifyInterval = 5 * time.Millisecond
+	ctx := context.Background()
+
+	// A session that comes up after being created is handed out once it runs
+	mockClient := NewMockAnboxClient()
+	mockClient.createStatus = "starting"
+	mockClient.SetGatewayStatus("ondemand-1", "starting")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mockClient.SetGatewayStatus("ondemand-1", "active")
+	}()
+	session, err := manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Expected acquire to succeed once the session runs, got %v", err)
+	}
+	if session.ID != "ondemand-1" || session.Status != InUse {
+		t.Errorf("Expected ondemand-1 in use, got %s %s", session.ID, session.Status)
+	}
+
+	// A session that never runs fails the acquire and is reclaimed
+	mockClient = NewMockAnboxClient()
+	mockClient.createStatus = "starting"
+	mockClient.SetGatewayStatus("ondemand-1", "starting")
+	manager = NewLocalSessionManager(cfg, mockClient)
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Fatalf("Expected acquire to fail for a session that never runs")
+	}
+	if len(manager.cache) != 0 || manager.pendingCreations != 0 {
+		t.Errorf("Expected no sessions after a failed verification")
+	}
+	if stats, _ := manager.Stats(ctx); stats.CreateFailures != 1 {
+		t.Errorf("Expected the failed verification to count as a create failure, got %d", stats.CreateFailures)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mockClient.mu.Lock()
+		_, exists := mockClient.sessions["ondemand-1"]
+		mockClient.mu.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the unverified session to be deleted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLocalSessionManager_Drain(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	for _, s := range []*Session{
+		{ID: "in-use-1", Status: InUse, ExpiresAt: now.Add(time.Hour)},
+		{ID: "in-use-2", Status: InUse, ExpiresAt: now.Add(time.Hour)},
+		{ID: "warmed-1", Status: Warmed},
+	} {
+		s.Anbox = &anbox.SessionDetails{ID: s.ID}
+		s.CreatedAt, s.LastHeartbeat = now, now
+		manager.cache[s.ID] = s
+		mockClient.AddRunningSession(s.ID, "test-game")
+	}
+
+	ctx := context.Background()
+	grace := 100 * time.Millisecond
+	done := make(chan error, 1)
+	go func() { done <- manager.Drain(ctx, grace) }()
+	time.Sleep(20 * time.Millisecond)
+
+	// In-use sessions are notified and their TTL is capped at the end of the grace window
+	for _, id := range []string{"in-use-1", "in-use-2"} {
+		session, err := manager.GetSession(ctx, id)
+		if err != nil {
+			t.Fatalf("Expected session %s to survive until the grace window ends: %v", id, err)
+		}
+		if session.EndingAt.IsZero() {
+			t.Errorf("Expected session %s to be notified it is ending", id)
+		}
+		if session.ExpiresAt.After(session.EndingAt) {
+			t.Errorf("Expected session %s TTL to stop at the end of the grace window", id)
+		}
+	}
+	if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, ErrDraining) {
+		t.Errorf("Expected ErrDraining while draining, got %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Drain failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Drain did not finish after the grace window")
+	}
+	if time.Since(now) < grace {
+		t.Errorf("Expected drain to wait for the grace window")
+	}
+
+	// In-use sessions are released, pooled ones are left alone
+	for _, id := range []string{"in-use-1", "in-use-2"} {
+		if _, err := manager.GetSession(ctx, id); err == nil {
+			t.Errorf("Expected session %s to be released after the grace window", id)
+		}
+	}
+	if _, err := manager.GetSession(ctx, "warmed-1"); err != nil {
+		t.Errorf("Expected warmed session to be kept: %v", err)
+	}
+}
+
+func TestLocalSessionManager_DrainOrder(t *testing.T) {
+	tests := []struct {
+		order DrainOrder
+		want  []string
+	}{
+		{"", []string{"acquired-1", "acquired-2", "acquired-3"}},
+		{DrainOldestFirst, []string{"acquired-1", "acquired-2", "acquired-3"}},
+		{DrainNewestFirst, []string{"acquired-3", "acquired-2", "acquired-1"}},
+	}
+	for _, tt := range tests {
+		cfg := NewConfig()
+		cfg.GameName = "test-game"
+		cfg.DrainOrder = tt.order
+
+		mockClient := NewMockAnboxClient()
+		sink := &recordingAuditSink{}
+		manager := NewLocalSessionManager(cfg, mockClient, WithAuditSink(sink))
+		now := time.Now()
+		// Added out of acquire order so the map order cannot pass the test by chance
+		for _, i := range []int{2, 3, 1} {
+			id := fmt.Sprintf("acquired-%d", i)
+			manager.cache[id] = &Session{
+				ID:              id,
+				Status:          InUse,
+				Anbox:           &anbox.SessionDetails{ID: id},
+				CreatedAt:       now,
+				LastHeartbeat:   now,
+				StatusChangedAt: now.Add(time.Duration(i) * time.Minute),
+				ExpiresAt:       now.Add(time.Hour),
+			}
+			mockClient.AddRunningSession(id, "test-game")
+		}
+
+		if err := manager.Drain(context.Background(), 0); err != nil {
+			t.Fatalf("Drain with order %q failed: %v", tt.order, err)
+		}
+		var released []string
+		for _, event := range sink.events {
+			if event.Reason == "release" {
+				released = append(released, event.SessionID)
+			}
+		}
+		if !reflect.DeepEqual(released, tt.want) {
+			t.Errorf("Expected drain order %q to release %v, got %v", tt.order, tt.want, released)
+		}
+	}
+}
+
+func TestLocalSessionManager_PoolEmptyRetryAfter(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	ctx := context.Background()
+
+	poolEmpty := func(err error) *PoolEmptyError {
+		t.Helper()
+		var empty *PoolEmptyError
+		if !errors.Is(err, ErrPoolEmpty) || !errors.As(err, &empty) {
+			t.Fatalf("Expected a pool-empty error, got %v", err)
+		}
+		if !empty.AvailableAt.Equal(clock.Now().Add(empty.RetryAfter)) {
+			t.Errorf("Expected the session to be available after the retry hint, got %s", empty.AvailableAt)
+		}
+		return empty
+	}
+	addCold := func(id string) {
+		manager.cache[id] = &Session{ID: id, Status: Cold, CreatedAt: clock.Now(), LastHeartbeat: clock.Now(), ExpiresAt: clock.Now().Add(time.Hour)}
+	}
+
+	// Nothing on its way
+	_, err := manager.AcquireWarmed(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != cfg.EmptyRetryAfter || empty.Warming != 0 {
+		t.Errorf("Expected the configured %s with nothing warming, got %+v", cfg.EmptyRetryAfter, empty)
+	}
+	_, err = manager.AcquireCold(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != cfg.EmptyRetryAfter {
+		t.Errorf("Expected the configured %s with nothing booting, got %s", cfg.EmptyRetryAfter, empty.RetryAfter)
+	}
+
+	// A warming session is expected to finish after the default warm-up estimate
+	addCold("session-1")
+	warming, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	clock.Advance(4 * time.Second)
+	_, err = manager.AcquireWarmed(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != DefaultWarmupEstimate-4*time.Second || empty.Warming != 1 {
+		t.Errorf("Expected %s left of the warm-up, got %+v", DefaultWarmupEstimate-4*time.Second, empty)
+	}
+
+	// Observed warm-ups replace the default estimate
+	if err := manager.SetWarmed(ctx, "session-1", warming.WarmToken); err != nil {
+		t.Fatalf("Failed to set warmed: %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx); err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	addCold("session-2")
+	if _, err := manager.AcquireCold(ctx); err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	clock.Advance(time.Second)
+	_, err = manager.AcquireWarmed(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != 3*time.Second {
+		t.Errorf("Expected 3s left of a 4s warm-up, got %s", empty.RetryAfter)
+	}
+	clock.Advance(time.Minute)
+	_, err = manager.AcquireWarmed(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != MinRetryAfter {
+		t.Errorf("Expected an overdue warm-up to hint %s, got %s", MinRetryAfter, empty.RetryAfter)
+	}
+
+	// Booting instances become cold sessions on the next sync
+	manager.booting = 2
+	_, err = manager.AcquireCold(ctx)
+	if empty := poolEmpty(err); empty.RetryAfter != cfg.SyncInterval || empty.Booting != 2 {
+		t.Errorf("Expected the sync interval with 2 instances booting, got %+v", empty)
+	}
+}
+
+// recordingAlerter keeps the starvation alerts it receives
+type recordingAlerter struct {
+	alerts []StarvationAlert
+}
+
+func (r *recordingAlerter) Alert(alert StarvationAlert) {
+	r.alerts = append(r.alerts, alert)
+}
+
+func TestLocalSessionManager_StarvationAlert(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.StarvationThreshold = 3
+	cfg.StarvationWindow = time.Minute
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	alerter := &recordingAlerter{}
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock), WithStarvationAlerter(alerter))
+	ctx := context.Background()
+
+	emptyAcquires := func(n int) {
+		for i := 0; i < n; i++ {
+			if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, ErrPoolEmpty) {
+				t.Fatalf("Expected an empty pool, got %v", err)
+			}
+			clock.Advance(time.Second)
+		}
+	}
+
+	// Up to the threshold is not starvation
+	emptyAcquires(3)
+	if len(alerter.alerts) != 0 {
+		t.Fatalf("Expected no alert at the threshold, got %+v", alerter.alerts)
+	}
+
+	// Past it the alert fires once for the window, however many more acquires fail
+	emptyAcquires(20)
+	if len(alerter.alerts) != 1 {
+		t.Fatalf("Expected exactly one alert within the window, got %d", len(alerter.alerts))
+	}
+	if alert := alerter.alerts[0]; alert.Game != "test-game" || alert.EmptyAcquires != 4 || alert.Threshold != 3 || alert.Window != time.Minute {
+		t.Errorf("Expected the alert to report 4 empty acquires over the threshold of 3, got %+v", alert)
+	}
+
+	// Once the window since the alert is over, a still starved pool alerts again
+	emptyAcquires(41)
+	if len(alerter.alerts) != 2 {
+		t.Fatalf("Expected a second alert in the next window, got %d", len(alerter.alerts))
+	}
+
+	// Failures spread out further than the window never add up
+	clock.Advance(time.Hour)
+	for i := 0; i < 10; i++ {
+		emptyAcquires(1)
+		clock.Advance(time.Minute)
+	}
+	if len(alerter.alerts) != 2 {
+		t.Errorf("Expected no alert for sparse empty acquires, got %d", len(alerter.alerts))
+	}
+
+	stats, _ := manager.Stats(ctx)
+	if stats.StarvationAlerts != 2 || stats.AcquireEmpty != 74 {
+		t.Errorf("Expected 2 starvation alerts over 74 empty acquires, got %+v", stats)
+	}
+}
+
+func TestWebhookAlerter(t *testing.T) {
+	received := make(chan StarvationAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert StarvationAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	NewWebhookAlerter(server.URL).Alert(StarvationAlert{Game: "test-game", EmptyAcquires: 6, Threshold: 5, Window: time.Minute})
+	select {
+	case alert := <-received:
+		if alert.Game != "test-game" || alert.EmptyAcquires != 6 || alert.Window != time.Minute {
+			t.Errorf("Expected the alert to be posted as sent, got %+v", alert)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the alert to be posted to the webhook")
+	}
+}
+
+func TestLocalSessionManager_LoopHealthGoesStale(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.SyncInterval = 10 * time.Millisecond
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+
+	if health := manager.LoopHealth(); health.SyncAlive || health.SyncStale || health.SyncStartedAt != nil {
+		t.Fatalf("Expected no sync loop before Start, got %+v", health)
+	}
+	ctx := context.Background()
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start session manager: %v", err)
+	}
+	stopped := false
+	defer func() {
+		if !stopped {
+			manager.Stop(ctx)
+		}
+	}()
+
+	waitFor := func(what string, ok func(LoopHealth) bool) LoopHealth {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			health := manager.LoopHealth()
+			if ok(health) {
+				return health
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s, got %+v", what, health)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	healthy := waitFor("a completed cycle", func(h LoopHealth) bool { return h.SyncAlive && h.LastCycleAt != nil })
+	if healthy.SyncStale || healthy.LastError != "" {
+		t.Fatalf("Expected a healthy sync loop, got %+v", healthy)
+	}
+
+	// A hanging AMS wedges the cycle: the loop is still alive but stops completing cycles
+	stall := make(chan struct{})
+	mockClient.mu.Lock()
+	mockClient.stall = stall
+	mockClient.mu.Unlock()
+	wedged := waitFor("the sync loop to go stale", func(h LoopHealth) bool { return h.SyncStale })
+	if !wedged.SyncAlive {
+		t.Errorf("Expected the wedged loop to still be alive, got %+v", wedged)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if again := manager.LoopHealth(); !again.LastCycleAt.Equal(*wedged.LastCycleAt) {
+		t.Errorf("Expected no cycle to complete while AMS hangs, last cycle moved from %s to %s", wedged.LastCycleAt, again.LastCycleAt)
+	}
+
+	mockClient.mu.Lock()
+	mockClient.stall = nil
+	mockClient.mu.Unlock()
+	close(stall)
+	waitFor("the sync loop to recover", func(h LoopHealth) bool { return !h.SyncStale && h.LastCycleAt.After(*wedged.LastCycleAt) })
+
+	// A stopped loop is stale right away
+	manager.Stop(ctx)
+	stopped = true
+	waitFor("the stopped sync loop to be reported dead", func(h LoopHealth) bool { return !h.SyncAlive && h.SyncStale })
+}
+
+func TestLocalSessionManager_SyncCycleHealth(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient, WithClock(clock))
+	ctx := context.Background()
+
+	manager.syncCycle(ctx)
+	synced := clock.Now()
+	health := manager.LoopHealth()
+	if health.LastSuccessAt == nil || !health.LastSuccessAt.Equal(synced) || health.ConsecutiveFailures != 0 || health.LastError != "" {
+		t.Fatalf("Expected a successful sync at %s, got %+v", synced, health)
+	}
+
+	mockClient.mu.Lock()
+	mockClient.listError = errors.New("AMS unreachable")
+	mockClient.mu.Unlock()
+	for i := 1; i <= 2; i++ {
+		clock.Advance(cfg.SyncInterval)
+		manager.syncCycle(ctx)
+		health = manager.LoopHealth()
+		if !health.LastSuccessAt.Equal(synced) || health.ConsecutiveFailures != i || !strings.Contains(health.LastError, "AMS unreachable") {
+			t.Fatalf("Expected failure %d since the sync at %s, got %+v", i, synced, health)
+		}
+		if !health.LastErrorAt.Equal(clock.Now()) || !health.LastCycleAt.Equal(clock.Now()) {
+			t.Errorf("Expected the failed cycle at %s to be recorded, got %+v", clock.Now(), health)
+		}
+	}
+
+	mockClient.mu.Lock()
+	mockClient.listError = nil
+	mockClient.mu.Unlock()
+	clock.Advance(cfg.SyncInterval)
+	manager.syncCycle(ctx)
+	health = manager.LoopHealth()
+	if !health.LastSuccessAt.Equal(clock.Now()) || health.ConsecutiveFailures != 0 {
+		t.Errorf("Expected the failures to be reset by the sync at %s, got %+v", clock.Now(), health)
+	}
+}
+
+// recordingNotifier keeps the guarantee events it receives
+type recordingNotifier struct {
+	events []GuaranteeEvent
+}
+
+func (r *recordingNotifier) Notify(event GuaranteeEvent) {
+	r.events = append(r.events, event)
+}
+
+func TestLocalSessionManager_WarmedGuarantee(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.MinWarmedGuarantee = 2
+	cfg.GuaranteeBreachAfter = 30 * time.Second
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	notifier := &recordingNotifier{}
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock), WithGuaranteeNotifier(notifier))
+	start := clock.Now()
+	for _, id := range []string{"warmed-1", "warmed-2"} {
+		manager.cache[id] = &Session{ID: id, Status: Warmed, CreatedAt: start, LastHeartbeat: start}
+	}
+
+	assertEvents := func(step string, breaches int64, want ...GuaranteeEventKind) {
+		t.Helper()
+		var got []GuaranteeEventKind
+		for _, event := range notifier.events {
+			got = append(got, event.Kind)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected guarantee events %v, got %v", step, want, got)
+		}
+		stats, _ := manager.Stats(context.Background())
+		if stats.GuaranteeBreaches != breaches {
+			t.Errorf("%s: expected %d guarantee breaches in stats, got %d", step, breaches, stats.GuaranteeBreaches)
+		}
+	}
+
+	manager.checkGuarantee()
+	assertEvents("met", 0)
+
+	// A short dip below the guarantee is not a breach
+	manager.cache["warmed-1"].Status = InUse
+	manager.checkGuarantee()
+	clock.Advance(20 * time.Second)
+	manager.checkGuarantee()
+	manager.cache["warmed-1"].Status = Warmed
+	manager.checkGuarantee()
+	assertEvents("short dip", 0)
+
+	// Staying below for GuaranteeBreachAfter is, and it is reported once
+	manager.cache["warmed-2"].Status = InUse
+	manager.checkGuarantee()
+	below := clock.Now()
+	clock.Advance(29 * time.Second)
+	manager.checkGuarantee()
+	assertEvents("not yet breached", 0)
+	clock.Advance(time.Second)
+	manager.checkGuarantee()
+	clock.Advance(time.Minute)
+	manager.checkGuarantee()
+	assertEvents("breached", 1, GuaranteeBreached)
+	if event := notifier.events[0]; event.Warmed != 1 || event.Guarantee != 2 || !event.BelowSince.Equal(below) || event.Duration != 30*time.Second {
+		t.Errorf("Expected the breach to report 1 of 2 warmed below since %s for 30s, got %+v", below, event)
+	}
+	if stats, _ := manager.Stats(context.Background()); stats.GuaranteeBreachedSince == nil || !stats.GuaranteeBreachedSince.Equal(below) {
+		t.Errorf("Expected stats to show the breach ongoing since %s, got %v", below, stats.GuaranteeBreachedSince)
+	}
+
+	// The recovery is reported as soon as the guarantee is met again
+	manager.cache["new-warmed"] = &Session{ID: "new-warmed", Status: Warmed, CreatedAt: clock.Now(), LastHeartbeat: clock.Now()}
+	manager.checkGuarantee()
+	manager.checkGuarantee()
+	assertEvents("recovered", 1, GuaranteeBreached, GuaranteeRecovered)
+	if event := notifier.events[1]; event.Warmed != 2 || event.Duration != 90*time.Second {
+		t.Errorf("Expected the recovery after a 90s breach with 2 warmed, got %+v", event)
+	}
+	if stats, _ := manager.Stats(context.Background()); stats.GuaranteeBreachedSince != nil {
+		t.Errorf("Expected no ongoing breach after the recovery, got %v", stats.GuaranteeBreachedSince)
+	}
+
+	// A pool paused for maintenance is not held to the guarantee
+	manager.Pause(context.Background())
+	delete(manager.cache, "new-warmed")
+	clock.Advance(time.Hour)
+	manager.checkGuarantee()
+	clock.Advance(time.Hour)
+	manager.checkGuarantee()
+	assertEvents("paused", 1, GuaranteeBreached, GuaranteeRecovered)
+}
+
+func TestLocalSessionManager_Stats(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.CreateBackoff = 0
+	cfg.GracePeriod = 0
+
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	assertStats := func(step string, want Stats) {
+		t.Helper()
+		got, err := manager.Stats(ctx)
+		if err != nil {
+			t.Fatalf("%s: failed to get stats: %v", step, err)
+		}
+		want.Since = got.Since
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected stats %+v, got %+v", step, want, got)
+		}
+	}
+
+	manager.createNewSession(ctx, "")
+	assertStats("create", Stats{Created: 1})
+
+	mockClient.createError = errors.New("connection reset")
+	manager.createNewSession(ctx, "")
+	assertStats("create failure", Stats{Created: 1, CreateFailures: 1, CreateFailureStreak: 1})
+
+	manager.AcquireCold(ctx)
+	manager.AcquireWarmed(ctx)
+	assertStats("acquire empty", Stats{Created: 1, CreateFailures: 1, CreateFailureStreak: 1, AcquireEmpty: 2})
+
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	manager.AcquireCold(ctx)
+	manager.AcquireWarmed(ctx)
+	assertStats("acquire success", Stats{Created: 1, CreateFailures: 1, CreateFailureStreak: 1, AcquireEmpty: 2, AcquireSuccess: 2})
+
+	if err := manager.Release(ctx, "warmed-1", ReleaseClient); err != nil {
+		t.Fatalf("Failed to release session: %v", err)
+	}
+	assertStats("release", Stats{Created: 1, CreateFailures: 1, CreateFailureStreak: 1, AcquireEmpty: 2, AcquireSuccess: 2, Released: 1,
+		ReleaseReasons: map[ReleaseReason]int64{ReleaseClient: 1}})
+
+	manager.cache["cold-1"].CreatedAt = now.Add(-2 * cfg.SessionTTL)
+	manager.cleanupExpired()
+	assertStats("expire", Stats{Created: 1, CreateFailures: 1, CreateFailureStreak: 1, AcquireEmpty: 2, AcquireSuccess: 2, Released: 1, Expired: 1,
+		ReleaseReasons: map[ReleaseReason]int64{ReleaseClient: 1, ReleaseExpired: 1}})
+}
+
+func TestLocalSessionManager_ReleaseRetriesFailedDelete(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	mockClient.deleteError = anbox.ErrUpstreamUnavailable
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now, Anbox: &anbox.SessionDetails{ID: "in-use-1"}}
+	ctx := context.Background()
+
+	// The breaker rejects the delete, the session already left the pool
+	if err := manager.Release(ctx, "in-use-1", ReleaseClient); err == nil {
+		t.Fatalf("Expected the rejected delete to be reported")
+	}
+	if pending := manager.LoopHealth().DeletesPending; pending != 1 {
+		t.Fatalf("Expected the failed delete to be queued, got %d pending", pending)
+	}
+
+	// The instance is still running, a sync must not adopt it back into the pool as cold
+	mockClient.AddRunningSession("in-use-1", cfg.appName())
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync running sessions: %v", err)
+	}
+	if _, adopted := manager.cache["in-use-1"]; adopted {
+		t.Errorf("Expected the session waiting to be deleted not to be adopted")
+	}
+
+	// A retry while the gateway still fails keeps it queued, one after it recovered deletes it
+	manager.retryDeletes(ctx)
+	if pending := manager.LoopHealth().DeletesPending; pending != 1 {
+		t.Errorf("Expected the delete to stay queued while it fails, got %d pending", pending)
+	}
+	mockClient.mu.Lock()
+	mockClient.deleteError = nil
+	mockClient.mu.Unlock()
+	manager.retryDeletes(ctx)
+	if pending := manager.LoopHealth().DeletesPending; pending != 0 {
+		t.Errorf("Expected the retried delete to succeed, got %d pending", pending)
+	}
+}
+
+func TestLocalSessionManager_ReleaseDeletesWithoutLock(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	mockClient.deleteStall = make(chan struct{})
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now, Anbox: &anbox.SessionDetails{ID: "in-use-1"}}
+	manager.cache["in-use-2"] = &Session{ID: "in-use-2", Status: InUse, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	released := make(chan error, 1)
+	go func() {
+		released <- manager.Release(ctx, "in-use-1", ReleaseClient)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for manager.LoopHealth().DeletesInFlight == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the delete to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The hung delete does not hold the lock every other call of the game needs
+	heartbeat := make(chan error, 1)
+	go func() {
+		heartbeat <- manager.Heartbeat(ctx, "in-use-2")
+	}()
+	select {
+	case err := <-heartbeat:
+		if err != nil {
+			t.Errorf("Expected the heartbeat to succeed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the heartbeat not to wait for the delete")
+	}
+
+	close(mockClient.deleteStall)
+	if err := <-released; err != nil {
+		t.Errorf("Expected the release to succeed once the delete went through, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_ReleaseReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		session Session
+		end     func(ctx context.Context, m *LocalSessionManager) error
+		want    ReleaseReason
+	}{
+		{"client release", Session{Status: InUse}, func(ctx context.Context, m *LocalSessionManager) error {
+			return m.Release(ctx, "session-1", ReleaseClient)
+		}, ReleaseClient},
+		{"ttl expiry", Session{Status: Cold, CreatedAt: time.Now().Add(-time.Hour)}, func(ctx context.Context, m *LocalSessionManager) error {
+			m.cleanupExpired()
+			return nil
+		}, ReleaseExpired},
+		{"heartbeat timeout", Session{Status: InUse, LastHeartbeat: time.Now().Add(-time.Hour)}, func(ctx context.Context, m *LocalSessionManager) error {
+			m.cleanupExpired()
+			return nil
+		}, ReleaseHeartbeatTimeout},
+		{"drain", Session{Status: InUse}, func(ctx context.Context, m *LocalSessionManager) error {
+			return m.Drain(ctx, 0)
+		}, ReleaseDrain},
+		{"gateway reports it dead", Session{Status: InUse}, func(ctx context.Context, m *LocalSessionManager) error {
+			m.reclaimDead("session-1", "gateway_session_error")
+			return nil
+		}, ReleaseErrored},
+		{"gone from AMS", Session{Status: Cold}, func(ctx context.Context, m *LocalSessionManager) error {
+			if err := m.anboxClient.Delete(ctx, "session-1"); err != nil {
+				return err
+			}
+			return m.syncRunningSession(ctx)
+		}, ReleaseErrored},
+		{"eviction", Session{Status: Cold}, func(ctx context.Context, m *LocalSessionManager) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if !m.evictLocked() {
+				return errors.New("nothing evicted")
+			}
+			return nil
+		}, ReleaseEvicted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.GameName = "test-game"
+			cfg.GracePeriod = 0
+			cfg.EvictionPolicy = EvictOldestCold
+			mockClient := NewMockAnboxClient()
+			mockClient.AddRunningSession("session-1", "test-game")
+			sink := &recordingAuditSink{}
+			releases := &recordingReleaseNotifier{}
+			manager := NewLocalSessionManager(cfg, mockClient, WithAuditSink(sink), WithReleaseNotifier(releases))
+
+			now := time.Now()
+			s := tt.session
+			s.ID = "session-1"
+			s.Anbox = &anbox.SessionDetails{ID: "session-1"}
+			if s.CreatedAt.IsZero() {
+				s.CreatedAt = now
+			}
+			if s.LastHeartbeat.IsZero() {
+				s.LastHeartbeat = now
+			}
+			manager.cache[s.ID] = &s
+
+			if err := tt.end(context.Background(), manager); err != nil {
+				t.Fatalf("Failed to end session: %v", err)
+			}
+
+			stats, err := manager.Stats(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to get stats: %v", err)
+			}
+			if want := map[ReleaseReason]int64{tt.want: 1}; !reflect.DeepEqual(stats.ReleaseReasons, want) {
+				t.Errorf("Expected release reasons %v, got %v", want, stats.ReleaseReasons)
+			}
+			if len(sink.events) != 1 || sink.events[0].To != Deleted || sink.events[0].ReleaseReason != tt.want {
+				t.Errorf("Expected one deletion audited with reason %s, got %+v", tt.want, sink.events)
+			}
+			// Only in-use sessions are reported as released
+			if tt.session.Status == InUse {
+				if len(releases.reasons) != 1 || releases.reasons["session-1"] != tt.want {
+					t.Errorf("Expected the release to be reported with reason %s, got %v", tt.want, releases.reasons)
+				}
+			} else if len(releases.reasons) != 0 {
+				t.Errorf("Expected no release reported for a %s session, got %v", tt.session.Status, releases.reasons)
+			}
+		})
+	}
+}
+
+// recordingReleaseNotifier keeps the reason each released session was reported with
+type recordingReleaseNotifier struct {
+	reasons map[string]ReleaseReason
+}
+
+func (n *recordingReleaseNotifier) Released(session Session, reason ReleaseReason) {
+	if n.reasons == nil {
+		n.reasons = make(map[string]ReleaseReason)
+	}
+	n.reasons[session.ID] = reason
+}
+
+func TestLocalSessionManager_EvictionUnderMax(t *testing.T) {
+	newManager := func(policy EvictionPolicy, sessions ...*Session) (*LocalSessionManager, *MockAnboxClient) {
+		cfg := NewConfig()
+		cfg.GameName = "test-game"
+		cfg.Min = 0
+		cfg.Max = len(sessions)
+		cfg.OnDemand = true
+		cfg.EvictionPolicy = policy
+		mockClient := NewMockAnboxClient()
+		manager := NewLocalSessionManager(cfg, mockClient)
+		for _, s := range sessions {
+			manager.cache[s.ID] = s
+		}
+		return manager, mockClient
+	}
+	now := time.Now()
+	newSession := func(id string, status SessionStatus, age time.Duration) *Session {
+		return &Session{ID: id, Status: status, CreatedAt: now.Add(-age), LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	// The oldest cold session is reclaimed, in-use and warming ones are kept
+	manager, _ := newManager(EvictOldestCold,
+		newSession("in-use-old", InUse, time.Hour),
+		newSession("warming-old", Warming, time.Hour),
+		newSession("cold-new", Cold, time.Minute),
+		newSession("cold-old", Cold, 10*time.Minute),
+	)
+	session, err := manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Expected eviction to make room, got %v", err)
+	}
+	if _, exists := manager.cache["cold-old"]; exists {
+		t.Errorf("Expected the oldest cold session to be evicted")
+	}
+	for _, id := range []string{"in-use-old", "warming-old", "cold-new", session.ID} {
+		if _, exists := manager.cache[id]; !exists {
+			t.Errorf("Expected session %s to be kept", id)
+		}
+	}
+	if stats, _ := manager.Stats(ctx); stats.Evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", stats.Evicted)
+	}
+
+	// Nothing idle to reclaim: the acquire is refused and nothing is evicted
+	manager, mockClient := newManager(EvictOldestIdle,
+		newSession("in-use-1", InUse, time.Hour),
+		newSession("warming-1", Warming, time.Hour),
+	)
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Errorf("Expected acquire to fail when only in-use and warming sessions exist")
+	}
+	if len(manager.cache) != 2 || mockClient.CreateCount() != 0 {
+		t.Errorf("Expected in-use and warming sessions to be protected")
+	}
+	if stats, _ := manager.Stats(ctx); stats.Evicted != 0 {
+		t.Errorf("Expected no eviction, got %d", stats.Evicted)
+	}
+
+	// Without a policy the acquire is refused even with idle sessions
+	manager, _ = newManager(EvictNone, newSession("cold-1", Cold, time.Hour))
+	if _, err := manager.AcquireWarmed(ctx); err == nil {
+		t.Errorf("Expected acquire to fail without an eviction policy")
+	}
+	if _, exists := manager.cache["cold-1"]; !exists {
+		t.Errorf("Expected cold session to be kept without an eviction policy")
+	}
+}
+
+func TestLocalSessionManager_Metadata(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	// Metadata is set as part of the acquire
+	session, err := manager.AcquireWarmed(ctx, WithMetadata(map[string]string{"player_id": "p-1", "bucket": "a"}))
+	if err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	if session.Metadata["player_id"] != "p-1" || session.Metadata["bucket"] != "a" {
+		t.Errorf("Expected metadata to be set at acquire time, got %v", session.Metadata)
+	}
+
+	// SetMetadata merges keys and removes the ones set to empty
+	acquired := session.Metadata
+	if err := manager.SetMetadata(ctx, "warmed-1", map[string]string{"campaign_id": "c-1", "bucket": ""}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	got, _ := manager.GetSession(ctx, "warmed-1")
+	if got.Metadata["campaign_id"] != "c-1" || got.Metadata["player_id"] != "p-1" {
+		t.Errorf("Expected metadata to be merged, got %v", got.Metadata)
+	}
+	if _, exists := got.Metadata["bucket"]; exists {
+		t.Errorf("Expected empty value to remove the key, got %v", got.Metadata)
+	}
+	if acquired["bucket"] != "a" {
+		t.Errorf("Expected metadata returned earlier not to be mutated, got %v", acquired)
+	}
+
+	if err := manager.SetMetadata(ctx, "missing", map[string]string{"k": "v"}); err == nil {
+		t.Errorf("Expected error for unknown session")
+	}
+}
+
+func TestLocalSessionManager_MetadataBounds(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("key-%d", i)] = "v"
+	}
+	longValue := make([]byte, MaxMetadataValueLength+1)
+	for i := range longValue {
+		longValue[i] = 'x'
+	}
+
+	for name, kv := range map[string]map[string]string{
+		"too many keys": tooMany,
+		"long value":    {"k": string(longValue)},
+		"empty key":     {"": "v"},
+	} {
+		if _, err := manager.AcquireCold(ctx, WithMetadata(kv)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: expected ErrInvalidMetadata on acquire, got %v", name, err)
+		}
+		if err := manager.SetMetadata(ctx, "cold-1", kv); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: expected ErrInvalidMetadata on set, got %v", name, err)
+		}
+	}
+
+	// A rejected acquire does not consume the session
+	if manager.cache["cold-1"].Status != Cold {
+		t.Errorf("Expected cold session to stay cold after a rejected acquire")
+	}
+}
+
+func TestLocalSessionManager_IdempotentAcquire(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.IdempotencyTTL = time.Minute
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	for _, id := range []string{"warmed-1", "warmed-2"} {
+		manager.cache[id] = &Session{ID: id, Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	first, err := manager.AcquireWarmed(ctx, WithIdempotencyKey("key-1"))
+	if err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	second, err := manager.AcquireWarmed(ctx, WithIdempotencyKey("key-1"))
+	if err != nil {
+		t.Fatalf("Failed to repeat acquire: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("Expected the same session for a repeated key, got %s and %s", first.ID, second.ID)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Warmed != 1 || status.InUse != 1 {
+		t.Errorf("Expected only one session consumed, got %+v", status)
+	}
+	if stats, _ := manager.Stats(ctx); stats.AcquireSuccess != 1 {
+		t.Errorf("Expected one successful acquire, got %d", stats.AcquireSuccess)
+	}
+
+	// A different key acquires another session
+	other, err := manager.AcquireWarmed(ctx, WithIdempotencyKey("key-2"))
+	if err != nil {
+		t.Fatalf("Failed to acquire with another key: %v", err)
+	}
+	if other.ID == first.ID {
+		t.Errorf("Expected a different session for a different key")
+	}
+
+	// Expired keys acquire again
+	manager.idempotencyKeys["key-1"] = idempotentAcquire{sessionID: first.ID, expiresAt: now.Add(-time.Second)}
+	manager.cleanupExpired()
+	if _, exists := manager.idempotencyKeys["key-1"]; exists {
+		t.Errorf("Expected expired idempotency key to be forgotten")
+	}
+	if _, err := manager.AcquireWarmed(ctx, WithIdempotencyKey("key-1")); err == nil {
+		t.Errorf("Expected an expired key to acquire a new session from the empty pool")
+	}
+}
+
+func TestLocalSessionManager_IdempotencyKeyScope(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.IdempotencyTTL = time.Minute
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	for _, id := range []string{"warmed-1", "warmed-2"} {
+		manager.cache[id] = &Session{ID: id, Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	cold, err := manager.AcquireCold(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-a"))
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	again, err := manager.AcquireCold(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-a"))
+	if err != nil || again.ID != cold.ID {
+		t.Fatalf("Expected the same caller to replay the cold acquire, got %v, %v", again, err)
+	}
+
+	// The key belongs to a cold acquire by partner-a
+	if _, err := manager.AcquireWarmed(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-a")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected a warmed acquire with a cold key to conflict, got %v", err)
+	}
+	if _, err := manager.AcquireCold(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-b")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected another caller replaying the key to conflict, got %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Warmed != 2 {
+		t.Errorf("Expected conflicting replays not to consume sessions, got %+v", status)
+	}
+
+	// Once the session is warmed the cold acquire can no longer be replayed
+	if err := manager.SetWarmed(ctx, cold.ID, cold.WarmToken); err != nil {
+		t.Fatalf("Failed to set session warmed: %v", err)
+	}
+	if _, err := manager.AcquireCold(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-a")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected replaying a cold acquire of a warmed session to conflict, got %v", err)
+	}
+
+	// A specific acquire replays only for the session it acquired
+	if _, err := manager.AcquireSpecific(ctx, "warmed-1", WithIdempotencyKey("key-2")); err != nil {
+		t.Fatalf("Failed to acquire specific session: %v", err)
+	}
+	if _, err := manager.AcquireSpecific(ctx, "warmed-1", WithIdempotencyKey("key-2")); err != nil {
+		t.Errorf("Expected the specific acquire to be replayed, got %v", err)
+	}
+	if _, err := manager.AcquireSpecific(ctx, "warmed-2", WithIdempotencyKey("key-2")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected a specific acquire of another session to conflict, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_PerKeyQuota(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.MaxSessionsPerKey = 1
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	for _, id := range []string{"warmed-1", "warmed-2", "warmed-3"} {
+		manager.cache[id] = &Session{ID: id, Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	first, err := manager.AcquireWarmed(ctx, WithAPIKey("partner-a"))
+	if err != nil {
+		t.Fatalf("Failed to acquire for partner-a: %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx, WithAPIKey("partner-a")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected partner-a to hit its quota, got %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx, WithAPIKey("partner-b")); err != nil {
+		t.Errorf("Expected partner-b to still acquire, got %v", err)
+	}
+
+	stats, _ := manager.Stats(ctx)
+	if stats.KeyUsage[KeyFingerprint("partner-a")] != 1 || stats.KeyUsage[KeyFingerprint("partner-b")] != 1 {
+		t.Errorf("Expected one session per partner in stats, got %v", stats.KeyUsage)
+	}
+	if _, exposed := stats.KeyUsage["partner-a"]; exposed {
+		t.Errorf("Expected stats not to expose raw API keys")
+	}
+
+	// Releasing frees the quota again
+	if err := manager.Release(ctx, first.ID, ReleaseClient); err != nil {
+		t.Fatalf("Failed to release session: %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx, WithAPIKey("partner-a")); err != nil {
+		t.Errorf("Expected partner-a to acquire after a release, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_WarmingTimeout(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.WarmingTimeout = 50 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx, WithIdempotencyKey("key-1"), WithAPIKey("partner-a"))
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+
+	// Right at the timeout the session stays warming
+	clock.Advance(cfg.WarmingTimeout)
+	manager.cleanupExpired()
+	if session.Status != Warming {
+		t.Fatalf("Expected session to stay warming within the timeout, got %s", session.Status)
+	}
+
+	// The client never calls SetWarmed
+	clock.Advance(time.Millisecond)
+	manager.cleanupExpired()
+
+	got, err := manager.GetSession(ctx, "cold-1")
+	if err != nil {
+		t.Fatalf("Expected the session to be kept: %v", err)
+	}
+	if got.Status != Cold {
+		t.Errorf("Expected session to revert to cold after the warming timeout, got %s", got.Status)
+	}
+	if got.APIKey != "" {
+		t.Errorf("Expected the reverted session to drop its API key")
+	}
+	if _, exists := manager.idempotencyKeys["key-1"]; exists {
+		t.Errorf("Expected the idempotency key of the reverted session to be forgotten")
+	}
+
+	// The reverted session can be acquired again
+	if _, err := manager.AcquireCold(ctx); err != nil {
+		t.Errorf("Expected the reverted session to be acquirable, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_MaxWarmingDuration(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.MaxWarmingDuration = 30 * time.Second
+	clock := NewFakeClock(time.Now())
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient, WithClock(clock))
+	now := clock.Now()
+	for _, id := range []string{"slow-1", "stuck-1"} {
+		manager.cache[id] = &Session{ID: id, Status: Cold, CreatedAt: now, LastHeartbeat: now, Anbox: &anbox.SessionDetails{ID: id}}
+		mockClient.sessions[id] = "test-game"
+	}
+	ctx := context.Background()
+
+	slow, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	stuck, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+
+	// Warming slowly but within the max succeeds
+	clock.Advance(cfg.MaxWarmingDuration)
+	manager.cleanupExpired()
+	if err := manager.SetWarmed(ctx, slow.ID, slow.WarmToken); err != nil {
+		t.Fatalf("Expected a session warming within the max to become warmed, got %v", err)
+	}
+
+	// The other one never finishes and is reclaimed with its instance
+	clock.Advance(time.Millisecond)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, stuck.ID); err == nil {
+		t.Fatalf("Expected the session warming past the max to be reclaimed")
+	}
+	if got, err := manager.GetSession(ctx, slow.ID); err != nil || got.Status != Warmed {
+		t.Errorf("Expected the slow session to stay warmed, got %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mockClient.mu.Lock()
+		_, exists := mockClient.sessions[stuck.ID]
+		mockClient.mu.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the anbox session of %s to be deleted", stuck.ID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := manager.SetWarmed(ctx, stuck.ID, stuck.WarmToken); err == nil {
+		t.Errorf("Expected a late SetWarmed of the reclaimed session to fail")
+	}
+
+	// With the revert action the session goes back to cold instead
+	cfg.MaxWarmingAction = WarmingOverrunRevert
+	manager = NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now = clock.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	if _, err := manager.AcquireCold(ctx); err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	clock.Advance(cfg.MaxWarmingDuration + time.Millisecond)
+	manager.cleanupExpired()
+	got, err := manager.GetSession(ctx, "cold-1")
+	if err != nil {
+		t.Fatalf("Expected the session to be kept with the revert action: %v", err)
+	}
+	if got.Status != Cold {
+		t.Errorf("Expected session to revert to cold, got %s", got.Status)
+	}
+}
+
+func TestLocalSessionManager_AbandonWarming(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now, Anbox: &anbox.SessionDetails{ID: "cold-1"}}
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now}
+	mockClient.AddRunningSession("cold-1", "test-game")
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	// Only the caller holding the warm token may abandon, and not while the warm-up actions run
+	for _, token := range []string{"", "not-the-token"} {
+		if err := manager.AbandonWarming(ctx, session.ID, token); !errors.Is(err, ErrInvalidWarmToken) {
+			t.Errorf("Expected ErrInvalidWarmToken for token %q, got %v", token, err)
+		}
+	}
+	cached := manager.cache[session.ID]
+	manager.mu.Lock()
+	cached.warmup = &warmupRun{done: make(chan struct{})}
+	manager.mu.Unlock()
+	if err := manager.AbandonWarming(ctx, session.ID, session.WarmToken); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState while the warm-up runs, got %v", err)
+	}
+	manager.mu.Lock()
+	cached.warmup = nil
+	manager.mu.Unlock()
+	if cached.Status != Warming {
+		t.Fatalf("Expected the refused abandons to keep the session warming, got %s", cached.Status)
+	}
+
+	if err := manager.AbandonWarming(ctx, session.ID, session.WarmToken); err != nil {
+		t.Fatalf("Failed to abandon warming session: %v", err)
+	}
+	if cached.Status != Cold {
+		t.Errorf("Expected abandoned session to be cold, got %s", cached.Status)
+	}
+	if _, exists := mockClient.sessions["cold-1"]; !exists {
+		t.Errorf("Expected the anbox session to be kept")
+	}
+
+	// Only warming sessions can be abandoned
+	for _, id := range []string{"cold-1", "in-use-1"} {
+		if err := manager.AbandonWarming(ctx, id, ""); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("Expected ErrInvalidState for %s, got %v", id, err)
+		}
+	}
+	if manager.cache["in-use-1"].Status != InUse {
+		t.Errorf("Expected in-use session to be untouched")
+	}
+	if err := manager.AbandonWarming(ctx, "missing", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for unknown session, got %v", err)
+	}
+	if err := manager.SetWarmed(ctx, "missing", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound from SetWarmed, got %v", err)
+	}
+	if err := manager.SetWarmed(ctx, "in-use-1", ""); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState from SetWarmed of an in-use session, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_SetWarmedRequiresWarmToken(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	abandoned := session.WarmToken
+	if abandoned == "" {
+		t.Fatalf("Expected AcquireCold to hand out a warm token")
+	}
+	if err := manager.AbandonWarming(ctx, session.ID, abandoned); err != nil {
+		t.Fatalf("Failed to abandon warming session: %v", err)
+	}
+
+	// The next acquire gets a fresh token, the one of the abandoned warm-up is void
+	session, err = manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	for _, token := range []string{"", "not-the-token", abandoned} {
+		if err := manager.SetWarmed(ctx, session.ID, token); !errors.Is(err, ErrInvalidWarmToken) {
+			t.Errorf("Expected ErrInvalidWarmToken for token %q, got %v", token, err)
+		}
+	}
+	cached := manager.cache[session.ID]
+	if cached.Status != Warming {
+		t.Fatalf("Expected the session to stay warming, got %s", cached.Status)
+	}
+
+	if err := manager.SetWarmed(ctx, session.ID, session.WarmToken); err != nil {
+		t.Fatalf("Failed to set warmed with the acquired token: %v", err)
+	}
+	if cached.Status != Warmed || cached.WarmToken != "" {
+		t.Errorf("Expected a warmed session without token, got %s %q", cached.Status, cached.WarmToken)
+	}
+}
+
+func TestLocalSessionManager_SyncReclaimsFailedInstance(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("session-1", "test-game")
+	mockClient.AddRunningSession("session-2", "test-game")
+	sink := &recordingAuditSink{}
+	manager := NewLocalSessionManager(cfg, mockClient, WithAuditSink(sink))
+	ctx := context.Background()
+
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Cold != 2 {
+		t.Fatalf("Expected 2 cold sessions, got %d", status.Cold)
+	}
+
+	// session-1 flips to error on AMS while cached as cold
+	mockClient.mu.Lock()
+	mockClient.instanceStatus = map[string]string{"session-1": "error"}
+	mockClient.mu.Unlock()
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+
+	if _, exists := manager.cache["session-1"]; exists {
+		t.Errorf("Expected the errored session to be reclaimed")
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.SessionID != "session-1" || last.Reason != "instance_error" {
+		t.Errorf("Expected session-1 to be reclaimed for its instance error, got %+v", last)
+	}
+	for range 2 {
+		session, err := manager.AcquireCold(ctx)
+		if err == nil && session.ID == "session-1" {
+			t.Errorf("Expected the errored session never to be handed out")
+		}
+	}
+}
+
+func TestLocalSessionManager_SyncKeepsInUseSessionMissingBriefly(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.InUseAbsentSyncs = 2
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("in-use-1", "test-game")
+	mockClient.AddRunningSession("cold-1", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	manager.cache["in-use-1"].Status = InUse
+	blip := func() {
+		mockClient.mu.Lock()
+		delete(mockClient.sessions, "in-use-1")
+		delete(mockClient.sessions, "cold-1")
+		mockClient.mu.Unlock()
+		if err := manager.syncRunningSession(ctx); err != nil {
+			t.Fatalf("Failed to sync sessions: %v", err)
+		}
+	}
+
+	// Both blip out of the AMS list for one cycle, only the idle session is pruned
+	blip()
+	if _, exists := manager.cache["in-use-1"]; !exists {
+		t.Fatalf("Expected the in-use session to survive a single absence from AMS")
+	}
+	if _, exists := manager.cache["cold-1"]; exists {
+		t.Errorf("Expected the cold session to be pruned on its first absence")
+	}
+
+	// Listed again, the count starts over
+	mockClient.AddRunningSession("in-use-1", "test-game")
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	blip()
+	if s, exists := manager.cache["in-use-1"]; !exists || s.Status != InUse {
+		t.Fatalf("Expected the in-use session to survive after reappearing, got %+v", s)
+	}
+
+	// Missing for InUseAbsentSyncs syncs in a row prunes it
+	blip()
+	if _, exists := manager.cache["in-use-1"]; exists {
+		t.Errorf("Expected the in-use session to be pruned after %d absences", cfg.InUseAbsentSyncs)
+	}
+}
+
+func TestLocalSessionManager_DeletePool(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	for id, status := range map[string]SessionStatus{"cold-1": Cold, "warming-1": Warming, "warmed-1": Warmed, "in-use-1": InUse} {
+		mockClient.AddRunningSession(id, "test-game")
+		manager.cache[id] = &Session{ID: id, Status: status, Anbox: &anbox.SessionDetails{ID: id}, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	deleted, err := manager.DeletePool(ctx)
+	if err != nil || deleted != 3 {
+		t.Fatalf("Expected 3 pool sessions deleted, got %d, %v", deleted, err)
+	}
+	mockClient.mu.Lock()
+	remaining := slices.Collect(maps.Keys(mockClient.sessions))
+	mockClient.mu.Unlock()
+	if !slices.Equal(remaining, []string{"in-use-1"}) {
+		t.Errorf("Expected only the in-use session left on anbox, got %v", remaining)
+	}
+	if ids := slices.Collect(maps.Keys(manager.cache)); !slices.Equal(ids, []string{"in-use-1"}) {
+		t.Errorf("Expected only the in-use session left in the pool, got %v", ids)
+	}
+	if stats, _ := manager.Stats(ctx); stats.ReleaseReasons[ReleaseShutdown] != 3 {
+		t.Errorf("Expected 3 shutdown releases, got %v", stats.ReleaseReasons)
+	}
+	if _, err := manager.AcquireCold(ctx); !errors.Is(err, ErrDraining) {
+		t.Errorf("Expected no session handed out after DeletePool, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_AcquireSpecific(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	sink := &recordingAuditSink{}
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithAuditSink(sink))
+	now := time.Now()
+	for id, status := range map[string]SessionStatus{"warmed-1": Warmed, "warmed-2": Warmed, "cold-1": Cold, "warming-1": Warming} {
+		manager.cache[id] = &Session{ID: id, Status: status, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	session, err := manager.AcquireSpecific(ctx, "warmed-2", WithMetadata(map[string]string{"player": "p-1"}))
+	if err != nil {
+		t.Fatalf("Failed to acquire warmed-2: %v", err)
+	}
+	if session.ID != "warmed-2" || session.Status != InUse || session.Metadata["player"] != "p-1" {
+		t.Errorf("Expected warmed-2 in use with the player metadata, got %+v", session)
+	}
+	if s, _ := manager.GetSession(ctx, "warmed-1"); s.Status != Warmed {
+		t.Errorf("Expected the other warmed session untouched, got %s", s.Status)
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.SessionID != "warmed-2" || last.To != InUse || last.Reason != "acquire_specific" {
+		t.Errorf("Expected the acquire audited, got %+v", last)
+	}
+
+	// Sessions that are not warmed, in use already or unknown are not handed out
+	for _, id := range []string{"cold-1", "warming-1", "warmed-2"} {
+		if _, err := manager.AcquireSpecific(ctx, id); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("Expected ErrInvalidState acquiring %s, got %v", id, err)
+		}
+	}
+	if _, err := manager.AcquireSpecific(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for an unknown session, got %v", err)
+	}
+	if s, _ := manager.GetSession(ctx, "cold-1"); s.Status != Cold {
+		t.Errorf("Expected the cold session to stay cold, got %s", s.Status)
+	}
+}
+
+func TestLocalSessionManager_ConcurrentSetWarmed(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	sink := &recordingAuditSink{}
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithAuditSink(sink))
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	token := session.WarmToken
+
+	// Both racing calls succeed, whichever comes second finds the session warmed already
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			errs <- manager.SetWarmed(ctx, "cold-1", token)
+		}()
+	}
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected both SetWarmed calls to succeed, got %v", err)
+		}
+	}
+	warmed := 0
+	for _, event := range sink.events {
+		if event.To == Warmed {
+			warmed++
+		}
+	}
+	if status := manager.cache["cold-1"].Status; status != Warmed || warmed != 1 {
+		t.Errorf("Expected the session warmed exactly once, got %s after %d transitions", status, warmed)
+	}
+
+	// Another token and incompatible states are still rejected
+	if err := manager.SetWarmed(ctx, "cold-1", "not-the-token"); err == nil {
+		t.Errorf("Expected SetWarmed with another token to fail on a warmed session")
+	}
+	if _, err := manager.AcquireWarmed(ctx); err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	if err := manager.SetWarmed(ctx, "cold-1", token); err == nil {
+		t.Errorf("Expected SetWarmed to fail on an in-use session")
+	}
+}
+
+// recordingWarmupRunner records the warm-up actions it runs, failing the command fail and blocking on
+// release when set
+type recordingWarmupRunner struct {
+	mu      sync.Mutex
+	actions []string
+	fail    string
+	release chan struct{}
+}
+
+func (r *recordingWarmupRunner) RunWarmupAction(ctx context.Context, sessionID string, action WarmupAction) error {
+	r.mu.Lock()
+	r.actions = append(r.actions, sessionID+": "+action.String())
+	r.mu.Unlock()
+	if r.release != nil {
+		<-r.release
+	}
+	if len(action.Command) > 0 && action.Command[0] == r.fail {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func (r *recordingWarmupRunner) ran() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.actions...)
+}
+
+func TestLocalSessionManager_WarmupActions(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.WarmupActions = []WarmupAction{
+		{Tap: []int{360, 1100}},
+		{Wait: 5 * time.Millisecond},
+		{Command: []string{"settings", "put", "system", "system_locales", "en-US"}},
+	}
+	runner := &recordingWarmupRunner{release: make(chan struct{})}
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithWarmupRunner(runner))
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	manager.cache["cold-2"] = &Session{ID: "cold-2", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	id, token := session.ID, session.WarmToken
+
+	// Both calls wait for the one warm-up, the session stays warming until its actions succeeded
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			errs <- manager.SetWarmed(ctx, id, token)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s, _ := manager.GetSession(ctx, id); s.Status != Warming {
+		t.Errorf("Expected the session to stay warming during its warm-up, got %s", s.Status)
+	}
+	close(runner.release)
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected SetWarmed to succeed after the warm-up, got %v", err)
+		}
+	}
+	if s, _ := manager.GetSession(ctx, id); s.Status != Warmed {
+		t.Errorf("Expected the session warmed, got %s", s.Status)
+	}
+	want := []string{id + ": tap [360 1100]", id + ": command [settings put system system_locales en-US]"}
+	if got := runner.ran(); !slices.Equal(got, want) {
+		t.Errorf("Expected the actions to run once in order, got %v", got)
+	}
+
+	// A failing action reclaims the session
+	runner.fail = "settings"
+	runner.release = nil
+	session, err = manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	if err := manager.SetWarmed(ctx, session.ID, session.WarmToken); !errors.Is(err, ErrWarmupFailed) {
+		t.Errorf("Expected ErrWarmupFailed, got %v", err)
+	}
+	if _, err := manager.GetSession(ctx, session.ID); err == nil {
+		t.Errorf("Expected the session whose warm-up failed to be reclaimed")
+	}
+	if stats, _ := manager.Stats(ctx); stats.ReleaseReasons[ReleaseErrored] != 1 {
+		t.Errorf("Expected one errored release, got %v", stats.ReleaseReasons)
+	}
+}
+
+// inputAnboxClient is a MockAnboxClient recording the commands it runs and the input it is sent
+type inputAnboxClient struct {
+	*MockAnboxClient
+	mu       sync.Mutex
+	commands [][]string
+	inputs   []anbox.Input
+}
+
+func (m *inputAnboxClient) LaunchApp(ctx context.Context, sessionID string, commands [][]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, commands...)
+	return nil
+}
+
+func (m *inputAnboxClient) SendInput(ctx context.Context, sessionID string, input anbox.Input) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inputs = append(m.inputs, input)
+	return nil
+}
+
+func TestLocalSessionManager_WarmupInputPassthrough(t *testing.T) {
+	actions := []WarmupAction{
+		{Tap: []int{360, 1100}},
+		{Swipe: []int{100, 800, 900, 800, 300}},
+		{Text: "player one"},
+		{Command: []string{"true"}},
+	}
+	for _, viaGateway := range []bool{false, true} {
+		cfg := NewConfig()
+		cfg.GameName = "test-game"
+		cfg.WarmupActions = actions
+		cfg.WarmupInputViaGateway = viaGateway
+		client := &inputAnboxClient{MockAnboxClient: NewMockAnboxClient()}
+		manager := NewLocalSessionManager(cfg, client)
+		now := time.Now()
+		manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+		ctx := context.Background()
+
+		session, err := manager.AcquireCold(ctx)
+		if err != nil {
+			t.Fatalf("Failed to acquire cold session: %v", err)
+		}
+		if err := manager.SetWarmed(ctx, session.ID, session.WarmToken); err != nil {
+			t.Fatalf("Expected SetWarmed to succeed, got %v", err)
+		}
+
+		wantCommands := [][]string{{"true"}}
+		var wantInputs []anbox.Input
+		if viaGateway {
+			wantInputs = []anbox.Input{
+				{Type: anbox.InputTap, X: 360, Y: 1100},
+				{Type: anbox.InputSwipe, X: 100, Y: 800, ToX: 900, ToY: 800, DurationMS: 300},
+				{Type: anbox.InputText, Text: "player one"},
+			}
+		} else {
+			wantCommands = [][]string{
+				{"input", "tap", "360", "1100"},
+				{"input", "swipe", "100", "800", "900", "800", "300"},
+				{"input", "text", "player%sone"},
+				{"true"},
+			}
+		}
+		if !reflect.DeepEqual(client.commands, wantCommands) {
+			t.Errorf("via gateway %v: expected commands %v, got %v", viaGateway, wantCommands, client.commands)
+		}
+		if !reflect.DeepEqual(client.inputs, wantInputs) {
+			t.Errorf("via gateway %v: expected input %v, got %v", viaGateway, wantInputs, client.inputs)
+		}
+	}
+}
+
+func TestLocalSessionManager_AcquireColdSameWarmOwner(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	for _, id := range []string{"cold-1", "cold-2", "cold-3"} {
+		manager.cache[id] = &Session{ID: id, Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	}
+	ctx := context.Background()
+
+	first, err := manager.AcquireCold(ctx, WithWarmOwner("worker-a"))
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	// The retry returns the session worker-a is warming, with the same token
+	again, err := manager.AcquireCold(ctx, WithWarmOwner("worker-a"))
+	if err != nil {
+		t.Fatalf("Failed to repeat the acquire: %v", err)
+	}
+	if again.ID != first.ID || again.WarmToken != first.WarmToken {
+		t.Errorf("Expected the repeated acquire to return %s, got %s", first.ID, again.ID)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Cold != 2 || status.Warming != 1 {
+		t.Errorf("Expected 2 cold and 1 warming session, got %d and %d", status.Cold, status.Warming)
+	}
+
+	// Another worker and callers without an owner take sessions of their own
+	other, err := manager.AcquireCold(ctx, WithWarmOwner("worker-b"))
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session for another worker: %v", err)
+	}
+	anonymous, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session without owner: %v", err)
+	}
+	if other.ID == first.ID || anonymous.ID == first.ID || anonymous.ID == other.ID {
+		t.Errorf("Expected distinct sessions, got %s, %s and %s", first.ID, other.ID, anonymous.ID)
+	}
+
+	// Another API key naming the same worker does not get its session or warm token
+	if _, err := manager.AcquireCold(ctx, WithWarmOwner("worker-a"), WithAPIKey("other-key")); !errors.Is(err, ErrPoolEmpty) {
+		t.Errorf("Expected another API key to need a cold session of its own, got %v", err)
+	}
+	// Nor does a caller claiming to be the server's warming worker
+	manager.mu.Lock()
+	manager.cache["server-1"] = &Session{ID: "server-1", Status: Warming, CreatedAt: now, LastHeartbeat: now, WarmOwner: serverWarmOwner, WarmToken: "server-token"}
+	manager.mu.Unlock()
+	if _, err := manager.AcquireCold(ctx, WithWarmOwner(serverWarmOwner)); !errors.Is(err, ErrPoolEmpty) {
+		t.Errorf("Expected the reserved warm owner to be ignored, got %v", err)
+	}
+
+	// Once warmed the owner holds nothing, its next acquire needs a cold session
+	if err := manager.SetWarmed(ctx, first.ID, first.WarmToken); err != nil {
+		t.Fatalf("Failed to set warmed: %v", err)
+	}
+	if owner := manager.cache[first.ID].WarmOwner; owner != "" {
+		t.Errorf("Expected the warm owner to be cleared, got %q", owner)
+	}
+	if _, err := manager.AcquireCold(ctx, WithWarmOwner("worker-a")); !errors.Is(err, ErrPoolEmpty) {
+		t.Errorf("Expected an empty pool after warming, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_GetConnectionInfo(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now, ExpiresAt: expiresAt, APIKey: "partner-a", Anbox: &anbox.SessionDetails{ID: "anbox-1"}}
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	info, err := manager.GetConnectionInfo(ctx, "in-use-1", "partner-a")
+	if err != nil {
+		t.Fatalf("Failed to get connection info: %v", err)
+	}
+	if info.SessionID != "in-use-1" {
+		t.Errorf("Expected session ID in-use-1, got %q", info.SessionID)
+	}
+	if info.GatewayURL != "wss://gateway.example.com/1.0/sessions/anbox-1/sockets/client?token=scoped-anbox-1" {
+		t.Errorf("Expected the signaling URL of the anbox session, got %q", info.GatewayURL)
+	}
+	if info.Token != "scoped-anbox-1" {
+		t.Errorf("Expected the scoped token, got %q", info.Token)
+	}
+	if len(info.StunServers) != 1 || len(info.StunServers[0].URLs) == 0 {
+		t.Errorf("Expected the STUN/TURN servers of the join, got %+v", info.StunServers)
+	}
+	want := anbox.Screen{Width: 720, Height: 1240, Density: 320, FPS: 30}
+	if info.Screen != want {
+		t.Errorf("Expected screen %+v, got %+v", want, info.Screen)
+	}
+	if !info.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected expiry %v, got %v", expiresAt, info.ExpiresAt)
+	}
+
+	// Only the key that acquired the session gets its join token
+	for _, key := range []string{"", "partner-b"} {
+		if _, err := manager.GetConnectionInfo(ctx, "in-use-1", key); !errors.Is(err, ErrNotSessionOwner) {
+			t.Errorf("Expected ErrNotSessionOwner for key %q, got %v", key, err)
+		}
+	}
+	if _, err := manager.GetConnectionInfo(ctx, "warmed-1", ""); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState for a warmed session, got %v", err)
+	}
+	if _, err := manager.GetConnectionInfo(ctx, "missing", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for unknown session, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_Reconnect(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	acquired := clock.Now()
+	expiresAt := acquired.Add(time.Hour)
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: acquired, LastHeartbeat: acquired, ExpiresAt: expiresAt, Anbox: &anbox.SessionDetails{ID: "anbox-1"}}
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: acquired, LastHeartbeat: acquired}
+	ctx := context.Background()
+
+	clock.Advance(20 * time.Second)
+	if _, err := manager.Reconnect(ctx, "in-use-1", "partner-b"); !errors.Is(err, ErrNotSessionOwner) {
+		t.Errorf("Expected ErrNotSessionOwner for another key, got %v", err)
+	}
+	if got := manager.cache["in-use-1"].LastHeartbeat; !got.Equal(acquired) {
+		t.Errorf("Expected a refused reconnect not to restart the heartbeat window, got %v", got)
+	}
+	info, err := manager.Reconnect(ctx, "in-use-1", "")
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if info.Token != "scoped-anbox-1" || len(info.StunServers) != 1 {
+		t.Errorf("Expected fresh credentials and STUN/TURN servers, got %+v", info)
+	}
+	if !info.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected the expiry to stay %v, got %v", expiresAt, info.ExpiresAt)
+	}
+	if got := manager.cache["in-use-1"].LastHeartbeat; !got.Equal(clock.Now()) {
+		t.Errorf("Expected the heartbeat window to restart at %v, got %v", clock.Now(), got)
+	}
+
+	if _, err := manager.Reconnect(ctx, "warmed-1", ""); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState for a warmed session, got %v", err)
+	}
+	delete(manager.cache, "in-use-1")
+	if _, err := manager.Reconnect(ctx, "in-use-1", ""); err == nil {
+		t.Errorf("Expected a reclaimed session to fail")
+	}
+}
+
+func TestLocalSessionManager_MinReadyIgnoresWarming(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 3
+	cfg.Max = 10
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	for _, id := range []string{"warming-1", "warming-2", "warming-3"} {
+		manager.cache[id] = &Session{ID: id, Status: Warming, CreatedAt: now, LastHeartbeat: now, StatusChangedAt: now}
+	}
+	ctx := context.Background()
+
+	// Min alone is satisfied by sessions stuck in warming
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 0 {
+		t.Fatalf("Expected no creation without MinReady, got %d", mockClient.CreateCount())
+	}
+
+	// MinReady counts only cold and warmed sessions
+	manager.cfg.MinReady = 1
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Fatalf("Expected MinReady to create a session while all are warming, got %d", mockClient.CreateCount())
+	}
+
+	manager.mu.Lock()
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	manager.mu.Unlock()
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected a warmed session to satisfy MinReady, got %d creations", mockClient.CreateCount())
+	}
+
+	// Max still caps the pool
+	manager.cfg.MinReady = 5
+	manager.cfg.Max = len(manager.cache)
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected no creation at max, got %d creations", mockClient.CreateCount())
+	}
+}
+
+func TestLocalSessionManager_CreateFailureBackoff(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.CreateBackoff = 20 * time.Millisecond
+	cfg.CreateBackoffMax = 80 * time.Millisecond
+	mockClient := NewMockAnboxClient()
+	mockClient.createError = errors.New("connection reset")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	// The backoff doubles from CreateBackoff up to CreateBackoffMax
+	for doublings, want := range []time.Duration{20, 40, 80, 80, 80} {
+		if got, _ := manager.createBackoffAfter(doublings); got != want*time.Millisecond {
+			t.Errorf("Expected backoff %s after %d doublings, got %s", want*time.Millisecond, doublings, got)
+		}
+	}
+
+	// Ticking every 5ms for 400ms would try 80 times without backoff
+	deadline := time.Now().Add(400 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if err := manager.ensureMinPoolSize(ctx); err != nil {
+			t.Fatalf("Failed to ensure min pool size: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	attempts := mockClient.CreateCount()
+	if attempts < 3 || attempts > 12 {
+		t.Errorf("Expected creation attempts to back off to a handful, got %d", attempts)
+	}
+
+	// A fresh failure leaves the manager backing off for the capped interval
+	manager.createNewSession(ctx, "")
+	stats, _ := manager.Stats(ctx)
+	if stats.CreateFailureStreak != attempts+1 {
+		t.Errorf("Expected a failure streak of %d, got %d", attempts+1, stats.CreateFailureStreak)
+	}
+	if stats.CreateBackoffUntil == nil {
+		t.Errorf("Expected the backoff to be reported in stats")
+	}
+
+	// The first success resets the backoff
+	mockClient.mu.Lock()
+	mockClient.createError = nil
+	mockClient.mu.Unlock()
+	manager.createNewSession(ctx, "")
+	stats, _ = manager.Stats(ctx)
+	if stats.CreateFailureStreak != 0 || stats.CreateBackoffUntil != nil {
+		t.Errorf("Expected a success to reset the backoff, got streak %d until %v", stats.CreateFailureStreak, stats.CreateBackoffUntil)
+	}
+}
+
+// hookedCreateClient calls onCreate with the number of sessions requested so far after every async create
+type hookedCreateClient struct {
+	*MockAnboxClient
+	onCreate func(count int)
+}
+
+func (m *hookedCreateClient) CreateAsync(ctx context.Context, req anbox.CreateSessionRequest) error {
+	err := m.MockAnboxClient.CreateAsync(ctx, req)
+	m.onCreate(m.CreateCount())
+	return err
+}
+
+func TestLocalSessionManager_CreateSessions(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Max = 5
+	cfg.WarmupConcurrency = 1
+	mockClient := &hookedCreateClient{MockAnboxClient: NewMockAnboxClient()}
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	if _, err := manager.CreateSessions(ctx, 0); err == nil {
+		t.Errorf("Expected creating no sessions to be rejected")
+	}
+
+	// Sessions created elsewhere fill the pool after the second request, the batch stops short of n
+	mockClient.onCreate = func(count int) {
+		if count != 2 {
+			return
+		}
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		for i := range 3 {
+			id := fmt.Sprintf("other-%d", i)
+			manager.cache[id] = &Session{ID: id, Status: Cold, CreatedAt: time.Now(), LastHeartbeat: time.Now()}
+		}
+	}
+	created, err := manager.CreateSessions(ctx, 5)
+	if err != nil {
+		t.Fatalf("Failed to create sessions: %v", err)
+	}
+	if created != 2 || mockClient.CreateCount() != 2 {
+		t.Errorf("Expected 2 sessions created before the pool filled up, got %d with %d requests", created, mockClient.CreateCount())
+	}
+	if manager.pendingCreations != 0 {
+		t.Errorf("Expected no creations left pending, got %d", manager.pendingCreations)
+	}
+
+	// Cancelling the context stops the batch without counting a create failure
+	manager.mu.Lock()
+	clear(manager.cache)
+	manager.mu.Unlock()
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	mockClient.onCreate = func(count int) {
+		if count == 3 {
+			cancel()
+		}
+	}
+	created, err = manager.CreateSessions(cancelCtx, 5)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation to be returned, got %v", err)
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 session created before the cancellation, got %d", created)
+	}
+	if stats, _ := manager.Stats(ctx); stats.CreateFailures != 0 {
+		t.Errorf("Expected the cancellation not to count as a create failure, got %d", stats.CreateFailures)
+	}
+}
+
+func TestLocalSessionManager_RecycleCold(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 2 * time.Hour
+	cfg.MaxColdAge = 30 * time.Minute
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	ctx := context.Background()
+	now := clock.Now()
+	for id, age := range map[string]time.Duration{"old-1": 40 * time.Minute, "old-2": 35 * time.Minute, "fresh": time.Minute} {
+		manager.cache[id] = &Session{ID: id, Status: Cold, CreatedAt: now.Add(-age), StatusChangedAt: now.Add(-age), LastHeartbeat: now}
+	}
+	manager.cache["in-use"] = &Session{ID: "in-use", Status: InUse, CreatedAt: now.Add(-time.Hour), LastHeartbeat: now}
+
+	// One session per cycle, the oldest first
+	for _, want := range []string{"old-1", "old-2"} {
+		manager.recycleCold()
+		if _, exists := manager.cache[want]; exists {
+			t.Fatalf("Expected %s to be recycled", want)
+		}
+	}
+	manager.recycleCold()
+	for _, id := range []string{"fresh", "in-use"} {
+		if _, exists := manager.cache[id]; !exists {
+			t.Errorf("Expected %s to be kept", id)
+		}
+	}
+	if stats, _ := manager.Stats(ctx); stats.ReleaseReasons[ReleaseRecycled] != 2 {
+		t.Errorf("Expected 2 recycled sessions, got %v", stats.ReleaseReasons)
+	}
+
+	// The fresh session ages out in turn, but not while no replacement can be created
+	clock.Advance(30 * time.Minute)
+	manager.mu.Lock()
+	manager.createBackoffUntil = clock.Now().Add(time.Minute)
+	manager.mu.Unlock()
+	manager.recycleCold()
+	if _, exists := manager.cache["fresh"]; !exists {
+		t.Errorf("Expected no recycling while creation backs off")
+	}
+	clock.Advance(time.Minute)
+	manager.recycleCold()
+	if _, exists := manager.cache["fresh"]; exists {
+		t.Errorf("Expected the aged session to be recycled once creation works again")
+	}
+}
+
+func TestLocalSessionManager_ExpiryFollowsClock(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+	cfg.HeartbeatTimeout = 30 * time.Second
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	manager.cache["cold-2"] = &Session{ID: "cold-2", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireCold(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	if err := manager.SetWarmed(ctx, session.ID, session.WarmToken); err != nil {
+		t.Fatalf("Failed to set warmed: %v", err)
+	}
+	if session, err = manager.AcquireWarmed(ctx); err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	if want := now.Add(cfg.SessionTTL); !session.ExpiresAt.Equal(want) {
+		t.Errorf("Expected the TTL to start at the fake time, expires at %v instead of %v", session.ExpiresAt, want)
+	}
+	inUseID := session.ID
+	idleID := "cold-1"
+	if inUseID == idleID {
+		idleID = "cold-2"
+	}
+
+	// Heartbeats keep the in-use session alive past the heartbeat timeout
+	for i := 0; i < 4; i++ {
+		clock.Advance(cfg.HeartbeatTimeout / 2)
+		if err := manager.Heartbeat(ctx, inUseID); err != nil {
+			t.Fatalf("Heartbeat failed: %v", err)
+		}
+		manager.cleanupExpired()
+	}
+	if _, err := manager.GetSession(ctx, inUseID); err != nil {
+		t.Fatalf("Expected heartbeats to keep the session, got %v", err)
+	}
+
+	// Missing heartbeats for longer than the timeout expire it
+	clock.Advance(cfg.HeartbeatTimeout + time.Second)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, inUseID); err == nil {
+		t.Errorf("Expected the session to expire after the heartbeat timeout")
+	}
+
+	// The idle cold session lives until its TTL runs out
+	if _, err := manager.GetSession(ctx, idleID); err != nil {
+		t.Fatalf("Expected the cold session to be kept before its TTL, got %v", err)
+	}
+	clock.Advance(cfg.SessionTTL - clock.Now().Sub(now))
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, idleID); err != nil {
+		t.Fatalf("Expected the cold session to be kept at its TTL, got %v", err)
+	}
+	clock.Advance(time.Second)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, idleID); err == nil {
+		t.Errorf("Expected the cold session to expire after its TTL")
+	}
+
+	stats, _ := manager.Stats(ctx)
+	if stats.Expired != 2 {
+		t.Errorf("Expected 2 expired sessions, got %d", stats.Expired)
+	}
+	if !stats.Since.Equal(now) {
+		t.Errorf("Expected stats to start at the fake time, got %v", stats.Since)
+	}
+}
+
+func TestLocalSessionManager_AcquireRacesCleanup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+	cfg.HeartbeatTimeout = 30 * time.Second
+	cfg.GracePeriod = 5 * time.Second
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+
+	// A warmed session whose heartbeat and pool TTL are both about to lapse
+	now := clock.Now()
+	manager.cache["warmed-1"] = &Session{
+		ID:              "warmed-1",
+		Status:          Warmed,
+		StatusChangedAt: now.Add(-time.Minute),
+		CreatedAt:       now.Add(-cfg.SessionTTL + time.Millisecond),
+		LastHeartbeat:   now.Add(-cfg.HeartbeatTimeout + time.Millisecond),
+	}
+	ctx := context.Background()
+
+	session, err := manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	if !session.LastHeartbeat.Equal(now) {
+		t.Errorf("Expected the acquire to refresh the heartbeat, got %v", session.LastHeartbeat)
+	}
+
+	// The cleanup tick lands right after the acquire, before the client's first heartbeat
+	clock.Advance(2 * time.Millisecond)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "warmed-1"); err != nil {
+		t.Fatalf("Expected the just-acquired session to survive cleanup, got %v", err)
+	}
+
+	// Once the grace period is over the session lives until its ExpiresAt, not the pool TTL
+	clock.Advance(cfg.GracePeriod)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "warmed-1"); err != nil {
+		t.Fatalf("Expected the session to outlive the pool TTL, got %v", err)
+	}
+	clock.Advance(session.ExpiresAt.Sub(clock.Now()) + time.Millisecond)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "warmed-1"); err == nil {
+		t.Errorf("Expected the session to expire at its ExpiresAt")
+	}
+}
+
+// recordingAuditSink keeps the audit events it receives
+type recordingAuditSink struct {
+	events []AuditEvent
+}
+
+func (s *recordingAuditSink) Record(event AuditEvent) {
+	s.events = append(s.events, event)
+}
+
+func TestLocalSessionManager_AuditLifecycle(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("session-1", "test-game")
+	sink := &recordingAuditSink{}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, mockClient, WithClock(clock), WithAuditSink(sink))
+	ctx := context.Background()
+	clientCtx := WithActor(ctx, "partner-a")
+
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	acquired, err := manager.AcquireCold(clientCtx)
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	clock.Advance(time.Second)
+	if err := manager.SetWarmed(clientCtx, "session-1", acquired.WarmToken); err != nil {
+		t.Fatalf("Failed to set warmed: %v", err)
+	}
+	clock.Advance(time.Second)
+	// Without an actor in the context the API key of the acquire is used
+	if _, err := manager.AcquireWarmed(ctx, WithAPIKey("partner-b")); err != nil {
+		t.Fatalf("Failed to acquire warmed session: %v", err)
+	}
+	clock.Advance(time.Second)
+	if err := manager.Release(clientCtx, "session-1", ReleaseClient); err != nil {
+		t.Fatalf("Failed to release session: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	want := []AuditEvent{
+		{Time: start, From: "", To: Cold, Actor: SystemActor, Reason: "synced"},
+		{Time: start, From: Cold, To: Warming, Actor: "partner-a", Reason: "acquire_cold"},
+		{Time: start.Add(time.Second), From: Warming, To: Warmed, Actor: "partner-a", Reason: "set_warmed"},
+		{Time: start.Add(2 * time.Second), From: Warmed, To: InUse, Actor: "partner-b", Reason: "acquire_warmed"},
+		{Time: start.Add(3 * time.Second), From: InUse, To: Deleted, Actor: "partner-a", Reason: "release", ReleaseReason: ReleaseClient},
+	}
+	for i := range want {
+		want[i].SessionID = "session-1"
+		want[i].Game = "test-game"
+	}
+	if !reflect.DeepEqual(sink.events, want) {
+		t.Errorf("Expected audit events\n%+v\ngot\n%+v", want, sink.events)
+	}
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLinesAuditSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sink.Record(AuditEvent{Time: at, SessionID: "session-1", Game: "test-game", From: Cold, To: Warming, Actor: "partner-a", Reason: "acquire_cold"})
+	sink.Record(AuditEvent{Time: at, SessionID: "session-1", Game: "test-game", From: Warming, To: Deleted, Actor: SystemActor, Reason: "ttl_expired"})
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Failed to close audit log: %v", err)
+	}
+
+	// Reopening appends instead of truncating
+	sink, err = NewJSONLinesAuditSink(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen audit log: %v", err)
+	}
+	sink.Record(AuditEvent{Time: at, SessionID: "session-2", Game: "test-game", To: Cold, Actor: SystemActor, Reason: "synced"})
+	sink.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %s", len(lines), data)
+	}
+	var event AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("Failed to decode audit line: %v", err)
+	}
+	if event.To != Deleted || event.Reason != "ttl_expired" || event.Actor != SystemActor {
+		t.Errorf("Unexpected second audit event %+v", event)
+	}
+}
+
+func TestLocalSessionManager_HealthSweep(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.HealthSweepConcurrency = 2
+	mockClient := NewMockAnboxClient()
+	for _, id := range []string{"healthy", "failed", "absent", "in-use-failed"} {
+		mockClient.AddRunningSession(id, "test-game")
+	}
+	mockClient.gatewayStatus = map[string]string{"failed": "error", "absent": "absent", "in-use-failed": "terminated"}
+	sink := &recordingAuditSink{}
+	manager := NewLocalSessionManager(cfg, mockClient, WithAuditSink(sink))
+	ctx := context.Background()
+
+	// AMS lists every instance as running
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+	manager.cache["in-use-failed"].Status = InUse
+
+	// Failed sessions go at once, one the gateway does not know yet gets another sweep
+	manager.healthSweep(ctx)
+	if _, err := manager.GetSession(ctx, "absent"); err != nil {
+		t.Errorf("Expected a session absent for one sweep to be kept, got %v", err)
+	}
+	if stats, _ := manager.Stats(ctx); stats.HealthMismatches != 2 {
+		t.Errorf("Expected 2 health mismatches after the first sweep, got %d", stats.HealthMismatches)
+	}
+	manager.healthSweep(ctx)
+
+	if _, err := manager.GetSession(ctx, "healthy"); err != nil {
+		t.Errorf("Expected the healthy session to be kept, got %v", err)
+	}
+	for _, id := range []string{"failed", "absent", "in-use-failed"} {
+		if _, err := manager.GetSession(ctx, id); err == nil {
+			t.Errorf("Expected %s to be reclaimed although AMS lists it", id)
+		}
+		mockClient.mu.Lock()
+		_, stillRunning := mockClient.sessions[id]
+		mockClient.mu.Unlock()
+		if stillRunning {
+			t.Errorf("Expected the leftover of %s to be deleted", id)
+		}
+	}
+
+	stats, _ := manager.Stats(ctx)
+	if stats.HealthMismatches != 3 {
+		t.Errorf("Expected 3 health mismatches, got %d", stats.HealthMismatches)
+	}
+	reasons := make(map[string]string)
+	for _, event := range sink.events {
+		if event.To == Deleted {
+			reasons[event.SessionID] = event.Reason
+		}
+	}
+	want := map[string]string{"failed": "gateway_session_error", "absent": "gateway_session_absent", "in-use-failed": "gateway_session_terminated"}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("Expected reclaim reasons %v, got %v", want, reasons)
+	}
+
+	// A lookup that fails for other reasons keeps the session
+	mockClient.mu.Lock()
+	mockClient.gatewayStatus = map[string]string{"healthy": "unreachable"}
+	mockClient.mu.Unlock()
+	manager.healthSweep(ctx)
+	if _, err := manager.GetSession(ctx, "healthy"); err != nil {
+		t.Errorf("Expected a failed lookup to keep the session, got %v", err)
+	}
+	if stats, _ := manager.Stats(ctx); stats.HealthMismatches != 3 {
+		t.Errorf("Expected no further mismatches, got %d", stats.HealthMismatches)
+	}
+}
+
+func TestLocalSessionManager_HealthSweepAbsentGrace(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.HealthAbsentSweeps = 3
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("flaky", "test-game")
+	mockClient.AddRunningSession("gone", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync sessions: %v", err)
+	}
+
+	// Absences only count in a row, a sweep that finds the session again starts over
+	mockClient.SetGatewayStatus("flaky", "absent")
+	mockClient.SetGatewayStatus("gone", "absent")
+	manager.healthSweep(ctx)
+	manager.healthSweep(ctx)
+	mockClient.SetGatewayStatus("flaky", "active")
+	manager.healthSweep(ctx)
+	mockClient.SetGatewayStatus("flaky", "absent")
+	manager.healthSweep(ctx)
+	if _, err := manager.GetSession(ctx, "flaky"); err != nil {
+		t.Errorf("Expected a session found again in between to be kept, got %v", err)
+	}
+	if _, err := manager.GetSession(ctx, "gone"); err == nil {
+		t.Errorf("Expected a session absent for %d sweeps to be reclaimed", cfg.HealthAbsentSweeps)
+	}
+
+	// A reclaimed session whose delete fails is queued for the next sync cycle
+	mockClient.mu.Lock()
+	mockClient.deleteError = anbox.ErrUpstreamUnavailable
+	mockClient.mu.Unlock()
+	manager.healthSweep(ctx)
+	manager.healthSweep(ctx)
+	if _, err := manager.GetSession(ctx, "flaky"); err == nil {
+		t.Errorf("Expected flaky to be reclaimed after %d absences in a row", cfg.HealthAbsentSweeps)
+	}
+	if pending := manager.deletes.pending(); !slices.Equal(pending, []string{"flaky"}) {
+		t.Errorf("Expected the failed delete to be queued, got %v", pending)
+	}
+	mockClient.mu.Lock()
+	mockClient.deleteError = nil
+	mockClient.mu.Unlock()
+	manager.retryDeletes(ctx)
+	if pending := manager.deletes.pending(); len(pending) != 0 {
+		t.Errorf("Expected the retried delete to leave the queue, got %v", pending)
+	}
+}
+
+func TestLocalSessionManager_Pause(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 3
+	cfg.Max = 10
+	cfg.OnDemand = true
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, LastHeartbeat: now}
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(time.Hour)}
+	ctx := context.Background()
+
+	if err := manager.Pause(ctx); err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+	if err := manager.Pause(ctx); err != nil {
+		t.Errorf("Expected pausing twice to succeed, got %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); !status.Paused {
+		t.Error("Expected the pool status to report paused")
+	}
+
+	// The pool is below Min but nothing is created
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 0 {
+		t.Errorf("Expected no creation while paused, got %d", mockClient.CreateCount())
+	}
+
+	// Acquires are rejected even with OnDemand, without falling back to creation
+	if _, err := manager.AcquireCold(ctx); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from AcquireCold, got %v", err)
+	}
+	if _, err := manager.AcquireWarmed(ctx); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected ErrPaused from AcquireWarmed, got %v", err)
+	}
+	if mockClient.CreateCount() != 0 {
+		t.Errorf("Expected no on-demand creation while paused, got %d", mockClient.CreateCount())
+	}
+
+	// In-use sessions keep working
+	if err := manager.Heartbeat(ctx, "in-use-1"); err != nil {
+		t.Errorf("Expected heartbeats to work while paused, got %v", err)
+	}
+	if err := manager.Release(ctx, "in-use-1", ReleaseClient); err != nil {
+		t.Errorf("Expected release to work while paused, got %v", err)
+	}
+
+	if err := manager.Resume(ctx); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Paused {
+		t.Error("Expected the pool status to report resumed")
+	}
+	if _, err := manager.AcquireWarmed(ctx); err != nil {
+		t.Errorf("Expected acquiring to work after resume, got %v", err)
+	}
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected creation to resume, got %d", mockClient.CreateCount())
+	}
+}
+
+func TestLocalSessionManager_Resize(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 2
+	cfg.Max = 3
+	cfg.MinReady = 0
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(time.Hour)}
+	manager.cache["in-use-2"] = &Session{ID: "in-use-2", Status: InUse, CreatedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(time.Hour)}
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name     string
+		min, max int
+	}{
+		{"negative min", -1, 5},
+		{"min above max", 6, 5},
+		{"max below in use", 0, 1},
+	} {
+		if err := manager.Resize(ctx, tc.min, tc.max); !errors.Is(err, ErrInvalidResize) {
+			t.Errorf("%s: expected ErrInvalidResize, got %v", tc.name, err)
+		}
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Min != 2 || status.Max != 3 {
+		t.Errorf("Expected a rejected resize to keep min 2 max 3, got min %d max %d", status.Min, status.Max)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 0 {
+		t.Errorf("Expected no creation at max, got %d", mockClient.CreateCount())
+	}
+
+	// Growing refills the pool right away instead of on the next sync tick
+	if err := manager.Resize(ctx, 4, 6); err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Min != 4 || status.Max != 6 {
+		t.Errorf("Expected min 4 max 6, got min %d max %d", status.Min, status.Max)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if mockClient.CreateCount() != 1 {
+		t.Errorf("Expected the resize to start a creation, got %d", mockClient.CreateCount())
+	}
+
+	// Shrinking to exactly the sessions in use is allowed
+	if err := manager.Resize(ctx, 0, 2); err != nil {
+		t.Errorf("Expected max equal to the in-use count to be accepted, got %v", err)
+	}
+}
+
+func newProfileTestConfig() *Config {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.Min = 0
+	cfg.Max = 10
+	cfg.ScreenProfiles = []ScreenProfile{
+		{Name: "portrait", Min: 2, ScreenConfig: ScreenConfig{Width: 720, Height: 1280, Density: 320, Fps: 30}},
+		{Name: "landscape", Min: 1, ScreenConfig: ScreenConfig{Width: 1280, Height: 720, Density: 320, Fps: 30}},
+	}
+	return cfg
+}
+
+func TestLocalSessionManager_ProfileAcquire(t *testing.T) {
+	cfg := newProfileTestConfig()
+	cfg.OnDemand = true
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	now := time.Now()
+	manager.cache["portrait-1"] = &Session{ID: "portrait-1", Status: Warmed, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["landscape-1"] = &Session{ID: "landscape-1", Status: Warmed, Profile: "landscape", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["landscape-cold"] = &Session{ID: "landscape-cold", Status: Cold, Profile: "landscape", CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	session, err := manager.AcquireWarmed(ctx, WithProfile("landscape"))
+	if err != nil {
+		t.Fatalf("Failed to acquire a landscape session: %v", err)
+	}
+	if session.ID != "landscape-1" {
+		t.Errorf("Expected the landscape session, got %s (%s)", session.ID, session.Profile)
+	}
+
+	// No profile means the first declared profile
+	session, err = manager.AcquireWarmed(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire a default profile session: %v", err)
+	}
+	if session.ID != "portrait-1" {
+		t.Errorf("Expected the portrait session as the default, got %s (%s)", session.ID, session.Profile)
+	}
+
+	if _, err := manager.AcquireCold(ctx); err == nil {
+		t.Error("Expected no cold portrait session to be available")
+	}
+	if session, err := manager.AcquireCold(ctx, WithProfile("landscape")); err != nil || session.ID != "landscape-cold" {
+		t.Errorf("Expected the cold landscape session, got %v, %v", session, err)
+	}
+
+	// An exhausted profile is created on demand with its own screen and tag
+	session, err = manager.AcquireWarmed(ctx, WithProfile("landscape"))
+	if err != nil {
+		t.Fatalf("Failed to acquire an on-demand landscape session: %v", err)
+	}
+	if session.Profile != "landscape" {
+		t.Errorf("Expected the on-demand session to be tagged landscape, got %q", session.Profile)
+	}
+	if req := mockClient.lastCreate; req.Screen.Width != 1280 || req.Screen.Height != 720 ||
+		anbox.GetTagValue(req.Tags, anbox.TagProfile) != "landscape" {
+		t.Errorf("Expected a landscape create request, got screen %+v tags %v", req.Screen, req.Tags)
+	}
+	if info, err := manager.GetConnectionInfo(ctx, session.ID, ""); err != nil || info.Screen.Width != 1280 {
+		t.Errorf("Expected the landscape screen in the connection info, got %+v, %v", info.Screen, err)
+	}
+
+	if _, err := manager.AcquireWarmed(ctx, WithProfile("square")); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Expected ErrUnknownProfile, got %v", err)
+	}
+}
+
+func TestLocalSessionManager_ProfileMinReady(t *testing.T) {
+	cfg := newProfileTestConfig()
+	cfg.MinReady = 1
+	cfg.ScreenProfiles[0].Min = 0
+	cfg.ScreenProfiles[1].Min = 0
+	cfg.ScreenProfiles[1].MinReady = 2
+	mockClient := NewMockAnboxClient()
+	mockClient.AddRunningSession("untagged-1", "test-game")
+	mockClient.AddRunningSession("landscape-1", "test-game")
+	mockClient.tags = map[string][]string{"landscape-1": {anbox.FormatTag(anbox.TagProfile, "landscape")}}
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+
+	// A session from before profiles were configured belongs to the default profile and can be acquired
+	if session, _ := manager.GetSession(ctx, "untagged-1"); session == nil || session.Profile != "portrait" {
+		t.Fatalf("Expected the untagged session in the default profile, got %+v", session)
+	}
+
+	// Ready landscape sessions do not cover the default profile's MinReady and vice versa
+	manager.mu.Lock()
+	if ready := manager.readyCountLocked("portrait"); ready != 1 {
+		t.Errorf("Expected 1 ready portrait session, got %d", ready)
+	}
+	if profile, needed := manager.profileToCreateLocked(); !needed || profile != "landscape" {
+		t.Errorf("Expected landscape to be below its min_ready, got %q %v", profile, needed)
+	}
+	if plan := manager.warmupPlanLocked(); !slices.Equal(plan, []string{"landscape"}) {
+		t.Errorf("Expected the warmup to plan one landscape session, got %v", plan)
+	}
+	manager.mu.Unlock()
+
+	if _, err := manager.AcquireCold(ctx); err != nil {
+		t.Fatalf("Failed to acquire the untagged session: %v", err)
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.cache["landscape-2"] = &Session{ID: "landscape-2", Status: Cold, Profile: "landscape", CreatedAt: time.Now(), LastHeartbeat: time.Now()}
+	if profile, needed := manager.profileToCreateLocked(); !needed || profile != "portrait" {
+		t.Errorf("Expected the default profile to be below min_ready once its session is warming, got %q %v", profile, needed)
+	}
+	if plan := manager.warmupPlanLocked(); !slices.Equal(plan, []string{"portrait"}) {
+		t.Errorf("Expected the warmup to plan one portrait session, got %v", plan)
+	}
+	if status := manager.profileStatusLocked(); status["landscape"].MinReady != 2 {
+		t.Errorf("Expected the landscape min_ready in the status, got %+v", status["landscape"])
+	}
+}
+
+func TestLocalSessionManager_ProfileMinima(t *testing.T) {
+	cfg := newProfileTestConfig()
+	cfg.Min = 4
+	mockClient := NewMockAnboxClient()
+	manager := NewLocalSessionManager(cfg, mockClient)
+	ctx := context.Background()
+
+	// Warmup fills every profile to its Min and the rest of Min with the default profile
+	cfg.WarmupConcurrency = 1
+	manager.warmupPool(ctx)
+	if mockClient.CreateCount() != 4 {
+		t.Fatalf("Expected 4 sessions to be created at warmup, got %d", mockClient.CreateCount())
+	}
+
+	// Each tick creates for the first profile below its Min
+	now := time.Now()
+	manager.cache["portrait-1"] = &Session{ID: "portrait-1", Status: Cold, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["portrait-2"] = &Session{ID: "portrait-2", Status: InUse, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	if profile, needed := manager.profileToCreateLocked(); !needed || profile != "landscape" {
+		t.Errorf("Expected a landscape session to be needed, got %q %v", profile, needed)
+	}
+	if err := manager.ensureMinPoolSize(ctx); err != nil {
+		t.Fatalf("Failed to ensure min pool size: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	mockClient.mu.Lock()
+	req := mockClient.lastCreate
+	mockClient.mu.Unlock()
+	if anbox.GetTagValue(req.Tags, anbox.TagProfile) != "landscape" || req.Screen.Width != 1280 {
+		t.Errorf("Expected a landscape session to be created, got screen %+v tags %v", req.Screen, req.Tags)
+	}
+
+	// Sync picks the profile up from the instance tags
+	mockClient.AddRunningSession("landscape-1", "test-game")
+	mockClient.tags = map[string][]string{"landscape-1": {anbox.FormatTag(anbox.TagProfile, "landscape")}}
+	mockClient.AddRunningSession("portrait-1", "test-game")
+	mockClient.AddRunningSession("portrait-2", "test-game")
+	if err := manager.syncRunningSession(ctx); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if session, _ := manager.GetSession(ctx, "landscape-1"); session == nil || session.Profile != "landscape" {
+		t.Fatalf("Expected the synced session to be tagged landscape, got %+v", session)
+	}
+
+	// Every profile is at its Min, the remaining Min of 4 is filled with the default profile
+	if profile, needed := manager.profileToCreateLocked(); !needed || profile != "portrait" {
+		t.Errorf("Expected the default profile to fill Min, got %q %v", profile, needed)
+	}
+	manager.cfg.Min = 3
+	if _, needed := manager.profileToCreateLocked(); needed {
+		t.Error("Expected no creation with every minimum met")
+	}
+
+	status, err := manager.PoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pool status: %v", err)
+	}
+	want := map[string]ProfileStatus{
+		"portrait":  {Min: 2, Total: 2, Cold: 1, InUse: 1},
+		"landscape": {Min: 1, Total: 1, Cold: 1},
+	}
+	if !reflect.DeepEqual(status.Profiles, want) {
+		t.Errorf("Expected per-profile status %+v, got %+v", want, status.Profiles)
+	}
+}
+
+func TestLocalSessionManager_Extend(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+	cfg.HeartbeatTimeout = time.Hour
+	cfg.MaxInUseDuration = 8 * time.Minute
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, StatusChangedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(cfg.SessionTTL)}
+	manager.cache["warmed-1"] = &Session{ID: "warmed-1", Status: Warmed, CreatedAt: now, StatusChangedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	if err := manager.Extend(ctx, "in-use-1", 2*time.Minute); err != nil {
+		t.Fatalf("Failed to extend: %v", err)
+	}
+	session, _ := manager.GetSession(ctx, "in-use-1")
+	if want := now.Add(7 * time.Minute); !session.ExpiresAt.Equal(want) {
+		t.Errorf("Expected the session to expire at %v, got %v", want, session.ExpiresAt)
+	}
+
+	// Only in-use sessions can be extended
+	if err := manager.Extend(ctx, "warmed-1", time.Minute); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected ErrInvalidState for a warmed session, got %v", err)
+	}
+	if err := manager.Extend(ctx, "missing", time.Minute); err == nil {
+		t.Errorf("Expected an error for an unknown session")
+	}
+	if err := manager.Extend(ctx, "warmed-1", 0); err == nil {
+		t.Errorf("Expected an error for a zero extension")
+	}
+
+	// The extended session outlives the plain TTL
+	clock.Advance(6 * time.Minute)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "in-use-1"); err != nil {
+		t.Fatalf("Expected the extended session to survive its TTL, got %v", err)
+	}
+
+	// Extensions stop at the cap, the next one is refused
+	if err := manager.Extend(ctx, "in-use-1", 5*time.Minute); err != nil {
+		t.Fatalf("Expected an extension past the cap to be shortened, got %v", err)
+	}
+	session, _ = manager.GetSession(ctx, "in-use-1")
+	if want := now.Add(cfg.MaxInUseDuration); !session.ExpiresAt.Equal(want) {
+		t.Errorf("Expected the session to expire at the cap %v, got %v", want, session.ExpiresAt)
+	}
+	if err := manager.Extend(ctx, "in-use-1", time.Minute); !errors.Is(err, ErrExtensionLimit) {
+		t.Errorf("Expected ErrExtensionLimit at the cap, got %v", err)
+	}
+
+	clock.Advance(2*time.Minute + time.Second)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "in-use-1"); err == nil {
+		t.Errorf("Expected the session to expire at the cap")
+	}
+}
+
+func TestLocalSessionManager_ExtendedSessionExpiresAt(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.SessionTTL = 5 * time.Minute
+	cfg.HeartbeatTimeout = time.Hour
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	// Sat warmed for longer than the TTL before it was acquired
+	created := now.Add(-10 * time.Minute)
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: created, StatusChangedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(cfg.SessionTTL)}
+	ctx := context.Background()
+
+	if err := manager.Extend(ctx, "in-use-1", 2*time.Minute); err != nil {
+		t.Fatalf("Failed to extend: %v", err)
+	}
+	session, _ := manager.GetSession(ctx, "in-use-1")
+	expiresAt := session.ExpiresAt
+
+	// The session lives until the ExpiresAt it was given, not a TTL after it was created
+	clock.Advance(expiresAt.Sub(clock.Now()))
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "in-use-1"); err != nil {
+		t.Fatalf("Expected the extended session to survive until %v, got %v", expiresAt, err)
+	}
+	clock.Advance(time.Second)
+	manager.cleanupExpired()
+	if _, err := manager.GetSession(ctx, "in-use-1"); err == nil {
+		t.Errorf("Expected the session to expire after %v", expiresAt)
+	}
+}
+
+func TestLocalSessionManager_HeartbeatPolicy(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.HeartbeatTimeout = 30 * time.Second
+	cfg.SessionTTL = time.Hour
+	clock := NewFakeClock(time.Now())
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	manager.cache["in-use-1"] = &Session{ID: "in-use-1", Status: InUse, CreatedAt: now, StatusChangedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(time.Hour)}
+	manager.cache["in-use-2"] = &Session{ID: "in-use-2", Status: InUse, CreatedAt: now, StatusChangedAt: now, LastHeartbeat: now, ExpiresAt: now.Add(time.Hour)}
+	ctx := context.Background()
+
+	policy := manager.HeartbeatPolicy()
+	if policy.Interval != 10*time.Second || policy.Timeout != 30*time.Second {
+		t.Fatalf("Expected a 10s interval and 30s timeout, got %+v", policy)
+	}
+
+	// Beating at the advertised interval keeps a session well past the timeout
+	for i := 0; i < 6; i++ {
+		clock.Advance(policy.Interval)
+		if err := manager.Heartbeat(ctx, "in-use-1"); err != nil {
+			t.Fatalf("Failed to heartbeat: %v", err)
+		}
+		manager.cleanupExpired()
+	}
+	if _, err := manager.GetSession(ctx, "in-use-1"); err != nil {
+		t.Errorf("Expected the heartbeating session to be kept, got %v", err)
+	}
+	if _, err := manager.GetSession(ctx, "in-use-2"); err == nil {
+		t.Errorf("Expected the silent session to be released after the timeout")
+	}
+}
+
+func TestLocalSessionManager_ConnectHint(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.ConnectSettle = 3 * time.Second
+	cfg.ConnectRetryMin = 250 * time.Millisecond
+	clock := NewFakeClock(time.Now())
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient(), WithClock(clock))
+	now := clock.Now()
+	fresh := &Session{ID: "fresh", Status: Warmed, CreatedAt: now.Add(-time.Minute), ReadyAt: now.Add(-time.Second)}
+	settled := &Session{ID: "settled", Status: Warmed, CreatedAt: now.Add(-time.Minute), ReadyAt: now.Add(-time.Minute)}
+
+	freshHint := manager.ConnectHint(fresh)
+	if !freshHint.Fresh || freshHint.RetryAfter != 2*time.Second {
+		t.Errorf("Expected a fresh session to wait out the 2s left of the settle time, got %+v", freshHint)
+	}
+	settledHint := manager.ConnectHint(settled)
+	if settledHint.Fresh || settledHint.RetryAfter != cfg.ConnectRetryMin {
+		t.Errorf("Expected a settled session to get the minimum hint, got %+v", settledHint)
+	}
+	if freshHint.RetryAfter <= settledHint.RetryAfter {
+		t.Errorf("Expected a larger hint for the fresh session, got %s <= %s", freshHint.RetryAfter, settledHint.RetryAfter)
+	}
+
+	// The hint shrinks towards the minimum as the session settles
+	clock.Advance(1900 * time.Millisecond)
+	if hint := manager.ConnectHint(fresh); !hint.Fresh || hint.RetryAfter != cfg.ConnectRetryMin {
+		t.Errorf("Expected the minimum hint just before the session settles, got %+v", hint)
+	}
+	clock.Advance(time.Second)
+	if hint := manager.ConnectHint(fresh); hint.Fresh {
+		t.Errorf("Expected the session to have settled, got %+v", hint)
+	}
+}
+
+func TestLocalSessionManager_ReadyAtWaitsForLaunch(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	cfg.LaunchApp = true
+	cfg.LaunchCommands = [][]string{{"am", "start", "-W", "-n", "com.example/.Main"}}
+	clock := NewFakeClock(time.Now())
+	mockClient := &launchingAnboxClient{MockAnboxClient: NewMockAnboxClient(), done: make(chan struct{})}
+	close(mockClient.done)
+	mockClient.AddRunningSession("session-1", "test-game")
+	manager := NewLocalSessionManager(cfg, mockClient, WithClock(clock))
+	ctx := context.Background()
+
+	manager.mu.Lock()
+	manager.cache["session-1"] = &Session{ID: "session-1", Status: Cold, CreatedAt: clock.Now(), LastHeartbeat: clock.Now()}
+	manager.mu.Unlock()
+
+	// The app takes a while to launch, the connect settles from then on and not from the sync
+	clock.Advance(time.Minute)
+	manager.launchSynced(ctx, "session-1")
+	session, err := manager.GetSession(ctx, "session-1")
+	if err != nil || !session.AppLaunched {
+		t.Fatalf("Expected the app to be launched, got %+v, %v", session, err)
+	}
+	if !session.ReadyAt.Equal(clock.Now()) {
+		t.Errorf("Expected the session to be ready when its app launched at %v, got %v", clock.Now(), session.ReadyAt)
+	}
+	if hint := manager.ConnectHint(session); !hint.Fresh {
+		t.Errorf("Expected a just launched session to be fresh, got %+v", hint)
+	}
+}
+
+func TestLocalSessionManager_WarmingWorkersFillWarmedPool(t *testing.T) {
+	cfg := &Config{
+		GameName:         "test-game",
+		Min:              0,
+		Max:              10,
+		SessionTTL:       5 * time.Minute,
+		HeartbeatTimeout: time.Minute,
+		SyncInterval:     time.Hour,
+		ScreenConfig:     &ScreenConfig{Width: 720, Height: 1240, Density: 320, Fps: 30},
+		WarmupActions:    []WarmupAction{{Wait: 5 * time.Millisecond}},
+		WarmingWorkers:   2,
+		MinWarmed:        2,
+	}
+	mockClient := NewMockAnboxClient()
+	for _, id := range []string{"session-1", "session-2", "session-3"} {
+		mockClient.AddRunningSession(id, "test-game")
+	}
+	manager := NewLocalSessionManager(cfg, mockClient)
+
+	ctx := context.Background()
+	if err := manager.Start(ctx); err != nil {
+		t.Fatalf("Failed to start session manager: %v", err)
+	}
+	defer manager.Stop(ctx)
+
+	// No client acquires cold or calls SetWarmed, the workers warm up to the target by themselves
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, _ := manager.PoolStatus(ctx)
+		if status.Warmed == cfg.MinWarmed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the workers to warm %d sessions, got %+v", cfg.MinWarmed, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if manager.warmNext(ctx) {
+		t.Errorf("Expected no session to be warmed past the target")
+	}
+	if status, _ := manager.PoolStatus(ctx); status.Cold != 1 || status.Warming != 0 {
+		t.Errorf("Expected the remaining session to stay cold, got %+v", status)
+	}
+
+	// Handing out a warmed session makes room for the workers to warm the cold one
+	if _, err := manager.AcquireWarmed(ctx); err != nil {
+		t.Fatalf("Expected a warmed session without client warming, got %v", err)
+	}
+	deadline = time.Now().Add(2 * DefaultWarmingCheckInterval)
+	for {
+		status, _ := manager.PoolStatus(ctx)
+		if status.Warmed == cfg.MinWarmed && status.Cold == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the warmed target to be restored from the cold session, got %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLocalSessionManager_WarmingWorkersClaimPerProfile(t *testing.T) {
+	cfg := newProfileTestConfig()
+	cfg.MinWarmed = 1
+	cfg.ScreenProfiles[1].MinWarmed = 1
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["portrait-warmed"] = &Session{ID: "portrait-warmed", Status: Warmed, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["portrait-cold-1"] = &Session{ID: "portrait-cold-1", Status: Cold, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["portrait-cold-2"] = &Session{ID: "portrait-cold-2", Status: Cold, Profile: "portrait", CreatedAt: now, LastHeartbeat: now}
+	manager.cache["landscape-cold"] = &Session{ID: "landscape-cold", Status: Cold, Profile: "landscape", CreatedAt: now, LastHeartbeat: now}
+
+	// The portrait target is met by its warmed session, so the landscape one is warmed rather than another portrait
+	id, _, ok := manager.claimForWarming()
+	if !ok || id != "landscape-cold" {
+		t.Fatalf("Expected the landscape session to be claimed, got %q %v", id, ok)
+	}
+	if id, _, ok := manager.claimForWarming(); ok {
+		t.Errorf("Expected every profile at its target, claimed %s", id)
+	}
+	if status, _ := manager.PoolStatus(context.Background()); status.Profiles["landscape"].MinWarmed != 1 {
+		t.Errorf("Expected the landscape min_warmed in the pool status, got %+v", status.Profiles["landscape"])
+	}
+}
+
+func TestLocalSessionManager_ReturnsSnapshots(t *testing.T) {
+	cfg := NewConfig()
+	cfg.GameName = "test-game"
+	manager := NewLocalSessionManager(cfg, NewMockAnboxClient())
+	now := time.Now()
+	manager.cache["cold-1"] = &Session{ID: "cold-1", Status: Cold, CreatedAt: now, LastHeartbeat: now}
+	ctx := context.Background()
+
+	acquired, err := manager.AcquireCold(ctx, WithMetadata(map[string]string{"player": "p1"}))
+	if err != nil {
+		t.Fatalf("Failed to acquire cold session: %v", err)
+	}
+	got, err := manager.GetSession(ctx, "cold-1")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+
+	// Callers read the returned sessions without m.mu, so they must not share state with the cache
+	cached := manager.cache["cold-1"]
+	if acquired == cached || got == cached {
+		t.Fatalf("Expected copies of the cached session")
+	}
+	got.Metadata["player"] = "p2"
+	if cached.Metadata["player"] != "p1" {
+		t.Errorf("Expected the cached metadata to be untouched, got %v", cached.Metadata)
+	}
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syncStaleAfter is how many sync intervals may pass without a completed cycle before the loop counts as stale
+const syncStaleAfter = 3
+
+// LoopHealth tells whether the background sync loop is making progress
+type LoopHealth struct {
+	SyncAlive bool `json:"sync_alive"` // the loop goroutine is running
+	// SyncStale is set when no cycle completed for syncStaleAfter sync intervals, the loop died or is wedged
+	SyncStale     bool          `json:"sync_stale"`
+	SyncInterval  time.Duration `json:"sync_interval_ns"`
+	SyncStartedAt *time.Time    `json:"sync_started_at,omitempty"` // when the loop goroutine started
+	// LastCycleStartedAt and LastCycleAt are when the latest cycle started and when the latest one completed
+	LastCycleStartedAt *time.Time `json:"last_cycle_started_at,omitempty"`
+	LastCycleAt        *time.Time `json:"last_cycle_at,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	LastErrorAt        *time.Time `json:"last_error_at,omitempty"`
+	// LastSuccessAt is when the latest cycle that ran into no error completed,
+	// ConsecutiveFailures how many cycles failed since then
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// CreationsInFlight and DeletesInFlight are the gateway and AMS calls creating or deleting sessions right now
+	CreationsInFlight int `json:"creations_in_flight"`
+	DeletesInFlight   int `json:"deletes_in_flight"`
+	// DeletesPending counts the sessions that left the pool but whose delete failed, they are retried every cycle
+	DeletesPending int `json:"deletes_pending"`
+}
+
+// loopTracker records the progress of backgroundSync, it has its own lock as cycles run without m.mu held
+type loopTracker struct {
+	mu           sync.Mutex
+	alive        bool
+	startedAt    time.Time
+	cycleStarted time.Time
+	cycleDone    time.Time
+	lastError    string
+	lastErrorAt  time.Time
+	lastSuccess  time.Time
+	failures     int
+	// creating counts the asynchronous creations in flight, deleting every gateway or AMS delete
+	creating atomic.Int64
+	deleting atomic.Int64
+}
+
+// loopStarted marks the sync loop running
+func (t *loopTracker) loopStarted(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.alive = true
+	t.startedAt = now
+}
+
+// loopStopped marks the sync loop gone
+func (t *loopTracker) loopStopped() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.alive = false
+}
+
+// cycleStart records the start of a sync cycle
+func (t *loopTracker) cycleStart(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycleStarted = now
+}
+
+// cycleEnd records a completed sync cycle and the last of the errors it ran into, if any
+func (t *loopTracker) cycleEnd(now time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycleDone = now
+	if err != nil {
+		t.lastError = err.Error()
+		t.lastErrorAt = now
+		t.failures++
+		return
+	}
+	t.lastSuccess = now
+	t.failures = 0
+}
+
+// LoopHealth reports whether the background sync loop is alive and when it last completed a cycle
+func (m *LocalSessionManager) LoopHealth() LoopHealth {
+	m.mu.RLock()
+	pending := m.pendingCreations
+	m.mu.RUnlock()
+
+	t := &m.loop
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	health := LoopHealth{
+		SyncAlive:           t.alive,
+		SyncInterval:        m.cfg.SyncInterval,
+		SyncStartedAt:       timeOrNil(t.startedAt),
+		LastCycleStartedAt:  timeOrNil(t.cycleStarted),
+		LastCycleAt:         timeOrNil(t.cycleDone),
+		LastError:           t.lastError,
+		LastErrorAt:         timeOrNil(t.lastErrorAt),
+		LastSuccessAt:       timeOrNil(t.lastSuccess),
+		ConsecutiveFailures: t.failures,
+		CreationsInFlight:   int(t.creating.Load()) + pending,
+		DeletesInFlight:     int(t.deleting.Load()),
+		DeletesPending:      len(m.deletes.pending()),
+	}
+	if !t.startedAt.IsZero() {
+		last := t.startedAt
+		if t.cycleDone.After(last) {
+			last = t.cycleDone
+		}
+		health.SyncStale = !t.alive || m.clock.Now().Sub(last) > syncStaleAfter*m.cfg.SyncInterval
+	}
+	return health
+}
+
+// deleteInstance deletes an AMS instance, counted as in flight meanwhile
+func (m *LocalSessionManager) deleteInstance(ctx context.Context, id string) error {
+	m.loop.deleting.Add(1)
+	defer m.loop.deleting.Add(-1)
+	return m.anboxClient.DeleteInstance(ctx, id)
+}
+
+// timeOrNil returns a pointer to t, nil for the zero time
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"time"
 )
 
 // session  cold -> warming -> warmed -> in use -> delete
@@ -13,15 +14,38 @@ type Manager interface {
 
 	// Session pool management
 	PoolStatus(ctx context.Context) (PoolStatus, error)
+	Stats(ctx context.Context) (Stats, error) // Cumulative counters since start
 
-	// State transition methods (State Pattern)
-	AcquireCold(ctx context.Context) (*Session, error)   // Get a cold session and change cold -> warming
-	SetWarmed(ctx context.Context, id string) error      // Change warming -> warmed
-	AcquireWarmed(ctx context.Context) (*Session, error) // Get a warmed session and change warmed -> in_use
-	Release(ctx context.Context, id string) error        // Delete session completely
+	// State transition methods (State Pattern), the sessions they return are snapshots
+	AcquireCold(ctx context.Context, opts ...AcquireOption) (*Session, error)   // Get a cold session and change cold -> warming
+	SetWarmed(ctx context.Context, id, warmToken string) error                  // Change warming -> warmed, warmToken comes from AcquireCold
+	AbandonWarming(ctx context.Context, id, warmToken string) error             // Change warming -> cold, keeping the anbox instance
+	AcquireWarmed(ctx context.Context, opts ...AcquireOption) (*Session, error) // Get a warmed session and change warmed -> in_use
+	Release(ctx context.Context, id string, reason ReleaseReason) error         // Delete session completely
+	// AcquireSpecific changes the warmed session id to in_use, failing when it is unknown or not warmed
+	AcquireSpecific(ctx context.Context, id string, opts ...AcquireOption) (*Session, error)
 
 	// Session utilities
-	GetSession(ctx context.Context, id string) (*Session, error)
-	ListSessions(ctx context.Context) ([]*Session, error)
-	Heartbeat(ctx context.Context, id string) error // Prevent session from being deleted due to timeout
+	GetSession(ctx context.Context, id string) (*Session, error) // A snapshot of the session
+	// ListSessions returns snapshots of the sessions in any of statuses, every session without statuses
+	ListSessions(ctx context.Context, statuses ...SessionStatus) ([]*Session, error)
+	Heartbeat(ctx context.Context, id string) error                                   // Prevent session from being deleted due to timeout
+	Extend(ctx context.Context, id string, by time.Duration) error                    // Push out the ExpiresAt of an in-use session, up to MaxInUseDuration
+	SetMetadata(ctx context.Context, id string, kv map[string]string) error           // Merge client metadata, an empty value removes the key
+	GetConnectionInfo(ctx context.Context, id, apiKey string) (ConnectionInfo, error) // Join an in-use session for the API key that acquired it
+	Reconnect(ctx context.Context, id, apiKey string) (ConnectionInfo, error)         // Join an in-use session again and restart its heartbeat window
+	ConnectHint(s *Session) ConnectHint                                               // How soon a client should retry a failed connect
+	HeartbeatPolicy() HeartbeatPolicy                                                 // How often clients should heartbeat in-use sessions
+	LoopHealth() LoopHealth                                                           // Whether the background sync loop is alive and making progress
+
+	// Drain stops handing out sessions, tells in-use sessions they end after grace and releases them afterwards
+	Drain(ctx context.Context, grace time.Duration) error
+	// DeletePool deletes every session that is not in use and stops handing out sessions, for a final cleanup
+	DeletePool(ctx context.Context) (int, error)
+
+	// Pause stops creating and handing out sessions until Resume, in-use sessions keep heartbeating and releasing
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	// Resize changes the pool's Min and Max in memory, the config file still applies after a restart
+	Resize(ctx context.Context, min, max int) error
 }
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Bounds on the metadata clients may attach to a session
+const (
+	MaxMetadataKeys        = 16
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 256
+)
+
+// ErrInvalidMetadata is returned when metadata exceeds the bounds above
+var ErrInvalidMetadata = errors.New("invalid session metadata")
+
+// AcquireOption customizes an acquire
+type AcquireOption func(*acquireOptions)
+
+type acquireOptions struct {
+	metadata       map[string]string
+	idempotencyKey string
+	apiKey         string
+	profile        string
+	warmOwner      string
+}
+
+// WithMetadata sets metadata on the acquired session as part of the acquire
+func WithMetadata(kv map[string]string) AcquireOption {
+	return func(o *acquireOptions) {
+		o.metadata = kv
+	}
+}
+
+func newAcquireOptions(opts []AcquireOption) (*acquireOptions, error) {
+	o := &acquireOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := validateMetadata(nil, o.metadata); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// validateMetadata checks that merging kv into current stays within the metadata bounds
+func validateMetadata(current, kv map[string]string) error {
+	keys := len(current)
+	for k, v := range kv {
+		if k == "" {
+			return fmt.Errorf("%w: key must not be empty", ErrInvalidMetadata)
+		}
+		if len(k) > MaxMetadataKeyLength {
+			return fmt.Errorf("%w: key %q is longer than %d characters", ErrInvalidMetadata, k, MaxMetadataKeyLength)
+		}
+		if len(v) > MaxMetadataValueLength {
+			return fmt.Errorf("%w: value for %q is longer than %d characters", ErrInvalidMetadata, k, MaxMetadataValueLength)
+		}
+		if _, exists := current[k]; !exists && v != "" {
+			keys++
+		}
+	}
+	if keys > MaxMetadataKeys {
+		return fmt.Errorf("%w: limited to %d keys", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+	return nil
+}
+
+// mergeMetadata returns a copy of current with kv applied, an empty value removes the key.
+// Sessions get a new map so responses already holding the old one are not mutated.
+func mergeMetadata(current, kv map[string]string) map[string]string {
+	if len(kv) == 0 {
+		return current
+	}
+	merged := make(map[string]string, len(current)+len(kv))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range kv {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,46 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DeletePool takes every cold, warming and warmed session out of the pool and deletes its anbox session,
+// so a clean shutdown does not leave idle instances running on the farm. No session is handed out
+// afterwards; in-use sessions are left to Drain. It returns how many sessions were deleted.
+func (m *LocalSessionManager) DeletePool(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	m.draining = true
+	sessions := make([]*Session, 0, len(m.cache))
+	for _, session := range m.cache {
+		if session.Status == InUse {
+			continue
+		}
+		m.removeLocked(session, SystemActor, "pool_deleted", ReleaseShutdown)
+		sessions = append(sessions, session)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	deleted := 0
+	for _, session := range sessions {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("stopped after deleting %d of %d sessions: %w", deleted, len(sessions), err))
+			break
+		}
+		if session.Anbox == nil {
+			continue
+		}
+		if err := m.deleteSession(ctx, session.Anbox.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete anbox session %s: %w", session.Anbox.ID, err))
+			continue
+		}
+		deleted++
+	}
+
+	logger.Infof("deleted %d of %d pool sessions of game %s", deleted, len(sessions), m.cfg.GameName)
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,204 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+)
+
+// ErrUnknownProfile is returned when an acquire names a screen profile the game does not declare
+var ErrUnknownProfile = errors.New("unknown screen profile")
+
+// ScreenProfile is a named screen, such as portrait or landscape, the pool keeps a sub-pool of sessions for
+type ScreenProfile struct {
+	Name         string `mapstructure:"name"`
+	Min          int    `mapstructure:"min"`        // sessions of this profile to keep, on top of which Min and MinReady fill the default profile
+	MinReady     int    `mapstructure:"min_ready"`  // cold or warmed sessions of this profile to keep
+	MinWarmed    int    `mapstructure:"min_warmed"` // warmed sessions of this profile the warming workers keep
+	ScreenConfig `mapstructure:",squash"`
+}
+
+// ProfileStatus breaks the pool counts down for one screen profile
+type ProfileStatus struct {
+	Min       int `json:"min"`
+	MinReady  int `json:"min_ready"`
+	MinWarmed int `json:"min_warmed"`
+	Total     int `json:"total"`
+	Cold      int `json:"cold"`
+	Warming   int `json:"warming"`
+	Warmed    int `json:"warmed"`
+	InUse     int `json:"in_use"`
+}
+
+// WithProfile acquires a session rendered with the named screen profile, without it the default profile is used
+func WithProfile(name string) AcquireOption {
+	return func(o *acquireOptions) {
+		o.profile = name
+	}
+}
+
+// defaultProfile is the first declared profile, or "" for a single-profile pool
+func (c *Config) defaultProfile() string {
+	if len(c.ScreenProfiles) == 0 {
+		return ""
+	}
+	return c.ScreenProfiles[0].Name
+}
+
+// taggedProfile maps the profile tag of a session to its profile, untagged sessions such as ones created
+// before profiles were configured belong to the default profile
+func (c *Config) taggedProfile(tag string) string {
+	if tag == "" {
+		return c.defaultProfile()
+	}
+	return tag
+}
+
+// minWarmed is how many warmed sessions of profile the warming workers keep. The default profile is held
+// to MinWarmed as well as to its own.
+func (c *Config) minWarmed(profile string) int {
+	n := 0
+	if p, ok := c.lookupProfile(profile); ok {
+		n = p.MinWarmed
+	}
+	if profile == c.defaultProfile() {
+		n = max(n, c.MinWarmed)
+	}
+	return n
+}
+
+// warmsOnServer reports whether the warming workers have a warmed target in any profile
+func (c *Config) warmsOnServer() bool {
+	if c.MinWarmed > 0 {
+		return true
+	}
+	for _, p := range c.ScreenProfiles {
+		if p.MinWarmed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupProfile returns the declared profile called name
+func (c *Config) lookupProfile(name string) (*ScreenProfile, bool) {
+	for i := range c.ScreenProfiles {
+		if c.ScreenProfiles[i].Name == name {
+			return &c.ScreenProfiles[i], true
+		}
+	}
+	return nil, false
+}
+
+// resolveProfile maps the profile an acquire asked for to the profile sessions are tagged with
+func (c *Config) resolveProfile(name string) (string, error) {
+	if name == "" {
+		return c.defaultProfile(), nil
+	}
+	if _, ok := c.lookupProfile(name); !ok {
+		return "", fmt.Errorf("%w %q for game %s", ErrUnknownProfile, name, c.GameName)
+	}
+	return name, nil
+}
+
+// screen returns the screen sessions of profile are created with, the game's screen_config outside any profile
+func (m *LocalSessionManager) screen(profile string) anbox.Screen {
+	screen := m.cfg.ScreenConfig
+	if p, ok := m.cfg.lookupProfile(profile); ok {
+		screen = &p.ScreenConfig
+	}
+	if screen == nil {
+		return anbox.Screen{}
+	}
+	return anbox.Screen{
+		Width:   screen.Width,
+		Height:  screen.Height,
+		Density: screen.Density,
+		FPS:     screen.Fps,
+	}
+}
+
+// profileCountsLocked counts the cached sessions of each profile. Callers must hold m.mu.
+func (m *LocalSessionManager) profileCountsLocked() map[string]int {
+	counts := make(map[string]int, len(m.cfg.ScreenProfiles))
+	for _, session := range m.cache {
+		counts[session.Profile]++
+	}
+	return counts
+}
+
+// profileToCreateLocked picks the profile the next pool session is created for: the first profile
+// below its own Min or MinReady, otherwise the default profile while the pool is below Min or the
+// default profile below MinReady. Callers must hold m.mu.
+func (m *LocalSessionManager) profileToCreateLocked() (string, bool) {
+	if len(m.cfg.ScreenProfiles) > 0 {
+		counts := m.profileCountsLocked()
+		for _, p := range m.cfg.ScreenProfiles {
+			if counts[p.Name] < p.Min || m.readyCountLocked(p.Name) < p.MinReady {
+				return p.Name, true
+			}
+		}
+	}
+	defaultProfile := m.cfg.defaultProfile()
+	if len(m.cache) < m.cfg.Min || m.readyCountLocked(defaultProfile) < m.cfg.MinReady {
+		return defaultProfile, true
+	}
+	return "", false
+}
+
+// warmupPlanLocked lists the profile of every session the startup warmup creates, capped at Max.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) warmupPlanLocked() []string {
+	var plan []string
+	planned := make(map[string]int)
+	counts := m.profileCountsLocked()
+	// New sessions start cold, so they count towards MinReady as well
+	for _, p := range m.cfg.ScreenProfiles {
+		for need := max(p.Min-counts[p.Name], p.MinReady-m.readyCountLocked(p.Name)); planned[p.Name] < need; planned[p.Name]++ {
+			plan = append(plan, p.Name)
+		}
+	}
+	defaultProfile := m.cfg.defaultProfile()
+	for len(m.cache)+len(plan) < m.cfg.Min || m.readyCountLocked(defaultProfile)+planned[defaultProfile] < m.cfg.MinReady {
+		plan = append(plan, defaultProfile)
+		planned[defaultProfile]++
+	}
+	if room := max(m.cfg.Max-len(m.cache), 0); len(plan) > room {
+		plan = plan[:room]
+	}
+	return plan
+}
+
+// profileStatusLocked breaks the pool down per declared profile, nil for a single-profile pool.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) profileStatusLocked() map[string]ProfileStatus {
+	if len(m.cfg.ScreenProfiles) == 0 {
+		return nil
+	}
+	profiles := make(map[string]ProfileStatus, len(m.cfg.ScreenProfiles))
+	for _, p := range m.cfg.ScreenProfiles {
+		profiles[p.Name] = ProfileStatus{Min: p.Min, MinReady: p.MinReady, MinWarmed: p.MinWarmed}
+	}
+	for _, session := range m.cache {
+		status, ok := profiles[session.Profile]
+		if !ok {
+			continue
+		}
+		status.Total++
+		switch session.Status {
+		case Cold:
+			if m.launchedLocked(session) {
+				status.Cold++
+			}
+		case Warming:
+			status.Warming++
+		case Warmed:
+			status.Warmed++
+		case InUse:
+			status.InUse++
+		}
+		profiles[session.Profile] = status
+	}
+	return profiles
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned when an API key already holds MaxSessionsPerKey sessions
+var ErrQuotaExceeded = errors.New("session quota exceeded")
+
+// WithAPIKey attributes the acquired session to a partner API key for per-key quotas
+func WithAPIKey(key string) AcquireOption {
+	return func(o *acquireOptions) {
+		o.apiKey = key
+	}
+}
+
+// checkQuotaLocked fails when key already holds its maximum of acquired sessions.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) checkQuotaLocked(key string) error {
+	if key == "" || m.cfg.MaxSessionsPerKey <= 0 {
+		return nil
+	}
+	if used := m.keyUsageLocked()[key]; used >= m.cfg.MaxSessionsPerKey {
+		return fmt.Errorf("%w: api key holds %d of %d sessions for game %s", ErrQuotaExceeded, used, m.cfg.MaxSessionsPerKey, m.cfg.GameName)
+	}
+	return nil
+}
+
+// keyUsageLocked counts the acquired sessions held by each API key. Callers must hold m.mu.
+func (m *LocalSessionManager) keyUsageLocked() map[string]int {
+	usage := make(map[string]int)
+	for _, session := range m.cache {
+		if session.APIKey == "" || (session.Status != Warming && session.Status != InUse) {
+			continue
+		}
+		usage[session.APIKey]++
+	}
+	return usage
+}
+
+// KeyFingerprint identifies an API key in stats and logs without revealing it: the first 12 hex digits
+// of its SHA-256
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// keyUsageByFingerprintLocked is keyUsageLocked keyed by KeyFingerprint. Callers must hold m.mu.
+func (m *LocalSessionManager) keyUsageByFingerprintLocked() map[string]int {
+	usage := make(map[string]int)
+	for key, count := range m.keyUsageLocked() {
+		usage[KeyFingerprint(key)] += count
+	}
+	return usage
+}
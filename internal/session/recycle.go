@@ -0,0 +1,48 @@
+package session
+
+import (
+	"context"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// recycleCold deletes the oldest cold session once it has been ready for longer than MaxColdAge, so the pool
+// does not hand out instances that idled for hours. Only one session is recycled per sync cycle, which staggers
+// a pool created at once, and ensureMinPoolSize creates the replacement. Nothing is recycled while a replacement
+// could not be created.
+func (m *LocalSessionManager) recycleCold() {
+	if m.cfg.MaxColdAge <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	if m.draining || m.paused || m.createHaltedLocked() || now.Before(m.createBackoffUntil) {
+		return
+	}
+
+	var oldest *Session
+	for _, session := range m.cache {
+		if session.Status != Cold || session.launching || now.Sub(session.CreatedAt) <= m.cfg.MaxColdAge {
+			continue
+		}
+		if oldest == nil || session.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = session
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	logger.Infof("recycling session %s of game %s, cold for %s", oldest.ID, m.cfg.GameName, now.Sub(oldest.CreatedAt))
+	m.removeLocked(oldest, SystemActor, "max_cold_age", ReleaseRecycled)
+	go func(s *Session) {
+		if s.Anbox != nil {
+			if err := m.deleteSession(context.Background(), s.Anbox.ID); err != nil {
+				logger.Errorf("failed to delete recycled anbox session %s: %v", s.Anbox.ID, err)
+			}
+		}
+	}(oldest)
+}
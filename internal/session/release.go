@@ -0,0 +1,47 @@
+package session
+
+// ReleaseReason is why a session left the pool
+type ReleaseReason string
+
+const (
+	// ReleaseClient is a client releasing its session through the API
+	ReleaseClient ReleaseReason = "client"
+	// ReleaseExpired is a session that outlived its TTL
+	ReleaseExpired ReleaseReason = "expired"
+	// ReleaseHeartbeatTimeout is a warmed or in-use session whose client stopped sending heartbeats
+	ReleaseHeartbeatTimeout ReleaseReason = "heartbeat_timeout"
+	// ReleaseDrain is an in-use session released when the pool was drained
+	ReleaseDrain ReleaseReason = "drain"
+	// ReleaseErrored is a session that failed, e.g. the gateway reported it dead or it could not be joined
+	ReleaseErrored ReleaseReason = "errored"
+	// ReleaseEvicted is an idle session reclaimed to make room under Max
+	ReleaseEvicted ReleaseReason = "evicted"
+	// ReleaseRecycled is a cold session replaced after MaxColdAge
+	ReleaseRecycled ReleaseReason = "recycled"
+	// ReleaseShutdown is an idle session deleted by DeletePool on shutdown
+	ReleaseShutdown ReleaseReason = "shutdown"
+)
+
+// ReleaseNotifier hears about the in-use sessions that leave the pool and why.
+// Released is called with the manager lock held and must neither block nor call back into the manager.
+type ReleaseNotifier interface {
+	Released(session Session, reason ReleaseReason)
+}
+
+// WithReleaseNotifier makes the manager tell notifier about every in-use session it releases
+func WithReleaseNotifier(notifier ReleaseNotifier) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.releases = notifier
+	}
+}
+
+// removeLocked takes session out of the pool, counting reason in the stats and auditing the transition.
+// Deleting the gateway session is up to the caller. Callers must hold m.mu.
+func (m *LocalSessionManager) removeLocked(session *Session, actor, transition string, reason ReleaseReason) {
+	delete(m.cache, session.ID)
+	m.releaseReasons[reason]++
+	m.recordAuditLocked(session, AuditEvent{From: session.Status, To: Deleted, Actor: actor, Reason: transition, ReleaseReason: reason})
+	if m.releases != nil && session.Status == InUse {
+		m.releases.Released(*session, reason)
+	}
+}
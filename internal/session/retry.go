@@ -0,0 +1,97 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultWarmupEstimate is how long a warm-up is expected to take before any SetWarmed was seen
+	DefaultWarmupEstimate = 10 * time.Second
+	// MinRetryAfter is the shortest retry hint given to a client that found the pool empty
+	MinRetryAfter = time.Second
+)
+
+// ErrPoolEmpty is returned, as a *PoolEmptyError, when an acquire finds no session to hand out
+var ErrPoolEmpty = errors.New("no session available")
+
+// PoolEmptyError tells a client that found the pool empty when a session will likely be available
+type PoolEmptyError struct {
+	Status      SessionStatus // the status the acquire looked for
+	RetryAfter  time.Duration
+	AvailableAt time.Time
+	// Warming and Booting are the sessions on their way that the estimate is based on
+	Warming int
+	Booting int
+	message string
+}
+
+func (e *PoolEmptyError) Error() string {
+	return e.message
+}
+
+func (e *PoolEmptyError) Unwrap() error {
+	return ErrPoolEmpty
+}
+
+// poolEmptyLocked builds the error for an acquire of status sessions of profile that found none.
+// Warmed sessions come from warming ones, estimated from how long warm-ups took so far;
+// cold ones from instances still booting, which the next sync adopts, or launching their app. Callers must hold m.mu.
+func (m *LocalSessionManager) poolEmptyLocked(status SessionStatus, profile, format string, args ...any) *PoolEmptyError {
+	now := m.clock.Now()
+	err := &PoolEmptyError{
+		Status:     status,
+		RetryAfter: m.cfg.EmptyRetryAfter,
+		Booting:    m.booting + m.pendingCreations + m.launchingLocked(),
+		message:    fmt.Sprintf(format, args...),
+	}
+
+	switch status {
+	case Warmed:
+		for _, session := range m.cache {
+			if session.Status != Warming || session.Profile != profile {
+				continue
+			}
+			err.Warming++
+			err.RetryAfter = min(err.RetryAfter, m.warmupEstimateLocked()-now.Sub(session.StatusChangedAt))
+		}
+	case Cold:
+		if err.Booting > 0 {
+			err.RetryAfter = min(err.RetryAfter, m.cfg.SyncInterval)
+		}
+	}
+
+	err.RetryAfter = max(err.RetryAfter, MinRetryAfter)
+	err.AvailableAt = now.Add(err.RetryAfter)
+	return err
+}
+
+// backoffEmptyLocked is poolEmptyLocked for an on-demand acquire refused while creation backs off until until.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) backoffEmptyLocked(profile string, until time.Time) *PoolEmptyError {
+	err := m.poolEmptyLocked(Warmed, profile, "no warmed sessions available and session creation is backing off until %s", until.Format(time.RFC3339))
+	if err.Warming == 0 {
+		err.RetryAfter = max(until.Sub(m.clock.Now()), MinRetryAfter)
+		err.AvailableAt = m.clock.Now().Add(err.RetryAfter)
+	}
+	return err
+}
+
+// warmupEstimateLocked is how long a warm-up is expected to take. Callers must hold m.mu.
+func (m *LocalSessionManager) warmupEstimateLocked() time.Duration {
+	if m.warmupEstimate == 0 {
+		return DefaultWarmupEstimate
+	}
+	return m.warmupEstimate
+}
+
+// observeWarmupLocked folds the duration of a finished warm-up into the estimate, recent ones weigh most.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) observeWarmupLocked(took time.Duration) {
+	if m.warmupEstimate == 0 {
+		m.warmupEstimate = took
+		return
+	}
+	m.warmupEstimate = (4*m.warmupEstimate + took) / 5
+}
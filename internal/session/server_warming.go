@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultWarmingCheckInterval is how often an idle warming worker looks for cold sessions to warm
+const DefaultWarmingCheckInterval = time.Second
+
+// serverWarmOwner is the warm owner of the sessions the warming workers are warming
+const serverWarmOwner = "system:warming_worker"
+
+// warmingWorker warms cold sessions while a profile has fewer than its MinWarmed warmed, checking every
+// DefaultWarmingCheckInterval once there is nothing to do, until the manager stops
+func (m *LocalSessionManager) warmingWorker(ctx context.Context) {
+	ticker := time.NewTicker(DefaultWarmingCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for m.warmNext(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.syncStopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warmNext claims a cold session and warms it through SetWarmed, running the warm-up actions, when its profile has
+// fewer than MinWarmed sessions warmed or being warmed by the workers. It reports whether a session became warmed.
+func (m *LocalSessionManager) warmNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	id, warmToken, ok := m.claimForWarming()
+	if !ok {
+		return false
+	}
+	if err := m.SetWarmed(WithActor(ctx, SystemActor), id, warmToken); err != nil {
+		logger.Warnf("warming worker of game %s failed to warm session %s: %v", m.cfg.GameName, id, err)
+		return false
+	}
+	return true
+}
+
+// claimForWarming moves a cold session of a profile below its MinWarmed to warming for a warming worker and
+// returns it with its warm token
+func (m *LocalSessionManager) claimForWarming() (string, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.draining || m.paused || !m.anboxClient.Available() {
+		return "", "", false
+	}
+
+	warmed := make(map[string]int)
+	for _, session := range m.cache {
+		if session.Status == Warmed || (session.Status == Warming && session.WarmOwner == serverWarmOwner) {
+			warmed[session.Profile]++
+		}
+	}
+
+	for _, session := range m.cache {
+		if session.Status == Cold && m.launchedLocked(session) && warmed[session.Profile] < m.cfg.minWarmed(session.Profile) {
+			m.auditLocked(session, session.Status, Warming, SystemActor, "server_warming")
+			session.Status = Warming
+			session.StatusChangedAt = m.clock.Now()
+			session.LastHeartbeat = m.clock.Now()
+			session.WarmToken = newWarmToken()
+			session.WarmOwner = serverWarmOwner
+			return session.ID, session.WarmToken, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultStarvationWindow is the window empty acquires are counted over when StarvationWindow is not set
+const DefaultStarvationWindow = time.Minute
+
+// StarvationAlert is raised when more than StarvationThreshold acquires found the pool empty within StarvationWindow
+type StarvationAlert struct {
+	Time          time.Time     `json:"time"`
+	Game          string        `json:"game"`
+	EmptyAcquires int           `json:"empty_acquires"` // empty acquires within the window, capped at threshold+1
+	Threshold     int           `json:"threshold"`
+	Window        time.Duration `json:"window_ns"`
+}
+
+// StarvationAlerter receives pool starvation alerts, at most one per game and window.
+// Alert is called with the manager lock held and must neither block nor call back into the manager.
+type StarvationAlerter interface {
+	Alert(alert StarvationAlert)
+}
+
+// WithStarvationAlerter makes the manager send pool starvation alerts to alerter, they are logged either way
+func WithStarvationAlerter(alerter StarvationAlerter) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.starvation.alerter = alerter
+	}
+}
+
+// starvationTracker keeps the times of the latest empty acquires to tell when the pool is starved
+type starvationTracker struct {
+	mu      sync.Mutex
+	empties []time.Time // oldest first, at most threshold+1 within the window
+	alerted time.Time   // when the last alert fired
+	alerter StarvationAlerter
+}
+
+// starvationWindow returns the window empty acquires are counted over
+func (c *Config) starvationWindow() time.Duration {
+	if c.StarvationWindow > 0 {
+		return c.StarvationWindow
+	}
+	return DefaultStarvationWindow
+}
+
+// recordAcquireEmpty counts an acquire that found no session and alerts when the pool is starved.
+// It is safe to call with or without m.mu held.
+func (m *LocalSessionManager) recordAcquireEmpty() {
+	m.counters.acquireEmpty.Add(1)
+	threshold := m.cfg.StarvationThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	now := m.clock.Now()
+	window := m.cfg.starvationWindow()
+	t := &m.starvation
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.empties = append(t.empties, now)
+	drop := 0
+	for drop < len(t.empties) && (now.Sub(t.empties[drop]) >= window || len(t.empties)-drop > threshold+1) {
+		drop++
+	}
+	t.empties = t.empties[drop:]
+
+	if len(t.empties) <= threshold || (!t.alerted.IsZero() && now.Sub(t.alerted) < window) {
+		return
+	}
+	t.alerted = now
+	m.counters.starvationAlerts.Add(1)
+
+	alert := StarvationAlert{Time: now, Game: m.cfg.GameName, EmptyAcquires: len(t.empties), Threshold: threshold, Window: window}
+	logger.Warnf("pool starvation: game=%s empty_acquires=%d threshold=%d window=%s", alert.Game, alert.EmptyAcquires, alert.Threshold, alert.Window)
+	if t.alerter != nil {
+		t.alerter.Alert(alert)
+	}
+}
+
+// DefaultWebhookTimeout bounds a starvation webhook request
+const DefaultWebhookTimeout = 5 * time.Second
+
+// WebhookAlerter posts every starvation alert or guarantee event as JSON to a URL, in the background
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter creates an alerter posting to url
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{url: url, client: &http.Client{Timeout: DefaultWebhookTimeout}}
+}
+
+// Alert posts alert without waiting for the answer, failures are logged
+func (w *WebhookAlerter) Alert(alert StarvationAlert) {
+	go func() {
+		if err := w.post(alert); err != nil {
+			logger.Errorf("failed to send pool starvation alert of game %s to webhook: %v", alert.Game, err)
+		}
+	}()
+}
+
+// Notify posts event without waiting for the answer, failures are logged
+func (w *WebhookAlerter) Notify(event GuaranteeEvent) {
+	go func() {
+		if err := w.post(event); err != nil {
+			logger.Errorf("failed to send warmed session guarantee %s event of game %s to webhook: %v", event.Kind, event.Game, err)
+		}
+	}()
+}
+
+func (w *WebhookAlerter) post(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package session
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// counters holds the cumulative session counters behind Stats
+type counters struct {
+	created        atomic.Int64
+	released       atomic.Int64
+	expired        atomic.Int64
+	acquireSuccess atomic.Int64
+	acquireEmpty   atomic.Int64
+	createFailures atomic.Int64
+	evicted        atomic.Int64
+	healthMismatch atomic.Int64
+	// starvationAlerts counts the pool starvation alerts raised
+	starvationAlerts atomic.Int64
+	// guaranteeBreaches counts the breaches of MinWarmedGuarantee reported
+	guaranteeBreaches atomic.Int64
+}
+
+// snapshot returns the current counter values
+func (c *counters) snapshot(since time.Time) Stats {
+	return Stats{
+		Since:             since,
+		Created:           c.created.Load(),
+		Released:          c.released.Load(),
+		Expired:           c.expired.Load(),
+		AcquireSuccess:    c.acquireSuccess.Load(),
+		AcquireEmpty:      c.acquireEmpty.Load(),
+		CreateFailures:    c.createFailures.Load(),
+		Evicted:           c.evicted.Load(),
+		HealthMismatches:  c.healthMismatch.Load(),
+		StarvationAlerts:  c.starvationAlerts.Load(),
+		GuaranteeBreaches: c.guaranteeBreaches.Load(),
+	}
+}
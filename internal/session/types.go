@@ -2,6 +2,8 @@ package session
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"time"
 
 	"github.com/letusgogo/playable-backend/internal/anbox"
@@ -10,39 +12,264 @@ import (
 // AnboxClient defines the interface for interacting with Anbox Gateway
 // This allows for easier testing by providing a mockable interface
 type AnboxClient interface {
+	Create(ctx context.Context, req anbox.CreateSessionRequest) (*anbox.SessionDetails, error)
 	CreateAsync(ctx context.Context, req anbox.CreateSessionRequest) error
 	Delete(ctx context.Context, sessionID string) error
+	CaptureScreenshot(ctx context.Context, sessionID string) ([]byte, error)
+	Join(ctx context.Context, sessionID string) (*anbox.JoinSessionDetails, error)   // connection details scoped to one session
+	GetSession(ctx context.Context, sessionID string) (*anbox.SessionDetails, error) // the gateway's view of a session
 	GetAllRunningSession(ctx context.Context) ([]*anbox.SessionDetails, error)
+	GetAllInstances(ctx context.Context) ([]*anbox.InstanceDetails, error)
+	DeleteInstance(ctx context.Context, instanceID string) error
+	GetApp(ctx context.Context, name string) (*anbox.AppDetails, error)
 	GetGatewayURL() string
 	GetAuthToken() string
+	GetReplicaID() string
+	Available() bool // false while the upstream circuit breaker is open
 }
 
 type PoolStatus struct {
+	Min     int `json:"min"`
+	Max     int `json:"max"`
 	Total   int `json:"total"`
 	Cold    int `json:"cold"`
 	Warming int `json:"warming"`
 	Warmed  int `json:"warmed"`
 	InUse   int `json:"in_use"`
+	// Paused is set while Pause holds off session creation and acquisition
+	Paused bool `json:"paused"`
+	// Booting and Errored count this replica's instances of the game that AMS reported as not running on the last sync
+	Booting int `json:"booting"`
+	Errored int `json:"errored"`
+	// Launching counts the cold sessions still running their LaunchApp commands, they are not in Cold
+	Launching int `json:"launching"`
+	// Profiles breaks the counts down per screen profile, only for games that declare screen_profiles
+	Profiles map[string]ProfileStatus `json:"profiles,omitempty"`
+}
+
+// Stats are cumulative session counters since the manager was created
+type Stats struct {
+	Since          time.Time `json:"since"`
+	Created        int64     `json:"created"`         // sessions the gateway accepted to create
+	Released       int64     `json:"released"`        // sessions released by clients or drain
+	Expired        int64     `json:"expired"`         // sessions removed for TTL or heartbeat timeout
+	AcquireSuccess int64     `json:"acquire_success"` // acquires that handed out a session
+	AcquireEmpty   int64     `json:"acquire_empty"`   // acquires that found no session to hand out
+	CreateFailures int64     `json:"create_failures"` // creation requests the gateway rejected
+	Evicted        int64     `json:"evicted"`         // idle sessions reclaimed to make room under Max
+	// HealthMismatches counts sessions AMS listed as running that the gateway reported as failed or absent
+	HealthMismatches int64 `json:"health_mismatches"`
+	// StarvationAlerts counts the windows in which more than StarvationThreshold acquires found the pool empty
+	StarvationAlerts int64 `json:"starvation_alerts"`
+	// GuaranteeBreaches counts the times warmed sessions stayed below MinWarmedGuarantee for GuaranteeBreachAfter,
+	// GuaranteeBreachedSince is when the ongoing breach started
+	GuaranteeBreaches      int64      `json:"guarantee_breaches"`
+	GuaranteeBreachedSince *time.Time `json:"guarantee_breached_since,omitempty"`
+	// CreateFailureStreak is the number of creation failures since the last success and
+	// CreateBackoffUntil when creation is tried again, both are zero while creation works
+	CreateFailureStreak int        `json:"create_failure_streak"`
+	CreateBackoffUntil  *time.Time `json:"create_backoff_until,omitempty"`
+	// KeyUsage is the number of warming and in-use sessions each API key currently holds, keyed by KeyFingerprint
+	KeyUsage map[string]int `json:"key_usage,omitempty"`
+	// ReleaseReasons counts the sessions that left the pool by why they left, whether released, expired or reclaimed
+	ReleaseReasons map[ReleaseReason]int64 `json:"release_reasons,omitempty"`
 }
 
 type Config struct {
 	GameName         string        `mapstructure:"game_name"`
+	AppName          string        `mapstructure:"app_name"`          // Anbox application name, defaults to GameName
 	Min              int           `mapstructure:"min"`               // Minimum sessions to maintain
 	Max              int           `mapstructure:"max"`               // Maximum total sessions allowed
 	SessionTTL       time.Duration `mapstructure:"session_ttl"`       // Time before session expires
 	HeartbeatTimeout time.Duration `mapstructure:"heartbeat_timeout"` // Time before session considered dead
 	SyncInterval     time.Duration `mapstructure:"sync_interval"`     // How often to sync running sessions from AMS
 	ScreenConfig     *ScreenConfig `mapstructure:"screen_config"`
+	// MinReady is the minimum number of acquirable (cold or warmed) sessions to maintain besides Min.
+	// Warming and in-use sessions do not count, so the pool grows past Min while ready inventory is low.
+	// With screen profiles it counts the default profile, the others keep their own MinReady.
+	MinReady int `mapstructure:"min_ready"`
+	// WarmupConcurrency is how many sessions may be created in parallel at startup until Min is reached.
+	// Values <= 1 keep the steady-state one-at-a-time creation.
+	WarmupConcurrency int `mapstructure:"warmup_concurrency"`
+	// OrphanMaxAge is the age after which a managed instance unknown to the cache is reaped.
+	// Defaults to 3x SessionTTL.
+	OrphanMaxAge time.Duration `mapstructure:"orphan_max_age"`
+	// KeepErrored leaves instances in error or stopped state on AMS for inspection, they are only logged and counted
+	KeepErrored bool `mapstructure:"keep_errored"`
+	// MaxInUseDuration caps how long after its acquire Extend can push a session's ExpiresAt, defaults to 2x SessionTTL
+	MaxInUseDuration time.Duration `mapstructure:"max_in_use_duration"`
+	// CreateBackoff is how long creation pauses after the gateway reports it is out of capacity
+	CreateBackoff time.Duration `mapstructure:"create_backoff"`
+	// CreateBackoffMax caps the backoff, which doubles with every creation failure in a row
+	CreateBackoffMax time.Duration `mapstructure:"create_backoff_max"`
+	// CreateHaltTimeout is how long creation stays halted after a permanent error, e.g. a missing app, before
+	// it is tried again. A successful creation or Init lifts the halt right away, 0 keeps it until then.
+	CreateHaltTimeout time.Duration `mapstructure:"create_halt_timeout"`
+	// OnDemand makes AcquireWarmed create a session synchronously when no warmed session is available.
+	// The session runs LaunchCommands and WarmupActions, when configured, before it is handed out.
+	OnDemand bool `mapstructure:"on_demand"`
+	// OnDemandTimeout bounds how long an on-demand acquire waits for the gateway to create the session
+	OnDemandTimeout time.Duration `mapstructure:"on_demand_timeout"`
+	// CreateVerifyTimeout makes an on-demand acquire poll the created session every CreateVerifyInterval until
+	// the gateway reports it running, a session that is not running in time is deleted. 0 trusts the create.
+	CreateVerifyTimeout  time.Duration `mapstructure:"create_verify_timeout"`
+	CreateVerifyInterval time.Duration `mapstructure:"create_verify_interval"`
+	// EvictionPolicy picks the idle session reclaimed when a new session is needed at Max, defaults to EvictNone
+	EvictionPolicy EvictionPolicy `mapstructure:"eviction_policy"`
+	// DrainOrder is the order Drain releases in-use sessions in once the grace window is over, defaults to DrainOldestFirst
+	DrainOrder DrainOrder `mapstructure:"drain_order"`
+	// IdempotencyTTL is how long an idempotency key keeps returning the session it acquired
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+	// MaxSessionsPerKey caps the warming and in-use sessions a single API key may hold, 0 means unlimited
+	MaxSessionsPerKey int `mapstructure:"max_sessions_per_key"`
+	// WarmingTimeout reverts a warming session to cold when its client never calls SetWarmed, 0 disables it
+	WarmingTimeout time.Duration `mapstructure:"warming_timeout"`
+	// MaxWarmingDuration is the tighter bound on warming after which the instance is considered broken and the
+	// session is deleted, or reverted to cold if MaxWarmingAction says so. 0 disables it. Like WarmingTimeout it
+	// does not apply while warm-up actions run, WarmupTimeout bounds those.
+	MaxWarmingDuration time.Duration        `mapstructure:"max_warming_duration"`
+	MaxWarmingAction   WarmingOverrunAction `mapstructure:"max_warming_action"`
+	// GracePeriod keeps sessions that changed state less than this long ago safe from expiry
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+	// MaxColdAge recycles cold sessions that have been ready for longer, one per sync cycle, 0 disables it
+	MaxColdAge time.Duration `mapstructure:"max_cold_age"`
+	// InUseAbsentSyncs is how many consecutive syncs an in-use session must be missing from the AMS list before
+	// it is pruned, so a listing that briefly lags does not drop a player. 0 or 1 prune on the first absence
+	// like idle sessions.
+	InUseAbsentSyncs int `mapstructure:"in_use_absent_syncs"`
+	// InstanceNamePrefix names created instances "<prefix>-<game>-<shortid>", empty leaves naming to AMS
+	InstanceNamePrefix string `mapstructure:"instance_name_prefix"`
+	// IdleTimeMin and Ephemeral are passed to anbox with every created session. Anbox stops a session no client
+	// has been connected to for IdleTimeMin minutes, which a pool session waiting to be handed out never has, so
+	// it should exceed how long idle sessions stay in the pool, i.e. SessionTTL. 0 leaves reaping to the pool.
+	// Ephemeral sessions are deleted by anbox once stopped, including when their client disconnects.
+	IdleTimeMin int  `mapstructure:"idle_time_min"`
+	Ephemeral   bool `mapstructure:"ephemeral"`
+	// HealthSweepInterval is how often every cached session is checked against the gateway, 0 disables the sweep.
+	// Sessions the gateway reports as failed or no longer knows are reclaimed even while AMS still lists them.
+	HealthSweepInterval time.Duration `mapstructure:"health_sweep_interval"`
+	// HealthSweepConcurrency bounds the gateway lookups a sweep runs at once
+	HealthSweepConcurrency int `mapstructure:"health_sweep_concurrency"`
+	// HealthAbsentSweeps is how many consecutive sweeps the gateway must not know a session before it is
+	// reclaimed, a session that was just created may not be registered with it yet. 0 or 1 reclaim on the first.
+	HealthAbsentSweeps int `mapstructure:"health_absent_sweeps"`
+	// ScreenProfiles splits the pool into sub-pools with their own screen and Min, the first one is the default.
+	// Without profiles every session uses ScreenConfig.
+	ScreenProfiles []ScreenProfile `mapstructure:"screen_profiles"`
+	// ConnectSettle is how long after a session became ready the gateway may still refuse joins,
+	// acquires within it hint clients to retry the connect after the time left
+	ConnectSettle time.Duration `mapstructure:"connect_settle"`
+	// ConnectRetryMin is the smallest connect retry hint, given for sessions that settled long ago
+	ConnectRetryMin time.Duration `mapstructure:"connect_retry_min"`
+	// EmptyRetryAfter is the retry hint of an acquire that found the pool empty with no session on its way,
+	// it also caps the estimate when sessions are warming or booting
+	EmptyRetryAfter time.Duration `mapstructure:"empty_retry_after"`
+	// StarvationThreshold raises a pool starvation alert when more empty acquires than this happen within
+	// StarvationWindow, at most once per window. 0 disables the alert.
+	StarvationThreshold int           `mapstructure:"starvation_threshold"`
+	StarvationWindow    time.Duration `mapstructure:"starvation_window"`
+	// MinWarmedGuarantee is the number of warmed sessions promised to be ready at all times, 0 disables the check.
+	// A breach is reported once fewer stay warmed for GuaranteeBreachAfter, and a recovery once they are back.
+	// It only observes the pool, MinReady is what makes it create sessions.
+	MinWarmedGuarantee   int           `mapstructure:"min_warmed_guarantee"`
+	GuaranteeBreachAfter time.Duration `mapstructure:"guarantee_breach_after"`
+	// LaunchApp runs LaunchCommands in every new session before it is handed out, so clients do not see the
+	// app still booting. Synced sessions only become acquirable once they finished, within LaunchTimeout.
+	// A synced session whose launch failed LaunchAttempts times is reclaimed. The anbox client must be an AppLauncher.
+	LaunchApp      bool          `mapstructure:"launch_app"`
+	LaunchCommands [][]string    `mapstructure:"launch_commands"`
+	LaunchTimeout  time.Duration `mapstructure:"launch_timeout"`
+	LaunchAttempts int           `mapstructure:"launch_attempts"`
+	// WarmupActions run in order in the instance when SetWarmed is called, the session only becomes warmed once
+	// all succeeded within WarmupTimeout and is reclaimed when one fails. They run through the WithWarmupRunner
+	// runner or an anbox client that is an AppLauncher, with WarmupInputViaGateway taps, swipes and text are
+	// injected over the gateway instead, the client must then be an InputSender.
+	WarmupActions         []WarmupAction `mapstructure:"warmup_actions"`
+	WarmupTimeout         time.Duration  `mapstructure:"warmup_timeout"`
+	WarmupInputViaGateway bool           `mapstructure:"warmup_input_via_gateway"`
+	// WarmingWorkers warm cold sessions on the backend until MinWarmed are warmed, so AcquireWarmed has inventory
+	// without a client warming them. A worker goes through SetWarmed, WarmupActions run as for clients, and
+	// checks again every DefaultWarmingCheckInterval once the target is met. 0 leaves warming to clients.
+	// With screen profiles MinWarmed counts the default profile, the others keep their own MinWarmed.
+	WarmingWorkers int `mapstructure:"warming_workers"`
+	MinWarmed      int `mapstructure:"min_warmed"`
+}
+
+// DrainOrder selects which in-use sessions Drain releases first, by the time they were acquired
+type DrainOrder string
+
+const (
+	DrainOldestFirst DrainOrder = "oldest_first" // players who have played longest go first
+	DrainNewestFirst DrainOrder = "newest_first" // players who just started go first
+)
+
+// Valid reports whether o is a known order, the empty order means DrainOldestFirst
+func (o DrainOrder) Valid() bool {
+	switch o {
+	case "", DrainOldestFirst, DrainNewestFirst:
+		return true
+	}
+	return false
+}
+
+// WarmingOverrunAction is what happens to a session warming for longer than MaxWarmingDuration
+type WarmingOverrunAction string
+
+const (
+	WarmingOverrunDelete WarmingOverrunAction = "delete" // reclaim the session and delete its instance
+	WarmingOverrunRevert WarmingOverrunAction = "revert" // put the session back to cold, keeping the instance
+)
+
+// Valid reports whether a is a known action, the empty action means WarmingOverrunDelete
+func (a WarmingOverrunAction) Valid() bool {
+	switch a {
+	case "", WarmingOverrunDelete, WarmingOverrunRevert:
+		return true
+	}
+	return false
+}
+
+// EvictionPolicy selects which idle session is reclaimed to make room under Max pressure.
+// In-use and warming sessions are never evicted.
+type EvictionPolicy string
+
+const (
+	EvictNone       EvictionPolicy = "none"        // refuse new sessions at Max
+	EvictOldestCold EvictionPolicy = "oldest_cold" // reclaim the oldest cold session
+	EvictOldestIdle EvictionPolicy = "oldest_idle" // reclaim the oldest cold session, then the oldest warmed one
+)
+
+// Valid reports whether p is a known policy, the empty policy means EvictNone
+func (p EvictionPolicy) Valid() bool {
+	switch p {
+	case "", EvictNone, EvictOldestCold, EvictOldestIdle:
+		return true
+	}
+	return false
 }
 
 func NewConfig() *Config {
 	return &Config{
-		GameName:         "idle_weapon",
-		Min:              5,
-		Max:              10,
-		SessionTTL:       5 * time.Minute,
-		HeartbeatTimeout: 30 * time.Second,
-		SyncInterval:     10 * time.Second,
+		GameName:               "idle_weapon",
+		Min:                    5,
+		Max:                    10,
+		SessionTTL:             5 * time.Minute,
+		HeartbeatTimeout:       30 * time.Second,
+		SyncInterval:           10 * time.Second,
+		CreateBackoff:          30 * time.Second,
+		CreateBackoffMax:       10 * time.Minute,
+		CreateHaltTimeout:      10 * time.Minute,
+		OnDemandTimeout:        60 * time.Second,
+		IdempotencyTTL:         5 * time.Minute,
+		WarmingTimeout:         2 * time.Minute,
+		GracePeriod:            5 * time.Second,
+		HealthSweepConcurrency: 4,
+		HealthAbsentSweeps:     2,
+		LaunchAttempts:         3,
+		ConnectSettle:          3 * time.Second,
+		ConnectRetryMin:        250 * time.Millisecond,
+		EmptyRetryAfter:        30 * time.Second,
+		GuaranteeBreachAfter:   30 * time.Second,
 		ScreenConfig: &ScreenConfig{
 			Width:   720,
 			Height:  1240,
@@ -52,6 +279,30 @@ func NewConfig() *Config {
 	}
 }
 
+// appName returns the anbox application backing the game
+func (c *Config) appName() string {
+	if c.AppName != "" {
+		return c.AppName
+	}
+	return c.GameName
+}
+
+// orphanMaxAge returns the age after which orphaned instances are reaped, 0 disables age-based reaping
+func (c *Config) orphanMaxAge() time.Duration {
+	if c.OrphanMaxAge != 0 {
+		return c.OrphanMaxAge
+	}
+	return 3 * c.SessionTTL
+}
+
+// maxInUseDuration returns the longest a session may stay in use with extensions
+func (c *Config) maxInUseDuration() time.Duration {
+	if c.MaxInUseDuration != 0 {
+		return c.MaxInUseDuration
+	}
+	return 2 * c.SessionTTL
+}
+
 type ScreenConfig struct {
 	Width   int `mapstructure:"width"`
 	Height  int `mapstructure:"height"`
@@ -59,6 +310,30 @@ type ScreenConfig struct {
 	Fps     int `mapstructure:"fps"`
 }
 
+// ErrInvalidState is returned when a transition is requested from the wrong session status
+var ErrInvalidState = errors.New("invalid session state")
+
+// ErrSessionNotFound is returned when a session requested by ID is not in the pool
+var ErrSessionNotFound = errors.New("session not found")
+
+// HeartbeatPolicy tells clients how often to heartbeat an in-use session
+type HeartbeatPolicy struct {
+	Interval time.Duration // send a heartbeat this often
+	Timeout  time.Duration // a session without a heartbeat for this long is released
+}
+
+// ErrDraining is returned when sessions are requested while the manager is shutting down
+var ErrDraining = errors.New("session manager is draining")
+
+// ErrPaused is returned when sessions are requested while pool maintenance is paused
+var ErrPaused = errors.New("session manager is paused")
+
+// ErrExtensionLimit is returned when Extend would keep a session in use for longer than MaxInUseDuration
+var ErrExtensionLimit = errors.New("session extension limit reached")
+
+// ErrInvalidResize is returned when Resize is asked for pool bounds the pool cannot honour
+var ErrInvalidResize = errors.New("invalid pool size")
+
 type SessionStatus string
 
 const (
@@ -68,14 +343,46 @@ const (
 	InUse   SessionStatus = "in_use"
 )
 
+// Valid reports whether s is one of the pool statuses
+func (s SessionStatus) Valid() bool {
+	switch s {
+	case Cold, Warming, Warmed, InUse:
+		return true
+	}
+	return false
+}
+
 type Session struct {
-	ID            string
-	Game          string
-	Status        SessionStatus
-	Anbox         *anbox.SessionDetails
-	GatewayURL    string
-	AuthToken     string
-	ExpiresAt     time.Time // InUse 的业务 TTL
-	LastHeartbeat time.Time
-	CreatedAt     time.Time
+	ID              string
+	Game            string
+	Status          SessionStatus
+	Profile         string    // screen profile the session was created with, "" without ScreenProfiles
+	StatusChangedAt time.Time // when Status last changed, used for the warming timeout
+	Anbox           *anbox.SessionDetails
+	GatewayURL      string
+	AuthToken       string
+	ExpiresAt       time.Time         // InUse 的业务 TTL
+	EndingAt        time.Time         // set while draining, the session is released at this time
+	Extended        time.Duration     // granted by Extend, already included in ExpiresAt
+	Metadata        map[string]string // small client state such as player ID, bounded by MaxMetadataKeys
+	APIKey          string            // partner API key the session was acquired with
+	WarmToken       string            // handed out by AcquireCold and required by SetWarmed, only set while warming
+	WarmOwner       string            // warm worker that acquired the session, only set while warming
+	LastHeartbeat   time.Time
+	CreatedAt       time.Time
+	ReadyAt         time.Time  // when the session became acquirable: it was synced or created, and its app launched with LaunchApp
+	AppLaunched     bool       // the LaunchApp commands completed, only tracked with LaunchApp
+	launching       bool       // the launch commands are running
+	warmedToken     string     // the warm token SetWarmed accepted, so a repeat of the call succeeds
+	warmup          *warmupRun // the warm-up actions started by SetWarmed, nil while none run
+	absentSyncs     int        // consecutive syncs the session was missing from the AMS list
+	absentSweeps    int        // consecutive health sweeps the gateway did not know the session
+	launchFailures  int        // failed LaunchApp attempts of a synced session
+}
+
+// snapshot copies a cached session for callers outside m.mu, the cached session keeps changing under the lock
+func (s *Session) snapshot() *Session {
+	copied := *s
+	copied.Metadata = maps.Clone(s.Metadata)
+	return &copied
 }
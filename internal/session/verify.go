@@ -0,0 +1,76 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultCreateVerifyInterval is how often a created session is polled when CreateVerifyInterval is not set
+const DefaultCreateVerifyInterval = time.Second
+
+// createVerifyInterval returns how often a created session is polled until it runs
+func (c *Config) createVerifyInterval() time.Duration {
+	if c.CreateVerifyInterval > 0 {
+		return c.CreateVerifyInterval
+	}
+	return DefaultCreateVerifyInterval
+}
+
+// isRunningGatewayStatus reports whether a gateway session status means it can be streamed
+func isRunningGatewayStatus(status string) bool {
+	switch status {
+	case "running", "active":
+		return true
+	}
+	return false
+}
+
+// verifyCreated polls the gateway until the session it just created runs and returns its latest details.
+// A session that fails or still does not run after CreateVerifyTimeout is deleted.
+func (m *LocalSessionManager) verifyCreated(ctx context.Context, details *anbox.SessionDetails) (*anbox.SessionDetails, error) {
+	err := m.waitRunning(ctx, details)
+	if err == nil {
+		return details, nil
+	}
+
+	logger.Warnf("reclaiming session %s of game %s that did not reach running: %v", details.ID, m.cfg.GameName, err)
+	go func(id string) {
+		if err := m.deleteSession(context.Background(), id); err != nil {
+			logger.Errorf("failed to delete unverified anbox session %s: %v", id, err)
+		}
+	}(details.ID)
+	return nil, err
+}
+
+// waitRunning polls the gateway every CreateVerifyInterval and updates details until the session runs
+func (m *LocalSessionManager) waitRunning(ctx context.Context, details *anbox.SessionDetails) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.CreateVerifyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(m.cfg.createVerifyInterval())
+	defer ticker.Stop()
+
+	for !isRunningGatewayStatus(details.Status) {
+		if isFailedGatewayStatus(details.Status) {
+			return fmt.Errorf("created session %s is %s", details.ID, details.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("created session %s is still %q after %s", details.ID, details.Status, m.cfg.CreateVerifyTimeout)
+		case <-ticker.C:
+		}
+
+		current, err := m.anboxClient.GetSession(ctx, details.ID)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warnf("could not check created session %s of game %s: %v", details.ID, m.cfg.GameName, err)
+			}
+			continue
+		}
+		details.Status = current.Status
+	}
+	return nil
+}
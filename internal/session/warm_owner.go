@@ -0,0 +1,27 @@
+package session
+
+// WithWarmOwner names the warm worker acquiring a cold session. While that session is warming, another AcquireCold
+// by the same owner with the same API key returns it again instead of taking a second one, so a retried call does
+// not strand a session. The name of the server's own warming workers is reserved and ignored.
+func WithWarmOwner(owner string) AcquireOption {
+	return func(o *acquireOptions) {
+		if owner != serverWarmOwner {
+			o.warmOwner = owner
+		}
+	}
+}
+
+// heldByOwnerLocked returns the session of profile owner is warming for apiKey, nil when it holds none.
+// Owners are only unique per API key, so another key naming the same owner never gets its session and warm token.
+// Callers must hold m.mu.
+func (m *LocalSessionManager) heldByOwnerLocked(owner, apiKey, profile string) *Session {
+	if owner == "" {
+		return nil
+	}
+	for _, session := range m.cache {
+		if session.Status == Warming && session.WarmOwner == owner && session.Profile == profile && heldBy(session, apiKey) {
+			return session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidWarmToken is returned when SetWarmed is not given the token AcquireCold handed out for the session
+var ErrInvalidWarmToken = errors.New("invalid warm token")
+
+// newWarmToken returns an opaque token proving which caller acquired a cold session
+func newWarmToken() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validWarmToken reports whether token is the one handed out for the session's current warm-up
+func validWarmToken(session *Session, token string) bool {
+	return sameWarmToken(session.WarmToken, token)
+}
+
+// warmedWithToken reports whether the session is warmed and token is the one its warm-up ended with
+func warmedWithToken(session *Session, token string) bool {
+	return session.Status == Warmed && sameWarmToken(session.warmedToken, token)
+}
+
+func sameWarmToken(want, got string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
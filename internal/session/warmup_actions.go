@@ -0,0 +1,257 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letusgogo/playable-backend/internal/anbox"
+	"github.com/letusgogo/quick/logger"
+)
+
+// DefaultWarmupTimeout bounds the warm-up actions of one session when WarmupTimeout is not set
+const DefaultWarmupTimeout = time.Minute
+
+// ErrWarmupFailed is returned by SetWarmed when a warm-up action failed, the session is reclaimed
+var ErrWarmupFailed = errors.New("warm-up failed")
+
+// WarmupAction is one step of the setup a session goes through before it is warmed, exactly one field is set
+type WarmupAction struct {
+	Tap     []int         `mapstructure:"tap"`     // x and y of a tap on the screen
+	Swipe   []int         `mapstructure:"swipe"`   // x1, y1, x2, y2 and optionally the duration in ms of a swipe
+	Text    string        `mapstructure:"text"`    // text typed into the focused field
+	Wait    time.Duration `mapstructure:"wait"`    // pause before the next action
+	Command []string      `mapstructure:"command"` // shell command run in the instance
+}
+
+// Validate checks that exactly one kind of action is set and taps and swipes have their coordinates
+func (a WarmupAction) Validate() error {
+	kinds := 0
+	if a.Tap != nil {
+		kinds++
+		if len(a.Tap) != 2 || a.Tap[0] < 0 || a.Tap[1] < 0 {
+			return fmt.Errorf("tap must be [x, y] with non-negative coordinates, got %v", a.Tap)
+		}
+	}
+	if a.Swipe != nil {
+		kinds++
+		if len(a.Swipe) != 4 && len(a.Swipe) != 5 || slices.ContainsFunc(a.Swipe, func(v int) bool { return v < 0 }) {
+			return fmt.Errorf("swipe must be [x1, y1, x2, y2] or [x1, y1, x2, y2, ms] with non-negative values, got %v", a.Swipe)
+		}
+	}
+	if a.Text != "" {
+		kinds++
+	}
+	if a.Wait != 0 {
+		kinds++
+		if a.Wait < 0 {
+			return fmt.Errorf("wait must not be negative, got %s", a.Wait)
+		}
+	}
+	if a.Command != nil {
+		kinds++
+		if len(a.Command) == 0 {
+			return fmt.Errorf("command must not be empty")
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("a warm-up action sets exactly one of tap, swipe, text, wait and command")
+	}
+	return nil
+}
+
+// RunsInInstance reports whether the action needs a WarmupRunner, waits do not
+func (a WarmupAction) RunsInInstance() bool {
+	return a.Wait == 0
+}
+
+func (a WarmupAction) String() string {
+	switch {
+	case a.Tap != nil:
+		return fmt.Sprintf("tap %v", a.Tap)
+	case a.Swipe != nil:
+		return fmt.Sprintf("swipe %v", a.Swipe)
+	case a.Text != "":
+		return fmt.Sprintf("text %q", a.Text)
+	case a.Command != nil:
+		return fmt.Sprintf("command %v", a.Command)
+	}
+	return fmt.Sprintf("wait %s", a.Wait)
+}
+
+// Input returns the input event a tap, swipe or text action injects, false for waits and commands
+func (a WarmupAction) Input() (anbox.Input, bool) {
+	switch {
+	case a.Tap != nil:
+		return anbox.Input{Type: anbox.InputTap, X: a.Tap[0], Y: a.Tap[1]}, true
+	case a.Swipe != nil:
+		input := anbox.Input{Type: anbox.InputSwipe, X: a.Swipe[0], Y: a.Swipe[1], ToX: a.Swipe[2], ToY: a.Swipe[3]}
+		if len(a.Swipe) == 5 {
+			input.DurationMS = a.Swipe[4]
+		}
+		return input, true
+	case a.Text != "":
+		return anbox.Input{Type: anbox.InputText, Text: a.Text}, true
+	}
+	return anbox.Input{}, false
+}
+
+// commandLine returns the shell command an action runs in the instance, input actions through input
+func (a WarmupAction) commandLine() []string {
+	input, ok := a.Input()
+	if !ok {
+		return a.Command
+	}
+	switch input.Type {
+	case anbox.InputSwipe:
+		command := []string{"input", "swipe", strconv.Itoa(input.X), strconv.Itoa(input.Y), strconv.Itoa(input.ToX), strconv.Itoa(input.ToY)}
+		if input.DurationMS > 0 {
+			command = append(command, strconv.Itoa(input.DurationMS))
+		}
+		return command
+	case anbox.InputText:
+		// input text ends the text at the first space, %s types one
+		return []string{"input", "text", strings.ReplaceAll(input.Text, " ", "%s")}
+	}
+	return []string{"input", "tap", strconv.Itoa(input.X), strconv.Itoa(input.Y)}
+}
+
+// InputSender is implemented by anbox clients that can inject input events into a session over the gateway
+type InputSender interface {
+	SendInput(ctx context.Context, sessionID string, input anbox.Input) error
+}
+
+// WarmupRunner runs the tap, swipe, text and command warm-up actions in the instance of a session
+type WarmupRunner interface {
+	RunWarmupAction(ctx context.Context, sessionID string, action WarmupAction) error
+}
+
+// WithWarmupRunner makes the manager run warm-up actions with runner, by default they run through
+// the anbox client, input actions over the gateway when WarmupInputViaGateway is set
+func WithWarmupRunner(runner WarmupRunner) ManagerOption {
+	return func(m *LocalSessionManager) {
+		m.warmupRunner = runner
+	}
+}
+
+// clientWarmupRunner runs warm-up actions through the anbox client, input actions over the gateway when
+// input is set and as commands in the instance otherwise
+type clientWarmupRunner struct {
+	launcher AppLauncher // nil when the client cannot run commands
+	input    InputSender // nil unless input goes over the gateway
+}
+
+func (r clientWarmupRunner) RunWarmupAction(ctx context.Context, sessionID string, action WarmupAction) error {
+	if input, ok := action.Input(); ok && r.input != nil {
+		return r.input.SendInput(ctx, sessionID, input)
+	}
+	if r.launcher == nil {
+		return fmt.Errorf("anbox client cannot run commands")
+	}
+	return r.launcher.LaunchApp(ctx, sessionID, [][]string{action.commandLine()})
+}
+
+// warmupRun is a warm-up in progress, SetWarmed calls with the session's token wait for it to be done
+type warmupRun struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// warmupTimeout returns how long the warm-up actions of one session may take
+func (c *Config) warmupTimeout() time.Duration {
+	if c.WarmupTimeout > 0 {
+		return c.WarmupTimeout
+	}
+	return DefaultWarmupTimeout
+}
+
+// runWarmupActions runs the configured warm-up actions in order in the session's instance
+func (m *LocalSessionManager) runWarmupActions(ctx context.Context, id string) error {
+	runner := m.warmupRunner
+	if runner == nil {
+		var client clientWarmupRunner
+		client.launcher, _ = m.anboxClient.(AppLauncher)
+		if m.cfg.WarmupInputViaGateway {
+			client.input, _ = m.anboxClient.(InputSender)
+		}
+		runner = client
+	}
+
+	for i, action := range m.cfg.WarmupActions {
+		if !action.RunsInInstance() {
+			timer := time.NewTimer(action.Wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("action %d (%s): %w", i+1, action, ctx.Err())
+			}
+			continue
+		}
+		if err := runner.RunWarmupAction(ctx, id, action); err != nil {
+			return fmt.Errorf("action %d (%s): %w", i+1, action, err)
+		}
+	}
+	return nil
+}
+
+// warmUp runs the warm-up actions of a session SetWarmed was called for and then promotes it to warmed.
+// A session whose actions fail is reclaimed, one that left warming meanwhile is left alone.
+func (m *LocalSessionManager) warmUp(ctx context.Context, id, warmToken string, run *warmupRun) {
+	start := m.clock.Now()
+	actionsCtx, cancel := context.WithTimeout(ctx, m.cfg.warmupTimeout())
+	err := m.runWarmupActions(actionsCtx, id)
+	cancel()
+
+	m.mu.Lock()
+	defer func() {
+		m.mu.Unlock()
+		close(run.done)
+	}()
+
+	session, exists := m.cache[id]
+	if !exists || session.warmup != run || session.Status != Warming || !validWarmToken(session, warmToken) {
+		run.err = fmt.Errorf("%w: session %s left warming during its warm-up", ErrInvalidState, id)
+		return
+	}
+	session.warmup = nil
+
+	if err != nil {
+		logger.Warnf("reclaiming session %s of game %s whose warm-up failed: %v", id, m.cfg.GameName, err)
+		m.removeLocked(session, SystemActor, "warmup_failed", ReleaseErrored)
+		go func(s *Session) {
+			if s.Anbox != nil {
+				if err := m.deleteSession(context.Background(), s.Anbox.ID); err != nil {
+					logger.Errorf("failed to delete anbox session %s whose warm-up failed: %v", s.Anbox.ID, err)
+				}
+			}
+		}(session)
+		run.err = fmt.Errorf("%w for session %s: %v", ErrWarmupFailed, id, err)
+		return
+	}
+
+	logger.Infof("session %s of game %s warmed up in %s", id, m.cfg.GameName, m.clock.Now().Sub(start))
+	m.promoteLocked(ctx, session)
+}
+
+// warmUpCreated runs the warm-up actions in a session created on demand, a session whose warm-up fails is deleted
+func (m *LocalSessionManager) warmUpCreated(ctx context.Context, details *anbox.SessionDetails) (*anbox.SessionDetails, error) {
+	actionsCtx, cancel := context.WithTimeout(ctx, m.cfg.warmupTimeout())
+	err := m.runWarmupActions(actionsCtx, details.ID)
+	cancel()
+	if err == nil {
+		return details, nil
+	}
+
+	logger.Warnf("reclaiming on-demand session %s of game %s whose warm-up failed: %v", details.ID, m.cfg.GameName, err)
+	go func(id string) {
+		if err := m.deleteSession(context.Background(), id); err != nil {
+			logger.Errorf("failed to delete anbox session %s whose warm-up failed: %v", id, err)
+		}
+	}(details.ID)
+	return nil, fmt.Errorf("%w for session %s: %v", ErrWarmupFailed, details.ID, err)
+}